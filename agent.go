@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// defaultAgentSteps is how many rounds of tool calls ask agent allows unless
+// --max-steps says otherwise.
+const defaultAgentSteps = 25
+
+// maxAgentRead caps how much of a file read_file returns.
+const maxAgentRead = 100000
+
+const agentSystemPrompt = `You are a coding assistant working in the user's project directory. Use the tools to inspect the project, make the changes the goal needs and check them, for example by building or running the tests. Paths are relative to the project directory and cannot leave it. The user may decline an action; if so, find another way or explain what you need. When you are done, reply with a short summary of what you changed and anything left to do.`
+
+// agent holds the state of one ask agent run.
+type agent struct {
+	root string
+	// roots are the workspace roots from .ask.toml, reachable besides root.
+	roots []workspaceRoot
+	// approveAll skips confirmation, from --yes or an "a" answer.
+	approveAll bool
+	// allowDangerous lets commands that look destructive be approved like
+	// any other, from --allow-dangerous.
+	allowDangerous bool
+	tty            bool
+	// revise redoes a proposed write's hunk the user commented on.
+	revise reviseFunc
+}
+
+// runAgent handles "ask agent <api> <goal> [--max-steps n] [--yes]
+// [--allow-dangerous]": the model works towards the goal with tools that
+// read, write and run commands in the current directory, asking before
+// every write and command.
+func runAgent(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"max-steps": true, "yes": false, "allow-dangerous": false, "session": true})
+	if err != nil || len(parsed.positional) < 2 {
+		fmt.Println("Usage: ask agent <api-name> \"<goal>\" [--max-steps N] [--yes] [--allow-dangerous] [--session name]")
+		os.Exit(1)
+	}
+	sessionName = parsed.value("session", "")
+	apiName, api := resolveAPI(config, parsed.positional[0])
+
+	steps := defaultAgentSteps
+	if s := parsed.value("max-steps", ""); s != "" {
+		if steps, err = strconv.Atoi(s); err != nil || steps < 1 {
+			fmt.Println("Error: --max-steps must be a positive number")
+			os.Exit(1)
+		}
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	roots, err := workspaceRoots()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	a := &agent{
+		root:           root,
+		roots:          roots,
+		approveAll:     parsed.has("yes"),
+		allowDangerous: parsed.has("allow-dangerous"),
+		tty:            term.IsTerminal(int(os.Stdout.Fd())),
+		revise:         hunkReviser(config, apiName, api),
+	}
+	if !a.approveAll && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Error: ask agent asks before every write and command; run it in a terminal or pass --yes")
+		os.Exit(1)
+	}
+
+	req := Request{
+		System:        agentSystemPrompt,
+		Prompt:        strings.Join(parsed.positional[1:], " "),
+		Tools:         a.tools(),
+		MaxToolRounds: steps,
+	}
+	for i, r := range roots {
+		if i == 0 {
+			req.System += "\n\nThe workspace also has these directories, which you can reach by path from the project directory:"
+		}
+		rel, _ := filepath.Rel(root, r.Path)
+		req.System += fmt.Sprintf("\n- %s: %s", r.Name, rel)
+	}
+	if err := applyProjectContext(config.Settings, &req); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	entry := newHistoryEntry(apiName, api, req)
+	resp, err := sendWithTools(api, req, nil)
+	entry.addResponse(resp)
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println(resp.Text)
+}
+
+func (a *agent) tools() []Tool {
+	pathParam := func(desc string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "description": desc}
+	}
+	return []Tool{
+		{
+			Name:        "list_dir",
+			Description: "List a directory; subdirectories end in /.",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"path": pathParam("Directory, . for the project root")},
+				"required":   []string{"path"},
+			},
+			Run: a.listDir,
+		},
+		{
+			Name:        "read_file",
+			Description: "Read a text file.",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"path": pathParam("File to read")},
+				"required":   []string{"path"},
+			},
+			Run: a.readFile,
+		},
+		{
+			Name:        "write_file",
+			Description: "Create or overwrite a file with the given content. Parent directories are created.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":    pathParam("File to write"),
+					"content": map[string]interface{}{"type": "string", "description": "The complete new content"},
+				},
+				"required": []string{"path", "content"},
+			},
+			Run: a.writeFile,
+		},
+		{
+			Name:        "run_command",
+			Description: "Run a shell command in the project directory and return its output and exit status.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{"type": "string", "description": "The command, run with sh -c"},
+				},
+				"required": []string{"command"},
+			},
+			Run: a.runCommand,
+		},
+	}
+}
+
+// resolve turns a path from the model into an absolute path inside the
+// project or one of the workspace roots.
+func (a *agent) resolve(path string) (string, error) {
+	return resolveInWorkspace(a.root, path, a.roots)
+}
+
+// resolveInside turns path, relative to root, into an absolute path inside
+// root, following symlinks so none can lead out of it. root must already be
+// free of symlinks.
+func resolveInside(root, path string) (string, error) {
+	abs := filepath.Clean(filepath.Join(root, path))
+	if filepath.IsAbs(path) {
+		abs = filepath.Clean(path)
+	}
+
+	// Resolve the longest existing prefix; the rest may not exist yet.
+	real, rest := abs, ""
+	for {
+		if r, err := filepath.EvalSymlinks(real); err == nil {
+			real = filepath.Join(r, rest)
+			break
+		}
+		parent := filepath.Dir(real)
+		if parent == real {
+			break
+		}
+		rest = filepath.Join(filepath.Base(real), rest)
+		real = parent
+	}
+
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the project directory", path)
+	}
+	return real, nil
+}
+
+// step prints what the agent is doing.
+func (a *agent) step(format string, args ...interface{}) {
+	line := "→ " + fmt.Sprintf(format, args...)
+	if a.tty {
+		line = dim(line)
+	}
+	fmt.Println(line)
+}
+
+// confirm asks the user to allow an action. "a" allows every remaining one.
+func (a *agent) confirm(question string) bool {
+	if a.approveAll {
+		return true
+	}
+	fmt.Printf("%s [y/N/a] ", question)
+	answer, _ := readLine()
+	switch strings.ToLower(answer) {
+	case "a", "all":
+		a.approveAll = true
+		return true
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+const declined = "The user declined this action."
+
+func (a *agent) listDir(_ context.Context, args map[string]interface{}) (string, error) {
+	path, _ := args["path"].(string)
+	if path == "" {
+		path = "."
+	}
+	dir, err := a.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	a.step("list %s", path)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n"), nil
+}
+
+func (a *agent) readFile(_ context.Context, args map[string]interface{}) (string, error) {
+	path, _ := args["path"].(string)
+	file, err := a.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	a.step("read %s", path)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxAgentRead {
+		return strings.ToValidUTF8(string(data[:maxAgentRead]), "") + "\n" + omissionNotice(fmt.Sprintf("%s more of the file, which is %s in all,", formatBytes(int64(len(data)-maxAgentRead)), formatBytes(int64(len(data))))), nil
+	}
+	return string(data), nil
+}
+
+func (a *agent) writeFile(_ context.Context, args map[string]interface{}) (string, error) {
+	path, _ := args["path"].(string)
+	content, _ := args["content"].(string)
+	file, err := a.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	old := ""
+	if data, err := os.ReadFile(file); err == nil {
+		if string(data) == content {
+			return "The file already has this content.", nil
+		}
+		old = string(data)
+	}
+	// Unless everything is approved, each hunk of the change needs an OK.
+	written := content
+	if !a.approveAll {
+		changes, err := reviewChanges([]fileChange{{Path: path, Old: old, New: content}}, a.revise)
+		if err != nil {
+			return "", err
+		}
+		if len(changes) == 0 {
+			return declined, nil
+		}
+		written = changes[0].New
+	}
+	a.step("write %s", path)
+
+	if err := snapshotBeforeWrite(file); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, []byte(written), 0644); err != nil {
+		return "", err
+	}
+	if written != content {
+		return "The user accepted only part of the change. The file now reads:\n" + written, nil
+	}
+	return "Written.", nil
+}
+
+func (a *agent) runCommand(ctx context.Context, args map[string]interface{}) (string, error) {
+	command, _ := args["command"].(string)
+	if reasons := dangerReasons(command); len(reasons) > 0 {
+		// Approving everything doesn't reach commands that look
+		// destructive: they're always pointed out, and confirmed again
+		// unless --allow-dangerous goes with it.
+		fmt.Printf("The agent wants to run `%s`.\n", command)
+		if a.approveAll && a.allowDangerous {
+			fmt.Printf("Warning: this command %s.\n", strings.Join(reasons, ", and "))
+		} else if !confirmRun(command, a.allowDangerous) {
+			return declined, nil
+		}
+	} else if !a.confirm(fmt.Sprintf("Run `%s`?", command)) {
+		return declined, nil
+	}
+	a.step("$ %s", command)
+	return runShellTool(ctx, command)
+}
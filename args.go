@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cliArgs is a parsed command line: positional arguments plus --flags.
+type cliArgs struct {
+	positional []string
+	flags      map[string][]string
+}
+
+// parseArgs splits args into positional arguments and the flags named in
+// spec, which maps each flag name to whether it takes a value. Words that
+// are not known flags stay positional, so prompts may contain dashes freely,
+// and "--" ends flag parsing. Flags are accepted as -x, --name, --name value
+// and --name=value.
+func parseArgs(args []string, spec map[string]bool) (*cliArgs, error) {
+	parsed := &cliArgs{flags: make(map[string][]string)}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			parsed.positional = append(parsed.positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			parsed.positional = append(parsed.positional, arg)
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		value, hasValue := "", false
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+
+		takesValue, known := spec[name]
+		if !known {
+			parsed.positional = append(parsed.positional, arg)
+			continue
+		}
+		if takesValue && !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag %s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+		parsed.flags[name] = append(parsed.flags[name], value)
+	}
+
+	return parsed, nil
+}
+
+// has reports whether the flag was given at all.
+func (a *cliArgs) has(name string) bool {
+	_, ok := a.flags[name]
+	return ok
+}
+
+// value returns the last value given for a flag, or def if it was not given.
+func (a *cliArgs) value(name, def string) string {
+	if values := a.flags[name]; len(values) > 0 && values[len(values)-1] != "" {
+		return values[len(values)-1]
+	}
+	return def
+}
+
+// values returns every value given for a repeatable flag.
+func (a *cliArgs) values(name string) []string {
+	return a.flags[name]
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Priority tiers for context items, most important first. When not
+// everything fits, the lowest tier goes first and, within a tier, later
+// items before earlier ones.
+const (
+	tierSystem = iota
+	tierMemory
+	tierFiles
+	tierRetrieved
+	tierHistory
+)
+
+// How an item that doesn't fit whole may be shortened.
+const (
+	cutNone  = iota // drop it whole
+	cutEnd          // keep its start
+	cutStart        // keep its end, as for logs
+)
+
+// contextItem is a candidate for a prompt's context.
+type contextItem struct {
+	Label string
+	Text  string
+	Tier  int
+	Cut   int
+}
+
+// assembleContext fits items into budget tokens as tok counts them, in tier
+// order, and returns them as parts in their original order, marked where
+// they were cut or dropped. A cut part's text says how much of it was
+// omitted, and where. The result only depends on the items, the budget and
+// the tokenizer.
+func assembleContext(items []contextItem, budget int, tok Tokenizer) []contextPart {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return items[order[a]].Tier < items[order[b]].Tier })
+
+	parts := make([]contextPart, len(items))
+	left := budget
+	for _, i := range order {
+		it := items[i]
+		total := tok.Count(it.Text)
+		p := contextPart{Label: it.Label, Text: it.Text, Tokens: total}
+		// The notice takes room too; one for the whole item is at least
+		// as long as the one the cut needs.
+		reserve := tok.Count(cutNotice(it.Label, total, it.Cut == cutStart))
+		switch {
+		case total <= left:
+		case it.Cut == cutNone || left <= reserve:
+			p.Text, p.Tokens, p.Omitted, p.Dropped = "", 0, total, true
+		default:
+			keepEnd := it.Cut == cutStart
+			kept := cutToTokens(it.Text, left-reserve, keepEnd, tok)
+			p.Omitted = total - tok.Count(kept)
+			p.Tokens, p.Truncated = left, true
+			if keepEnd {
+				p.Text = cutNotice(it.Label, p.Omitted, true) + "\n" + kept
+			} else {
+				p.Text = kept + "\n" + cutNotice(it.Label, p.Omitted, false)
+			}
+		}
+		left -= p.Tokens
+		parts[i] = p
+	}
+	return parts
+}
+
+// cutToTokens shortens text to at most tokens tokens, keeping its start,
+// or its end when keepEnd is set. The length is found by doubling and then
+// bisecting, so only about as much text as is kept gets counted.
+func cutToTokens(text string, tokens int, keepEnd bool, tok Tokenizer) string {
+	keep := func(n int) string {
+		if keepEnd {
+			return strings.ToValidUTF8(text[len(text)-n:], "")
+		}
+		return strings.ToValidUTF8(text[:n], "")
+	}
+	lo, hi := 0, max(tokens, 1)*4
+	for hi < len(text) && tok.Count(keep(hi)) <= tokens {
+		lo, hi = hi, hi*2
+	}
+	if hi >= len(text) {
+		if tok.Count(text) <= tokens {
+			return text
+		}
+		hi = len(text)
+	}
+	for lo+1 < hi {
+		if mid := (lo + hi) / 2; tok.Count(keep(mid)) <= tokens {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return keep(lo)
+}
+
+// omissionNotice marks where text was left out of a prompt, so the model
+// knows it isn't seeing everything, e.g. "[...12k tokens of earlier log
+// omitted...]".
+func omissionNotice(what string) string {
+	return "[..." + what + " omitted...]"
+}
+
+// cutNotice is the notice for omitted tokens cut from the start of the
+// part labeled label, when fromStart is set, or from its end.
+func cutNotice(label string, omitted int, fromStart bool) string {
+	if fromStart {
+		return omissionNotice(fmt.Sprintf("%s earlier tokens of %s", formatTokens(omitted), label))
+	}
+	return omissionNotice(fmt.Sprintf("%s more tokens of %s", formatTokens(omitted), label))
+}
+
+// omittedPart is what stands in for a dropped part.
+func omittedPart(p contextPart) string {
+	return omissionNotice(fmt.Sprintf("%s tokens of %s", formatTokens(p.Omitted), p.Label))
+}
+
+// formatTokens writes a token count the short way: 950, 12k, 1.2M.
+func formatTokens(n int) string {
+	switch {
+	case n >= 1000000:
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	case n >= 1000:
+		return fmt.Sprintf("%dk", (n+500)/1000)
+	}
+	return fmt.Sprint(n)
+}
+
+// joinParts joins the text of the parts, with a notice in place of each
+// that was left out.
+func joinParts(parts []contextPart, sep string) string {
+	var texts []string
+	for _, p := range parts {
+		if p.Dropped {
+			texts = append(texts, omittedPart(p))
+		} else {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, sep)
+}
+
+// reportAssembly tells on stderr which parts were left out or cut short to
+// fit, if any.
+func reportAssembly(settings Settings, parts []contextPart) {
+	var dropped, cut []string
+	for _, p := range parts {
+		if p.Dropped {
+			dropped = append(dropped, fmt.Sprintf("%s (%s tokens)", p.Label, formatTokens(p.Omitted)))
+		} else if p.Truncated {
+			cut = append(cut, fmt.Sprintf("%s (%s tokens omitted)", p.Label, formatTokens(p.Omitted)))
+		}
+	}
+	if len(dropped) > 0 {
+		notifyTruncation(settings, "Left out to fit the context budget: %s", strings.Join(dropped, ", "))
+	}
+	if len(cut) > 0 {
+		notifyTruncation(settings, "Cut short to fit the context budget: %s", strings.Join(cut, ", "))
+	}
+}
+
+// notifyTruncation tells on stderr that something was cut from a prompt,
+// unless the truncation_notices setting is "quiet".
+func notifyTruncation(settings Settings, format string, args ...interface{}) {
+	if settings.TruncationNotices == "quiet" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// contextWindow is the number of tokens api's model takes in: the
+// configured context_window, Ollama's num_ctx, or a typical size for the
+// provider.
+func contextWindow(api APIConfig) int {
+	if api.ContextWindow > 0 {
+		return api.ContextWindow
+	}
+	if n, ok := api.Options["num_ctx"].(float64); ok && n > 0 {
+		return int(n)
+	}
+	switch api.Provider {
+	case ProviderClaude:
+		return 200000
+	case ProviderGemini:
+		return 1000000
+	case ProviderOpenAI:
+		return 128000
+	case ProviderLocal:
+		return 4096
+	}
+	return 8192
+}
+
+// promptBudget is how many tokens a prompt to api may take, leaving a
+// quarter of the window, at most 4096 tokens, for the answer.
+func promptBudget(api APIConfig) int {
+	window := contextWindow(api)
+	return window - min(window/4, 4096)
+}
+
+// diffItems splits a git diff into one item per file, so a diff too large
+// for the budget loses whole files from the end rather than stopping in
+// the middle of one.
+func diffItems(diff string) []contextItem {
+	var items []contextItem
+	for _, section := range strings.SplitAfter(diff, "\ndiff --git ") {
+		if len(items) > 0 {
+			section = "diff --git " + section
+		}
+		section = strings.TrimSuffix(section, "\ndiff --git ")
+		label := "diff"
+		if header, _, _ := strings.Cut(section, "\n"); strings.HasPrefix(header, "diff --git ") {
+			if _, b, ok := strings.Cut(header, " b/"); ok {
+				label = b
+			}
+		}
+		items = append(items, contextItem{Label: label, Text: section, Tier: tierFiles, Cut: cutEnd})
+	}
+	return items
+}
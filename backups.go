@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sessionName is the session file changes are recorded under: --session
+// when given, otherwise named after the time of the first change.
+var sessionName string
+
+// backupSession is a record of the files one session changed, with copies
+// of them as they were before it first touched them.
+type backupSession struct {
+	Name    string       `json:"name"`
+	Created time.Time    `json:"created"`
+	Files   []backupFile `json:"files"`
+}
+
+// backupFile is a changed file. Snapshot names its copy in the session's
+// directory; a file that didn't exist has none, and undo removes it.
+type backupFile struct {
+	Path     string `json:"path"`
+	Existed  bool   `json:"existed"`
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+func getBackupsDir() string {
+	return filepath.Join(stateDir(), "backups")
+}
+
+func loadSession(name string) (*backupSession, error) {
+	data, err := os.ReadFile(filepath.Join(getBackupsDir(), name, "session.json"))
+	if err != nil {
+		return nil, err
+	}
+	var s backupSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("session %s is damaged: %v", name, err)
+	}
+	return &s, nil
+}
+
+func (s *backupSession) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(getBackupsDir(), s.Name, "session.json"), append(data, '\n'), 0600)
+}
+
+// snapshotBeforeWrite records path in the current session, copying it
+// first if this is the session's first change to it. Call it before every
+// write made on the model's behalf.
+func snapshotBeforeWrite(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if sessionName == "" {
+		sessionName = time.Now().Format("20060102-150405")
+	}
+	if !safeName.MatchString(sessionName) {
+		return fmt.Errorf("session names may only use letters, digits, '.', '_' and '-'")
+	}
+	dir := filepath.Join(getBackupsDir(), sessionName)
+
+	s, err := loadSession(sessionName)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		s = &backupSession{Name: sessionName, Created: time.Now()}
+		fmt.Printf("Recording changes in session %s (undo with 'ask undo --session %s')\n", sessionName, sessionName)
+	} else if err != nil {
+		return err
+	}
+	for _, f := range s.Files {
+		if f.Path == abs {
+			return nil
+		}
+	}
+
+	f := backupFile{Path: abs}
+	if data, err := os.ReadFile(abs); err == nil {
+		f.Existed = true
+		f.Snapshot = strconv.Itoa(len(s.Files)) + "-" + filepath.Base(abs)
+		if err := os.WriteFile(filepath.Join(dir, f.Snapshot), data, 0600); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	s.Files = append(s.Files, f)
+	return s.save()
+}
+
+// listSessions returns the recorded sessions, oldest first.
+func listSessions() ([]*backupSession, error) {
+	entries, err := os.ReadDir(getBackupsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*backupSession
+	for _, e := range entries {
+		if s, err := loadSession(e.Name()); err == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+	return sessions, nil
+}
+
+// runUndo handles "ask undo [--session name] [--list]": every file the
+// session changed goes back to how it was before, whatever git says, and
+// files it created are removed. Without --session it's the latest session.
+func runUndo(args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"session": true, "list": false})
+	if err != nil || len(parsed.positional) > 0 {
+		fmt.Println("Usage: ask undo [--session <name>] [--list]")
+		os.Exit(1)
+	}
+	sessions, err := listSessions()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if parsed.has("list") {
+		if len(sessions) == 0 {
+			fmt.Println("No sessions to undo.")
+			return
+		}
+		for _, s := range sessions {
+			fmt.Printf("%-24s %s  %d file(s)\n", s.Name, s.Created.Local().Format("2006-01-02 15:04"), len(s.Files))
+		}
+		return
+	}
+
+	var s *backupSession
+	if name := parsed.value("session", ""); name != "" {
+		if safeName.MatchString(name) {
+			s, _ = loadSession(name)
+		}
+		if s == nil {
+			fmt.Printf("Error: no session %s (see 'ask undo --list')\n", name)
+			os.Exit(1)
+		}
+	} else if len(sessions) > 0 {
+		s = sessions[len(sessions)-1]
+	} else {
+		fmt.Println("No sessions to undo.")
+		return
+	}
+
+	dir := filepath.Join(getBackupsDir(), s.Name)
+	failed := false
+	for _, f := range s.Files {
+		if !f.Existed {
+			if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("Error: %s: %v\n", f.Path, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("Removed %s\n", f.Path)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Snapshot))
+		if err == nil {
+			mode := os.FileMode(0644)
+			if info, err := os.Stat(f.Path); err == nil {
+				mode = info.Mode().Perm()
+			}
+			err = os.MkdirAll(filepath.Dir(f.Path), 0755)
+			if err == nil {
+				err = os.WriteFile(f.Path, data, mode)
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", f.Path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Restored %s\n", f.Path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	os.RemoveAll(dir)
+	fmt.Printf("Undid session %s.\n", s.Name)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pythonSpace is what \s matches in the Python regexes tiktoken's patterns
+// are written for; Go's \s is ASCII only.
+const pythonSpace = `\s\x{0B}\x{1C}-\x{1F}\x{85}\p{Z}`
+
+// bpeTokenizer is a tiktoken-compatible byte-pair encoder: text is split
+// into pieces by a pattern, and each piece is merged from single bytes up,
+// lowest ranked pair first.
+type bpeTokenizer struct {
+	name  string
+	ranks map[string]int
+	split *regexp.Regexp
+}
+
+// parseTiktoken reads a .tiktoken vocabulary: one base64 token and its rank
+// per line.
+func parseTiktoken(name string, data []byte, pattern string) (*bpeTokenizer, error) {
+	split, err := regexp.Compile(`^(?:` + strings.ReplaceAll(pattern, "{ws}", pythonSpace) + `)`)
+	if err != nil {
+		return nil, err
+	}
+	t := &bpeTokenizer{name: name, ranks: make(map[string]int, 1<<17), split: split}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		token, rank, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad token %q", name, token)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad rank %q", name, rank)
+		}
+		t.ranks[string(b)] = n
+	}
+	if len(t.ranks) < 256 {
+		return nil, fmt.Errorf("%s: not a tiktoken vocabulary", name)
+	}
+	return t, nil
+}
+
+func (t *bpeTokenizer) Name() string { return t.name }
+
+func (t *bpeTokenizer) Count(text string) int { return len(t.encode(text)) }
+
+func (t *bpeTokenizer) encode(text string) []int {
+	var ids []int
+	for _, piece := range t.pieces(text) {
+		if id, ok := t.ranks[piece]; ok {
+			ids = append(ids, id)
+			continue
+		}
+		ids = append(ids, t.merge(piece)...)
+	}
+	return ids
+}
+
+// pieces splits text with the pattern. The patterns end in \s+(?!\S),
+// which RE2 can't express: a run of spaces leaves its last one to the word
+// after it, so " foo" stays one piece. Runs matched by the plain \s+
+// alternative are shortened here the same way.
+func (t *bpeTokenizer) pieces(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := 0
+		if loc := t.split.FindStringIndex(text[i:]); loc != nil {
+			n = loc[1]
+		}
+		if n == 0 {
+			_, n = utf8.DecodeRuneInString(text[i:])
+		}
+		piece := text[i : i+n]
+		if i+n < len(text) && !strings.HasSuffix(piece, "\n") && !strings.HasSuffix(piece, "\r") &&
+			utf8.RuneCountInString(piece) > 1 && strings.TrimFunc(piece, unicode.IsSpace) == "" {
+			_, last := utf8.DecodeLastRuneInString(piece)
+			piece = piece[:len(piece)-last]
+		}
+		pieces = append(pieces, piece)
+		i += len(piece)
+	}
+	return pieces
+}
+
+// merge encodes a piece that isn't a token itself, starting from its bytes
+// and merging the adjacent pair with the lowest rank until none is left.
+func (t *bpeTokenizer) merge(piece string) []int {
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, at := -1, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := t.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (at < 0 || rank < best) {
+				best, at = rank, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+	ids := make([]int, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		ids = append(ids, t.ranks[piece[bounds[i]:bounds[i+1]]])
+	}
+	return ids
+}
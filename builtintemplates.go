@@ -0,0 +1,68 @@
+package main
+
+// builtinTemplatesVersion is bumped whenever the built-in templates change,
+// so a template's source says which revision of them it is.
+const builtinTemplatesVersion = 1
+
+// builtinTemplates ship with ask, written like template files. A file of
+// the same name in the templates directory takes the place of one.
+var builtinTemplates = map[string]string{
+	"explain": `---
+description: Explain code, a config or an error step by step
+example: ask api:claude --template explain --var input=@main.go
+---
+Explain the following to a {{audience|developer new to this code}}. Start with a short summary of what it does and why, then walk through how it works. Call out anything non-obvious: edge cases, hidden assumptions, error handling, performance or concurrency concerns. Don't restate the code line by line.
+
+{{input}}`,
+
+	"refactor": `---
+description: Refactor code without changing what it does
+example: ask api:claude --template refactor --var code=@handler.go --var goal="split the long function"
+---
+Refactor this code for {{goal|readability and maintainability}}. Keep its behaviour and public interface exactly the same, follow the conventions it already uses, and don't add features. Give the complete refactored code in one fenced code block, then list the changes you made and why, briefly.
+
+{{code}}`,
+
+	"tests": `---
+description: Write unit tests for code
+example: ask api:gpt-4o --template tests --var code=@parse.go --var framework="Go's testing package"
+---
+Write unit tests for the code below using {{framework|the testing framework its language usually uses}}. Cover the normal cases, the edge cases (empty input, boundaries, invalid values) and the error paths, one behaviour per test, with names that say what is being checked. Don't test private details that could change without the behaviour changing. Give the tests in one fenced code block, ready to save as a file.
+
+{{code}}`,
+
+	"commit": `---
+description: Write a commit message for a diff
+example: git diff --staged > staged.diff && ask api:claude --template commit --var diff=@staged.diff
+---
+Write a git commit message in the {{style|Conventional Commits}} style for the diff below. The first line is an imperative summary under 72 characters. If the change needs explaining, add a blank line and a short body saying what changed and why, wrapped at 72 characters. Reply with only the message.
+
+{{diff}}`,
+
+	"regex": `---
+description: Build a regular expression and explain it
+example: ask api:gpt-4o --template regex "ISO dates like 2024-01-31, but not 2024-13-01"
+---
+Write a {{flavor|PCRE}} regular expression matching {{input}}
+
+Give the regex in a fenced code block, then explain each part, and list a few strings it matches and a few it rejects, including the tricky ones.`,
+
+	"sql": `---
+description: Write a SQL query from a description
+example: ask api:claude --template sql --var schema=@schema.sql "monthly revenue per customer in 2024"
+---
+Write a {{dialect|PostgreSQL}} query for: {{input}}
+
+Tables:
+{{schema|(not given; state the tables and columns you assume)}}
+
+Give the query in one fenced sql code block, then explain briefly how it works and note any index that would help it.`,
+
+	"review": `---
+description: Review a diff or code for bugs and risks
+example: git diff main > change.diff && ask api:claude --template review --var diff=@change.diff
+---
+Review this change, focusing on {{focus|bugs, security problems, error handling and maintainability}}. Report only real problems, most important first, each with where it is, why it matters and a concrete fix. If it looks good, say so briefly.
+
+{{diff}}`,
+}
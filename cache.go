@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// cacheTTL is how long answers are reused, from the cache setting; 0 leaves
+// the cache off.
+var cacheTTL time.Duration
+
+// noCache is set by --no-cache, which neither reads nor writes the cache.
+var noCache bool
+
+// cachedResponse is a cached answer and when it was given.
+type cachedResponse struct {
+	Time         time.Time  `json:"time"`
+	Text         string     `json:"text"`
+	Citations    []Citation `json:"citations,omitempty"`
+	Thinking     string     `json:"thinking,omitempty"`
+	Usage        *Usage     `json:"usage,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Raw          []byte     `json:"raw,omitempty"`
+}
+
+func getResponseCacheDir() string {
+	return filepath.Join(stateDir(), "cache", "responses")
+}
+
+// takeCacheFlag removes --no-cache from args, wherever it is before "--",
+// and applies it, so every command accepts it.
+func takeCacheFlag(args []string) []string {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(rest, args[i:]...)
+		}
+		if arg == "--no-cache" {
+			noCache = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest
+}
+
+// useCache turns the cache on for the TTL in settings, if any.
+func useCache(settings Settings) error {
+	if settings.Cache == "" || settings.Cache == "off" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(settings.Cache)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf(`settings.cache must be a duration like "24h", or "off"`)
+	}
+	cacheTTL = ttl
+	return nil
+}
+
+// cacheable reports whether the answer to req may be reused: tools have
+// effects each time they run, and token probabilities aren't kept.
+func cacheable(req Request) bool {
+	return cacheTTL > 0 && !noCache && len(req.Tools) == 0 && !req.Logprobs
+}
+
+// cacheKey identifies a request to api: the same prompt, attachments and
+// schema sent to the same model at the same endpoint with the same options
+// and headers. The API key isn't part of it, so rotating keys share answers.
+func cacheKey(api APIConfig, req Request) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"provider":   api.Provider,
+		"base_url":   api.BaseURL,
+		"model":      api.Model,
+		"options":    api.Options,
+		"headers":    cacheHeaders(api.Headers),
+		"system":     req.System,
+		"history":    req.History,
+		"prompt":     req.Prompt,
+		"images":     req.Images,
+		"documents":  req.Documents,
+		"sources":    req.Sources,
+		"schema":     req.Schema,
+		"max_rounds": req.MaxToolRounds,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// secretHeader matches the names of headers that carry credentials.
+var secretHeader = regexp.MustCompile(`(?i)auth|key|token|secret|cookie|password`)
+
+// cacheHeaders is what of an entry's headers goes into the cache key: the
+// values of those that can change the answer, such as routing or version
+// headers, and only the names of those carrying credentials, which are left
+// out as the API key is.
+func cacheHeaders(headers map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range headers {
+		if secretHeader.MatchString(k) {
+			out[strings.ToLower(k)] = ""
+			continue
+		}
+		if expanded, err := expandEnv(v); err == nil {
+			v = expanded
+		}
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+// cachedAnswer returns the cached answer to req, if there's one younger than
+// the TTL, saying on stderr that it's reused.
+func cachedAnswer(api APIConfig, req Request) (Response, bool) {
+	if !cacheable(req) {
+		return Response{}, false
+	}
+	path := filepath.Join(getResponseCacheDir(), cacheKey(api, req)+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Response{}, false
+	}
+	var c cachedResponse
+	if json.Unmarshal(data, &c) != nil || time.Since(c.Time) > cacheTTL {
+		os.Remove(path)
+		return Response{}, false
+	}
+
+	notice := fmt.Sprintf("Cached answer from %s ago; --no-cache to ask again", time.Since(c.Time).Round(time.Second))
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		notice = styleDim + notice + styleReset
+	}
+	fmt.Fprintln(os.Stderr, notice)
+	resp := Response{Text: c.Text, Citations: c.Citations, Thinking: c.Thinking, Usage: c.Usage,
+		Model: c.Model, FinishReason: c.FinishReason, Raw: c.Raw}
+	recordCacheHit(api, resp)
+	return resp, true
+}
+
+// cacheAnswer keeps resp as the answer to req. Answers with images aren't
+// kept, nor empty ones.
+func cacheAnswer(api APIConfig, req Request, resp Response) {
+	if !cacheable(req) || strings.TrimSpace(resp.Text) == "" || len(resp.Images) > 0 {
+		return
+	}
+	data, err := json.Marshal(cachedResponse{Time: time.Now(), Text: resp.Text, Citations: resp.Citations,
+		Thinking: resp.Thinking, Usage: resp.Usage, Model: resp.Model, FinishReason: resp.FinishReason, Raw: resp.Raw})
+	if err != nil {
+		return
+	}
+	os.MkdirAll(getResponseCacheDir(), 0700)
+	writeFileAtomic(filepath.Join(getResponseCacheDir(), cacheKey(api, req)+".json"), data)
+}
+
+// runCache handles "ask cache [stats | clear]".
+func runCache(args []string) {
+	sub := "stats"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	if len(args) > 1 || (sub != "stats" && sub != "clear") {
+		fmt.Println("Usage: ask cache [stats | clear]")
+		os.Exit(1)
+	}
+
+	entries, err := os.ReadDir(getResponseCacheDir())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	var count int
+	var size int64
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			size += info.Size()
+		}
+		if sub == "clear" {
+			if err := os.Remove(filepath.Join(getResponseCacheDir(), e.Name())); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+		count++
+	}
+
+	if sub == "clear" {
+		fmt.Printf("Removed %d cached answer(s), %s.\n", count, formatBytes(size))
+		// Pages fetched for --url and compiled plugins go too.
+		for _, dir := range []string{getWebCacheDir(), getPluginCacheDir()} {
+			if err := os.RemoveAll(dir); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+	fmt.Printf("%d cached answer(s), %s, in %s\n", count, formatBytes(size), getResponseCacheDir())
+	if config := loadConfig(); config.Settings.Cache == "" || config.Settings.Cache == "off" {
+		fmt.Println(`The cache is off; set "cache": "24h" (or another duration) in settings to turn it on.`)
+	} else {
+		fmt.Printf("Answers are reused for %s.\n", config.Settings.Cache)
+	}
+}
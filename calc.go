@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// calcSystemPrompt tells the model to leave arithmetic to the calc tool.
+const calcSystemPrompt = `You have a calc tool that evaluates arithmetic exactly and a convert tool for units and currencies. Use them for every calculation and conversion, however simple, instead of working numbers out yourself, and take every number in your answer from their results. Briefly show the steps you took, then give the result.`
+
+// maxExactExponent bounds the exponents calc raises exact numbers to, and
+// maxExactBits the size of the powers it works out exactly; larger powers
+// are approximated.
+const (
+	maxExactExponent = 4096
+	maxExactBits     = 1 << 17
+)
+
+// maxRoundDigits bounds round's digits either side of the point.
+const maxRoundDigits = 1000
+
+// calcTool evaluates expressions for the model.
+var calcTool = Tool{
+	Name: "calc",
+	Description: "Evaluate an arithmetic expression exactly. Supports + - * / ^, parentheses, x% (percent), n! " +
+		"and the functions sqrt, abs, round(x[, digits]), floor, ceil, min, max, mod, ln, log, log2, exp, sin, cos, tan " +
+		"and the constants pi and e. Returns the exact result, as a fraction with its decimal value when it doesn't " +
+		"terminate, or an approximation marked with ≈.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"expression": map[string]interface{}{
+				"type":        "string",
+				"description": "The expression to evaluate, e.g. (2^64 - 1) / 3",
+			},
+		},
+		"required": []string{"expression"},
+	},
+	Run: func(_ context.Context, args map[string]interface{}) (string, error) {
+		expr, _ := args["expression"].(string)
+		v, err := evalExpression(expr)
+		if err != nil {
+			return "", err
+		}
+		return v.String(), nil
+	},
+}
+
+// runCalc handles "ask calc <question> [--api name] [--offline]": the model
+// answers with every number computed locally by the calc and convert tools,
+// and the work is shown.
+func runCalc(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"api": true, "offline": false})
+	if err != nil || len(parsed.positional) == 0 {
+		fmt.Println("Usage: ask calc \"<question>\" [--api <api-name>] [--offline]")
+		os.Exit(1)
+	}
+
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	req := Request{
+		System: calcSystemPrompt,
+		Prompt: strings.Join(parsed.positional, " "),
+		Tools:  []Tool{calcTool, convertTool(parsed.has("offline"))},
+	}
+
+	entry := newHistoryEntry(apiName, api, req)
+	resp, err := sendWithTools(api, req, func(call toolCall, result string) {
+		line := fmt.Sprintf("  %v = %s", call.Args["expression"], result)
+		if call.Name == "convert" {
+			line = fmt.Sprintf("  %v %v in %v = %s", call.Args["value"], call.Args["from"], call.Args["to"], result)
+		}
+		if tty {
+			line = dim(line)
+		}
+		fmt.Println(line)
+	})
+	entry.addResponse(resp)
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println(resp.Text)
+}
+
+// calcValue is a number that is either exact or an approximation.
+type calcValue struct {
+	r     *big.Rat
+	exact bool
+}
+
+func exactValue(r *big.Rat) calcValue { return calcValue{r: r, exact: true} }
+
+func approxValue(f float64) (calcValue, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return calcValue{}, fmt.Errorf("result is not a finite number")
+	}
+	return calcValue{r: new(big.Rat).SetFloat64(f)}, nil
+}
+
+func (v calcValue) float() float64 {
+	f, _ := v.r.Float64()
+	return f
+}
+
+func (v calcValue) isInt() bool { return v.r.IsInt() }
+
+// String formats v: integers and terminating decimals in full, other exact
+// values as a fraction (when it's short enough to read) with their decimal
+// expansion, approximations with ≈.
+func (v calcValue) String() string {
+	if v.r == nil {
+		return ""
+	}
+	if !v.exact {
+		return "≈ " + strconv.FormatFloat(v.float(), 'g', 15, 64)
+	}
+	if v.r.IsInt() {
+		return v.r.Num().String()
+	}
+	if digits, ok := terminatingDigits(v.r.Denom()); ok && digits <= 50 {
+		return v.r.FloatString(digits)
+	}
+	decimal := strings.TrimRight(v.r.FloatString(20), "0") + "…"
+	if fraction := v.r.String(); len(fraction) <= 40 {
+		return fmt.Sprintf("%s (≈ %s)", fraction, decimal)
+	}
+	return "≈ " + decimal
+}
+
+// terminatingDigits reports how many decimal places 1/d needs, if its
+// expansion terminates (d has no prime factors but 2 and 5).
+func terminatingDigits(d *big.Int) (int, bool) {
+	d = new(big.Int).Set(d)
+	two, five, zero := big.NewInt(2), big.NewInt(5), new(big.Int)
+	rem := new(big.Int)
+	twos, fives := 0, 0
+	for rem.Mod(d, two).Cmp(zero) == 0 {
+		d.Quo(d, two)
+		twos++
+	}
+	for rem.Mod(d, five).Cmp(zero) == 0 {
+		d.Quo(d, five)
+		fives++
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	return max(twos, fives), true
+}
+
+// evalExpression parses and evaluates an arithmetic expression.
+func evalExpression(expr string) (calcValue, error) {
+	p := &calcParser{input: expr}
+	if err := p.tokenize(); err != nil {
+		return calcValue{}, err
+	}
+	v, err := p.expr()
+	if err != nil {
+		return calcValue{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return calcValue{}, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return v, nil
+}
+
+type calcParser struct {
+	input  string
+	tokens []string
+	pos    int
+}
+
+func (p *calcParser) tokenize() error {
+	s := strings.NewReplacer("×", "*", "÷", "/", "−", "-").Replace(p.input)
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == '_') {
+				j++
+			}
+			// Scientific notation: 1.5e3, 2E-4.
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && s[k] >= '0' && s[k] <= '9' {
+					for k < len(s) && s[k] >= '0' && s[k] <= '9' {
+						k++
+					}
+					j = k
+				}
+			}
+			p.tokens = append(p.tokens, strings.ReplaceAll(s[i:j], "_", ""))
+			i = j
+		case unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			p.tokens = append(p.tokens, strings.ToLower(s[i:j]))
+			i = j
+		case strings.HasPrefix(s[i:], "**"):
+			p.tokens = append(p.tokens, "^")
+			i += 2
+		case strings.ContainsRune("+-*/^%!(),", c):
+			p.tokens = append(p.tokens, string(c))
+			i++
+		default:
+			return fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return nil
+}
+
+func (p *calcParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *calcParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *calcParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		if got == "" {
+			return fmt.Errorf("expected %q at end of expression", tok)
+		}
+		return fmt.Errorf("expected %q, found %q", tok, got)
+	}
+	return nil
+}
+
+// expr := term (("+" | "-") term)*
+func (p *calcParser) expr() (calcValue, error) {
+	left, err := p.term()
+	if err != nil {
+		return left, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()
+		right, err := p.term()
+		if err != nil {
+			return right, err
+		}
+		r := new(big.Rat)
+		if op == "+" {
+			r.Add(left.r, right.r)
+		} else {
+			r.Sub(left.r, right.r)
+		}
+		left = calcValue{r: r, exact: left.exact && right.exact}
+	}
+	return left, nil
+}
+
+// term := unary (("*" | "/") unary)*
+func (p *calcParser) term() (calcValue, error) {
+	left, err := p.unary()
+	if err != nil {
+		return left, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.next()
+		right, err := p.unary()
+		if err != nil {
+			return right, err
+		}
+		r := new(big.Rat)
+		if op == "*" {
+			r.Mul(left.r, right.r)
+		} else {
+			if right.r.Sign() == 0 {
+				return calcValue{}, fmt.Errorf("division by zero")
+			}
+			r.Quo(left.r, right.r)
+		}
+		left = calcValue{r: r, exact: left.exact && right.exact}
+	}
+	return left, nil
+}
+
+// unary := ("-" | "+") unary | power
+func (p *calcParser) unary() (calcValue, error) {
+	switch p.peek() {
+	case "-":
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return v, err
+		}
+		return calcValue{r: new(big.Rat).Neg(v.r), exact: v.exact}, nil
+	case "+":
+		p.next()
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power := postfix ("^" unary)?, so 2^3^2 is 2^9 and 2^-1 is 1/2.
+func (p *calcParser) power() (calcValue, error) {
+	base, err := p.postfix()
+	if err != nil || p.peek() != "^" {
+		return base, err
+	}
+	p.next()
+	exp, err := p.unary()
+	if err != nil {
+		return exp, err
+	}
+	return pow(base, exp)
+}
+
+// postfix := primary ("%" | "!")*
+func (p *calcParser) postfix() (calcValue, error) {
+	v, err := p.primary()
+	if err != nil {
+		return v, err
+	}
+	for {
+		switch p.peek() {
+		case "%":
+			p.next()
+			v = calcValue{r: new(big.Rat).Quo(v.r, big.NewRat(100, 1)), exact: v.exact}
+		case "!":
+			p.next()
+			if v, err = factorial(v); err != nil {
+				return v, err
+			}
+		default:
+			return v, nil
+		}
+	}
+}
+
+// primary := number | constant | function "(" args ")" | "(" expr ")"
+func (p *calcParser) primary() (calcValue, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return calcValue{}, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		v, err := p.expr()
+		if err != nil {
+			return v, err
+		}
+		return v, p.expect(")")
+	case tok[0] >= '0' && tok[0] <= '9' || tok[0] == '.':
+		r, ok := new(big.Rat).SetString(tok)
+		if !ok {
+			return calcValue{}, fmt.Errorf("bad number %q", tok)
+		}
+		return exactValue(r), nil
+	case unicode.IsLetter(rune(tok[0])):
+		if p.peek() != "(" {
+			switch tok {
+			case "pi":
+				return approxValue(math.Pi)
+			case "e":
+				return approxValue(math.E)
+			}
+			return calcValue{}, fmt.Errorf("unknown name %q", tok)
+		}
+		p.next()
+		var args []calcValue
+		for p.peek() != ")" {
+			v, err := p.expr()
+			if err != nil {
+				return v, err
+			}
+			args = append(args, v)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return calcValue{}, err
+		}
+		return callFunction(tok, args)
+	}
+	return calcValue{}, fmt.Errorf("unexpected %q", tok)
+}
+
+func pow(base, exp calcValue) (calcValue, error) {
+	if base.exact && exp.exact && exp.isInt() {
+		n := exp.r.Num()
+		if n.IsInt64() && n.Int64() >= -maxExactExponent && n.Int64() <= maxExactExponent && powBits(base, n.Int64()) <= maxExactBits {
+			e := n.Int64()
+			if e < 0 && base.r.Sign() == 0 {
+				return calcValue{}, fmt.Errorf("division by zero")
+			}
+			abs := big.NewInt(e)
+			abs.Abs(abs)
+			num := new(big.Int).Exp(base.r.Num(), abs, nil)
+			den := new(big.Int).Exp(base.r.Denom(), abs, nil)
+			r := new(big.Rat).SetFrac(num, den)
+			if e < 0 {
+				r.Inv(r)
+			}
+			return exactValue(r), nil
+		}
+	}
+	return approxValue(math.Pow(base.float(), exp.float()))
+}
+
+// powBits estimates the size in bits of base raised to e, from the sizes
+// of its numerator and denominator.
+func powBits(base calcValue, e int64) int64 {
+	if e < 0 {
+		e = -e
+	}
+	return int64(base.r.Num().BitLen()+base.r.Denom().BitLen()) * e
+}
+
+func factorial(v calcValue) (calcValue, error) {
+	if !v.exact || !v.isInt() || v.r.Sign() < 0 || v.r.Num().Cmp(big.NewInt(10000)) > 0 {
+		return calcValue{}, fmt.Errorf("factorial needs a whole number from 0 to 10000")
+	}
+	n := v.r.Num().Int64()
+	r := new(big.Int).MulRange(1, n)
+	if n == 0 {
+		r.SetInt64(1)
+	}
+	return exactValue(new(big.Rat).SetInt(r)), nil
+}
+
+// callFunction applies a named function to its arguments.
+func callFunction(name string, args []calcValue) (calcValue, error) {
+	arity := map[string]int{
+		"sqrt": 1, "abs": 1, "floor": 1, "ceil": 1, "ln": 1, "log": 1, "log2": 1,
+		"exp": 1, "sin": 1, "cos": 1, "tan": 1, "mod": 2,
+	}
+	if want, ok := arity[name]; ok && len(args) != want {
+		return calcValue{}, fmt.Errorf("%s takes %d argument(s), got %d", name, want, len(args))
+	}
+
+	switch name {
+	case "sqrt":
+		x := args[0]
+		if x.r.Sign() < 0 {
+			return calcValue{}, fmt.Errorf("square root of a negative number")
+		}
+		if x.exact {
+			num, den := new(big.Int).Sqrt(x.r.Num()), new(big.Int).Sqrt(x.r.Denom())
+			if r := new(big.Rat).SetFrac(num, den); new(big.Rat).Mul(r, r).Cmp(x.r) == 0 {
+				return exactValue(r), nil
+			}
+		}
+		return approxValue(math.Sqrt(x.float()))
+	case "abs":
+		return calcValue{r: new(big.Rat).Abs(args[0].r), exact: args[0].exact}, nil
+	case "floor", "ceil":
+		x := args[0]
+		q := new(big.Int).Quo(x.r.Num(), x.r.Denom()) // truncates toward zero
+		if !x.isInt() && (name == "floor") == (x.r.Sign() < 0) {
+			if name == "floor" {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+		return calcValue{r: new(big.Rat).SetInt(q), exact: x.exact}, nil
+	case "round":
+		if len(args) != 1 && len(args) != 2 {
+			return calcValue{}, fmt.Errorf("round takes 1 or 2 arguments, got %d", len(args))
+		}
+		digits := 0
+		if len(args) == 2 {
+			if !args[1].isInt() {
+				return calcValue{}, fmt.Errorf("round's digits must be a whole number")
+			}
+			n := args[1].r.Num()
+			if !n.IsInt64() || n.Int64() < -maxRoundDigits || n.Int64() > maxRoundDigits {
+				return calcValue{}, fmt.Errorf("round's digits must be from %d to %d", -maxRoundDigits, maxRoundDigits)
+			}
+			digits = int(n.Int64())
+		}
+		if digits >= 0 {
+			r, _ := new(big.Rat).SetString(args[0].r.FloatString(digits))
+			return calcValue{r: r, exact: args[0].exact}, nil
+		}
+		// FloatString can't round left of the point: round x / 10^-digits to
+		// a whole number and scale it back.
+		scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-digits)), nil))
+		r, _ := new(big.Rat).SetString(new(big.Rat).Quo(args[0].r, scale).FloatString(0))
+		return calcValue{r: r.Mul(r, scale), exact: args[0].exact}, nil
+	case "min", "max":
+		if len(args) == 0 {
+			return calcValue{}, fmt.Errorf("%s needs at least one argument", name)
+		}
+		best := args[0]
+		for _, a := range args[1:] {
+			if c := a.r.Cmp(best.r); (name == "min" && c < 0) || (name == "max" && c > 0) {
+				best = a
+			}
+		}
+		return best, nil
+	case "mod":
+		a, b := args[0], args[1]
+		if b.r.Sign() == 0 {
+			return calcValue{}, fmt.Errorf("division by zero")
+		}
+		q := new(big.Rat).Quo(a.r, b.r)
+		whole := new(big.Int).Quo(q.Num(), q.Denom())
+		if q.Sign() < 0 && !q.IsInt() {
+			whole.Sub(whole, big.NewInt(1))
+		}
+		r := new(big.Rat).Sub(a.r, new(big.Rat).Mul(b.r, new(big.Rat).SetInt(whole)))
+		return calcValue{r: r, exact: a.exact && b.exact}, nil
+	}
+
+	fns := map[string]func(float64) float64{
+		"ln": math.Log, "log": math.Log10, "log2": math.Log2, "exp": math.Exp,
+		"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	}
+	if fn, ok := fns[name]; ok {
+		return approxValue(fn(args[0].float()))
+	}
+	return calcValue{}, fmt.Errorf("unknown function %q", name)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const chartDescribePrompt = `Describe this chart or diagram: what it shows, its axes and units, the main trends, and any notable values or outliers.`
+
+const chartExtractPrompt = `Reconstruct the data behind this chart as JSON, and reply with the JSON only:
+
+{
+  "title": "chart title or empty",
+  "columns": ["label column", "series 1", "series 2"],
+  "rows": [["label", 1.5, 2], ...],
+  "percent": true if the values of each series are shares that should add up to 100,
+  "totals": {"series name": total} for any totals printed on the chart, otherwise {}
+}
+
+The first column holds the category or x value; every other cell must be a number, or null where no value can be read. Read values as precisely as the chart allows.`
+
+// chartData is the table a vision model reconstructs from a chart image.
+type chartData struct {
+	Title   string             `json:"title"`
+	Columns []string           `json:"columns"`
+	Rows    [][]interface{}    `json:"rows"`
+	Percent bool               `json:"percent"`
+	Totals  map[string]float64 `json:"totals"`
+}
+
+// chartAttempts bounds how often extraction is retried after the model
+// returns unparseable or inconsistent data.
+const chartAttempts = 3
+
+func runChart(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{
+		"api": true, "extract-data": false, "format": true, "o": true,
+	})
+	if err != nil || len(parsed.positional) != 1 {
+		fmt.Println("Usage: ask chart <image> [--api <api-name>] [--extract-data [--format csv|json] [-o file]]")
+		os.Exit(1)
+	}
+
+	img, err := loadImage(parsed.positional[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	_, api := selectAPI(config, parsed.value("api", ""))
+
+	if !parsed.has("extract-data") {
+		resp, err := sendRequest(api, Request{Prompt: chartDescribePrompt, Images: []Image{img}})
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(resp)
+		return
+	}
+
+	format := parsed.value("format", "csv")
+	if format != "csv" && format != "json" {
+		fmt.Println("Unknown format:", format)
+		os.Exit(1)
+	}
+
+	data, problems, err := extractChartData(api, img)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, "warning:", p)
+	}
+
+	out := os.Stdout
+	if path := parsed.value("o", ""); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		enc.Encode(data)
+		return
+	}
+
+	w := csv.NewWriter(out)
+	w.Write(data.Columns)
+	for _, row := range data.Rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = formatCell(cell)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+}
+
+// extractChartData asks the model for the chart's data and checks it for
+// consistency, feeding any problems back for another attempt. Problems that
+// remain after the last attempt are returned alongside the data.
+func extractChartData(api APIConfig, img Image) (*chartData, []string, error) {
+	prompt := chartExtractPrompt
+	var data *chartData
+	var problems []string
+
+	for attempt := 0; attempt < chartAttempts; attempt++ {
+		resp, err := sendRequest(api, Request{Prompt: prompt, Images: []Image{img}})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parsed := &chartData{}
+		if err := json.Unmarshal([]byte(extractJSON(resp.Text)), parsed); err != nil {
+			problems = []string{"response was not valid JSON: " + err.Error()}
+		} else {
+			data = parsed
+			problems = checkChartData(parsed)
+		}
+		if len(problems) == 0 {
+			return data, nil, nil
+		}
+
+		prompt = chartExtractPrompt + "\n\nYour previous answer had these problems, fix them:\n- " +
+			strings.Join(problems, "\n- ") + "\n\nPrevious answer:\n" + resp.Text
+	}
+
+	if data == nil {
+		return nil, nil, fmt.Errorf("model did not return usable data: %s", strings.Join(problems, "; "))
+	}
+	return data, problems, nil
+}
+
+// checkChartData verifies the table's shape and that its numbers agree with
+// each other: numeric cells parse, percentage series add up to 100 and
+// series sum to any totals shown on the chart.
+func checkChartData(data *chartData) []string {
+	var problems []string
+	if len(data.Columns) < 2 {
+		return []string{"expected a label column and at least one data column"}
+	}
+	if len(data.Rows) == 0 {
+		return []string{"no rows were extracted"}
+	}
+
+	sums := make([]float64, len(data.Columns))
+	for i, row := range data.Rows {
+		if len(row) != len(data.Columns) {
+			problems = append(problems, fmt.Sprintf("row %d has %d cells, expected %d", i+1, len(row), len(data.Columns)))
+			continue
+		}
+		for j, cell := range row[1:] {
+			if cell == nil {
+				continue
+			}
+			v, ok := cellNumber(cell)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("row %d, column %q is not a number: %v", i+1, data.Columns[j+1], cell))
+				continue
+			}
+			sums[j+1] += v
+		}
+	}
+
+	for j, name := range data.Columns[1:] {
+		sum := sums[j+1]
+		if data.Percent && math.Abs(sum-100) > 1.5 {
+			problems = append(problems, fmt.Sprintf("percentages in %q add up to %s, not 100", name, formatNumber(sum)))
+		}
+		if total, ok := data.Totals[name]; ok && math.Abs(sum-total) > math.Max(0.01*math.Abs(total), 0.5) {
+			problems = append(problems, fmt.Sprintf("values in %q add up to %s but the chart shows a total of %s", name, formatNumber(sum), formatNumber(total)))
+		}
+	}
+	return problems
+}
+
+func cellNumber(cell interface{}) (float64, bool) {
+	switch v := cell.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.ReplaceAll(v, ",", ""), "%"), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func formatCell(cell interface{}) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case float64:
+		return formatNumber(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// extractJSON returns the JSON object or array embedded in a model response,
+// dropping code fences and any prose around it.
+func extractJSON(text string) string {
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return text
+	}
+	closer := "}"
+	if text[start] == '[' {
+		closer = "]"
+	}
+	end := strings.LastIndex(text, closer)
+	if end < start {
+		return text
+	}
+	return text[start : end+1]
+}
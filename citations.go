@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Response is a provider's answer along with any sources it cited.
+type Response struct {
+	Text      string     `json:"text"`
+	Citations []Citation `json:"citations,omitempty"`
+	// Logprobs holds the probability of each generated token, when the
+	// request asked for them and the provider supplies them.
+	Logprobs []TokenLogprob `json:"-"`
+	// Thinking is the model's visible reasoning, where the provider
+	// returns it.
+	Thinking string `json:"-"`
+	// Images are the images the model generated, if any.
+	Images []Image `json:"-"`
+	// Steps are the rounds of tool calls made before the answer.
+	Steps []ToolStep `json:"-"`
+	// Usage is the token count of the exchange, when the provider reports
+	// it.
+	Usage *Usage `json:"usage,omitempty"`
+	// Model is the model that answered, as the provider names it.
+	Model string `json:"-"`
+	// FinishReason is why generation stopped ("stop", "length", ...), in
+	// the provider's own terms.
+	FinishReason string `json:"-"`
+	// Raw is the provider's response body as received, for --raw.
+	Raw []byte `json:"-"`
+}
+
+// Usage counts the tokens a request consumed.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// add returns the sum of two counts, either of which may be missing.
+func (u *Usage) add(v *Usage) *Usage {
+	if u == nil {
+		return v
+	}
+	if v == nil {
+		return u
+	}
+	return &Usage{InputTokens: u.InputTokens + v.InputTokens, OutputTokens: u.OutputTokens + v.OutputTokens}
+}
+
+// Citation is a source backing part of a response. Footnote markers in the
+// response text ("[1]") refer to citations by their 1-based position.
+type Citation struct {
+	Title   string `json:"title,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+	// Number is the marker the text uses for this citation when it isn't
+	// simply its position in the list.
+	Number int `json:"number,omitempty"`
+}
+
+// String renders the response with its citations as a numbered source list
+// below the text.
+func (r Response) String() string {
+	return r.render(false)
+}
+
+// render is String, optionally quoting each source's snippet under it.
+func (r Response) render(snippets bool) string {
+	list := r.sourceList(snippets)
+	if list == "" {
+		return r.Text
+	}
+	return strings.TrimRight(r.Text, "\n") + "\n\n" + list
+}
+
+// sourceList renders the citations as a numbered list, or "" if there are
+// none.
+func (r Response) sourceList(snippets bool) string {
+	if len(r.Citations) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Sources:\n")
+	for i, c := range r.Citations {
+		label := c.Title
+		if label == "" {
+			label = c.URL
+		} else if c.URL != "" && c.URL != c.Title {
+			label += " - " + c.URL
+		}
+		if label == "" {
+			label = c.Snippet
+		} else if snippets && c.Snippet != "" {
+			label += "\n" + indent(strings.TrimRight(c.Snippet, "\n"), "    ")
+		}
+		n := c.Number
+		if n == 0 {
+			n = i + 1
+		}
+		fmt.Fprintf(&sb, "[%d] %s\n", n, label)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// citationMarker matches footnote markers such as "[3]".
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// citedSources returns the sources text refers to by number, in order and
+// keeping their numbers.
+func citedSources(text string, sources []Citation) []Citation {
+	used := map[int]bool{}
+	for _, m := range citationMarker.FindAllStringSubmatch(text, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= 1 && n <= len(sources) {
+			used[n] = true
+		}
+	}
+
+	var cites []Citation
+	for n := 1; n <= len(sources); n++ {
+		if used[n] {
+			c := sources[n-1]
+			c.Number = n
+			cites = append(cites, c)
+		}
+	}
+	return cites
+}
+
+// citationSpan ties the text ending at byte offset end to the sources that
+// back it.
+type citationSpan struct {
+	end     int
+	sources []Citation
+}
+
+// footnote numbers the sources behind each span in order of first use and
+// inserts the markers into text, returning the annotated text and the
+// citation list the markers refer to.
+func footnote(text string, spans []citationSpan) (string, []Citation) {
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].end < spans[j].end })
+
+	var cites []Citation
+	index := map[Citation]int{}
+	markers := make([]string, len(spans))
+	for i, span := range spans {
+		var nums []int
+		for _, src := range span.sources {
+			n, ok := index[src]
+			if !ok {
+				cites = append(cites, src)
+				n = len(cites)
+				index[src] = n
+			}
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for j, n := range nums {
+			if j > 0 && nums[j-1] == n {
+				continue
+			}
+			markers[i] += fmt.Sprintf("[%d]", n)
+		}
+	}
+
+	var sb strings.Builder
+	pos := 0
+	for i, span := range spans {
+		end := span.end
+		if end > len(text) {
+			end = len(text)
+		}
+		if end < pos {
+			end = pos
+		}
+		sb.WriteString(text[pos:end])
+		sb.WriteString(markers[i])
+		pos = end
+	}
+	sb.WriteString(text[pos:])
+	return sb.String(), cites
+}
+
+// runeToByte converts a character offset into a byte offset within s.
+func runeToByte(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// cohereCitations reads the citations Cohere returns when a chat is grounded
+// in documents or connectors such as web search.
+func cohereCitations(text string, result map[string]interface{}) Response {
+	docs := map[string]Citation{}
+	if list, ok := result["documents"].([]interface{}); ok {
+		for _, d := range list {
+			doc, _ := d.(map[string]interface{})
+			id, _ := doc["id"].(string)
+			c := Citation{}
+			c.Title, _ = doc["title"].(string)
+			c.URL, _ = doc["url"].(string)
+			if c.Title == "" && c.URL == "" {
+				c.Snippet, _ = doc["snippet"].(string)
+			}
+			docs[id] = c
+		}
+	}
+
+	var spans []citationSpan
+	if list, ok := result["citations"].([]interface{}); ok {
+		for _, c := range list {
+			cite, _ := c.(map[string]interface{})
+			end, _ := cite["end"].(float64)
+			span := citationSpan{end: runeToByte(text, int(end))}
+			ids, _ := cite["document_ids"].([]interface{})
+			for _, id := range ids {
+				if doc, ok := docs[fmt.Sprint(id)]; ok {
+					span.sources = append(span.sources, doc)
+				}
+			}
+			if len(span.sources) > 0 {
+				spans = append(spans, span)
+			}
+		}
+	}
+
+	text, cites := footnote(text, spans)
+	return Response{Text: text, Citations: cites}
+}
+
+// geminiCitations reads a candidate's grounding metadata, present when a
+// Gemini request is grounded with Google Search.
+func geminiCitations(text string, candidate map[string]interface{}) Response {
+	meta, ok := candidate["groundingMetadata"].(map[string]interface{})
+	if !ok {
+		return Response{Text: text}
+	}
+
+	var chunks []Citation
+	if list, ok := meta["groundingChunks"].([]interface{}); ok {
+		for _, ch := range list {
+			chunk, _ := ch.(map[string]interface{})
+			web, _ := chunk["web"].(map[string]interface{})
+			c := Citation{}
+			c.Title, _ = web["title"].(string)
+			c.URL, _ = web["uri"].(string)
+			chunks = append(chunks, c)
+		}
+	}
+
+	var spans []citationSpan
+	if list, ok := meta["groundingSupports"].([]interface{}); ok {
+		for _, s := range list {
+			support, _ := s.(map[string]interface{})
+			segment, _ := support["segment"].(map[string]interface{})
+			end, _ := segment["endIndex"].(float64)
+			span := citationSpan{end: int(end)}
+			indices, _ := support["groundingChunkIndices"].([]interface{})
+			for _, idx := range indices {
+				if i, ok := idx.(float64); ok && int(i) < len(chunks) {
+					span.sources = append(span.sources, chunks[int(i)])
+				}
+			}
+			if len(span.sources) > 0 {
+				spans = append(spans, span)
+			}
+		}
+	}
+
+	text, cites := footnote(text, spans)
+	return Response{Text: text, Citations: cites}
+}
+
+// urlCitations turns a plain list of source URLs, as Perplexity returns
+// alongside text that already carries "[n]" markers, into citations.
+func urlCitations(list []interface{}) []Citation {
+	var cites []Citation
+	for _, u := range list {
+		if s, ok := u.(string); ok {
+			cites = append(cites, Citation{URL: s})
+		}
+	}
+	return cites
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// clientCertificate loads the certificate api presents to servers that ask
+// for one: PEM files of a certificate and its key, a PKCS#12 bundle, or an
+// identity in the OS's certificate store. It returns nil when the entry
+// sets none.
+func clientCertificate(api APIConfig) (*tls.Certificate, error) {
+	password, err := expandEnv(api.ClientCertPassword)
+	if err != nil {
+		return nil, fmt.Errorf("client_cert_password: %v", err)
+	}
+	switch {
+	case api.ClientCertStore != "":
+		if api.ClientCert != "" || api.ClientKey != "" {
+			return nil, fmt.Errorf("client_cert_store can't be combined with client_cert or client_key")
+		}
+		return storeCertificate(api.ClientCertStore)
+	case api.ClientCert == "" && api.ClientKey == "":
+		return nil, nil
+	case api.ClientCert == "":
+		return nil, fmt.Errorf("client_key needs client_cert")
+	}
+
+	certData, err := readTLSFile(api.ClientCert)
+	if err != nil {
+		return nil, fmt.Errorf("client_cert: %v", err)
+	}
+	if block, _ := pem.Decode(certData); block == nil {
+		// Not PEM: a .p12 or .pfx bundle, holding the key as well.
+		if api.ClientKey != "" {
+			return nil, fmt.Errorf("client_key: not needed with a PKCS#12 client_cert, which holds the key")
+		}
+		cert, err := pkcs12Identity(certData, password, "")
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %v", err)
+		}
+		return cert, nil
+	}
+
+	// Without client_key, the key is looked for in the certificate's file.
+	keyData := certData
+	if api.ClientKey != "" {
+		if keyData, err = readTLSFile(api.ClientKey); err != nil {
+			return nil, fmt.Errorf("client_key: %v", err)
+		}
+	}
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		if api.ClientKey == "" {
+			return nil, fmt.Errorf("client_key: not set, and client_cert holds no key")
+		}
+		if encryptedPEMKey(keyData) {
+			return nil, fmt.Errorf("client_key is encrypted; decrypt it (openssl pkey -in key.pem -out plain.pem) or bundle it with its certificate as PKCS#12 and set client_cert_password")
+		}
+		return nil, fmt.Errorf("client certificate: %v", err)
+	}
+	return &cert, nil
+}
+
+// encryptedPEMKey reports whether data holds a passphrase-protected key.
+func encryptedPEMKey(data []byte) bool {
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return false
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+			return true
+		}
+		data = rest
+	}
+}
+
+// pkcs12Identity returns the certificate and key in a PKCS#12 bundle, with
+// the CA certificates that come with it as its chain. Bundles can hold
+// several identities, as Keychain exports do; match, when set, picks the one
+// whose subject contains it or whose SHA-1 thumbprint it is.
+func pkcs12Identity(data []byte, password, match string) (*tls.Certificate, error) {
+	// ToPEM, unlike DecodeChain, copes with more than one key in a bundle.
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		if err == pkcs12.ErrIncorrectPassword {
+			return nil, fmt.Errorf("wrong client_cert_password")
+		}
+		return nil, err
+	}
+	var certs, keys [][]byte
+	var cas [][]byte
+	for _, b := range blocks {
+		switch {
+		case b.Type == "CERTIFICATE":
+			certs = append(certs, pem.EncodeToMemory(b))
+			if c, err := x509.ParseCertificate(b.Bytes); err == nil && c.IsCA {
+				cas = append(cas, b.Bytes)
+			}
+		case strings.HasSuffix(b.Type, "PRIVATE KEY"):
+			keys = append(keys, pem.EncodeToMemory(b))
+		}
+	}
+	for _, certPEM := range certs {
+		for _, keyPEM := range keys {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil || match != "" && !identityMatches(cert.Leaf, match) {
+				continue
+			}
+			for _, ca := range cas {
+				if !bytes.Equal(ca, cert.Certificate[0]) {
+					cert.Certificate = append(cert.Certificate, ca)
+				}
+			}
+			return &cert, nil
+		}
+	}
+	if match != "" {
+		return nil, fmt.Errorf("no certificate with a private key matches %q", match)
+	}
+	return nil, fmt.Errorf("no certificate with its private key in the bundle")
+}
+
+// identityMatches reports whether cert's subject contains match, ignoring
+// case, or match is its SHA-1 thumbprint, as the OS stores show it.
+func identityMatches(cert *x509.Certificate, match string) bool {
+	sum := sha1.Sum(cert.Raw)
+	thumbprint := strings.NewReplacer(" ", "", ":", "").Replace(match)
+	if strings.EqualFold(hex.EncodeToString(sum[:]), thumbprint) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(cert.Subject.String()), strings.ToLower(match))
+}
+
+// storeIdentities holds the identities already taken from the OS store, so
+// a run asks the store, and the user, once per identity.
+var (
+	storeIdentities   = map[string]*tls.Certificate{}
+	storeIdentitiesMu sync.Mutex
+)
+
+// windowsExportScript exports the first identity in the user's or the
+// machine's personal store matching $env:ASK_CERT_MATCH, by thumbprint or
+// subject, as base64 PKCS#12 protected by $env:ASK_CERT_PASSWORD.
+const windowsExportScript = `$m = $env:ASK_CERT_MATCH -replace '[\s:]', ''
+$c = Get-ChildItem Cert:\CurrentUser\My, Cert:\LocalMachine\My | Where-Object { $_.HasPrivateKey -and ($_.Thumbprint -eq $m -or $_.Subject -like "*$env:ASK_CERT_MATCH*") } | Select-Object -First 1
+if (-not $c) { [Console]::Error.WriteLine("no certificate with a private key matches"); exit 3 }
+[Convert]::ToBase64String($c.Export('Pfx', $env:ASK_CERT_PASSWORD))`
+
+// storeCertificate takes the identity matching match, by subject or SHA-1
+// thumbprint, from the OS's certificate store: the login keychain on macOS,
+// the personal store on Windows. Its key has to be exportable; macOS asks
+// the user to allow it.
+func storeCertificate(match string) (*tls.Certificate, error) {
+	match, err := expandEnv(match)
+	if err != nil {
+		return nil, fmt.Errorf("client_cert_store: %v", err)
+	}
+	storeIdentitiesMu.Lock()
+	defer storeIdentitiesMu.Unlock()
+	if cert, ok := storeIdentities[match]; ok {
+		return cert, nil
+	}
+
+	// The export is protected with a throwaway password, only ever held
+	// here.
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	password := hex.EncodeToString(secret)
+
+	var data []byte
+	switch runtime.GOOS {
+	case "darwin":
+		cmd := exec.Command("security", "export", "-t", "identities", "-f", "pkcs12", "-P", password)
+		cmd.Stderr = os.Stderr
+		if data, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("client_cert_store: exporting from the keychain: %v", err)
+		}
+	case "windows":
+		cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsExportScript)
+		cmd.Env = append(os.Environ(), "ASK_CERT_MATCH="+match, "ASK_CERT_PASSWORD="+password)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("client_cert_store: exporting %q from the certificate store: %v %s", match, err, strings.TrimSpace(stderr.String()))
+		}
+		if data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(out))); err != nil {
+			return nil, fmt.Errorf("client_cert_store: unreadable export: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("client_cert_store works on macOS and Windows; elsewhere set client_cert (PEM or PKCS#12) instead")
+	}
+
+	cert, err := pkcs12Identity(data, password, match)
+	if err != nil {
+		return nil, fmt.Errorf("client_cert_store: %v", err)
+	}
+	storeIdentities[match] = cert
+	return cert, nil
+}
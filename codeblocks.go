@@ -0,0 +1,122 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// codeBlock is a fenced code block found in a model response.
+type codeBlock struct {
+	Lang string // first word of the info string less any :path, e.g. "go", or the detected language
+	Info string // full info string after the fence
+	Code string
+}
+
+// fencePath matches a file path given in a fence's info string, as in
+// ```go title=main.go or ```js filename="src/app.js".
+var fencePath = regexp.MustCompile(`(?:^|\s)(?:title|file|filename|path)=(?:"([^"]+)"|'([^']+)'|(\S+))`)
+
+// path is the file the block is annotated with, from a title=, file=,
+// filename= or path= attribute or the lang:path shorthand (```go:main.go),
+// or "" when it has none.
+func (b codeBlock) path() string {
+	if m := fencePath.FindStringSubmatch(b.Info); m != nil {
+		return m[1] + m[2] + m[3]
+	}
+	first, _, _ := strings.Cut(b.Info, " ")
+	if lang, path, ok := strings.Cut(first, ":"); ok && lang != "" && path != "" {
+		return path
+	}
+	return ""
+}
+
+// fenceLang is the language a fence's info string tags its block with: its
+// first word, without the file of the lang:path shorthand.
+func fenceLang(info string) string {
+	lang := info
+	if i := strings.IndexAny(lang, " \t{"); i >= 0 {
+		lang = lang[:i]
+	}
+	lang, _, _ = strings.Cut(lang, ":")
+	return strings.ToLower(lang)
+}
+
+// extractCodeBlocks returns the fenced (``` or ~~~) code blocks in text, in
+// order. An unterminated final block is returned as well, since truncated
+// answers are common.
+func extractCodeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var current *codeBlock
+	var fence string
+	var code []string
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current == nil {
+			if f := fenceOf(trimmed); f != "" {
+				info := strings.TrimSpace(strings.TrimLeft(trimmed, f[:1]))
+				current = &codeBlock{Lang: fenceLang(info), Info: info}
+				fence = f
+				code = nil
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			current.Code = strings.Join(code, "\n")
+			current.guessLanguage()
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		code = append(code, line)
+	}
+
+	if current != nil {
+		current.Code = strings.Join(code, "\n")
+		current.guessLanguage()
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// guessLanguage fills in Lang from the code when the fence has no tag.
+func (b *codeBlock) guessLanguage() {
+	if b.Lang == "" {
+		b.Lang = detectLanguage(b.Code)
+	}
+}
+
+// fenceOf returns the fence opening line, if line opens a code block.
+func fenceOf(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+// languageAliases maps alternative fence languages to one name.
+var languageAliases = map[string]string{
+	"sh": "bash", "shell": "bash", "zsh": "bash", "console": "bash",
+	"js": "javascript", "jsx": "javascript",
+	"ts": "typescript", "tsx": "typescript",
+	"py": "python", "golang": "go", "rb": "ruby", "rs": "rust",
+	"yml": "yaml", "c++": "cpp", "cs": "csharp",
+}
+
+// sameLanguage reports whether two fence languages name the same language,
+// treating aliases such as "sh" and "bash" alike.
+func sameLanguage(a, b string) bool {
+	return canonicalLanguage(a) == canonicalLanguage(b)
+}
+
+func canonicalLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if alias, ok := languageAliases[lang]; ok {
+		return alias
+	}
+	return lang
+}
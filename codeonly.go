@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// codeOnlyAttempts is how many answers --code-only asks for before giving
+// up on getting valid code.
+const codeOnlyAttempts = 3
+
+// syntaxCheckers parse code with a local toolchain, by language: the
+// command is run on a file with the extension given, and fails on a syntax
+// error. None of them runs the code.
+var syntaxCheckers = map[string]struct {
+	ext string
+	cmd []string
+}{
+	"go":         {".go", []string{"gofmt", "-e", "-l"}},
+	"python":     {".py", []string{"python3", "-m", "py_compile"}},
+	"javascript": {".js", []string{"node", "--check"}},
+	"bash":       {".sh", []string{"bash", "-n"}},
+	"ruby":       {".rb", []string{"ruby", "-c"}},
+	"php":        {".php", []string{"php", "-l"}},
+}
+
+// languageWord matches what may be a language name after --code-only.
+var languageWord = regexp.MustCompile(`^[a-z][a-z0-9+#-]*$`)
+
+// takeCodeOnlyLanguage rewrites "--code-only <lang>" as "--code-only=<lang>"
+// when the word after the flag names a language, so it can be given either
+// way without a prompt's first word being taken for one.
+func takeCodeOnlyLanguage(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(out, args[i:]...)
+		}
+		if args[i] == "--code-only" && i+1 < len(args) && knownLanguage(args[i+1]) {
+			out = append(out, "--code-only="+args[i+1])
+			i++
+			continue
+		}
+		out = append(out, args[i])
+	}
+	return out
+}
+
+// knownLanguage reports whether word is a language ask knows by name.
+func knownLanguage(word string) bool {
+	if !languageWord.MatchString(word) {
+		return false
+	}
+	lang := canonicalLanguage(word)
+	if _, ok := syntaxCheckers[lang]; ok || lang == "json" {
+		return true
+	}
+	for _, alias := range languageAliases {
+		if alias == lang {
+			return true
+		}
+	}
+	for _, h := range languageHints {
+		if h.lang == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// answerCodeOnly prints an answer that must be exactly one code block, in
+// lang if one is given, that parses with the local toolchain when there is
+// one. Answers that don't are sent back with the problem, up to
+// codeOnlyAttempts times; if none passes nothing is printed and ask exits
+// with 1, so the output can go straight to a file.
+func answerCodeOnly(config *Config, parsed *cliArgs, entry *HistoryEntry, apiConfig APIConfig, req Request) {
+	lang := parsed.value("code-only", "")
+	instruction := "Reply with exactly one fenced code block holding the complete code, and nothing before or after it: no explanation, no other blocks."
+	if lang != "" {
+		instruction = fmt.Sprintf("Reply with exactly one fenced code block tagged %s holding the complete code, and nothing before or after it: no explanation, no other blocks.", lang)
+	}
+	req.System = strings.TrimSpace(req.System + "\n\n" + instruction)
+	prompt := req.Prompt
+
+	var problem error
+	var code string
+	var resp Response
+	for attempt := 0; attempt < codeOnlyAttempts; attempt++ {
+		var err error
+		resp, err = sendRequest(apiConfig, req)
+		entry.addResponse(resp)
+		if err != nil {
+			saveHistory(config.Settings, entry, err)
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if code, problem = checkCodeOnly(resp.Text, lang); problem == nil || attempt == codeOnlyAttempts-1 {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "attempt %d rejected, retrying: %v\n", attempt+1, problem)
+		req.Prompt = prompt + "\n\nA previous answer was rejected: " + problem.Error() + ".\n\nPrevious answer:\n" + resp.Text
+	}
+	saveHistory(config.Settings, entry, problem)
+	if problem != nil {
+		fmt.Fprintf(os.Stderr, "Error: no valid code after %d attempts: %v\n", codeOnlyAttempts, problem)
+		os.Exit(1)
+	}
+	fmt.Println(code)
+	reportCost(config.Settings, parsed.has("cost"), apiConfig, resp)
+}
+
+// checkCodeOnly returns the code in text if text is a single code block in
+// lang (any language when lang is "") that parses, and otherwise what's
+// wrong with it.
+func checkCodeOnly(text, lang string) (string, error) {
+	blocks := extractCodeBlocks(text)
+	switch {
+	case len(blocks) == 0:
+		return "", fmt.Errorf("the answer has no code block")
+	case len(blocks) > 1:
+		return "", fmt.Errorf("the answer has %d code blocks, not one", len(blocks))
+	}
+	block := blocks[0]
+	if lang != "" && !sameLanguage(block.Lang, lang) {
+		if block.Lang == "" {
+			return "", fmt.Errorf("the code block isn't tagged %s", lang)
+		}
+		return "", fmt.Errorf("the code block is %s, not %s", block.Lang, lang)
+	}
+	if lang == "" {
+		lang = block.Lang
+	}
+	if err := checkSyntax(lang, block.Code); err != nil {
+		return "", err
+	}
+	return block.Code, nil
+}
+
+// checkSyntax parses code in lang with the local toolchain, when there is
+// one for the language and it's installed.
+func checkSyntax(lang, code string) error {
+	lang = canonicalLanguage(lang)
+	if lang == "json" {
+		if !json.Valid([]byte(code)) {
+			return fmt.Errorf("the JSON doesn't parse")
+		}
+		return nil
+	}
+	checker, ok := syntaxCheckers[lang]
+	if !ok {
+		return nil
+	}
+	if _, err := exec.LookPath(checker.cmd[0]); err != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "ask-code-")
+	if err != nil {
+		return nil
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "code"+checker.ext)
+	if err := os.WriteFile(path, []byte(code+"\n"), 0600); err != nil {
+		return nil
+	}
+	cmd := exec.Command(checker.cmd[0], append(checker.cmd[1:], path)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		msg := strings.TrimSpace(strings.ReplaceAll(string(out), path, "code"+checker.ext))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("it fails %s's syntax check:\n%s", checker.cmd[0], msg)
+	}
+	return nil
+}
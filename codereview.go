@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const reviewPrompt = `You are a careful code reviewer. Review the diff for bugs, security problems, race conditions, error handling, performance and maintainability, in that order of importance. Report only real problems in the changed lines, each with the file, the line in the new version when there is one, a severity and a concrete suggestion. Severities: critical (will break or is exploitable), major (likely bug or serious design problem), minor (worth fixing), nit (style or naming). If the change looks good, say so in the summary and report nothing.`
+
+// reviewSeverities are the severities findings can have, most serious first.
+var reviewSeverities = []string{"critical", "major", "minor", "nit"}
+
+var reviewSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"summary": map[string]interface{}{"type": "string"},
+		"findings": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"file":       map[string]interface{}{"type": "string"},
+					"line":       map[string]interface{}{"type": "integer"},
+					"severity":   map[string]interface{}{"type": "string", "enum": []interface{}{"critical", "major", "minor", "nit"}},
+					"message":    map[string]interface{}{"type": "string"},
+					"suggestion": map[string]interface{}{"type": "string"},
+				},
+				"required": []interface{}{"file", "severity", "message"},
+			},
+		},
+	},
+	"required": []interface{}{"summary", "findings"},
+}
+
+// reviewFinding is one problem the review found.
+type reviewFinding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line,omitempty"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+type reviewResult struct {
+	Summary  string          `json:"summary"`
+	Findings []reviewFinding `json:"findings"`
+}
+
+// runReview handles "ask review [--diff | --range a..b | --pr N] [--api name]
+// [--json] [--fail-on severity]": the diff goes to the model for review and
+// the findings come back grouped by file, most serious first.
+func runReview(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{
+		"diff": false, "range": true, "pr": true, "api": true, "json": false, "fail-on": true, "cost": false,
+	})
+	if err != nil || len(parsed.positional) > 0 {
+		fmt.Println("Usage: ask review [--diff | --range <a..b> | --pr <number>] [--api <api-name>] [--json] [--fail-on <severity>] [--cost]")
+		os.Exit(1)
+	}
+	failOn := parsed.value("fail-on", "")
+	if failOn != "" && severityRank(failOn) < 0 {
+		fmt.Printf("Error: --fail-on must be one of %s\n", strings.Join(reviewSeverities, ", "))
+		os.Exit(1)
+	}
+
+	var diff string
+	switch {
+	case parsed.has("pr"):
+		diff, err = prDiff(parsed.value("pr", ""))
+	case parsed.has("range"):
+		diff, err = git("diff", "--no-color", parsed.value("range", ""))
+	default:
+		// Everything not yet committed, staged or not.
+		diff, err = git("diff", "--no-color", "HEAD")
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if strings.TrimSpace(diff) == "" {
+		fmt.Println("No changes to review.")
+		return
+	}
+
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	parts := assembleContext(diffItems(diff), min(promptBudget(api), maxDiffTokens), tokenizerFor(api))
+	reportAssembly(config.Settings, parts)
+	req := Request{System: reviewPrompt, Prompt: "Review this diff:\n\n" + joinParts(parts, "\n"), Schema: reviewSchema}
+	if err := applyProjectContext(config.Settings, &req); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	entry := newHistoryEntry(apiName, api, req)
+	resp, err := sendRequest(api, req)
+	entry.addResponse(resp)
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	reportCost(config.Settings, parsed.has("cost"), api, resp)
+
+	var result reviewResult
+	if err := json.Unmarshal([]byte(resp.Text), &result); err != nil {
+		fmt.Println("Error: unreadable review:", err)
+		os.Exit(1)
+	}
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		a, b := result.Findings[i], result.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		return a.Line < b.Line
+	})
+
+	if parsed.has("json") {
+		if result.Findings == nil {
+			result.Findings = []reviewFinding{}
+		}
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printReview(result, term.IsTerminal(int(os.Stdout.Fd())))
+	}
+
+	if failOn != "" {
+		for _, f := range result.Findings {
+			if r := severityRank(f.Severity); r >= 0 && r <= severityRank(failOn) {
+				os.Exit(2)
+			}
+		}
+	}
+}
+
+// prDiff fetches a pull request's diff with the GitHub CLI.
+func prDiff(number string) (string, error) {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return "", fmt.Errorf("--pr needs the GitHub CLI (gh)")
+	}
+	cmd := exec.Command("gh", "pr", "diff", number, "--color", "never")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("gh pr diff: %s", msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+func severityRank(severity string) int {
+	for i, s := range reviewSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// printReview prints the summary and the findings under their files.
+func printReview(result reviewResult, color bool) {
+	colors := map[string]string{"critical": "\x1b[1;31m", "major": "\x1b[31m", "minor": "\x1b[33m", "nit": styleDim}
+	fmt.Println(strings.TrimSpace(result.Summary))
+	file := ""
+	for _, f := range result.Findings {
+		if f.File != file {
+			file = f.File
+			heading := file
+			if color {
+				heading = styleBold + heading + styleReset
+			}
+			fmt.Printf("\n%s\n", heading)
+		}
+		severity := "[" + f.Severity + "]"
+		if color {
+			severity = colors[f.Severity] + severity + styleReset
+		}
+		where := ""
+		if f.Line > 0 {
+			where = fmt.Sprintf("line %d: ", f.Line)
+		}
+		fmt.Printf("  %s %s%s\n", severity, where, f.Message)
+		if f.Suggestion != "" {
+			fmt.Printf("    → %s\n", f.Suggestion)
+		}
+	}
+	if len(result.Findings) == 0 {
+		fmt.Println("\nNo findings.")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxDiffTokens caps how much of a diff is sent, in estimated tokens, even
+// to models with room for more.
+const maxDiffTokens = 15000
+
+const conventionalCommitPrompt = `You write git commit messages in the Conventional Commits format. The first line is "type(scope): summary", where type is one of feat, fix, docs, style, refactor, perf, test, build, ci or chore, the scope is optional and the summary is imperative, lower case, without a trailing period and under 72 characters in all. Mark breaking changes with "!" after the scope. If the change needs explaining, add a blank line and a short body saying what changed and why, wrapped at 72 characters. Reply with only the message.`
+
+const plainCommitPrompt = `You write git commit messages. The first line is a capitalized, imperative summary without a trailing period, under 72 characters. If the change needs explaining, add a blank line and a short body saying what changed and why, wrapped at 72 characters. Reply with only the message.`
+
+// runCommit handles "ask commit [api] [--style conventional|plain] [--scope
+// name | --no-scope] [--yes] [--cost]": it writes a message for the staged
+// changes, lets it be edited or regenerated and commits with it.
+func runCommit(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"style": true, "scope": true, "no-scope": false, "yes": false, "cost": false})
+	if err != nil || len(parsed.positional) > 1 {
+		fmt.Println("Usage: ask commit [api-name] [--style conventional|plain] [--scope name | --no-scope] [--yes] [--cost]")
+		os.Exit(1)
+	}
+	style := parsed.value("style", "conventional")
+	if style != "conventional" && style != "plain" {
+		fmt.Println("Error: --style must be conventional or plain")
+		os.Exit(1)
+	}
+	if !parsed.has("yes") && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Error: ask commit asks before committing; run it in a terminal or pass --yes")
+		os.Exit(1)
+	}
+
+	diff, err := git("diff", "--cached", "--no-color")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if strings.TrimSpace(diff) == "" {
+		fmt.Println("Nothing is staged. Stage changes with git add first.")
+		os.Exit(1)
+	}
+	stat, _ := git("diff", "--cached", "--stat", "--no-color")
+	names, _ := git("diff", "--cached", "--name-only")
+
+	var b strings.Builder
+	if style == "conventional" && !parsed.has("no-scope") {
+		if scope := parsed.value("scope", inferScope(strings.Fields(names))); scope != "" {
+			fmt.Fprintf(&b, "Use the scope %q.\n\n", scope)
+		}
+	} else if style == "conventional" {
+		b.WriteString("Leave out the scope.\n\n")
+	}
+	apiName, api := selectAPI(config, strings.Join(parsed.positional, ""))
+	tok := tokenizerFor(api)
+	parts := assembleContext(diffItems(diff), min(promptBudget(api)-tok.Count(stat), maxDiffTokens), tok)
+	reportAssembly(config.Settings, parts)
+	fmt.Fprintf(&b, "Files changed:\n%s\nStaged diff:\n%s", stat, joinParts(parts, "\n"))
+
+	req := Request{System: conventionalCommitPrompt, Prompt: b.String()}
+	if style == "plain" {
+		req.System = plainCommitPrompt
+	}
+
+	message := ""
+	for {
+		if message == "" {
+			entry := newHistoryEntry(apiName, api, req)
+			resp, err := sendRequest(api, req)
+			entry.addResponse(resp)
+			saveHistory(config.Settings, entry, err)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			reportCost(config.Settings, parsed.has("cost"), api, resp)
+			message = cleanCommitMessage(resp.Text)
+		}
+		if parsed.has("yes") {
+			break
+		}
+
+		fmt.Printf("\n%s\n\n", message)
+		fmt.Print("Commit with this message? [y]es, [e]dit, [r]egenerate, [n]o: ")
+		answer, _ := readLine()
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+		case "e", "edit":
+			lines, err := editLines("COMMIT_EDITMSG", strings.Split(message, "\n"))
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			if edited := strings.TrimSpace(strings.Join(lines, "\n")); edited != "" {
+				message = edited
+			}
+			continue
+		case "r", "regenerate":
+			// The cache would hand back the same message.
+			noCache = true
+			message = ""
+			continue
+		default:
+			fmt.Println("Not committed.")
+			return
+		}
+		break
+	}
+
+	cmd := exec.Command("git", "commit", "-m", message)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// git runs a git command and returns its output, or its error output as the
+// error.
+func git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// inferScope picks a Conventional Commits scope from the changed files: the
+// last part of the directory they all share, or the name of a lone file at
+// the top. Changes spread over the tree get none.
+func inferScope(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	dir := path.Dir(files[0])
+	for _, f := range files[1:] {
+		for dir != "." && !strings.HasPrefix(f, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	if dir != "." {
+		return path.Base(dir)
+	}
+	if len(files) == 1 {
+		return strings.TrimSuffix(path.Base(files[0]), path.Ext(files[0]))
+	}
+	return ""
+}
+
+// cleanCommitMessage strips what models wrap messages in: a code fence,
+// quotes or a "Commit message:" label.
+func cleanCommitMessage(text string) string {
+	if blocks := extractCodeBlocks(text); len(blocks) > 0 && strings.HasPrefix(strings.TrimSpace(text), "```") {
+		text = blocks[0].Code
+	}
+	text = strings.TrimSpace(text)
+	if label, rest, ok := strings.Cut(text, ":"); ok && strings.EqualFold(strings.TrimSpace(label), "commit message") {
+		text = strings.TrimSpace(rest)
+	}
+	if len(text) > 1 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0] {
+		text = text[1 : len(text)-1]
+	}
+	return strings.TrimSpace(text)
+}
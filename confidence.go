@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// confidencePrompt asks the model to annotate its claims with how sure it is.
+const confidencePrompt = `After each factual claim in your answer, add your confidence in it in square brackets, as a level and a probability, e.g. [confidence: high, ~95%] or [confidence: low, ~40%]. Be calibrated: of the claims you mark ~70%, about 70% should turn out true. Don't inflate confidence to sound authoritative. For anything below ~60%, briefly say what would settle it.`
+
+// confidenceNote matches the annotations confidencePrompt asks for.
+var confidenceNote = regexp.MustCompile(`(?i)\[confidence:\s*([A-Za-z -]*?)\s*(?:,\s*~?\s*(\d+(?:\.\d+)?)\s*%)?\s*\]`)
+
+// answerConfidence is what --confidence adds to --output json.
+type answerConfidence struct {
+	// Claims are the answer's annotations, in order.
+	Claims []confidenceClaim `json:"claims"`
+	// Uncertain holds the runs of tokens below lowConfidence, and Tokens
+	// every token's logprob, for providers that report them.
+	Uncertain []string       `json:"uncertain,omitempty"`
+	Tokens    []TokenLogprob `json:"tokens,omitempty"`
+}
+
+// confidenceClaim is one annotated claim. Probability is from 0 to 1, or
+// nil when the model gave only a level.
+type confidenceClaim struct {
+	Claim       string   `json:"claim"`
+	Level       string   `json:"level"`
+	Probability *float64 `json:"probability"`
+}
+
+// parseConfidence collects the annotations in text and, if the tokens spell
+// it out, the uncertain spans.
+func parseConfidence(text string, tokens []TokenLogprob) *answerConfidence {
+	c := &answerConfidence{Claims: []confidenceClaim{}}
+	prev := 0
+	for _, m := range confidenceNote.FindAllStringSubmatchIndex(text, -1) {
+		claim := confidenceClaim{Claim: lastSentence(text[prev:m[0]]), Level: strings.ToLower(text[m[2]:m[3]])}
+		if m[4] >= 0 {
+			if p, err := strconv.ParseFloat(text[m[4]:m[5]], 64); err == nil {
+				p /= 100
+				claim.Probability = &p
+			}
+		}
+		c.Claims = append(c.Claims, claim)
+		prev = m[1]
+	}
+
+	var joined strings.Builder
+	for _, t := range tokens {
+		joined.WriteString(t.Token)
+	}
+	if len(tokens) == 0 || joined.String() != text {
+		return c
+	}
+	c.Tokens = tokens
+	var span strings.Builder
+	for _, t := range append(tokens, TokenLogprob{}) {
+		if math.Exp(t.Logprob) < lowConfidence {
+			span.WriteString(t.Token)
+			continue
+		}
+		if s := strings.TrimSpace(span.String()); s != "" {
+			c.Uncertain = append(c.Uncertain, s)
+		}
+		span.Reset()
+	}
+	return c
+}
+
+// lastSentence is the sentence text ends with, which an annotation follows.
+func lastSentence(text string) string {
+	text = strings.TrimSpace(text)
+	start := strings.LastIndexByte(text, '\n') + 1
+	for _, end := range []string{". ", "! ", "? "} {
+		if i := strings.LastIndex(text, end); i >= 0 {
+			start = max(start, i+len(end))
+		}
+	}
+	return strings.TrimSpace(strings.TrimLeft(text[start:], "-*#> "))
+}
+
+// lowConfidence is the token probability below which a span is flagged as
+// uncertain when logprobs are available.
+const lowConfidence = 0.5
+
+// Escape sequences used to flag low-certainty spans: yellow, underlined.
+const (
+	uncertainStart = "\x1b[4;33m"
+	uncertainEnd   = "\x1b[0m"
+)
+
+// TokenLogprob is a generated token and the log probability the model gave it.
+type TokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+}
+
+// openAILogprobs reads the per-token logprobs from a chat completion choice.
+func openAILogprobs(choice map[string]interface{}) []TokenLogprob {
+	logprobs, _ := choice["logprobs"].(map[string]interface{})
+	content, _ := logprobs["content"].([]interface{})
+
+	var tokens []TokenLogprob
+	for _, c := range content {
+		entry, _ := c.(map[string]interface{})
+		token, _ := entry["token"].(string)
+		lp, _ := entry["logprob"].(float64)
+		tokens = append(tokens, TokenLogprob{Token: token, Logprob: lp})
+	}
+	return tokens
+}
+
+// highlightUncertain marks the runs of low-probability tokens in text. The
+// text is returned unchanged if the tokens don't spell it out exactly.
+func highlightUncertain(text string, tokens []TokenLogprob) string {
+	var joined strings.Builder
+	for _, t := range tokens {
+		joined.WriteString(t.Token)
+	}
+	if len(tokens) == 0 || joined.String() != text {
+		return text
+	}
+
+	var sb strings.Builder
+	inSpan := false
+	for _, t := range tokens {
+		low := math.Exp(t.Logprob) < lowConfidence
+		if low && !inSpan {
+			// Leading whitespace stays outside the highlight.
+			trimmed := strings.TrimLeft(t.Token, " \n\t")
+			sb.WriteString(t.Token[:len(t.Token)-len(trimmed)])
+			sb.WriteString(uncertainStart)
+			sb.WriteString(trimmed)
+			inSpan = true
+			continue
+		}
+		if !low && inSpan {
+			sb.WriteString(uncertainEnd)
+			inSpan = false
+		}
+		sb.WriteString(t.Token)
+	}
+	if inSpan {
+		sb.WriteString(uncertainEnd)
+	}
+	return sb.String()
+}
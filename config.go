@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxConfigBackups is how many timestamped config backups are kept around.
+const maxConfigBackups = 10
+
+func runConfigCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: ask config repair")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "repair":
+		repairConfig()
+	default:
+		fmt.Printf("Unknown config command: %s\n", args[0])
+		if hint := didYouMean(args[0], []string{"repair"}); hint != "" {
+			fmt.Println(hint)
+		}
+		os.Exit(1)
+	}
+}
+
+// describeJSONError turns a decoding error into a message with the line and
+// column of the offending byte, when the error carries an offset.
+func describeJSONError(data []byte, err error) string {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	if offset < 0 {
+		return err.Error()
+	}
+
+	line, col := lineColumn(data, offset)
+	return fmt.Sprintf("line %d, column %d: %v", line, col, err)
+}
+
+// lineColumn converts a byte offset into a 1-based line and column.
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// backupConfig copies the current config file to a timestamped backup next
+// to it before it gets rewritten, pruning the oldest backups.
+func backupConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bak", configPath, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backupPath, data, 0600); err != nil {
+		return err
+	}
+
+	backups, _ := filepath.Glob(configPath + ".*.bak")
+	sort.Strings(backups)
+	for len(backups) > maxConfigBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// repairConfig rewrites the config file keeping every API entry that can
+// still be decoded. Entries after a syntax error are lost, since there is no
+// reliable way to resynchronise the JSON stream past it.
+func repairConfig() {
+	configPath := getConfigPath()
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		fmt.Printf("Error reading config %s: %v\n", configPath, err)
+		os.Exit(1)
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err == nil {
+		fmt.Println("Config is valid, nothing to repair.")
+		return
+	}
+
+	config, dropped, parseErr := salvageConfig(data)
+	if err := saveConfig(config); err != nil {
+		fmt.Println("Error saving repaired config:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Recovered %d API(s).\n", len(config.APIs))
+	for _, name := range dropped {
+		fmt.Printf("  dropped %s\n", name)
+	}
+	if parseErr != nil {
+		fmt.Printf("Stopped at %s\n", describeJSONError(data, parseErr))
+	}
+	fmt.Println("The original file was backed up next to the config.")
+}
+
+// salvageConfig decodes as much of a damaged config as possible. It returns
+// the recovered config, the names of entries that were present but invalid,
+// and the error that stopped decoding, if any.
+func salvageConfig(data []byte) (*Config, []string, error) {
+	config := &Config{APIs: make(map[string]APIConfig)}
+	var dropped []string
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := expectDelim(dec, '{'); err != nil {
+		return config, nil, err
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return config, dropped, err
+		}
+		if key != "apis" {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return config, dropped, err
+			}
+			// Keep other top-level settings if they still decode on their own.
+			name, _ := json.Marshal(key)
+			json.Unmarshal([]byte("{"+string(name)+":"+string(raw)+"}"), config)
+			continue
+		}
+
+		if err := expectDelim(dec, '{'); err != nil {
+			return config, dropped, err
+		}
+		for dec.More() {
+			nameTok, err := dec.Token()
+			if err != nil {
+				return config, dropped, err
+			}
+			name, _ := nameTok.(string)
+
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return config, append(dropped, name), err
+			}
+			var api APIConfig
+			if err := json.Unmarshal(raw, &api); err != nil || api.Provider == "" {
+				dropped = append(dropped, name)
+				continue
+			}
+			config.APIs[name] = api
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return config, dropped, err
+		}
+	}
+
+	return config, dropped, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, found %v", want, tok)
+	}
+	return nil
+}
+
+// mergeIncludes loads every file listed in config.Include (and, recursively,
+// their own includes) into config: APIs, tools, settings and the default.
+// Includes are applied in the order listed, glob matches in lexical order,
+// and later files override earlier ones, setting by setting; the main file
+// always has the final say.
+func mergeIncludes(config *Config, dir string) error {
+	if len(config.Include) == 0 {
+		return nil
+	}
+
+	merged := &Config{
+		APIs:             make(map[string]APIConfig),
+		Tools:            make(map[string]ToolConfig),
+		sources:          make(map[string]string),
+		toolSources:      make(map[string]string),
+		includedSettings: make(map[string]json.RawMessage),
+	}
+	seen := map[string]bool{filepath.Join(dir, "config.json"): true}
+	if err := loadIncludes(merged, config.Include, dir, seen); err != nil {
+		return err
+	}
+
+	for name, api := range config.APIs {
+		merged.APIs[name] = api
+		delete(merged.sources, name)
+	}
+	for name, tool := range config.Tools {
+		merged.Tools[name] = tool
+		delete(merged.toolSources, name)
+	}
+	config.APIs = merged.APIs
+	config.Tools = merged.Tools
+	config.sources = merged.sources
+	config.toolSources = merged.toolSources
+
+	config.includedSettings, config.includedDefault = merged.includedSettings, merged.includedDefault
+	config.ownSettings, config.ownDefault = settingsMap(config.Settings), config.Default
+	settings := make(map[string]json.RawMessage)
+	for key, value := range config.includedSettings {
+		settings[key] = value
+	}
+	for key, value := range config.ownSettings {
+		settings[key] = value
+	}
+	data, _ := json.Marshal(settings)
+	config.Settings = Settings{}
+	if err := json.Unmarshal(data, &config.Settings); err != nil {
+		return fmt.Errorf("included settings: %v", err)
+	}
+	if config.Default == "" {
+		config.Default = config.includedDefault
+	}
+	return nil
+}
+
+// settingsMap returns the settings s sets, keyed as in the config file.
+func settingsMap(s Settings) map[string]json.RawMessage {
+	data, _ := json.Marshal(s)
+	m := make(map[string]json.RawMessage)
+	json.Unmarshal(data, &m)
+	return m
+}
+
+func loadIncludes(dst *Config, patterns []string, dir string, seen map[string]bool) error {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "~/") {
+			home, _ := os.UserHomeDir()
+			pattern = filepath.Join(home, pattern[2:])
+		} else if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("bad include pattern %q: %v", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("included config %s not found", pattern)
+		}
+		sort.Strings(matches)
+
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			included := &Config{}
+			if err := json.Unmarshal(data, included); err != nil {
+				return fmt.Errorf("included config %s is invalid: %s", path, describeJSONError(data, err))
+			}
+
+			if err := loadIncludes(dst, included.Include, filepath.Dir(path), seen); err != nil {
+				return err
+			}
+			mergeConfig(dst, included, path)
+		}
+	}
+	return nil
+}
+
+// mergeConfig copies every entry of src into dst, recording source as the
+// file each one came from, and the settings and default it sets.
+func mergeConfig(dst, src *Config, source string) {
+	for key, value := range settingsMap(src.Settings) {
+		dst.includedSettings[key] = value
+	}
+	if src.Default != "" {
+		dst.includedDefault = src.Default
+	}
+	for name, api := range src.APIs {
+		dst.APIs[name] = api
+		dst.sources[name] = source
+	}
+	for name, tool := range src.Tools {
+		dst.Tools[name] = tool
+		dst.toolSources[name] = source
+	}
+}
+
+// mainConfig returns the part of config that belongs in the main config
+// file, leaving out entries, settings and the default merged in from
+// includes, unless they've since been changed.
+func mainConfig(config *Config) *Config {
+	if len(config.sources) == 0 && len(config.toolSources) == 0 && len(config.includedSettings) == 0 && config.includedDefault == "" {
+		return config
+	}
+
+	out := *config
+	if config.includedDefault != "" && config.Default == config.includedDefault && config.ownDefault == "" {
+		out.Default = ""
+	}
+	if len(config.includedSettings) > 0 {
+		settings := settingsMap(config.Settings)
+		for key, value := range config.includedSettings {
+			if _, own := config.ownSettings[key]; !own && bytes.Equal(settings[key], value) {
+				delete(settings, key)
+			}
+		}
+		data, _ := json.Marshal(settings)
+		out.Settings = Settings{}
+		json.Unmarshal(data, &out.Settings)
+	}
+	out.APIs = make(map[string]APIConfig)
+	for name, api := range config.APIs {
+		if _, included := config.sources[name]; !included {
+			out.APIs[name] = api
+		}
+	}
+	out.Tools = nil
+	for name, tool := range config.Tools {
+		if _, included := config.toolSources[name]; !included {
+			if out.Tools == nil {
+				out.Tools = make(map[string]ToolConfig)
+			}
+			out.Tools[name] = tool
+		}
+	}
+	return &out
+}
+
+// envRef matches ${VAR} and ${VAR:-default} references in config values.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} references in value with the environment
+// variable's value, falling back to the ${VAR:-default} default when unset.
+func expandEnv(value string) (string, error) {
+	var missing string
+	expanded := envRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok && v != "" {
+			return v
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		if missing == "" {
+			missing = m[1]
+		}
+		return ""
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return expanded, nil
+}
+
+// expandAPIConfig returns a copy of api with environment references in its
+// key, base URL and models resolved. Expansion happens at use time so the
+// stored config keeps the references.
+func expandAPIConfig(api APIConfig) (APIConfig, error) {
+	var err error
+	if len(api.APIKeys) > 0 {
+		key, _ := pickKey(api)
+		api = withKey(api, key)
+	}
+	if api.APIKey, err = expandEnv(api.APIKey); err != nil {
+		return api, fmt.Errorf("api_key: %v", err)
+	}
+	if api.BaseURL, err = expandEnv(api.BaseURL); err != nil {
+		return api, fmt.Errorf("base_url: %v", err)
+	}
+	if api.Model, err = expandEnv(api.Model); err != nil {
+		return api, fmt.Errorf("model: %v", err)
+	}
+	if api.EmbedModel, err = expandEnv(api.EmbedModel); err != nil {
+		return api, fmt.Errorf("embed_model: %v", err)
+	}
+	if api.RerankModel, err = expandEnv(api.RerankModel); err != nil {
+		return api, fmt.Errorf("rerank_model: %v", err)
+	}
+	return api, nil
+}
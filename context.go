@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// contextFile is the per-directory context profile ask looks for.
+const contextFile = ".ask.toml"
+
+// defaultContextBudget is the context token budget when .ask.toml sets none.
+const defaultContextBudget = 4000
+
+// ProjectContext is the standing context a .ask.toml declares for prompts
+// run in its directory and below.
+type ProjectContext struct {
+	Path        string
+	Summary     string
+	Conventions string
+	Files       []string
+	// Budget caps the estimated tokens of the assembled context.
+	Budget int
+	// Roots are the workspace's other directories, sorted by name.
+	Roots []workspaceRoot
+	// Glossary is the house terminology, if the file names one.
+	Glossary *Glossary
+}
+
+// estimateTokens is a rough token count, about four characters per token.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// findProjectContext looks for .ask.toml in dir and its parents. It returns
+// nil when there is none.
+func findProjectContext(dir string) (*ProjectContext, error) {
+	for {
+		path := filepath.Join(dir, contextFile)
+		if data, err := os.ReadFile(path); err == nil {
+			return parseProjectContext(path, string(data))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func parseProjectContext(path, data string) (*ProjectContext, error) {
+	values, err := parseTOML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	pc := &ProjectContext{Path: path, Budget: defaultContextBudget}
+	roots := map[string]*workspaceRoot{}
+	for key, v := range values {
+		var ok bool
+		switch key {
+		case "summary":
+			pc.Summary, ok = v.(string)
+		case "conventions":
+			pc.Conventions, ok = v.(string)
+		case "files":
+			pc.Files, ok = v.([]string)
+		case "budget":
+			var n int64
+			n, ok = v.(int64)
+			ok = ok && n > 0
+			pc.Budget = int(n)
+		case "glossary":
+			var p string
+			if p, ok = v.(string); ok && p != "" {
+				if pc.Glossary, err = loadGlossary(glossaryPath(path, p)); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if rest, isRoot := strings.CutPrefix(key, "roots."); isRoot {
+				ok = parseRoot(roots, rest, v)
+				break
+			}
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid value for %s", path, key)
+		}
+	}
+
+	for _, r := range roots {
+		if r.Path == "" {
+			return nil, fmt.Errorf("%s: root %s has no path", path, r.Name)
+		}
+		if !filepath.IsAbs(r.Path) {
+			r.Path = filepath.Join(filepath.Dir(path), r.Path)
+		}
+		pc.Roots = append(pc.Roots, *r)
+	}
+	sort.Slice(pc.Roots, func(i, j int) bool { return pc.Roots[i].Name < pc.Roots[j].Name })
+	return pc, nil
+}
+
+// contextPart is one piece of the assembled context.
+type contextPart struct {
+	Label  string
+	Text   string
+	Tokens int
+	// Truncated is set when the part was cut to fit the budget, Dropped
+	// when nothing of it fit. Omitted is how many tokens were left out.
+	Truncated, Dropped bool
+	Omitted            int
+}
+
+// parts assembles the context in order: the glossary, summary,
+// conventions, then the key files. Whatever goes past the budget is cut,
+// except the glossary.
+func (pc *ProjectContext) parts() []contextPart {
+	var items []contextItem
+	if pc.Glossary != nil {
+		items = append(items, contextItem{Label: "Terminology", Text: pc.Glossary.prompt(""), Tier: tierSystem, Cut: cutNone})
+	}
+	if pc.Summary != "" {
+		items = append(items, contextItem{Label: "Project summary", Text: strings.TrimSpace(pc.Summary), Tier: tierMemory, Cut: cutEnd})
+	}
+	if pc.Conventions != "" {
+		items = append(items, contextItem{Label: "Coding conventions", Text: strings.TrimSpace(pc.Conventions), Tier: tierMemory, Cut: cutEnd})
+	}
+
+	root := filepath.Dir(pc.Path)
+	for _, pattern := range pc.Files {
+		matches, _ := filepath.Glob(filepath.Join(root, pattern))
+		if len(matches) == 0 {
+			items = append(items, contextItem{Label: pattern, Text: "(not found)", Tier: tierFiles, Cut: cutEnd})
+		}
+		for _, path := range matches {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			rel, _ := filepath.Rel(root, path)
+			items = append(items, contextItem{Label: "File " + rel, Text: string(data), Tier: tierFiles, Cut: cutEnd})
+		}
+	}
+	return assembleContext(items, pc.Budget, estimator{})
+}
+
+// prompt renders the context as a system prompt.
+func (pc *ProjectContext) prompt() string {
+	var b strings.Builder
+	b.WriteString("Context for the project the user is working in:")
+	for _, p := range pc.parts() {
+		if p.Dropped {
+			fmt.Fprintf(&b, "\n\n## %s\n\n%s", p.Label, omittedPart(p))
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n## %s\n\n%s", p.Label, p.Text)
+	}
+	return b.String()
+}
+
+// applyProjectContext adds the .ask.toml context for the working directory,
+// if any, to req's system prompt, and says what didn't fit its budget.
+func applyProjectContext(settings Settings, req *Request) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	pc, err := findProjectContext(dir)
+	if err != nil || pc == nil {
+		return err
+	}
+	reportAssembly(settings, pc.parts())
+	req.System = strings.TrimSpace(pc.prompt() + "\n\n" + req.System)
+	return nil
+}
+
+// runContextCommand handles "ask context show".
+func runContextCommand(args []string) {
+	if len(args) < 1 || args[0] != "show" {
+		fmt.Println("Usage: ask context show")
+		os.Exit(1)
+	}
+
+	dir, _ := os.Getwd()
+	pc, err := findProjectContext(dir)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if pc == nil {
+		fmt.Printf("No %s found in this directory or its parents.\n", contextFile)
+		return
+	}
+
+	total := 0
+	fmt.Printf("From %s (budget %d tokens):\n\n", pc.Path, pc.Budget)
+	for _, p := range pc.parts() {
+		note := ""
+		if p.Truncated {
+			note = fmt.Sprintf(", truncated: %s tokens omitted", formatTokens(p.Omitted))
+		} else if p.Dropped {
+			note = fmt.Sprintf(", dropped: %s tokens over budget", formatTokens(p.Omitted))
+		}
+		fmt.Printf("  %-40s ~%d tokens%s\n", p.Label, p.Tokens, note)
+		total += p.Tokens
+	}
+	if len(pc.Roots) > 0 {
+		fmt.Println("\nWorkspace roots:")
+		for _, r := range pc.Roots {
+			rules := ""
+			if len(r.Include) > 0 {
+				rules += " include " + strings.Join(r.Include, ", ")
+			}
+			if len(r.Exclude) > 0 {
+				rules += " exclude " + strings.Join(r.Exclude, ", ")
+			}
+			fmt.Printf("  %-16s %s%s\n", r.Name, r.Path, rules)
+		}
+	}
+	fmt.Printf("\n~%d tokens are sent with every prompt run here:\n\n%s\n", total, pc.prompt())
+}
+
+// parseTOML reads the subset of TOML .ask.toml needs: key = value pairs
+// with string (basic, literal and multi-line), integer, boolean and
+// string-array values. [table] headers prefix the keys that follow with
+// "table.".
+func parseTOML(data string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	prefix := ""
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty table name", i+1)
+			}
+			prefix = name + "."
+			continue
+		}
+
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		rest = strings.TrimSpace(rest)
+
+		start := i
+		// Multi-line strings and arrays continue on the following lines.
+		for _, delim := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(rest, delim) && !strings.Contains(rest[3:], delim) {
+				for i++; i < len(lines); i++ {
+					rest += "\n" + lines[i]
+					if strings.Contains(lines[i], delim) {
+						break
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(rest, "[") {
+			last := rest
+			for !strings.HasSuffix(strings.TrimSpace(stripTOMLComment(last)), "]") && i+1 < len(lines) {
+				i++
+				last = lines[i]
+				rest += "\n" + last
+			}
+		}
+
+		v, err := parseTOMLValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", start+1, err)
+		}
+		values[prefix+key] = v
+	}
+	return values, nil
+}
+
+// stripTOMLComment drops a trailing # comment outside of strings.
+func stripTOMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func parseTOMLValue(s string) (interface{}, error) {
+	for _, delim := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(s, delim) {
+			end := strings.Index(s[3:], delim)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			body := strings.TrimPrefix(s[3:3+end], "\n")
+			if delim == `"""` {
+				return unescapeTOML(body)
+			}
+			return body, nil
+		}
+	}
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = stripTOMLComment(line)
+	}
+	s = strings.TrimSpace(strings.Join(lines, "\n"))
+	switch {
+	case s == "true" || s == "false":
+		return s == "true", nil
+	case strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) && len(s) >= 2:
+		return unescapeTOML(s[1 : len(s)-1])
+	case strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") && len(s) >= 2:
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		var list []string
+		for _, item := range splitTOMLArray(s[1 : len(s)-1]) {
+			v, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			str, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("only arrays of strings are supported")
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 10, 64); err == nil {
+		return n, nil
+	}
+	return nil, fmt.Errorf("unsupported value %q", s)
+}
+
+// splitTOMLArray splits the inside of an array at commas outside strings,
+// dropping comments and empty items.
+func splitTOMLArray(s string) []string {
+	var items []string
+	for _, line := range strings.Split(s, "\n") {
+		line = stripTOMLComment(line)
+		var quote byte
+		start := 0
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case quote != 0:
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == ',':
+				items = append(items, line[start:i])
+				start = i + 1
+			}
+		}
+		items = append(items, line[start:])
+	}
+
+	var out []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func unescapeTOML(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	v, err := strconv.Unquote(`"` + strings.ReplaceAll(s, "\n", `\n`) + `"`)
+	if err != nil {
+		return "", fmt.Errorf("invalid escape in string")
+	}
+	return v, nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// crawlUserAgent identifies ask to the sites it fetches; robots.txt groups
+// for "ask" apply to it, as do those for "*".
+const crawlUserAgent = "ask/1.0 (command-line LLM client; fetches pages its user names)"
+
+const (
+	// defaultCrawlDepth and defaultMaxPages bound --crawl when --depth and
+	// --max-pages aren't given.
+	defaultCrawlDepth = 2
+	defaultMaxPages   = 20
+	// minCrawlDelay is the least time between two requests to a host,
+	// longer when its robots.txt asks for it.
+	minCrawlDelay = time.Second
+	// webCacheTTL is how long fetched pages are reused.
+	webCacheTTL = time.Hour
+	// maxPageSize caps how much of a page is read.
+	maxPageSize = 5 << 20
+	// renderTimeout bounds loading a page in a headless browser.
+	renderTimeout = time.Minute
+)
+
+// browserCommands are the headless browsers --extract browser looks for,
+// in order.
+var browserCommands = []string{
+	"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "microsoft-edge",
+	"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+	"/Applications/Chromium.app/Contents/MacOS/Chromium",
+}
+
+// webPage is a fetched page, as text.
+type webPage struct {
+	URL string
+	htmlPage
+}
+
+// cachedPage is a page in the web cache.
+type cachedPage struct {
+	Time        time.Time `json:"time"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Body        string    `json:"body"`
+}
+
+func getWebCacheDir() string {
+	return filepath.Join(stateDir(), "cache", "web")
+}
+
+// crawler fetches pages politely: one at a time, at most one request per
+// host per crawl delay, only where robots.txt allows when following links,
+// and from the cache when a page was fetched recently.
+type crawler struct {
+	// ctx is the context pages are fetched in.
+	ctx       context.Context
+	client    *http.Client
+	robots    map[string]*robotsRules
+	lastFetch map[string]time.Time
+	// extract is how pages become text; browser is the browser that
+	// renders them, for extractBrowser.
+	extract string
+	browser string
+}
+
+func newCrawler(ctx context.Context, extract string) (*crawler, error) {
+	c := &crawler{
+		ctx:       ctx,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		robots:    map[string]*robotsRules{},
+		lastFetch: map[string]time.Time{},
+		extract:   extract,
+	}
+	switch extract {
+	case extractReadability, extractText:
+	case extractBrowser:
+		for _, name := range browserCommands {
+			if path, err := exec.LookPath(name); err == nil {
+				c.browser = path
+				break
+			}
+		}
+		if c.browser == "" {
+			return nil, fmt.Errorf("--extract browser needs Chrome or Chromium installed (chromium, google-chrome)")
+		}
+	default:
+		return nil, fmt.Errorf("--extract must be readability, text or browser")
+	}
+	return c, nil
+}
+
+// crawl fetches the pages at starts and, up to depth links away, the pages
+// they link to on the same host under the same directory, breadth first,
+// until it has maxPages, and turns them into text as extract says. A start
+// page that can't be fetched is an error; other pages are skipped with a
+// note on stderr.
+func crawl(ctx context.Context, starts []string, depth, maxPages int, extract string) ([]webPage, error) {
+	c, err := newCrawler(ctx, extract)
+	if err != nil {
+		return nil, err
+	}
+	type queued struct {
+		url   *url.URL
+		depth int
+		scope *url.URL
+	}
+
+	var queue []queued
+	seen := map[string]bool{}
+	for _, s := range starts {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("--url: %q is not an http(s) URL", s)
+		}
+		u.Fragment = ""
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			queue = append(queue, queued{url: u, scope: u})
+		}
+	}
+	startCount := len(queue)
+
+	var pages []webPage
+	for i := 0; i < len(queue) && len(pages) < maxPages; i++ {
+		q := queue[i]
+		if i >= startCount {
+			writeProgress(fmt.Sprintf("Fetching %s (%d of at most %d pages)", q.url, len(pages)+1, maxPages))
+		}
+		page, err := c.page(q.url, i >= startCount)
+		if err != nil {
+			if i < startCount {
+				return nil, err
+			}
+			writeProgress(fmt.Sprintf("Skipped %s: %v", q.url, err))
+			continue
+		}
+		pages = append(pages, page)
+		if q.depth >= depth {
+			continue
+		}
+		for _, link := range page.Links {
+			u, err := url.Parse(link)
+			if err != nil || seen[u.String()] || !inCrawlScope(q.scope, u) {
+				continue
+			}
+			seen[u.String()] = true
+			queue = append(queue, queued{url: u, depth: q.depth + 1, scope: q.scope})
+		}
+	}
+	return pages, nil
+}
+
+// inCrawlScope reports whether u is on start's host, under the directory
+// start is in: from /docs/guide/intro, anything under /docs/guide/.
+func inCrawlScope(start, u *url.URL) bool {
+	if u.Host != start.Host || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	dir := start.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	return strings.HasPrefix(u.Path+"/", dir)
+}
+
+// page fetches u and turns it into text. HTML is converted, after
+// rendering it for extractBrowser; plain text and Markdown are taken as
+// they are. Pages the user named aren't held to robots.txt, any more than a
+// browser is; pages found by following links are.
+func (c *crawler) page(u *url.URL, checkRobots bool) (webPage, error) {
+	p, err := c.fetch(u, checkRobots, c.extract == extractBrowser)
+	if err != nil {
+		return webPage{}, err
+	}
+	if p.Status < 200 || p.Status > 299 {
+		return webPage{}, fmt.Errorf("fetching %s: status %d", u, p.Status)
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(p.ContentType, ";")[0]))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "" && strings.Contains(strings.ToLower(p.Body[:min(len(p.Body), 512)]), "<html"):
+		return webPage{URL: u.String(), htmlPage: parseHTML(p.Body, u, c.extract)}, nil
+	case strings.HasPrefix(mediaType, "text/"):
+		return webPage{URL: u.String(), htmlPage: htmlPage{Text: strings.TrimSpace(p.Body)}}, nil
+	}
+	return webPage{}, fmt.Errorf("%s is %s, not a web page", u, mediaType)
+}
+
+// fetch gets u from the cache or, waiting its turn and where robots.txt
+// allows, from its host, rendered in the browser when render is set.
+// --no-cache skips the cache.
+func (c *crawler) fetch(u *url.URL, checkRobots, render bool) (cachedPage, error) {
+	key := u.String()
+	if render {
+		key += " rendered"
+	}
+	sum := sha256.Sum256([]byte(key))
+	cachePath := filepath.Join(getWebCacheDir(), hex.EncodeToString(sum[:])+".json")
+	if !noCache {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var p cachedPage
+			if json.Unmarshal(data, &p) == nil && time.Since(p.Time) < webCacheTTL {
+				return p, nil
+			}
+		}
+	}
+
+	delay := minCrawlDelay
+	if checkRobots {
+		rules := c.robotsFor(u)
+		if !rules.allows(u) {
+			return cachedPage{}, fmt.Errorf("robots.txt on %s disallows %s", u.Host, u.Path)
+		}
+		delay = max(delay, rules.delay)
+	}
+	if last, ok := c.lastFetch[u.Host]; ok {
+		time.Sleep(time.Until(last.Add(delay)))
+	}
+	c.lastFetch[u.Host] = time.Now()
+
+	get := c.download
+	if render {
+		get = c.render
+	}
+	p, err := get(u)
+	if err != nil {
+		return cachedPage{}, err
+	}
+	if !noCache {
+		if data, err := json.Marshal(p); err == nil && os.MkdirAll(getWebCacheDir(), 0700) == nil {
+			os.WriteFile(cachePath, data, 0600)
+		}
+	}
+	return p, nil
+}
+
+// download gets u over HTTP.
+func (c *crawler) download(u *url.URL) (cachedPage, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", u.String(), nil)
+	if err != nil {
+		return cachedPage{}, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.1")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return cachedPage{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return cachedPage{}, err
+	}
+	return cachedPage{Time: time.Now(), Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: string(body)}, nil
+}
+
+// render loads u in the headless browser and returns the page as its
+// scripts left it, after up to ten seconds of (virtual) time.
+func (c *crawler) render(u *url.URL) (cachedPage, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, renderTimeout)
+	defer cancel()
+	args := []string{"--headless=new", "--disable-gpu", "--user-agent=" + crawlUserAgent, "--virtual-time-budget=10000", "--dump-dom", u.String()}
+	if os.Geteuid() == 0 {
+		// Chrome refuses to run as root with its sandbox, as in containers.
+		args = append([]string{"--no-sandbox"}, args...)
+	}
+	out, err := exec.CommandContext(ctx, c.browser, args...).Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+			return cachedPage{}, fmt.Errorf("rendering %s: %v: %s", u, err, strings.TrimSpace(string(exit.Stderr)))
+		}
+		return cachedPage{}, fmt.Errorf("rendering %s: %v", u, err)
+	}
+	if len(out) > maxPageSize {
+		out = out[:maxPageSize]
+	}
+	// The browser doesn't say how the page answered; what it shows is the
+	// page.
+	return cachedPage{Time: time.Now(), Status: http.StatusOK, ContentType: "text/html", Body: string(out)}, nil
+}
+
+// robotsRules are the rules of a robots.txt that apply to ask.
+type robotsRules struct {
+	allow, disallow []*regexp.Regexp
+	// patterns holds the rules' paths, for the longest match to win.
+	patterns map[*regexp.Regexp]string
+	delay    time.Duration
+}
+
+// robotsFor returns the robots.txt rules for u's host, fetching them the
+// first time. A site without a robots.txt, or whose robots.txt can't be
+// read, allows everything.
+func (c *crawler) robotsFor(u *url.URL) *robotsRules {
+	origin := u.Scheme + "://" + u.Host
+	if rules, ok := c.robots[origin]; ok {
+		return rules
+	}
+	rules := &robotsRules{}
+	robotsURL, _ := url.Parse(origin + "/robots.txt")
+	if p, err := c.fetch(robotsURL, false, false); err == nil && p.Status >= 200 && p.Status <= 299 {
+		rules = parseRobots(p.Body)
+	}
+	c.robots[origin] = rules
+	return rules
+}
+
+// parseRobots reads the group of a robots.txt for ask, or the one for all
+// agents when there's none for ask.
+func parseRobots(body string) *robotsRules {
+	groups := map[string]*robotsRules{}
+	var current []string
+	inAgents := false
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			agent := strings.ToLower(value)
+			if groups[agent] == nil {
+				groups[agent] = &robotsRules{patterns: map[*regexp.Regexp]string{}}
+			}
+			current = append(current, agent)
+			continue
+		}
+		inAgents = false
+		for _, agent := range current {
+			g := groups[agent]
+			switch key {
+			case "allow", "disallow":
+				if value == "" {
+					continue
+				}
+				re := robotsPattern(value)
+				g.patterns[re] = value
+				if key == "allow" {
+					g.allow = append(g.allow, re)
+				} else {
+					g.disallow = append(g.disallow, re)
+				}
+			case "crawl-delay":
+				var seconds float64
+				if _, err := fmt.Sscan(value, &seconds); err == nil && seconds > 0 {
+					g.delay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	if g := groups["ask"]; g != nil {
+		return g
+	}
+	if g := groups["*"]; g != nil {
+		return g
+	}
+	return &robotsRules{}
+}
+
+// robotsPattern compiles a robots.txt path, where "*" is any run of
+// characters and a final "$" anchors the end.
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	var b strings.Builder
+	b.WriteString("^")
+	for i, part := range strings.Split(p, "*") {
+		if i > 0 {
+			b.WriteString(".*")
+		}
+		b.WriteString(regexp.QuoteMeta(part))
+	}
+	if anchored {
+		b.WriteString("$")
+	}
+	return regexp.MustCompile(b.String())
+}
+
+// allows reports whether u may be fetched: the longest matching rule
+// decides, and Allow wins a tie.
+func (r *robotsRules) allows(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	longest := func(rules []*regexp.Regexp) int {
+		n := -1
+		for _, re := range rules {
+			if re.MatchString(target) {
+				n = max(n, len(r.patterns[re]))
+			}
+		}
+		return n
+	}
+	return longest(r.allow) >= longest(r.disallow)
+}
+
+// attachPages puts pages into req's prompt, numbered for citation, ahead
+// of what was asked, fitting them into what api can take; pages crawled
+// last are cut or left out first.
+func attachPages(settings Settings, api APIConfig, req *Request, pages []webPage) {
+	tok := tokenizerFor(api)
+	items := make([]contextItem, len(pages))
+	for i, p := range pages {
+		items[i] = contextItem{Label: p.URL, Text: p.Text, Tier: tierRetrieved, Cut: cutEnd}
+	}
+	parts := assembleContext(items, promptBudget(api)-tok.Count(req.System)-tok.Count(req.Prompt), tok)
+	reportAssembly(settings, parts)
+
+	var sb strings.Builder
+	sb.WriteString("Use the numbered web pages below. Cite the pages you rely on by number in square brackets, like [2], right after the statement they support.\n\n")
+	n := 0
+	for i, p := range parts {
+		if p.Dropped {
+			sb.WriteString(omittedPart(p) + "\n\n")
+			continue
+		}
+		n++
+		title := pages[i].Title
+		if title == "" {
+			title = pages[i].URL
+		}
+		fmt.Fprintf(&sb, "[%d] %s (%s)\n%s\n\n", n, title, pages[i].URL, p.Text)
+		req.Sources = append(req.Sources, Citation{Title: pages[i].Title, URL: pages[i].URL})
+	}
+	req.Prompt = sb.String() + req.Prompt
+}
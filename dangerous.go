@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dangerRule flags commands that destroy data or hand the machine to
+// someone else, with what they do in words.
+type dangerRule struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+var dangerRules = []dangerRule{
+	{regexp.MustCompile(`\brm\s+(\S+\s+)*(-[a-zA-Z]*[rRf]|--recursive|--force)`), "deletes files recursively or without asking"},
+	{regexp.MustCompile(`\bfind\b.*\s(-delete|-exec\s+rm)\b`), "deletes everything find matches"},
+	{regexp.MustCompile(`\bdd\b.*\bof=`), "overwrites a file or device with dd"},
+	{regexp.MustCompile(`\b(mkfs(\.\w+)?|mke2fs|wipefs|fdisk|parted|sgdisk)\b`), "formats or repartitions a disk"},
+	{regexp.MustCompile(`>\s*/dev/(sd|hd|nvme|vd|xvd|disk|mmcblk)`), "writes straight to a disk device"},
+	{regexp.MustCompile(`\b(curl|wget|fetch)\b[^|;&]*\|\s*(sudo\s+)?(\w*sh|python\d?|perl|ruby|node)\b`), "runs a script downloaded from the network"},
+	{regexp.MustCompile(`\bgit\s+push\b.*(\s(-f|--force|--force-with-lease|--mirror|--delete)\b|\s\+\S)`), "force-pushes or deletes remote branches"},
+	{regexp.MustCompile(`\bgit\s+(reset\s+--hard|clean\s+-[a-zA-Z]*f|checkout\s+--\s+\.|restore\s+\.)`), "throws away uncommitted work"},
+	{regexp.MustCompile(`\b(chmod|chown|chgrp)\s+(-\S+\s+)*-[a-zA-Z]*R`), "changes ownership or permissions recursively"},
+	{regexp.MustCompile(`\bchmod\s+(-\S+\s+)*0?777\b`), "makes files writable by everyone"},
+	{regexp.MustCompile(`\b(shutdown|reboot|halt|poweroff)\b`), "shuts down or restarts the machine"},
+	{regexp.MustCompile(`\bkill(all)?\s+(-\S+\s+)*-1\b|\bpkill\s+-9\b`), "kills processes wholesale"},
+	{regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`), "is a fork bomb"},
+	{regexp.MustCompile(`(?i)\b(drop\s+(table|database|schema)|truncate\s+table)\b`), "drops or empties database tables"},
+	{regexp.MustCompile(`\b(docker|podman)\s+(system\s+prune|volume\s+(rm|prune))\b`), "deletes containers' data"},
+	{regexp.MustCompile(`\bkubectl\s+delete\b`), "deletes Kubernetes resources"},
+	{regexp.MustCompile(`\bterraform\s+destroy\b`), "destroys infrastructure"},
+	{regexp.MustCompile(`>\s*~?/?\.(bashrc|zshrc|profile|bash_profile|ssh/authorized_keys)\b`), "overwrites a shell or ssh startup file"},
+}
+
+// dangerReasons returns what is destructive about command, if anything.
+func dangerReasons(command string) []string {
+	var reasons []string
+	for _, rule := range dangerRules {
+		if rule.re.MatchString(command) {
+			reasons = append(reasons, rule.reason)
+		}
+	}
+	return reasons
+}
+
+// confirmRun asks before running command: y/N, or, when it looks
+// destructive and allowDangerous isn't set, typing "run it" out in full.
+func confirmRun(command string, allowDangerous bool) bool {
+	reasons := dangerReasons(command)
+	if len(reasons) > 0 {
+		fmt.Printf("Warning: this command %s.\n", strings.Join(reasons, ", and "))
+	}
+	if len(reasons) > 0 && !allowDangerous {
+		fmt.Print("Type 'run it' to run it anyway: ")
+		answer, _ := readLine()
+		return answer == "run it"
+	}
+	fmt.Print("Run it? [y/N] ")
+	answer, _ := readLine()
+	a := strings.ToLower(answer)
+	return a == "y" || a == "yes"
+}
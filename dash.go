@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// dashViews are the dashboard's pages, in tab order.
+var dashViews = []string{"Spend", "Runs", "Providers"}
+
+// dashDay is one day of spend.
+type dashDay struct {
+	Date     time.Time
+	Cost     float64
+	Requests int
+	Unpriced int
+}
+
+// dashProvider sums one provider's runs, failures and cache hits.
+type dashProvider struct {
+	Name      string
+	Runs      int
+	Errors    int
+	Requests  int
+	CacheHits int
+}
+
+// dashData is what the dashboard shows, read once at start.
+type dashData struct {
+	days      []dashDay
+	runs      []HistoryEntry
+	providers []*dashProvider
+}
+
+// runDash handles "ask dash [--days N]": spend over time, recent runs,
+// and error and cache hit rates by provider, from the usage ledger and the
+// history. In a terminal it's interactive; otherwise every view is printed.
+func runDash(args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"days": true})
+	days := 14
+	if err == nil {
+		if v := parsed.value("days", ""); v != "" {
+			if days, err = strconv.Atoi(v); err == nil && days < 1 {
+				err = fmt.Errorf("--days must be 1 or more")
+			}
+		}
+	}
+	if err != nil || len(parsed.positional) > 0 {
+		fmt.Println("Usage: ask dash [--days N]")
+		os.Exit(1)
+	}
+	data, err := loadDash(days, time.Now())
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		for i, view := range dashViews {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Println(view)
+			for _, line := range data.view(i, -1, 100) {
+				fmt.Println(line)
+			}
+		}
+		return
+	}
+	data.interact()
+}
+
+// daysBetween counts the calendar days from from's date to to's, each in
+// its own location. Days are counted on dates rather than elapsed hours, so
+// a day made longer or shorter by a DST change still counts as one.
+func daysBetween(from, to time.Time) int {
+	fy, fm, fd := from.Date()
+	ty, tm, td := to.Date()
+	return int(time.Date(ty, tm, td, 0, 0, 0, 0, time.UTC).Sub(time.Date(fy, fm, fd, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+// loadDash reads the last days of the ledger and the history.
+func loadDash(days int, now time.Time) (*dashData, error) {
+	d := &dashData{}
+	y, m, day := now.Date()
+	start := time.Date(y, m, day-days+1, 0, 0, 0, 0, now.Location())
+	for i := 0; i < days; i++ {
+		d.days = append(d.days, dashDay{Date: start.AddDate(0, 0, i)})
+	}
+	providers := map[string]*dashProvider{}
+	provider := func(name string) *dashProvider {
+		if providers[name] == nil {
+			providers[name] = &dashProvider{Name: name}
+		}
+		return providers[name]
+	}
+
+	err := loadLedger(func(e LedgerEntry) {
+		if e.Time.Before(start) {
+			return
+		}
+		p := provider(e.Provider)
+		p.Requests++
+		if e.Cached {
+			p.CacheHits++
+			return
+		}
+		i := daysBetween(start, e.Time.In(now.Location()))
+		if i < 0 || i >= len(d.days) {
+			return
+		}
+		d.days[i].Requests++
+		if e.Cost != nil {
+			d.days[i].Cost += *e.Cost
+		} else {
+			d.days[i].Unpriced++
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading the usage ledger: %v", err)
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		return nil, fmt.Errorf("reading the history: %v", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Time.Before(start) {
+			break
+		}
+		d.runs = append(d.runs, e)
+		p := provider(e.Provider)
+		p.Runs++
+		// Ctrl-C isn't the provider's failure.
+		if e.Error != "" && e.Error != errInterrupted.Error() {
+			p.Errors++
+		}
+	}
+
+	for _, p := range providers {
+		d.providers = append(d.providers, p)
+	}
+	sort.Slice(d.providers, func(i, j int) bool {
+		if d.providers[i].Runs != d.providers[j].Runs {
+			return d.providers[i].Runs > d.providers[j].Runs
+		}
+		return d.providers[i].Name < d.providers[j].Name
+	})
+	return d, nil
+}
+
+// view renders page i, with run selected highlighted on the runs page, in
+// lines at most width wide.
+func (d *dashData) view(i, selected, width int) []string {
+	var lines []string
+	switch dashViews[i] {
+	case "Spend":
+		most, total := 0.0, 0.0
+		for _, day := range d.days {
+			most = max(most, day.Cost)
+			total += day.Cost
+		}
+		barWidth := max(width-34, 10)
+		for _, day := range d.days {
+			bar := 0
+			if most > 0 {
+				bar = int(day.Cost / most * float64(barWidth))
+			}
+			cost := formatDollars(day.Cost)
+			if day.Unpriced > 0 {
+				cost += "*"
+			}
+			lines = append(lines, fmt.Sprintf("%s  %9s  %4d  %s", day.Date.Format("Mon 01-02"), cost, day.Requests, strings.Repeat("█", bar)))
+		}
+		lines = append(lines, "", fmt.Sprintf("Total %s over %d days", formatDollars(total), len(d.days)))
+	case "Runs":
+		if len(d.runs) == 0 {
+			return []string{"No runs recorded."}
+		}
+		for n, e := range d.runs {
+			status := "ok "
+			if e.Error != "" {
+				status = "ERR"
+			}
+			line := fmt.Sprintf("%s  %s  %-14s  %s", e.Time.Local().Format("01-02 15:04"), status, clipRunes(e.label(), 14), e.summary())
+			line = clipRunes(line, width-2)
+			if n == selected {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			lines = append(lines, line)
+		}
+	case "Providers":
+		lines = append(lines, fmt.Sprintf("%-18s %6s %7s %9s %10s", "PROVIDER", "RUNS", "ERRORS", "ERR RATE", "CACHE HIT"))
+		for _, p := range d.providers {
+			lines = append(lines, fmt.Sprintf("%-18s %6d %7d %9s %10s", clipRunes(p.Name, 18), p.Runs, p.Errors, percent(p.Errors, p.Runs), percent(p.CacheHits, p.Requests)))
+		}
+		lines = append(lines, "", "Cache hits count only while the cache setting is on.")
+	}
+	return lines
+}
+
+// runDetail shows one run in full: its prompt, answer and error.
+func runDetail(e HistoryEntry, width int) []string {
+	lines := []string{fmt.Sprintf("%s  %s (%s %s)", e.Time.Local().Format("2006-01-02 15:04:05"), e.API, e.Provider, e.Model), ""}
+	for _, m := range e.Messages {
+		for _, p := range m.Parts {
+			if p.Type != "text" || strings.TrimSpace(p.Text) == "" {
+				continue
+			}
+			lines = append(lines, strings.ToUpper(m.Role)+":")
+			for _, line := range strings.Split(strings.TrimSpace(p.Text), "\n") {
+				lines = append(lines, clipRunes(line, width-2))
+			}
+			lines = append(lines, "")
+		}
+	}
+	if e.Error != "" {
+		lines = append(lines, "ERROR: "+e.Error)
+	}
+	return lines
+}
+
+// interact runs the dashboard until q: Tab or the arrows change pages, up
+// and down move through the runs, Enter opens one and Esc goes back.
+func (d *dashData) interact() {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, oldState)
+	}()
+
+	page, selected, scroll := 0, 0, 0
+	open := false
+	buf := make([]byte, 16)
+	for {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		var lines []string
+		if open {
+			lines = runDetail(d.runs[selected], width)
+		} else {
+			lines = d.view(page, selected, width)
+		}
+		d.draw(page, open, lines, scroll, width, height)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		key := string(buf[:n])
+		rows := height - 4
+		switch {
+		case key == "q" || key == "\x03" || key == "\x1b" && !open:
+			return
+		case key == "\x1b" || open && (key == "\x7f" || key == "\x1b[D"):
+			open, scroll = false, 0
+		case open && (key == "\x1b[B" || key == "j"):
+			scroll = min(scroll+1, max(len(lines)-rows, 0))
+		case open && (key == "\x1b[A" || key == "k"):
+			scroll = max(scroll-1, 0)
+		case open:
+		case key == "\t" || key == "\x1b[C" || key == "l":
+			page, scroll = (page+1)%len(dashViews), 0
+		case key == "\x1b[Z" || key == "\x1b[D" || key == "h":
+			page, scroll = (page+len(dashViews)-1)%len(dashViews), 0
+		case key >= "1" && key <= strconv.Itoa(len(dashViews)) && len(key) == 1:
+			page, scroll = int(key[0]-'1'), 0
+		case dashViews[page] == "Runs" && (key == "\x1b[B" || key == "j"):
+			selected = min(selected+1, max(len(d.runs)-1, 0))
+		case dashViews[page] == "Runs" && (key == "\x1b[A" || key == "k"):
+			selected = max(selected-1, 0)
+		case dashViews[page] == "Runs" && key == "\r" && len(d.runs) > 0:
+			open, scroll = true, 0
+		}
+		// Keep the selected run on screen.
+		if !open && dashViews[page] == "Runs" {
+			scroll = min(max(scroll, selected-rows+1), selected)
+		}
+	}
+}
+
+// draw paints the tab bar, lines from scroll on and the key help.
+func (d *dashData) draw(page int, open bool, lines []string, scroll, width, height int) {
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	for i, view := range dashViews {
+		label := fmt.Sprintf(" %d %s ", i+1, view)
+		if i == page {
+			label = "\x1b[1;7m" + label + "\x1b[0m"
+		}
+		sb.WriteString(label + " ")
+	}
+	sb.WriteString("\r\n\r\n")
+	rows := height - 4
+	for i := scroll; i < len(lines) && i < scroll+rows; i++ {
+		sb.WriteString(lines[i] + "\r\n")
+	}
+	help := "Tab/←→ page  ↑↓ move  Enter open run  q quit"
+	if open {
+		help = "↑↓ scroll  Esc back  q quit"
+	}
+	fmt.Fprintf(&sb, "\x1b[%d;1H%s", height, dim(clipRunes(help, width-1)))
+	fmt.Print(sb.String())
+}
+
+// clipRunes cuts s to n characters, marking the cut.
+func clipRunes(s string, n int) string {
+	r := []rune(s)
+	if n < 1 || len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// percent is n as a share of of, or "-" when there is none.
+func percent(n, of int) string {
+	if of == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(n)*100/float64(of))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// diagramAttempts bounds how often a diagram is regenerated after failing
+// the syntax check.
+const diagramAttempts = 3
+
+var diagramPrompts = map[string]string{
+	"mermaid":  "Write a Mermaid diagram for the following. Reply with a single ```mermaid code block and nothing else.\n\n",
+	"plantuml": "Write a PlantUML diagram for the following. Reply with a single ```plantuml code block, starting with @startuml and ending with @enduml, and nothing else.\n\n",
+}
+
+// mermaidTypes are the keywords a Mermaid diagram may start with.
+var mermaidTypes = []string{
+	"graph", "flowchart", "sequenceDiagram", "classDiagram", "stateDiagram", "stateDiagram-v2",
+	"erDiagram", "journey", "gantt", "pie", "gitGraph", "mindmap", "timeline", "quadrantChart",
+	"requirementDiagram", "C4Context", "C4Container", "C4Component", "C4Dynamic", "C4Deployment",
+	"sankey-beta", "xychart-beta", "block-beta", "packet-beta", "architecture-beta",
+}
+
+func runDiagram(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{
+		"api": true, "format": true, "o": true, "render": false,
+	})
+	if err != nil || len(parsed.positional) == 0 {
+		fmt.Println("Usage: ask diagram \"<description>\" [--format mermaid|plantuml] [-o file] [--render] [--api <api-name>]")
+		os.Exit(1)
+	}
+
+	format := parsed.value("format", "mermaid")
+	basePrompt, ok := diagramPrompts[format]
+	if !ok {
+		fmt.Println("Unknown format:", format)
+		os.Exit(1)
+	}
+	_, api := selectAPI(config, parsed.value("api", ""))
+
+	prompt := basePrompt + strings.Join(parsed.positional, " ")
+	var source string
+	var syntaxErr error
+	for attempt := 0; attempt < diagramAttempts; attempt++ {
+		text, err := sendPrompt(api, prompt)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		source = strings.TrimSpace(text)
+		if blocks := extractCodeBlocks(text); len(blocks) > 0 {
+			source = strings.TrimSpace(blocks[0].Code)
+		}
+		if syntaxErr = checkDiagram(format, source); syntaxErr == nil {
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "attempt %d: %v, retrying\n", attempt+1, syntaxErr)
+		prompt = basePrompt + strings.Join(parsed.positional, " ") +
+			"\n\nA previous attempt failed the syntax check with:\n" + syntaxErr.Error() +
+			"\n\nPrevious attempt:\n" + source
+	}
+	if syntaxErr != nil {
+		fmt.Fprintln(os.Stderr, "warning: diagram still fails the syntax check:", syntaxErr)
+	}
+
+	out := parsed.value("o", "")
+	if out == "" {
+		fmt.Println(source)
+	} else if err := os.WriteFile(out, []byte(source+"\n"), 0644); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if parsed.has("render") {
+		if out == "" {
+			fmt.Println("--render needs -o to know where to write the SVG")
+			os.Exit(1)
+		}
+		svg := strings.TrimSuffix(out, filepath.Ext(out)) + ".svg"
+		if err := renderDiagram(format, out, svg); err != nil {
+			fmt.Println("Error rendering diagram:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "Rendered", svg)
+	}
+}
+
+// checkDiagram validates diagram source, using the real renderer when it is
+// installed and a structural check otherwise.
+func checkDiagram(format, source string) error {
+	if source == "" {
+		return fmt.Errorf("empty diagram")
+	}
+
+	tmp, err := os.CreateTemp("", "ask-diagram-*."+format)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.WriteString(source)
+	tmp.Close()
+
+	svg := strings.TrimSuffix(tmp.Name(), filepath.Ext(tmp.Name())) + ".svg"
+	defer os.Remove(svg)
+	if err := renderDiagram(format, tmp.Name(), svg); err != errNoRenderer {
+		return err
+	}
+
+	switch format {
+	case "mermaid":
+		return checkMermaid(source)
+	case "plantuml":
+		return checkPlantUML(source)
+	}
+	return nil
+}
+
+var errNoRenderer = fmt.Errorf("no renderer installed")
+
+// renderDiagram renders src to an SVG at dst with mmdc or plantuml.
+func renderDiagram(format, src, dst string) error {
+	var cmd *exec.Cmd
+	switch format {
+	case "mermaid":
+		if _, err := exec.LookPath("mmdc"); err != nil {
+			return errNoRenderer
+		}
+		cmd = exec.Command("mmdc", "-q", "-i", src, "-o", dst)
+	case "plantuml":
+		if _, err := exec.LookPath("plantuml"); err != nil {
+			return errNoRenderer
+		}
+		// plantuml writes next to the source; -o takes a directory.
+		cmd = exec.Command("plantuml", "-tsvg", "-failfast2", "-o", filepath.Dir(absPath(dst)), src)
+	default:
+		return errNoRenderer
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func checkMermaid(source string) error {
+	var first string
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "%%") && line != "---" {
+			first = line
+			break
+		}
+	}
+
+	known := false
+	for _, t := range mermaidTypes {
+		if first == t || strings.HasPrefix(first, t+" ") {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown diagram type %q", first)
+	}
+	return checkBrackets(source)
+}
+
+func checkPlantUML(source string) error {
+	if !strings.HasPrefix(source, "@start") {
+		return fmt.Errorf("diagram must start with @startuml")
+	}
+	if !strings.Contains(source, "\n@end") {
+		return fmt.Errorf("diagram must end with @enduml")
+	}
+	return checkBrackets(source)
+}
+
+// asymmetricShape matches Mermaid's id>text] node shape, whose lone closing
+// bracket would otherwise look unbalanced.
+var asymmetricShape = regexp.MustCompile(`\w+>[^\]\n]*\]`)
+
+// erRelationship matches an erDiagram relationship such as ||--o{ or
+// }o..|{, whose crow's-foot braces aren't brackets.
+var erRelationship = regexp.MustCompile(`[|}][|o](?:--|\.\.)[|o][|{]`)
+
+// checkBrackets reports the first unbalanced bracket outside quoted text.
+func checkBrackets(source string) error {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	type opener struct {
+		r    rune
+		line int
+	}
+	var stack []opener
+
+	source = asymmetricShape.ReplaceAllString(source, "")
+	source = erRelationship.ReplaceAllString(source, "")
+	for n, line := range strings.Split(source, "\n") {
+		inQuote := false
+		for _, r := range line {
+			switch {
+			case r == '"':
+				inQuote = !inQuote
+			case inQuote:
+			case r == '(' || r == '[' || r == '{':
+				stack = append(stack, opener{r, n + 1})
+			case pairs[r] != 0:
+				if len(stack) == 0 || stack[len(stack)-1].r != pairs[r] {
+					return fmt.Errorf("line %d: unexpected %q", n+1, r)
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return fmt.Errorf("line %d: unclosed %q", top.line, top.r)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxEditRetries is how many times an edit that doesn't apply is sent back
+// to the model with the reason before ask edit gives up.
+const maxEditRetries = 2
+
+const editDiffPrompt = `You edit files. Reply with the change as a unified diff: for each file, a "--- a/<path>" and "+++ b/<path>" header, then hunks starting with "@@ -<line>,<count> +<line>,<count> @@". Give each hunk a few unchanged context lines, copied exactly, and prefix every line with a space, "-" or "+". Only change what the instruction asks for. Put the diff in one fenced code block tagged diff, after at most a sentence of explanation.`
+
+const editReplacePrompt = `You edit files. Reply with the change as search/replace blocks. For each change write the file path on its own line, then:
+<<<<<<< SEARCH
+the exact lines to replace, copied from the file, with enough of them to be unique
+=======
+the new lines
+>>>>>>> REPLACE
+Only change what the instruction asks for, and keep each block small.`
+
+const reviseHunkPrompt = `You revise one part of a proposed change to a file. You get the file, the lines the change replaces, the replacement that was proposed and the reviewer's comment on it. Reply with only the new replacement lines in one fenced code block, keeping any unchanged lines at its start and end.`
+
+// fileChange is a file's content before and after an edit.
+type fileChange struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// runEdit handles "ask edit <api> --file <path>... "<instruction>" [--format
+// diff|replace] [--yes]": the model answers with a diff (or search/replace
+// blocks) that has to apply cleanly to the files; the result is shown and,
+// once confirmed, written with the originals kept as .bak files.
+func runEdit(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"file": true, "format": true, "yes": false, "session": true})
+	if err != nil || len(parsed.positional) < 2 || len(parsed.values("file")) == 0 {
+		fmt.Println("Usage: ask edit <api-name> --file <path>... \"<instruction>\" [--format diff|replace] [--yes] [--session name]")
+		os.Exit(1)
+	}
+	sessionName = parsed.value("session", "")
+	format := parsed.value("format", "diff")
+	if format != "diff" && format != "replace" {
+		fmt.Println("Error: --format must be diff or replace")
+		os.Exit(1)
+	}
+	if !parsed.has("yes") && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Error: ask edit asks before changing files; run it in a terminal or pass --yes")
+		os.Exit(1)
+	}
+	apiName, api := resolveAPI(config, parsed.positional[0])
+
+	files, err := readFiles(parsed.values("file"))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	changes, err := requestEdits(config, apiName, api, parsed.values("file"), files, strings.Join(parsed.positional[1:], " "), format)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if _, err := confirmChanges(changes, parsed.has("yes"), hunkReviser(config, apiName, api)); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// requestEdits asks the model to carry out instruction on the files (paths
+// in order, contents in files) and returns the resulting changes. An answer
+// whose edits don't apply is sent back with the reason, up to
+// maxEditRetries times. Each attempt is recorded in the history.
+func requestEdits(config *Config, apiName string, api APIConfig, paths []string, files map[string]string, instruction, format string) ([]fileChange, error) {
+	req := Request{System: editDiffPrompt}
+	if format == "replace" {
+		req.System = editReplacePrompt
+	}
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s\n```\n%s\n```\n\n", path, strings.TrimSuffix(files[path], "\n"))
+	}
+	b.WriteString("Instruction: " + instruction)
+	prompt := b.String()
+	req.Prompt = prompt
+	if err := applyProjectContext(config.Settings, &req); err != nil {
+		return nil, err
+	}
+
+	var problem error
+	for attempt := 0; attempt <= maxEditRetries; attempt++ {
+		entry := newHistoryEntry(apiName, api, req)
+		resp, err := sendRequest(api, req)
+		entry.addResponse(resp)
+		saveHistory(config.Settings, entry, err)
+		if err != nil {
+			return nil, err
+		}
+
+		changes, err := patchFiles(resp.Text, format, paths, files)
+		if err == nil {
+			return changes, nil
+		}
+		problem = err
+		fmt.Fprintf(os.Stderr, "attempt %d: %s, retrying\n", attempt+1, strings.TrimSuffix(firstLine(err.Error()), ":"))
+		req.Prompt = fmt.Sprintf("%s\n\nYour previous reply was:\n%s\n\nIt couldn't be applied: %v\nReply again with edits that apply to the files exactly as given.", prompt, resp.Text, problem)
+	}
+	return nil, fmt.Errorf("no edit applied cleanly after %d attempts; last problem: %v", maxEditRetries+1, problem)
+}
+
+// patchFiles parses the edits in answer and applies them to the files,
+// failing if any edit names another file or doesn't apply.
+func patchFiles(answer, format string, paths []string, files map[string]string) ([]fileChange, error) {
+	defaultPath := ""
+	if len(paths) == 1 {
+		defaultPath = paths[0]
+	}
+	var patches []filePatch
+	if format == "replace" {
+		patches = parseSearchReplace(answer, defaultPath)
+	} else {
+		patches = parseUnifiedDiff(answer, defaultPath)
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("the reply has no edits")
+	}
+
+	var changes []fileChange
+	for _, p := range patches {
+		path, ok := matchPatchPath(p.Path, paths)
+		if !ok {
+			return nil, fmt.Errorf("the edit is for %s, which isn't one of the files given", p.Path)
+		}
+		patched, err := applyHunks(files[path], p.Hunks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		changes = append(changes, fileChange{Path: path, Old: files[path], New: patched})
+	}
+	return changes, nil
+}
+
+// confirmChanges goes through the changes hunk by hunk for approval (or,
+// with yes, just shows them) and writes what was accepted, keeping each
+// original as <file>.bak. Hunks commented on go to revise. It returns the
+// changes written.
+func confirmChanges(changes []fileChange, yes bool, revise reviseFunc) ([]fileChange, error) {
+	var pending []fileChange
+	for _, c := range changes {
+		if c.New != c.Old {
+			pending = append(pending, c)
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Println("The edit changes nothing.")
+		return nil, nil
+	}
+
+	if yes {
+		color := term.IsTerminal(int(os.Stdout.Fd()))
+		for _, c := range pending {
+			fmt.Print(formatDiff(c.Path, diffHunks(c.Old, c.New, 3), color))
+		}
+	} else {
+		var err error
+		if pending, err = reviewChanges(pending, revise); err != nil {
+			return nil, err
+		}
+		if len(pending) == 0 {
+			fmt.Println("Nothing changed.")
+			return nil, nil
+		}
+	}
+	for _, c := range pending {
+		if err := writeWithBackup(c.Path, c.New); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Patched %s (original in %s.bak)\n", c.Path, c.Path)
+	}
+	return pending, nil
+}
+
+// hunkReviser returns a reviseFunc that asks api for the new version of a
+// hunk, recording each request in the history.
+func hunkReviser(config *Config, apiName string, api APIConfig) reviseFunc {
+	return func(path, old string, h hunk, comment string) ([]string, error) {
+		req := Request{
+			System: reviseHunkPrompt,
+			Prompt: fmt.Sprintf("%s\n```\n%s\n```\n\nLines being replaced:\n```\n%s\n```\n\nProposed replacement:\n```\n%s\n```\n\nReviewer's comment: %s",
+				path, strings.TrimSuffix(old, "\n"), strings.Join(h.Old, "\n"), strings.Join(h.New, "\n"), comment),
+		}
+		entry := newHistoryEntry(apiName, api, req)
+		resp, err := sendRequest(api, req)
+		entry.addResponse(resp)
+		saveHistory(config.Settings, entry, err)
+		if err != nil {
+			return nil, err
+		}
+		text := resp.Text
+		if blocks := extractCodeBlocks(text); len(blocks) > 0 {
+			text = blocks[0].Code
+		}
+		lines, _ := splitLines(text)
+		return lines, nil
+	}
+}
+
+// writeWithBackup replaces path's content, first copying the current file
+// to path.bak. The file keeps its permissions.
+func writeWithBackup(path, content string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := snapshotBeforeWrite(path); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".bak", old, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), info.Mode().Perm())
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
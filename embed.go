@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Embedding purposes. Some providers embed search queries and the
+// documents being searched differently.
+const (
+	embedDocument = "document"
+	embedQuery    = "query"
+)
+
+// embedBatchSize is how many texts go in one request; Cohere's limit.
+const embedBatchSize = 96
+
+// defaultEmbedModels are used when an API entry has no embed_model set.
+// Local entries embed with their own model.
+var defaultEmbedModels = map[string]string{
+	ProviderOpenAI: "text-embedding-3-small",
+	ProviderCohere: "embed-english-v3.0",
+	ProviderGemini: "text-embedding-004",
+}
+
+// embedding is one input and its vector, as written by ask embed.
+type embedding struct {
+	Input     string    `json:"input"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// runEmbed handles "ask embed <api> [text] [--file path]... [-o out.json]".
+func runEmbed(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"file": true, "model": true, "o": true})
+	if err != nil || len(parsed.positional) < 1 {
+		fmt.Println("Usage: ask embed <api-name> [\"<text>\"] [--file <path>]... [--model <id>] [-o <file>]")
+		os.Exit(1)
+	}
+
+	_, api := resolveAPI(config, parsed.positional[0])
+	api.EmbedModel = parsed.value("model", api.EmbedModel)
+
+	var labels, texts []string
+	if text := strings.Join(parsed.positional[1:], " "); text != "" {
+		labels, texts = append(labels, text), append(texts, text)
+	}
+	for _, path := range parsed.values("file") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		labels, texts = append(labels, path), append(texts, string(data))
+	}
+	if len(texts) == 0 && !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("Error reading stdin:", err)
+			os.Exit(1)
+		}
+		labels, texts = append(labels, "-"), append(texts, string(data))
+	}
+	if len(texts) == 0 {
+		fmt.Println("Nothing to embed.")
+		os.Exit(1)
+	}
+
+	vectors, err := embedTexts(api, texts, embedDocument)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	result := make([]embedding, len(texts))
+	for i := range texts {
+		result[i] = embedding{Input: labels[i], Embedding: vectors[i]}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if out := parsed.value("o", ""); out != "" {
+		if err := os.WriteFile(out, append(data, '\n'), 0644); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Wrote %d embedding(s) of %d dimensions to %s\n", len(result), len(vectors[0]), filepath.Clean(out))
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// embedModel is the model api embeds with: its embed_model, the
+// provider's standard one, or its model.
+func embedModel(api APIConfig) string {
+	if api.EmbedModel != "" {
+		return api.EmbedModel
+	}
+	if model := defaultEmbedModels[api.Provider]; model != "" {
+		return model
+	}
+	return api.Model
+}
+
+// embedTexts returns an embedding vector for each text, in order.
+func embedTexts(api APIConfig, texts []string, purpose string) ([][]float64, error) {
+	api, err := expandAPIConfig(api)
+	if err != nil {
+		return nil, err
+	}
+
+	model := embedModel(api)
+	tokenAPI := api
+	tokenAPI.Model = model
+	tok := tokenizerFor(tokenAPI)
+	var vectors [][]float64
+	for start := 0; start < len(texts); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		// Each batch is held to the budget and recorded on its own, so a
+		// large index stops where the budget runs out.
+		tokens := 0
+		for _, text := range texts[start:end] {
+			tokens += tok.Count(text)
+		}
+		cost, priced := costOf(api.Provider, model, Usage{InputTokens: tokens})
+		if err := checkCost(api, model, cost, priced); err != nil {
+			return nil, err
+		}
+
+		var batch [][]float64
+		switch api.Provider {
+		case ProviderOpenAI, ProviderLocalOpenAI:
+			batch, err = embedOpenAI(api, model, texts[start:end])
+		case ProviderCohere:
+			batch, err = embedCohere(api, model, texts[start:end], purpose)
+		case ProviderGemini:
+			batch, err = embedGemini(api, model, texts[start:end], purpose)
+		case ProviderLocal:
+			batch, err = embedOllama(api, model, texts[start:end])
+		default:
+			return nil, fmt.Errorf("%s does not support embeddings", api.Provider)
+		}
+		if err != nil {
+			return nil, err
+		}
+		recordSpend(api, model, LedgerEntry{InputTokens: tokens, Estimated: true}, cost, priced)
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(batch))
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func embedOpenAI(api APIConfig, model string, texts []string) ([][]float64, error) {
+	headers := map[string]string{}
+	if api.APIKey != "" {
+		headers["Authorization"] = "Bearer " + api.APIKey
+	}
+
+	result, err := postJSON(api, api.BaseURL+"/embeddings", map[string]interface{}{
+		"model": model,
+		"input": texts,
+	}, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := result["data"].([]interface{})
+	vectors := make([][]float64, len(data))
+	for i, d := range data {
+		item, _ := d.(map[string]interface{})
+		idx := i
+		if n, ok := item["index"].(float64); ok && int(n) < len(data) {
+			idx = int(n)
+		}
+		vectors[idx] = floats(item["embedding"])
+	}
+	return vectors, nil
+}
+
+func embedCohere(api APIConfig, model string, texts []string, purpose string) ([][]float64, error) {
+	inputType := "search_document"
+	if purpose == embedQuery {
+		inputType = "search_query"
+	}
+
+	result, err := postJSON(api, api.BaseURL+"/embed", map[string]interface{}{
+		"model":      model,
+		"texts":      texts,
+		"input_type": inputType,
+	}, map[string]string{
+		"Authorization": "Bearer " + api.APIKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list, _ := result["embeddings"].([]interface{})
+	var vectors [][]float64
+	for _, v := range list {
+		vectors = append(vectors, floats(v))
+	}
+	return vectors, nil
+}
+
+func embedGemini(api APIConfig, model string, texts []string, purpose string) ([][]float64, error) {
+	taskType := "RETRIEVAL_DOCUMENT"
+	if purpose == embedQuery {
+		taskType = "RETRIEVAL_QUERY"
+	}
+
+	var requests []map[string]interface{}
+	for _, text := range texts {
+		requests = append(requests, map[string]interface{}{
+			"model":    "models/" + model,
+			"content":  map[string]interface{}{"parts": []map[string]string{{"text": text}}},
+			"taskType": taskType,
+		})
+	}
+
+	url := fmt.Sprintf("%s/models/%s:batchEmbedContents?key=%s", api.BaseURL, model, api.APIKey)
+	result, err := postJSON(api, url, map[string]interface{}{"requests": requests}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	list, _ := result["embeddings"].([]interface{})
+	var vectors [][]float64
+	for _, e := range list {
+		item, _ := e.(map[string]interface{})
+		vectors = append(vectors, floats(item["values"]))
+	}
+	return vectors, nil
+}
+
+func embedOllama(api APIConfig, model string, texts []string) ([][]float64, error) {
+	resp, err := ollamaPost(api, "/api/embed", map[string]interface{}{
+		"model": model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Embeddings, nil
+}
+
+// floats converts a decoded JSON array of numbers.
+func floats(v interface{}) []float64 {
+	list, _ := v.([]interface{})
+	out := make([]float64, 0, len(list))
+	for _, x := range list {
+		f, _ := x.(float64)
+		out = append(out, f)
+	}
+	return out
+}
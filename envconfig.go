@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// configFromEnv is set by --config-from-env or ASK_CONFIG_FROM_ENV=1. The
+// config then comes from ASK_CONFIG (the JSON itself) or ASK_CONFIG_FILE (a
+// path, such as a mounted secret), is never written back, and nothing needs
+// a writable home directory.
+var configFromEnv bool
+
+var errConfigFromEnv = errors.New("the config comes from the environment (--config-from-env) and can't be changed")
+
+// loadEnvConfig is loadConfig for --config-from-env. Includes are resolved
+// relative to ASK_CONFIG_FILE, or the working directory for ASK_CONFIG.
+func loadEnvConfig() *Config {
+	inline, path := os.Getenv("ASK_CONFIG"), os.Getenv("ASK_CONFIG_FILE")
+	var data []byte
+	var source, dir string
+	switch {
+	case inline != "" && path != "":
+		fmt.Println("Error: set only one of ASK_CONFIG and ASK_CONFIG_FILE")
+		os.Exit(1)
+	case inline != "":
+		data, source = []byte(inline), "ASK_CONFIG"
+		dir, _ = os.Getwd()
+	case path != "":
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			fmt.Printf("Error reading config %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		source, dir = path, filepath.Dir(path)
+	default:
+		fmt.Println("Error: --config-from-env needs ASK_CONFIG (the config JSON) or ASK_CONFIG_FILE (a path to it)")
+		os.Exit(1)
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		fmt.Printf("Error: config in %s is invalid: %s\n", source, describeJSONError(data, err))
+		os.Exit(1)
+	}
+	if config.APIs == nil {
+		config.APIs = make(map[string]APIConfig)
+	}
+	if err := mergeIncludes(config, dir); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	nameAPIs(config)
+	return config
+}
+
+// stateDir is where history, indexes and caches live: next to the config
+// file, or with --config-from-env in ASK_STATE_DIR, falling back to the
+// system temp directory.
+func stateDir() string {
+	if !configFromEnv {
+		return filepath.Dir(getConfigPath())
+	}
+	if dir := os.Getenv("ASK_STATE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "ask")
+}
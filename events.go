@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// eventStream writes --output events: one JSON object per line, each with
+// a "type" of delta, tool_call, tool_result, image, usage, done or error.
+type eventStream struct {
+	enc *json.Encoder
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{enc: json.NewEncoder(os.Stdout)}
+}
+
+func (s *eventStream) emit(kind string, fields map[string]interface{}) {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["type"] = kind
+	s.enc.Encode(fields)
+}
+
+// answerEvents is answer for --output events. Plain answers stream as
+// deltas; verified answers, structured answers, answers with token
+// probabilities and tool runs arrive as a single delta once complete, tool
+// runs preceded by an event for every call and its result.
+func answerEvents(config *Config, parsed *cliArgs, entry *HistoryEntry, apiConfig APIConfig, req Request) {
+	events := newEventStream()
+	fail := func(err error) {
+		saveHistory(config.Settings, entry, err)
+		events.emit("error", map[string]interface{}{"message": err.Error()})
+		os.Exit(1)
+	}
+	delta := func(text string) {
+		events.emit("delta", map[string]interface{}{"text": text})
+	}
+
+	var resp Response
+	var err error
+	streamed := false
+	switch {
+	case len(req.Tools) > 0:
+		resp, err = sendWithTools(apiConfig, req, func(call toolCall, result string) {
+			events.emit("tool_call", map[string]interface{}{"id": call.ID, "name": call.Name, "arguments": call.Args})
+			events.emit("tool_result", map[string]interface{}{"id": call.ID, "name": call.Name, "result": result})
+		})
+	case parsed.has("verify") || req.Logprobs || req.Schema != nil:
+		resp, err = sendRequest(apiConfig, req)
+	default:
+		resp, err = streamRequest(apiConfig, req, delta)
+		streamed = true
+	}
+	entry.addResponse(resp)
+	if err != nil {
+		fail(err)
+	}
+
+	if parsed.has("verify") {
+		if resp, err = verifyAnswer(config, parsed.value("verifier", config.Settings.Verifier), apiConfig, req, resp); err != nil {
+			fail(err)
+		}
+		entry.addResponse(Response{Text: resp.Text})
+	}
+	if !streamed {
+		delta(resp.Text)
+	}
+	saveHistory(config.Settings, entry, nil)
+	for _, path := range saveAnswerImages(parsed, req, resp) {
+		events.emit("image", map[string]interface{}{"path": path})
+	}
+
+	if resp.Usage != nil {
+		events.emit("usage", map[string]interface{}{
+			"input_tokens":  resp.Usage.InputTokens,
+			"output_tokens": resp.Usage.OutputTokens,
+		})
+	}
+	if len(req.Sources) > 0 {
+		resp.Citations = citedSources(resp.Text, req.Sources)
+	}
+	done := map[string]interface{}{"text": resp.Text}
+	if len(resp.Citations) > 0 {
+		done["citations"] = resp.Citations
+	}
+	events.emit("done", done)
+}
+
+// jsonAnswer is the object --output json prints.
+type jsonAnswer struct {
+	Text         string     `json:"text"`
+	Model        string     `json:"model"`
+	Usage        *Usage     `json:"usage"`
+	FinishReason *string    `json:"finish_reason"`
+	LatencyMS    int64      `json:"latency_ms"`
+	Citations    []Citation `json:"citations,omitempty"`
+	// Images are the paths generated images were saved to.
+	Images []string `json:"images,omitempty"`
+	// Confidence is set with --confidence.
+	Confidence *answerConfidence `json:"confidence,omitempty"`
+}
+
+// answerJSON is answer for --output json: nothing is printed until the
+// answer is complete, then a single JSON object describes it. Failures print
+// {"error": ...} and exit 1. Fields a provider doesn't report are null.
+func answerJSON(config *Config, parsed *cliArgs, entry *HistoryEntry, apiConfig APIConfig, req Request) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	fail := func(err error) {
+		saveHistory(config.Settings, entry, err)
+		enc.Encode(map[string]string{"error": err.Error()})
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	resp, err := sendOrPull(apiConfig, func() (Response, error) { return sendRequest(apiConfig, req) })
+	entry.addResponse(resp)
+	if err != nil {
+		fail(err)
+	}
+	if parsed.has("verify") {
+		verified, err := verifyAnswer(config, parsed.value("verifier", config.Settings.Verifier), apiConfig, req, resp)
+		if err != nil {
+			fail(err)
+		}
+		resp.Text, resp.Citations = verified.Text, verified.Citations
+		entry.addResponse(Response{Text: resp.Text})
+	}
+	latency := time.Since(start)
+	saveHistory(config.Settings, entry, nil)
+
+	if len(req.Sources) > 0 {
+		resp.Citations = citedSources(resp.Text, req.Sources)
+	}
+	out := jsonAnswer{
+		Text:      resp.Text,
+		Model:     resp.Model,
+		Usage:     resp.Usage,
+		LatencyMS: latency.Milliseconds(),
+		Citations: resp.Citations,
+		Images:    saveAnswerImages(parsed, req, resp),
+	}
+	if out.Model == "" {
+		out.Model = apiConfig.Model
+	}
+	if parsed.has("confidence") {
+		out.Confidence = parseConfidence(resp.Text, resp.Logprobs)
+	}
+	if resp.FinishReason != "" {
+		out.FinishReason = &resp.FinishReason
+	}
+	enc.Encode(out)
+}
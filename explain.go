@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// explainContextLines is how many lines either side of a --lines range are
+// sent with it when the whole file doesn't fit.
+const explainContextLines = 60
+
+// explainPrompts are the system prompts for each level of ask explain.
+var explainPrompts = map[string]string{
+	"normal": `You explain code, configuration, logs and other technical text to a working developer who hasn't seen it before. Start with a one or two sentence summary of what it is and does, then walk through how it works, in the order that makes it easiest to follow rather than line by line. Point out anything non-obvious: edge cases, hidden assumptions, error handling, performance or concurrency concerns. Don't restate what the text already says plainly.`,
+	"eli5":   `You explain code and other technical text to someone with no programming background. Use plain words and everyday comparisons, define any term you can't avoid, and keep it short: what it is for, what it does step by step in broad strokes, and why someone would write it this way. Leave out details that don't help the big picture.`,
+	"expert": `You explain code and other technical text to an experienced engineer. Skip the basics and anything the text states plainly. Focus on design decisions and their trade-offs, subtle behaviour, invariants it relies on, failure modes, concurrency and performance characteristics, and anything surprising or likely to be a bug. Be dense and precise.`,
+}
+
+// runExplain handles "ask explain [<file> | -] [--eli5 | --expert] [--lines
+// a-b] [--api name]": it explains a file or stdin at the level asked for.
+// With --lines it explains those lines, sending the rest of the file, or as
+// much around them as fits, for context.
+func runExplain(config *Config, args []string) {
+	spec := map[string]bool{"api": true, "eli5": false, "expert": false, "lines": true}
+	for flag, takesValue := range promptFlags {
+		spec[flag] = takesValue
+	}
+	parsed, err := parseArgs(args, spec)
+	if err != nil || len(parsed.positional) > 1 {
+		fmt.Println("Usage: ask explain [<file> | -] [--eli5 | --expert] [--lines 40-80] [--api <api-name>]")
+		os.Exit(1)
+	}
+	level := "normal"
+	switch {
+	case parsed.has("eli5") && parsed.has("expert"):
+		fmt.Println("Error: --eli5 and --expert can't be used together")
+		os.Exit(1)
+	case parsed.has("eli5"):
+		level = "eli5"
+	case parsed.has("expert"):
+		level = "expert"
+	}
+
+	name := "-"
+	if len(parsed.positional) == 1 {
+		name = parsed.positional[0]
+	}
+	var data []byte
+	if name == "-" {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Println("Usage: ask explain [<file> | -] [--eli5 | --expert] [--lines 40-80] [--api <api-name>]")
+			os.Exit(1)
+		}
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if strings.TrimSpace(text) == "" {
+		fmt.Println("Nothing to explain.")
+		os.Exit(1)
+	}
+
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	prompt := explainPrompt(config, api, name, text, parsed.value("lines", ""))
+	if prompt == "" {
+		os.Exit(1)
+	}
+	answer(config, parsed, apiName, api, Request{System: explainPrompts[level], Prompt: prompt})
+}
+
+// explainPrompt builds the prompt for explaining text, read from the file
+// name ("-" for stdin), or only its lines in lineRange when that's set. It
+// prints the problem and returns "" when the range is no good.
+func explainPrompt(config *Config, api APIConfig, name, text, lineRange string) string {
+	label := "the input"
+	if name != "-" {
+		label = filepath.Base(name)
+	}
+	lang := detectLanguage(text)
+	if lineRange == "" {
+		return fmt.Sprintf("Explain %s:\n\n```%s\n%s\n```", label, lang, strings.TrimRight(text, "\n"))
+	}
+
+	first, last, err := parsePageRange(lineRange)
+	if err != nil {
+		fmt.Printf("Error: invalid line range %q; use --lines 40-80\n", lineRange)
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if last == 0 || last > len(lines) {
+		last = len(lines)
+	}
+	if first > len(lines) {
+		fmt.Printf("Error: %s has only %d lines\n", label, len(lines))
+		return ""
+	}
+
+	// The whole file goes along when it fits in half the budget; otherwise
+	// the lines around the range.
+	from, to := 1, len(lines)
+	if tokenizerFor(api).Count(text) > promptBudget(api)/2 {
+		from, to = max(first-explainContextLines, 1), min(last+explainContextLines, len(lines))
+		notifyTruncation(config.Settings, "Sending lines %d-%d of %d as context", from, to, len(lines))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Explain lines %d-%d of %s, marked with >. The lines around them are there for context; refer to them only as far as they help explain the marked lines. Lines are numbered.\n\n```%s\n", first, last, label, lang)
+	if from > 1 {
+		fmt.Fprintf(&b, "%s\n", omissionNotice(fmt.Sprintf("lines 1-%d", from-1)))
+	}
+	width := len(fmt.Sprint(to))
+	for i := from; i <= to; i++ {
+		mark := " "
+		if i >= first && i <= last {
+			mark = ">"
+		}
+		fmt.Fprintf(&b, "%s%*d| %s\n", mark, width, i, lines[i-1])
+	}
+	if to < len(lines) {
+		fmt.Fprintf(&b, "%s\n", omissionNotice(fmt.Sprintf("lines %d-%d", to+1, len(lines))))
+	}
+	b.WriteString("```")
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// failover makes a request with try, first to api and then, while it
+// fails, to each of the APIs it falls back to, saying on stderr which is
+// next. An API with several keys tries the others first when one is rate
+// limited. canRetry, if set, can stop it from going on when a failed
+// attempt has already done something that can't be undone.
+func failover(api APIConfig, try func(APIConfig) (Response, error), canRetry func(Response) bool) (Response, error) {
+	fallbacks := api.fallbacks
+	api.fallbacks = nil
+	resp, err := tryKeys(api, try, canRetry)
+	for _, next := range fallbacks {
+		if err == nil || api.requestContext().Err() != nil || (canRetry != nil && !canRetry(resp)) {
+			break
+		}
+		notice := fmt.Sprintf("%s failed (%s); trying %s", api.name, smokeReason(err), next.name)
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			notice = styleDim + notice + styleReset
+		}
+		fmt.Fprintln(os.Stderr, notice)
+		next.ctx = api.ctx
+		api = next
+		api.fallbacks = nil
+		resp, err = tryKeys(api, try, canRetry)
+	}
+	return resp, err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxFixLogLines caps how much of the log ask fix sends: the end, where
+// builds and test runs report what failed.
+const maxFixLogLines = 300
+
+// defaultFixIterations is how many patches ask fix --cmd tries before
+// giving up, unless --max-iterations says otherwise.
+const defaultFixIterations = 3
+
+// maxLogFiles caps how many files named in a log ask fix --cmd sends.
+const maxLogFiles = 8
+
+// logFileRef finds file:line references in build and test output.
+var logFileRef = regexp.MustCompile(`[\w./-]+\.\w+:\d+`)
+
+// runFix handles "ask fix <log|-> <file>... [--api name] [--yes]": the log
+// (build output, a stack trace, test failures) goes to the model with the
+// files, and the minimal patch that comes back goes through the same checks
+// and confirmation as ask edit.
+//
+// With --cmd it runs the command instead of reading a log, patches what it
+// reports and runs it again, until it passes or --max-iterations patches
+// have been tried. The files default to those the output names.
+func runFix(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"api": true, "yes": false, "session": true, "cmd": true, "max-iterations": true})
+	if err != nil || !parsed.has("cmd") && len(parsed.positional) < 2 {
+		fmt.Println("Usage: ask fix <log-file|-> <file>... [--api <api-name>] [--yes] [--session name]")
+		fmt.Println("       ask fix --cmd \"<command>\" [file...] [--max-iterations N] [--api <api-name>] [--yes] [--session name]")
+		os.Exit(1)
+	}
+	sessionName = parsed.value("session", "")
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	if parsed.has("cmd") {
+		runFixLoop(config, parsed, apiName, api)
+		return
+	}
+
+	logPath, paths := parsed.positional[0], parsed.positional[1:]
+	if !parsed.has("yes") && (logPath == "-" || !term.IsTerminal(int(os.Stdin.Fd()))) {
+		fmt.Println("Error: ask fix asks before changing files; run it in a terminal or pass --yes")
+		os.Exit(1)
+	}
+
+	var log []byte
+	if logPath == "-" {
+		log, err = io.ReadAll(os.Stdin)
+	} else {
+		log, err = os.ReadFile(logPath)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if strings.TrimSpace(string(log)) == "" {
+		fmt.Println("Error: the log is empty")
+		os.Exit(1)
+	}
+
+	files, err := readFiles(paths)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	changes, err := requestEdits(config, apiName, api, paths, files, fixInstruction(config.Settings, string(log)), "diff")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if _, err := confirmChanges(changes, parsed.has("yes"), hunkReviser(config, apiName, api)); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runFixLoop runs --cmd, and while it fails, has the model patch the files
+// and runs it again. Each patch is reviewed as with ask edit unless --yes;
+// declining all of it ends the loop.
+func runFixLoop(config *Config, parsed *cliArgs, apiName string, api APIConfig) {
+	command := parsed.value("cmd", "")
+	iterations := defaultFixIterations
+	if s := parsed.value("max-iterations", ""); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			fmt.Println("Error: --max-iterations must be a positive number")
+			os.Exit(1)
+		}
+		iterations = n
+	}
+	if !parsed.has("yes") && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Error: ask fix asks before changing files; run it in a terminal or pass --yes")
+		os.Exit(1)
+	}
+
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	for i := 0; ; i++ {
+		if tty {
+			fmt.Println(dim("$ " + command))
+		} else {
+			fmt.Println("$ " + command)
+		}
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+		cmd.Stderr = cmd.Stdout
+		err := cmd.Run()
+		if err == nil {
+			if i == 0 {
+				fmt.Println("The command passes; nothing to fix.")
+			} else {
+				fmt.Printf("The command passes after %d fix(es).\n", i)
+			}
+			return
+		}
+		if _, failed := err.(*exec.ExitError); !failed {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if i == iterations {
+			fmt.Printf("Still failing after %d fix(es); giving up.\n", iterations)
+			os.Exit(1)
+		}
+
+		paths := parsed.positional
+		if len(paths) == 0 {
+			paths = logFiles(out.String())
+		}
+		if len(paths) == 0 {
+			fmt.Println("Error: the output names no files to fix; list them after --cmd")
+			os.Exit(1)
+		}
+		files, err := readFiles(paths)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\nFix %d/%d: asking %s about %s\n", i+1, iterations, apiName, strings.Join(paths, ", "))
+		changes, err := requestEdits(config, apiName, api, paths, files, fixInstruction(config.Settings, out.String()), "diff")
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		written, err := confirmChanges(changes, parsed.has("yes"), hunkReviser(config, apiName, api))
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if len(written) == 0 {
+			fmt.Println("Stopping: no changes to try.")
+			os.Exit(1)
+		}
+		fmt.Println()
+	}
+}
+
+// readFiles reads the files at paths, keyed by path.
+func readFiles(paths []string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = string(data)
+	}
+	return files, nil
+}
+
+// logFiles returns the files under the current directory that output
+// refers to as file:line, in order of first mention, at most maxLogFiles.
+func logFiles(output string) []string {
+	root, err := os.Getwd()
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	seen := map[string]bool{}
+	for _, ref := range logFileRef.FindAllString(output, -1) {
+		path := ref[:strings.LastIndex(ref, ":")]
+		if seen[path] || len(paths) == maxLogFiles {
+			continue
+		}
+		seen[path] = true
+		abs, err := resolveInside(root, path)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(abs); err == nil && info.Mode().IsRegular() {
+			rel, _ := filepath.Rel(root, abs)
+			paths = append(paths, rel)
+		}
+	}
+	return paths
+}
+
+// fixInstruction asks for the smallest change that fixes what log reports,
+// quoting its last maxFixLogLines lines.
+func fixInstruction(settings Settings, log string) string {
+	lines := strings.Split(strings.TrimRight(log, "\n"), "\n")
+	note := ""
+	if n := len(lines) - maxFixLogLines; n > 0 {
+		notifyTruncation(settings, "Sending only the last %d of %d log lines", maxFixLogLines, len(lines))
+		note = fmt.Sprintf(" (its last %d of %d lines)", maxFixLogLines, len(lines))
+		lines = append([]string{omissionNotice(fmt.Sprintf("%d earlier lines of the log", n))}, lines[n:]...)
+	}
+	return fmt.Sprintf("Make the smallest change to the files above that fixes the errors in this log%s. Don't refactor or touch unrelated code.\n\n```\n%s\n```", note, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Glossary is a project's house terminology, from the file .ask.toml names
+// with glossary = "<path>":
+//
+//	[preferred]
+//	email = ["e-mail", "E-Mail"]
+//	"sign in" = ["log in", "login"]
+//
+//	[banned]
+//	whitelist = "allowlist"
+//	simply = ""
+//
+//	[translations.de]
+//	"sign in" = "anmelden"
+//
+// Preferred terms replace the variants listed for them, banned terms
+// shouldn't appear at all (with what to say instead, if anything) and
+// translations fix how terms are rendered in a language.
+type Glossary struct {
+	Path         string
+	Preferred    []glossaryTerm
+	Banned       []glossaryTerm
+	Translations map[string][]glossaryTerm
+}
+
+// glossaryTerm is a term and, depending on the table, its variants to
+// avoid, what to use instead or its translation.
+type glossaryTerm struct {
+	Term    string
+	Avoid   []string
+	Instead string
+}
+
+// glossaryViolation is a use of a term the glossary rules out.
+type glossaryViolation struct {
+	Found string
+	Rule  string
+}
+
+func loadGlossary(path string) (*Glossary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	g := &Glossary{Path: path, Translations: map[string][]glossaryTerm{}}
+	for key, v := range values {
+		table, term, _ := strings.Cut(key, ".")
+		var ok bool
+		switch table {
+		case "preferred":
+			var avoid []string
+			avoid, ok = v.([]string)
+			g.Preferred = append(g.Preferred, glossaryTerm{Term: term, Avoid: avoid})
+		case "banned":
+			var instead string
+			instead, ok = v.(string)
+			g.Banned = append(g.Banned, glossaryTerm{Term: term, Instead: instead})
+		case "translations":
+			lang, source, found := strings.Cut(term, ".")
+			var target string
+			target, ok = v.(string)
+			ok = ok && found && target != ""
+			g.Translations[lang] = append(g.Translations[lang], glossaryTerm{Term: source, Instead: target})
+		default:
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+		if !ok || term == "" {
+			return nil, fmt.Errorf("%s: invalid value for %s", path, key)
+		}
+	}
+
+	byTerm := func(terms []glossaryTerm) {
+		sort.Slice(terms, func(i, j int) bool { return terms[i].Term < terms[j].Term })
+	}
+	byTerm(g.Preferred)
+	byTerm(g.Banned)
+	for _, terms := range g.Translations {
+		byTerm(terms)
+	}
+	return g, nil
+}
+
+// projectGlossary returns the glossary of the .ask.toml for the working
+// directory, or nil when there is none.
+func projectGlossary() (*Glossary, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	pc, err := findProjectContext(dir)
+	if err != nil || pc == nil {
+		return nil, err
+	}
+	return pc.Glossary, nil
+}
+
+// answerGlossary is the glossary an answer is held to: the project's,
+// unless --no-context leaves the project out.
+func answerGlossary(parsed *cliArgs) *Glossary {
+	if parsed.has("no-context") {
+		return nil
+	}
+	g, _ := projectGlossary()
+	return g
+}
+
+// glossaryPath resolves the glossary key of the .ask.toml at contextPath.
+func glossaryPath(contextPath, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(contextPath), p)
+}
+
+// prompt renders the rules for a system prompt. Translations are only
+// included for lang, when it's given.
+func (g *Glossary) prompt(lang string) string {
+	var b strings.Builder
+	b.WriteString("Use this project's terminology exactly, in everything you write:")
+	for _, t := range g.Preferred {
+		fmt.Fprintf(&b, "\n- Write %q", t.Term)
+		if len(t.Avoid) > 0 {
+			fmt.Fprintf(&b, ", never %s", quoteList(t.Avoid))
+		}
+		b.WriteString(".")
+	}
+	for _, t := range g.Banned {
+		fmt.Fprintf(&b, "\n- Don't use %q", t.Term)
+		if t.Instead != "" {
+			fmt.Fprintf(&b, "; write %q instead", t.Instead)
+		}
+		b.WriteString(".")
+	}
+	if lang != "" {
+		for _, t := range g.translations(lang) {
+			fmt.Fprintf(&b, "\n- In %s, translate %q as %q.", lang, t.Term, t.Instead)
+		}
+	}
+	return b.String()
+}
+
+// withGlossary appends g's rules to a system prompt; g may be nil.
+func withGlossary(system string, g *Glossary) string {
+	if g == nil {
+		return system
+	}
+	return system + "\n\n" + g.prompt("")
+}
+
+// translations returns the glossary's translations into lang, whose name
+// is matched without regard to case.
+func (g *Glossary) translations(lang string) []glossaryTerm {
+	for l, terms := range g.Translations {
+		if strings.EqualFold(l, lang) {
+			return terms
+		}
+	}
+	return nil
+}
+
+// check returns the uses of avoided and banned terms in text, outside code
+// blocks. For a translation, with source and lang given, it also reports
+// glossary terms in source whose translation is missing from text.
+func (g *Glossary) check(text, source, lang string) []glossaryViolation {
+	prose := withoutCodeBlocks(text)
+	var found []glossaryViolation
+	for _, t := range g.Preferred {
+		for _, avoid := range t.Avoid {
+			if containsTerm(prose, avoid, !strings.EqualFold(avoid, t.Term)) {
+				found = append(found, glossaryViolation{Found: avoid, Rule: fmt.Sprintf("write %q, not %q", t.Term, avoid)})
+			}
+		}
+	}
+	for _, t := range g.Banned {
+		if containsTerm(prose, t.Term, true) {
+			rule := fmt.Sprintf("%q is banned", t.Term)
+			if t.Instead != "" {
+				rule += fmt.Sprintf("; write %q instead", t.Instead)
+			}
+			found = append(found, glossaryViolation{Found: t.Term, Rule: rule})
+		}
+	}
+	if source != "" && lang != "" {
+		for _, t := range g.translations(lang) {
+			if containsTerm(source, t.Term, true) && !containsTerm(prose, t.Instead, true) {
+				found = append(found, glossaryViolation{Found: t.Term, Rule: fmt.Sprintf("translate %q as %q", t.Term, t.Instead)})
+			}
+		}
+	}
+	return found
+}
+
+const glossaryFixPrompt = `Rewrite the text below so it follows the project's terminology. Fix only these problems, adjusting the grammar around each change where needed, and leave everything else, including formatting and code blocks, exactly as it is:
+%s
+
+Reply with the corrected text only.
+
+<text>
+%s
+</text>`
+
+// enforceGlossary checks text against g and, when it breaks any rules, has
+// api correct it once. It returns the text to use, the usage of the
+// correction and the violations that remain.
+func enforceGlossary(api APIConfig, g *Glossary, text, source, lang string) (string, *Usage, []glossaryViolation) {
+	violations := g.check(text, source, lang)
+	if len(violations) == 0 {
+		return text, nil, nil
+	}
+	writeProgress(fmt.Sprintf("Correcting terminology (%d glossary issues)...", len(violations)))
+	var rules []string
+	for _, v := range violations {
+		rules = append(rules, "- "+v.Rule)
+	}
+	resp, err := sendRequest(api, Request{Prompt: fmt.Sprintf(glossaryFixPrompt, strings.Join(rules, "\n"), text)})
+	if err != nil || strings.TrimSpace(resp.Text) == "" {
+		return text, resp.Usage, violations
+	}
+	fixed := strings.TrimSpace(resp.Text)
+	return fixed, resp.Usage, g.check(fixed, source, lang)
+}
+
+// reportGlossary warns on stderr about violations left in an answer.
+func reportGlossary(violations []glossaryViolation) {
+	for _, v := range violations {
+		writeProgress("Glossary: " + v.Rule)
+	}
+}
+
+// withoutCodeBlocks blanks out the fenced code blocks in text, where
+// identifiers may legitimately differ from the prose terms.
+func withoutCodeBlocks(text string) string {
+	var b strings.Builder
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence == "" {
+			if f := fenceOf(trimmed); f != "" {
+				fence = f
+				continue
+			}
+			b.WriteString(line + "\n")
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			fence = ""
+		}
+	}
+	return b.String()
+}
+
+// containsTerm reports whether term appears in text as a whole word or
+// phrase, ignoring case when ignoreCase is set.
+func containsTerm(text, term string, ignoreCase bool) bool {
+	pattern := `(^|[^\pL\pN_])` + regexp.QuoteMeta(term) + `($|[^\pL\pN_])`
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern).MatchString(text)
+}
+
+// quoteList renders items as "a", "b" or "c".
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxGogenTypes caps how many related types go along with the one named,
+// nearest first, so prompts stay small for types at the centre of a large
+// package.
+const maxGogenTypes = 12
+
+const gogenPrompt = `You write Go code for an existing package. You get the definition of a type, the package's types it uses, its methods and the functions that return it, all exactly as they are in the source. Write code that fits that package: the same package name, naming, error handling and comment style, using only what is shown, the standard library and the imports listed. Reply with the new code in one fenced go code block, without repeating the existing definitions, then at most a few sentences on anything the caller should know.`
+
+// goPackage is the part of "go list -json" output ask gogen uses.
+type goPackage struct {
+	Dir        string
+	ImportPath string
+	Name       string
+	GoFiles    []string
+}
+
+// runGogen handles "ask gogen --type <pkg>.<Type> --task "<what to write>"
+// [--api name]": it sends the type's definition, with the package's types it
+// refers to, its methods and constructors, and nothing else from the package.
+func runGogen(config *Config, args []string) {
+	spec := map[string]bool{"api": true, "type": true, "task": true}
+	for flag, takesValue := range promptFlags {
+		spec[flag] = takesValue
+	}
+	parsed, err := parseArgs(takeCodeOnlyLanguage(args), spec)
+	task := strings.TrimSpace(parsed.value("task", strings.Join(parsed.positional, " ")))
+	if err != nil || parsed.value("type", "") == "" || task == "" {
+		fmt.Println(`Usage: ask gogen --type ./pkg/api.Type --task "<what to write>" [--api <api-name>]`)
+		os.Exit(1)
+	}
+
+	pkgPath, typeName := splitGoType(parsed.value("type", ""))
+	pkg, err := listGoPackage(pkgPath)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	context, err := goTypeContext(pkg, typeName)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	prompt := fmt.Sprintf("Package %s (%s).\n\n%s\nTask for %s: %s", pkg.Name, pkg.ImportPath, context, typeName, task)
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	answer(config, parsed, apiName, api, Request{System: gogenPrompt, Prompt: prompt})
+}
+
+// splitGoType splits "./pkg/api.Type" into the package and the type name. A
+// bare name is looked up in the package in the current directory.
+func splitGoType(spec string) (pkg, name string) {
+	i := strings.LastIndex(spec, ".")
+	if i < 0 || strings.Contains(spec[i:], "/") {
+		return ".", spec
+	}
+	pkg, name = spec[:i], spec[i+1:]
+	if pkg == "" {
+		pkg = "."
+	}
+	return pkg, name
+}
+
+// listGoPackage asks the go command where a package is and which files
+// make it up under the current build constraints.
+func listGoPackage(path string) (*goPackage, error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil, fmt.Errorf("ask gogen needs the go command on the PATH")
+	}
+	cmd := exec.Command("go", "list", "-json", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("go list %s: %s", path, msg)
+		}
+		return nil, err
+	}
+	pkg := &goPackage{}
+	if err := json.Unmarshal(out, pkg); err != nil {
+		return nil, fmt.Errorf("reading go list output: %v", err)
+	}
+	return pkg, nil
+}
+
+// goTypeContext renders what a model needs to write code for the named
+// type: its definition, the package's types it uses (transitively, up to
+// maxGogenTypes), its methods and the functions returning it, as
+// signatures, and the imports of its file.
+func goTypeContext(pkg *goPackage, name string) (string, error) {
+	fset := token.NewFileSet()
+	types := map[string]*goTypeDecl{}
+	var files []*ast.File
+	for _, f := range pkg.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, f), nil, parser.ParseComments)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range gen.Specs {
+				ts := s.(*ast.TypeSpec)
+				types[ts.Name.Name] = &goTypeDecl{spec: ts, decl: gen, file: file}
+			}
+		}
+	}
+
+	target, ok := types[name]
+	if !ok {
+		var names []string
+		for n := range types {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if hint := didYouMean(name, names); hint != "" {
+			return "", fmt.Errorf("no type %s in %s. %s", name, pkg.ImportPath, hint)
+		}
+		return "", fmt.Errorf("no type %s in %s", name, pkg.ImportPath)
+	}
+
+	// Breadth first from the target, so the nearest types make the cut.
+	order := []string{name}
+	seen := map[string]bool{name: true}
+	for i := 0; i < len(order) && len(order) <= maxGogenTypes; i++ {
+		for _, ref := range typeRefs(types[order[i]].spec) {
+			if _, local := types[ref]; local && !seen[ref] && len(order) <= maxGogenTypes {
+				seen[ref] = true
+				order = append(order, ref)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("The type and the types it uses:\n\n```go\n")
+	for i, n := range order {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(types[n].source(fset))
+	}
+	b.WriteString("\n```\n")
+
+	var methods, constructors []string
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			switch {
+			case fn.Recv != nil && receiverName(fn) == name:
+				methods = append(methods, signature(fset, file, fn))
+			case fn.Recv == nil && returnsType(fn, name):
+				constructors = append(constructors, signature(fset, file, fn))
+			}
+		}
+	}
+	if len(methods) > 0 {
+		fmt.Fprintf(&b, "\nMethods of %s:\n\n```go\n%s\n```\n", name, strings.Join(methods, "\n\n"))
+	}
+	if len(constructors) > 0 {
+		fmt.Fprintf(&b, "\nFunctions returning %s:\n\n```go\n%s\n```\n", name, strings.Join(constructors, "\n\n"))
+	}
+
+	var imports []string
+	for _, imp := range target.file.Imports {
+		imports = append(imports, imp.Path.Value)
+	}
+	if len(imports) > 0 {
+		fmt.Fprintf(&b, "\nImports of the file %s is in: %s\n", name, strings.Join(imports, ", "))
+	}
+	return b.String(), nil
+}
+
+// goTypeDecl is a type declared in the package and where.
+type goTypeDecl struct {
+	spec *ast.TypeSpec
+	decl *ast.GenDecl
+	file *ast.File
+}
+
+// source prints the type's declaration with its comments.
+func (t *goTypeDecl) source(fset *token.FileSet) string {
+	if len(t.decl.Specs) == 1 {
+		return printNode(fset, t.file, t.decl)
+	}
+	// One of a grouped declaration: print it on its own.
+	doc := ""
+	if t.spec.Doc != nil {
+		doc = printNode(fset, t.file, t.spec.Doc) + "\n"
+	}
+	return doc + "type " + printNode(fset, t.file, t.spec)
+}
+
+// typeRefs lists the unqualified type names a type's definition refers to.
+func typeRefs(spec *ast.TypeSpec) []string {
+	var refs []string
+	var inspect func(n ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			// Field and method names aren't types.
+			ast.Inspect(n.Type, inspect)
+			return false
+		case *ast.SelectorExpr:
+			// Another package's type; not followed.
+			return false
+		case *ast.Ident:
+			refs = append(refs, n.Name)
+		}
+		return true
+	}
+	ast.Inspect(spec.Type, inspect)
+	return refs
+}
+
+// receiverName is the name of the type fn is a method of.
+func receiverName(fn *ast.FuncDecl) string {
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	case *ast.IndexListExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	}
+	return ""
+}
+
+// returnsType reports whether fn returns a name or *name among its results.
+func returnsType(fn *ast.FuncDecl, name string) bool {
+	if fn.Type.Results == nil {
+		return false
+	}
+	for _, r := range fn.Type.Results.List {
+		expr := r.Type
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+		}
+		if id, ok := expr.(*ast.Ident); ok && id.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// signature prints fn's doc comment and signature without its body.
+func signature(fset *token.FileSet, file *ast.File, fn *ast.FuncDecl) string {
+	bodyless := *fn
+	bodyless.Body = nil
+	return printNode(fset, file, &bodyless)
+}
+
+func printNode(fset *token.FileSet, file *ast.File, node ast.Node) string {
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	cfg.Fprint(&buf, fset, &printer.CommentedNode{Node: node, Comments: file.Comments})
+	return buf.String()
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	askv1 "github.com/MasterTuto/ask/proto/ask/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer serves the ask.v1 control API (proto/ask/v1/ask.proto).
+type grpcServer struct {
+	askv1.UnimplementedAskServer
+	config  *Config
+	apiName string
+	api     APIConfig
+	token   string
+
+	mu       sync.Mutex
+	sessions map[string]*grpcSession
+}
+
+// grpcSession is a conversation the server keeps for its lifetime.
+type grpcSession struct {
+	// mu holds one prompt at a time, so turns stay in order.
+	mu      sync.Mutex
+	id      string
+	api     string
+	system  string
+	created time.Time
+	turns   []*askv1.Turn
+}
+
+// serveGRPC handles "ask serve --grpc <addr> [api] [--token t]". addr is
+// host:port, or unix:<path> for a socket only this user can open; TCP
+// listeners need the token as on --http.
+func serveGRPC(config *Config, addr, spec, token string) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+		if token == "" {
+			token = os.Getenv("ASK_SERVE_TOKEN")
+		}
+		// A socket left by a server that's gone would stop the listen.
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			fmt.Printf("Error: %s is in use by another server\n", path)
+			os.Exit(1)
+		}
+		os.Remove(path)
+	} else {
+		token = serveToken("--grpc", addr, token)
+	}
+
+	s := &grpcServer{config: config, token: token, sessions: map[string]*grpcSession{}}
+	s.apiName, s.api = selectAPI(config, spec)
+	var listener net.Listener
+	var err error
+	if network == "unix" {
+		listener, err = listenPrivate(addr)
+	} else {
+		listener, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.authUnary), grpc.StreamInterceptor(s.authStream))
+	askv1.RegisterAskServer(server, s)
+	// Reflection lets grpcurl and the like list the methods.
+	reflection.Register(server)
+	fmt.Fprintf(os.Stderr, "Serving the ask.v1 control API on %s:%s with %s\n", network, addr, s.apiName)
+	if err := server.Serve(listener); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// listenPrivate listens on a unix socket at path that only this user can
+// open. The socket is made in a directory of its own, which no one else can
+// enter, and only moved to path once it's 0600, so there's no moment when
+// others could connect.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".ask-sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "sock")
+	listener, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is cleaned up by its new name on exit, not the old one.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(private, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// authorize checks the bearer token in a call's metadata, when the server
+// has one.
+func (s *grpcServer) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		given, _ := strings.CutPrefix(value, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+}
+
+func (s *grpcServer) authUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *grpcServer) authStream(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// resolve looks up the API spec names, or the server's for an empty spec.
+// Unlike on the command line, an unknown or ambiguous name is the caller's
+// error rather than a question or an exit.
+func (s *grpcServer) resolve(spec string) (string, APIConfig, error) {
+	if spec == "" {
+		return s.apiName, s.api, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if _, ok := s.config.APIs[part]; ok {
+			continue
+		}
+		if base, model, ok := strings.Cut(part, "/"); ok && model != "" {
+			if _, _, ok := providerAPI(s.config, base); ok {
+				continue
+			}
+		}
+		switch candidates := matchAPIs(s.config, part); len(candidates) {
+		case 0:
+			return "", APIConfig{}, status.Errorf(codes.NotFound, "API %q not configured", part)
+		case 1:
+		default:
+			return "", APIConfig{}, status.Errorf(codes.InvalidArgument, "%q matches several APIs: %s", part, strings.Join(candidates, ", "))
+		}
+	}
+	name, api := resolveAPI(s.config, spec)
+	return name, api, nil
+}
+
+func (s *grpcServer) ListAPIs(context.Context, *askv1.ListAPIsRequest) (*askv1.ListAPIsResponse, error) {
+	names := make([]string, 0, len(s.config.APIs))
+	for name := range s.config.APIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resp := &askv1.ListAPIsResponse{}
+	for _, name := range names {
+		api := s.config.APIs[name]
+		resp.Apis = append(resp.Apis, &askv1.API{Name: name, Provider: api.Provider, Model: api.Model, Default: name == s.apiName})
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) Prompt(in *askv1.PromptRequest, stream grpc.ServerStreamingServer[askv1.PromptEvent]) error {
+	if strings.TrimSpace(in.Prompt) == "" {
+		return status.Error(codes.InvalidArgument, "the prompt is empty")
+	}
+	spec, system := in.Api, in.System
+	var session *grpcSession
+	if in.SessionId != "" {
+		if session = s.session(in.SessionId); session == nil {
+			return status.Errorf(codes.NotFound, "no session %s", in.SessionId)
+		}
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if spec == "" {
+			spec = session.api
+		}
+		system = strings.TrimSpace(session.system + "\n\n" + system)
+	}
+	name, api, err := s.resolve(spec)
+	if err != nil {
+		return err
+	}
+
+	req := Request{System: system, Prompt: in.Prompt}
+	if session != nil {
+		req.History = sessionHistory(api, session.turns, req)
+	}
+	entry := newHistoryEntry(name, api, req)
+	// A client that goes away, or can't be sent the answer, stops the
+	// request.
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	api.ctx = ctx
+	resp, err := streamRequest(api, req, func(delta string) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := stream.Send(&askv1.PromptEvent{Event: &askv1.PromptEvent_Delta{Delta: &askv1.Delta{Text: delta}}}); err != nil {
+			cancel()
+		}
+	})
+	if err == nil && ctx.Err() != nil {
+		err = errInterrupted
+	}
+	entry.addResponse(resp)
+	saveHistory(s.config.Settings, entry, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grpc Prompt (%s): %v\n", name, err)
+		if err == errInterrupted {
+			return status.Error(codes.Canceled, err.Error())
+		}
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	done := &askv1.Done{Text: resp.Text, Api: name, Model: resp.Model, FinishReason: resp.FinishReason}
+	if done.Model == "" {
+		done.Model = api.Model
+	}
+	if resp.Usage != nil {
+		done.Usage = &askv1.Usage{InputTokens: int64(resp.Usage.InputTokens), OutputTokens: int64(resp.Usage.OutputTokens)}
+	}
+	if err := stream.Send(&askv1.PromptEvent{Event: &askv1.PromptEvent_Done{Done: done}}); err != nil {
+		return err
+	}
+	// Only a turn the client got is part of the conversation.
+	if session != nil {
+		session.turns = append(session.turns, &askv1.Turn{Role: "user", Text: in.Prompt}, &askv1.Turn{Role: "assistant", Text: resp.Text})
+	}
+	return nil
+}
+
+// sessionHistory is the conversation so far as messages to send ahead of
+// req, leaving out the oldest exchanges when it would not fit api's
+// context.
+func sessionHistory(api APIConfig, turns []*askv1.Turn, req Request) []Message {
+	tok := tokenizerFor(api)
+	budget := promptBudget(api) - tok.Count(req.System) - tok.Count(req.Prompt)
+	start := len(turns)
+	for i := len(turns) - 1; i >= 0; i-- {
+		if budget -= tok.Count(turns[i].Text); budget < 0 {
+			break
+		}
+		start = i
+	}
+	// The history opens with the user, as providers want turns to
+	// alternate from there.
+	for start < len(turns) && turns[start].Role != "user" {
+		start++
+	}
+	var history []Message
+	for _, turn := range turns[start:] {
+		history = append(history, textMessage(turn.Role, turn.Text))
+	}
+	return history
+}
+
+func (s *grpcServer) session(id string) *grpcSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+func (s *grpcServer) CreateSession(_ context.Context, in *askv1.CreateSessionRequest) (*askv1.Session, error) {
+	if in.Api != "" {
+		if _, _, err := s.resolve(in.Api); err != nil {
+			return nil, err
+		}
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	session := &grpcSession{id: hex.EncodeToString(id), api: in.Api, system: in.System, created: time.Now()}
+	s.mu.Lock()
+	s.sessions[session.id] = session
+	s.mu.Unlock()
+	return session.proto(false), nil
+}
+
+func (s *grpcServer) GetSession(_ context.Context, in *askv1.GetSessionRequest) (*askv1.Session, error) {
+	session := s.session(in.Id)
+	if session == nil {
+		return nil, status.Errorf(codes.NotFound, "no session %s", in.Id)
+	}
+	// Waits for a prompt under way, so its turns are whole.
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.proto(true), nil
+}
+
+func (s *grpcServer) ListSessions(context.Context, *askv1.ListSessionsRequest) (*askv1.ListSessionsResponse, error) {
+	s.mu.Lock()
+	sessions := make([]*grpcSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].created.Before(sessions[j].created) })
+	resp := &askv1.ListSessionsResponse{}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, session.proto(false))
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) DeleteSession(_ context.Context, in *askv1.DeleteSessionRequest) (*askv1.DeleteSessionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[in.Id] == nil {
+		return nil, status.Errorf(codes.NotFound, "no session %s", in.Id)
+	}
+	delete(s.sessions, in.Id)
+	return &askv1.DeleteSessionResponse{}, nil
+}
+
+// proto returns the session as the API shows it, with its turns or not.
+func (g *grpcSession) proto(turns bool) *askv1.Session {
+	out := &askv1.Session{Id: g.id, Api: g.api, System: g.system, CreatedUnix: g.created.Unix()}
+	if turns {
+		out.Turns = g.turns
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Colors for highlighted code. Each token resets only the foreground, so
+// highlighting composes with other styles.
+const (
+	colorKeyword = "\x1b[35m"
+	colorString  = "\x1b[32m"
+	colorComment = "\x1b[90m"
+	colorNumber  = "\x1b[33m"
+)
+
+// syntax is what the highlighter knows about a language: enough to color
+// keywords, strings, numbers and comments line by line.
+type syntax struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+}
+
+func keywordSet(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLikeComments = [2]string{"/*", "*/"}
+
+	goSyntax = &syntax{
+		keywords:     keywordSet("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+		lineComments: []string{"//"},
+		blockComment: cLikeComments,
+		quotes:       "\"'`",
+	}
+	pythonSyntax = &syntax{
+		keywords:     keywordSet("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	jsSyntax = &syntax{
+		keywords:     keywordSet("async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof interface let new of return static super switch this throw try type typeof var void while yield null undefined true false enum implements private protected public readonly"),
+		lineComments: []string{"//"},
+		blockComment: cLikeComments,
+		quotes:       "\"'`",
+	}
+	shellSyntax = &syntax{
+		keywords:     keywordSet("if then else elif fi for while until do done case esac in function return local export readonly set unset shift exit break continue"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	rustSyntax = &syntax{
+		keywords:     keywordSet("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while Some None Ok Err"),
+		lineComments: []string{"//"},
+		blockComment: cLikeComments,
+		quotes:       "\"",
+	}
+	cSyntax = &syntax{
+		keywords:     keywordSet("auto break case char class const continue default delete do double else enum extern final float for goto if int long namespace new nullptr private protected public return short signed sizeof static struct switch template this throw try typedef union unsigned using virtual void volatile while boolean import package extends implements interface null true false var val fun"),
+		lineComments: []string{"//"},
+		blockComment: cLikeComments,
+		quotes:       "\"'",
+	}
+	sqlSyntax = &syntax{
+		keywords:     keywordSet("select from where and or not insert into values update set delete create table drop alter add index primary key foreign references join left right inner outer on group by order having limit offset as distinct union all null is in like between case when then else end SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER ADD INDEX PRIMARY KEY FOREIGN REFERENCES JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS DISTINCT UNION ALL NULL IS IN LIKE BETWEEN CASE WHEN THEN ELSE END"),
+		lineComments: []string{"--"},
+		blockComment: cLikeComments,
+		quotes:       "'\"",
+	}
+	rubySyntax = &syntax{
+		keywords:     keywordSet("alias and begin break case class def do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield require"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+	jsonSyntax = &syntax{
+		keywords: keywordSet("true false null"),
+		quotes:   "\"",
+	}
+	yamlSyntax = &syntax{
+		keywords:     keywordSet("true false null yes no"),
+		lineComments: []string{"#"},
+		quotes:       "\"'",
+	}
+)
+
+// syntaxes maps fence languages, including common aliases, to their rules.
+var syntaxes = map[string]*syntax{
+	"go":         goSyntax,
+	"golang":     goSyntax,
+	"python":     pythonSyntax,
+	"py":         pythonSyntax,
+	"javascript": jsSyntax,
+	"js":         jsSyntax,
+	"jsx":        jsSyntax,
+	"typescript": jsSyntax,
+	"ts":         jsSyntax,
+	"tsx":        jsSyntax,
+	"sh":         shellSyntax,
+	"bash":       shellSyntax,
+	"shell":      shellSyntax,
+	"zsh":        shellSyntax,
+	"console":    shellSyntax,
+	"rust":       rustSyntax,
+	"rs":         rustSyntax,
+	"c":          cSyntax,
+	"h":          cSyntax,
+	"cpp":        cSyntax,
+	"c++":        cSyntax,
+	"java":       cSyntax,
+	"kotlin":     cSyntax,
+	"cs":         cSyntax,
+	"csharp":     cSyntax,
+	"sql":        sqlSyntax,
+	"ruby":       rubySyntax,
+	"rb":         rubySyntax,
+	"json":       jsonSyntax,
+	"yaml":       yamlSyntax,
+	"yml":        yamlSyntax,
+	"toml":       yamlSyntax,
+}
+
+// codeHighlighter colors a code block one line at a time, remembering
+// whether a block comment is still open between lines.
+type codeHighlighter struct {
+	syn       *syntax
+	inComment bool
+}
+
+// newCodeHighlighter returns a highlighter for lang, or nil when the
+// language isn't known.
+func newCodeHighlighter(lang string) *codeHighlighter {
+	syn, ok := syntaxes[strings.ToLower(lang)]
+	if !ok {
+		return nil
+	}
+	return &codeHighlighter{syn: syn}
+}
+
+func (h *codeHighlighter) line(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		rest := string(rs[i:])
+
+		comment := h.syn.blockComment
+		if h.inComment || (comment[0] != "" && strings.HasPrefix(rest, comment[0])) {
+			from := 0
+			if !h.inComment {
+				from = len(comment[0])
+			}
+			h.inComment = true
+			end := strings.Index(rest[from:], comment[1])
+			if end < 0 {
+				b.WriteString(colorComment + rest + styleNoColor)
+				return b.String()
+			}
+			end += from + len(comment[1])
+			b.WriteString(colorComment + rest[:end] + styleNoColor)
+			i += len([]rune(rest[:end]))
+			h.inComment = false
+			continue
+		}
+		if h.startsLineComment(rs, i, rest) {
+			b.WriteString(colorComment + rest + styleNoColor)
+			return b.String()
+		}
+
+		r := rs[i]
+		switch {
+		case strings.ContainsRune(h.syn.quotes, r):
+			j := i + 1
+			for j < len(rs) && rs[j] != r {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rs) {
+				j = len(rs) - 1
+			}
+			b.WriteString(colorString + string(rs[i:j+1]) + styleNoColor)
+			i = j + 1
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(rs[i-1])):
+			j := i
+			for j < len(rs) && (isIdentRune(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			b.WriteString(colorNumber + string(rs[i:j]) + styleNoColor)
+			i = j
+		case isIdentRune(r):
+			j := i
+			for j < len(rs) && isIdentRune(rs[j]) {
+				j++
+			}
+			word := string(rs[i:j])
+			if h.syn.keywords[word] {
+				word = colorKeyword + word + styleNoColor
+			}
+			b.WriteString(word)
+			i = j
+		default:
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// startsLineComment reports whether a line comment starts at rs[i]. A "#"
+// only counts at the start of a word, so shell's $# and URLs' anchors
+// aren't mistaken for comments.
+func (h *codeHighlighter) startsLineComment(rs []rune, i int, rest string) bool {
+	for _, c := range h.syn.lineComments {
+		if !strings.HasPrefix(rest, c) {
+			continue
+		}
+		if c == "#" && i > 0 && !unicode.IsSpace(rs[i-1]) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is one recorded run: the command line, the API that answered
+// and the full conversation, including tool calls and their results.
+type HistoryEntry struct {
+	Time     time.Time `json:"time"`
+	Args     []string  `json:"args"`
+	API      string    `json:"api,omitempty"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model,omitempty"`
+	BaseURL  string    `json:"base_url,omitempty"`
+	Messages []Message `json:"messages"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func getHistoryPath() string {
+	return filepath.Join(stateDir(), "history.jsonl")
+}
+
+// newHistoryEntry starts an entry for req sent to the named API.
+func newHistoryEntry(apiName string, api APIConfig, req Request) *HistoryEntry {
+	e := &HistoryEntry{
+		Time:     time.Now(),
+		Args:     os.Args[1:],
+		API:      apiName,
+		Provider: api.Provider,
+		Model:    api.Model,
+		BaseURL:  api.BaseURL,
+	}
+	e.Messages = requestMessages(req)
+	return e
+}
+
+// addResponse records the model's side of the conversation: each round of
+// tool calls and results, then the answer.
+func (e *HistoryEntry) addResponse(resp Response) {
+	for _, step := range resp.Steps {
+		e.addAssistant(step.Thinking, step.Text, step.Calls)
+		e.Messages = append(e.Messages, resultsMessage(step.Calls, step.Results))
+	}
+	if resp.Text != "" || resp.Thinking != "" || len(resp.Images) > 0 {
+		e.addAssistant(resp.Thinking, resp.Text, nil)
+		last := &e.Messages[len(e.Messages)-1]
+		for _, img := range resp.Images {
+			last.Parts = append(last.Parts, attachmentPart("image", "", img.MediaType, img.Data))
+		}
+	}
+}
+
+func (e *HistoryEntry) addAssistant(thinking, text string, calls []toolCall) {
+	var parts []Part
+	if thinking != "" {
+		parts = append(parts, Part{Type: "thinking", Text: thinking})
+	}
+	if text != "" {
+		parts = append(parts, Part{Type: "text", Text: text})
+	}
+	for _, call := range calls {
+		parts = append(parts, Part{Type: "tool_call", ID: call.ID, Name: call.Name, Args: call.Args})
+	}
+	e.Messages = append(e.Messages, Message{Role: "assistant", Parts: parts})
+}
+
+// saveHistory appends e to the history file unless history is turned off,
+// or, with --config-from-env, hasn't been turned on. Failing to record a run
+// never fails the run itself.
+func saveHistory(settings Settings, e *HistoryEntry, err error) {
+	if settings.History == "off" || (configFromEnv && settings.History != "on") {
+		return
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	data, jsonErr := json.Marshal(e)
+	if jsonErr != nil {
+		return
+	}
+
+	path := getHistoryPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	f, openErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if openErr != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// loadHistory reads every recorded entry, oldest first.
+func loadHistory() ([]HistoryEntry, error) {
+	f, err := os.Open(getHistoryPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// runHistory handles "ask history [list [-n N] | show <id> | export <id>
+// [--format json|md] [-o file] | clear]". Entries are numbered from 1,
+// oldest first; "last" is the most recent.
+func runHistory(args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"n": true, "format": true, "o": true})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	sub := "list"
+	if len(parsed.positional) > 0 {
+		sub = parsed.positional[0]
+	}
+
+	if sub == "clear" {
+		if err := os.Remove(getHistoryPath()); err != nil && !os.IsNotExist(err) {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("History cleared.")
+		return
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Println("Error reading history:", err)
+		os.Exit(1)
+	}
+
+	switch sub {
+	case "list":
+		n, err := strconv.Atoi(parsed.value("n", "20"))
+		if err != nil || n < 1 {
+			fmt.Println("Error: -n must be a positive number")
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No history yet.")
+			return
+		}
+		for i := max(0, len(entries)-n); i < len(entries); i++ {
+			e := entries[i]
+			fmt.Printf("%4d  %s  %-20s %s\n", i+1, e.Time.Local().Format("2006-01-02 15:04"), e.label(), e.summary())
+		}
+	case "show", "export":
+		if len(parsed.positional) < 2 {
+			fmt.Printf("Usage: ask history %s <id|last>\n", sub)
+			os.Exit(1)
+		}
+		e, err := findHistoryEntry(entries, parsed.positional[1])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		var out string
+		if sub == "show" || parsed.value("format", "json") == "md" {
+			out = e.markdown()
+		} else if parsed.value("format", "json") == "json" {
+			data, _ := json.MarshalIndent(e, "", "  ")
+			out = string(data)
+		} else {
+			fmt.Println("Error: --format must be json or md")
+			os.Exit(1)
+		}
+		if path := parsed.value("o", ""); path != "" {
+			if err := os.WriteFile(path, []byte(out+"\n"), 0644); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+		fmt.Println(out)
+	default:
+		fmt.Println("Usage: ask history [list [-n N] | show <id> | export <id> [--format json|md] [-o file] | clear]")
+		os.Exit(1)
+	}
+}
+
+func findHistoryEntry(entries []HistoryEntry, id string) (HistoryEntry, error) {
+	if id == "last" && len(entries) > 0 {
+		return entries[len(entries)-1], nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 || n > len(entries) {
+		return HistoryEntry{}, fmt.Errorf("no history entry %s", id)
+	}
+	return entries[n-1], nil
+}
+
+func (e HistoryEntry) label() string {
+	if e.API != "" {
+		return e.API
+	}
+	return e.Provider + ":" + e.Model
+}
+
+// prompt is the text of the last user message, the one that was answered
+// after any earlier turns.
+func (e HistoryEntry) prompt() string {
+	for i := len(e.Messages) - 1; i >= 0; i-- {
+		m := e.Messages[i]
+		if m.Role != "user" {
+			continue
+		}
+		for _, p := range m.Parts {
+			if p.Type == "text" {
+				return p.Text
+			}
+		}
+	}
+	return ""
+}
+
+// summary is the first line of the prompt, shortened.
+func (e HistoryEntry) summary() string {
+	return summarizePrompt(e.prompt())
+}
+
+// summarizePrompt is the first line of prompt, shortened.
+func summarizePrompt(prompt string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	if len([]rune(line)) > 60 {
+		line = string([]rune(line)[:57]) + "..."
+	}
+	return line
+}
+
+// markdown renders the entry for reading, keeping every part visible.
+func (e HistoryEntry) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# ask %s\n\n%s · %s", strings.Join(e.Args, " "), e.Time.Local().Format("2006-01-02 15:04:05"), e.label())
+	if e.API != "" && e.Model != "" {
+		fmt.Fprintf(&b, " · %s", e.Model)
+	}
+	if e.BaseURL != "" {
+		fmt.Fprintf(&b, " · %s", e.BaseURL)
+	}
+	b.WriteString("\n")
+	for _, m := range e.Messages {
+		fmt.Fprintf(&b, "\n## %s\n", m.Role)
+		for _, p := range m.Parts {
+			switch p.Type {
+			case "text":
+				fmt.Fprintf(&b, "\n%s\n", p.Text)
+			case "thinking":
+				fmt.Fprintf(&b, "\n> thinking:\n%s\n", indent(p.Text, "> "))
+			case "image", "document":
+				fmt.Fprintf(&b, "\n[%s %s %s, %s, sha256 %s]\n", p.Type, p.Name, p.MediaType, formatBytes(int64(p.Size)), p.SHA256[:12])
+			case "tool_call":
+				args, _ := json.Marshal(p.Args)
+				fmt.Fprintf(&b, "\n→ %s(%s)\n", p.Name, args)
+			case "tool_result":
+				fmt.Fprintf(&b, "\n← %s:\n```\n%s\n```\n", p.Name, strings.TrimRight(p.Text, "\n"))
+			}
+		}
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "\n## error\n\n%s\n", e.Error)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHookPayload caps the JSON a webhook may send.
+const maxHookPayload = 1 << 20
+
+// hookCallbackTimeout bounds posting a result to a callback.
+const hookCallbackTimeout = 30 * time.Second
+
+// hookVarName is what a payload field must look like to fill a template
+// variable.
+var hookVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// hookServer answers webhooks: POST /hooks/<template> renders the template
+// with the JSON payload's fields and sends it to the API.
+type hookServer struct {
+	config  *Config
+	apiName string
+	api     APIConfig
+	token   string
+	// callbackHosts are the hosts results may be posted to, or with
+	// anyCallback any host at all.
+	callbackHosts []string
+	anyCallback   bool
+	callbacks     *http.Client
+
+	// mu runs one webhook at a time: the request path keeps its state
+	// (the cache, budgets, the history) for a single run of ask.
+	mu sync.Mutex
+}
+
+// hookResult is a webhook's answer, returned or posted to the callback.
+type hookResult struct {
+	Template string `json:"template"`
+	API      string `json:"api"`
+	Text     string `json:"text,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// serveHooks handles "ask serve --http addr [api] [--token t]
+// [--callback-host h]... [--any-callback]". Requests must carry the token as
+// a bearer token; without one only loopback addresses may be listened on.
+// Results are only posted to the callback hosts given, unless anyCallback
+// opens them to any.
+func serveHooks(config *Config, addr, spec, token string, callbackHosts []string, anyCallback bool) {
+	s := &hookServer{
+		config:        config,
+		token:         serveToken("--http", addr, token),
+		callbackHosts: callbackHosts,
+		anyCallback:   anyCallback,
+		callbacks: &http.Client{
+			Timeout: hookCallbackTimeout,
+			// A redirect could lead anywhere the host check doesn't allow.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+	s.apiName, s.api = selectAPI(config, spec)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{template}", s.hook)
+	fmt.Fprintf(os.Stderr, "Serving webhooks on http://%s/hooks/<template> with %s\n", addr, s.apiName)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// serveToken returns the token a server on addr requires, from --token or
+// ASK_SERVE_TOKEN, exiting if there is none and addr isn't a loopback one.
+// flag names the option addr came from.
+func serveToken(flag, addr, token string) string {
+	if token == "" {
+		token = os.Getenv("ASK_SERVE_TOKEN")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		fmt.Printf("Error: %s takes an address such as 127.0.0.1:8080 or :8080\n", flag)
+		os.Exit(1)
+	}
+	if ip := net.ParseIP(host); token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		fmt.Println("Error: listening beyond this machine needs --token or ASK_SERVE_TOKEN, so strangers can't spend your API credit")
+		os.Exit(1)
+	}
+	return token
+}
+
+// hook renders the named template with the payload and answers it. With a
+// callback (?callback=URL or X-Callback-URL) it replies 202 at once and
+// posts the result there when it's ready; otherwise the result is the
+// response.
+func (s *hookServer) hook(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHookPayload+1))
+	if err != nil || len(body) > maxHookPayload {
+		http.Error(w, "payload too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "payload must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	t, err := findTemplate(r.PathValue("template"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// Each top-level field fills the variable of its name, strings as they
+	// are and anything else as JSON. The whole payload is {{input}}, and
+	// follows a template that has no variables.
+	vars := map[string]string{}
+	for k, v := range payload {
+		if !hookVarName.MatchString(k) {
+			continue
+		}
+		if str, ok := v.(string); ok {
+			vars[k] = str
+		} else {
+			data, _ := json.Marshal(v)
+			vars[k] = string(data)
+		}
+	}
+	input := ""
+	if len(t.variables()) == 0 {
+		input = string(body)
+	} else if _, ok := vars["input"]; !ok {
+		vars["input"] = string(body)
+	}
+	prompt, err := t.render(vars, input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	callback := r.URL.Query().Get("callback")
+	if callback == "" {
+		callback = r.Header.Get("X-Callback-URL")
+	}
+	if callback == "" {
+		result, status := s.run(r.Context(), t.Name, prompt), http.StatusOK
+		if result.Error != "" {
+			status = http.StatusBadGateway
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	if err := s.checkCallback(callback); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	go func() {
+		data, _ := json.Marshal(s.run(context.Background(), t.Name, prompt))
+		resp, err := s.callbacks.Post(callback, "application/json", bytes.NewReader(data))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("status %s", resp.Status)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hooks/%s: callback %s failed: %v\n", t.Name, callback, err)
+		}
+	}()
+}
+
+// checkCallback makes sure results may be posted to callback: an http or
+// https URL on one of the callback hosts.
+func (s *hookServer) checkCallback(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback must be an http or https URL")
+	}
+	if s.anyCallback {
+		return nil
+	}
+	for _, host := range s.callbackHosts {
+		if strings.EqualFold(host, u.Hostname()) || strings.EqualFold(host, u.Host) {
+			return nil
+		}
+	}
+	if len(s.callbackHosts) == 0 {
+		return fmt.Errorf("callbacks are off; start the server with --callback-host %s to allow them", u.Hostname())
+	}
+	return fmt.Errorf("callback host %s is not allowed", u.Hostname())
+}
+
+// run sends prompt to the server's API, recording it in the history.
+// Webhooks are answered one at a time; ctx ends with the caller's
+// connection, when the result goes back on it.
+func (s *hookServer) run(ctx context.Context, template, prompt string) hookResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := Request{Prompt: prompt}
+	entry := newHistoryEntry(s.apiName, s.api, req)
+	api := s.api
+	api.ctx = ctx
+	resp, err := sendRequest(api, req)
+	entry.addResponse(resp)
+	saveHistory(s.config.Settings, entry, err)
+	result := hookResult{Template: template, API: s.apiName, Text: resp.Text}
+	if err != nil {
+		result.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "hooks/%s: %v\n", template, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "hooks/%s: answered\n", template)
+	}
+	return result
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// htmlToken is a piece of an HTML document: a start or end tag, or text.
+type htmlToken struct {
+	Kind  int
+	Tag   string
+	Attrs map[string]string
+	Text  string
+}
+
+const (
+	htmlText = iota
+	htmlStart
+	htmlEnd
+)
+
+// htmlRawTags hold text that isn't markup, skipped whole.
+var htmlRawTags = map[string]bool{"script": true, "style": true, "noscript": true, "template": true, "svg": true}
+
+var htmlSpace = regexp.MustCompile(`\s+`)
+
+var htmlAttr = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+)))?`)
+
+// tokenizeHTML splits src into tags and text, tolerating the malformed
+// markup real pages have. Comments, doctypes and the contents of scripts
+// and styles are dropped; entities in text and attributes are decoded.
+func tokenizeHTML(src string) []htmlToken {
+	var tokens []htmlToken
+	for len(src) > 0 {
+		lt := strings.IndexByte(src, '<')
+		if lt < 0 {
+			tokens = append(tokens, htmlToken{Kind: htmlText, Text: html.UnescapeString(src)})
+			break
+		}
+		if lt > 0 {
+			tokens = append(tokens, htmlToken{Kind: htmlText, Text: html.UnescapeString(src[:lt])})
+			src = src[lt:]
+		}
+
+		if strings.HasPrefix(src, "<!--") {
+			end := strings.Index(src, "-->")
+			if end < 0 {
+				break
+			}
+			src = src[end+3:]
+			continue
+		}
+		gt := strings.IndexByte(src, '>')
+		if gt < 0 {
+			break
+		}
+		inner := src[1:gt]
+		src = src[gt+1:]
+		if inner == "" || inner[0] == '!' || inner[0] == '?' {
+			continue
+		}
+
+		if inner[0] == '/' {
+			name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(inner, "/")))
+			if i := strings.IndexAny(name, " \t\n"); i >= 0 {
+				name = name[:i]
+			}
+			tokens = append(tokens, htmlToken{Kind: htmlEnd, Tag: name})
+			continue
+		}
+
+		name := inner
+		if i := strings.IndexAny(inner, " \t\r\n/"); i >= 0 {
+			name = inner[:i]
+		}
+		name = strings.ToLower(name)
+		attrs := map[string]string{}
+		for _, m := range htmlAttr.FindAllStringSubmatch(inner[len(name):], -1) {
+			attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+		}
+		if htmlRawTags[name] && !strings.HasSuffix(inner, "/") {
+			end := strings.Index(strings.ToLower(src), "</"+name)
+			if end < 0 {
+				break
+			}
+			src = src[end:]
+			if gt := strings.IndexByte(src, '>'); gt >= 0 {
+				src = src[gt+1:]
+			}
+			continue
+		}
+		tokens = append(tokens, htmlToken{Kind: htmlStart, Tag: name, Attrs: attrs})
+	}
+	return tokens
+}
+
+// htmlBlockTags start a new paragraph.
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true, "footer": true,
+	"nav": true, "aside": true, "ul": true, "ol": true, "table": true, "tr": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "dl": true,
+	"dt": true, "dd": true, "figure": true, "figcaption": true, "hr": true, "form": true,
+}
+
+// htmlPage is what ask takes from a web page.
+type htmlPage struct {
+	Title string
+	Text  string
+	// Links are the absolute http(s) URLs the page links to, in order,
+	// without fragments or duplicates.
+	Links []string
+}
+
+// How --extract turns a page into text.
+const (
+	// extractReadability keeps the page's main content, as Markdown.
+	extractReadability = "readability"
+	// extractText keeps all of the page's text, navigation and all.
+	extractText = "text"
+	// extractBrowser renders the page in a headless browser first, for
+	// pages built by JavaScript, then extracts it like readability.
+	extractBrowser = "browser"
+)
+
+// parseHTML turns a page fetched from base into text the way extract says,
+// and collects its title and links. Links come from the whole page, so
+// crawling follows the navigation even when the text leaves it out.
+func parseHTML(src string, base *url.URL, extract string) htmlPage {
+	tokens := tokenizeHTML(src)
+	page := htmlPage{Title: htmlTitle(tokens), Links: htmlLinks(tokens, base)}
+	if extract == extractText {
+		page.Text = htmlPlainText(tokens)
+	} else {
+		page.Text = htmlToMarkdown(readableContent(buildHTMLTree(tokens)), base)
+	}
+	return page
+}
+
+// htmlTitle returns the text of the page's <title>.
+func htmlTitle(tokens []htmlToken) string {
+	var title strings.Builder
+	in := false
+	for _, t := range tokens {
+		switch {
+		case t.Tag == "title":
+			in = t.Kind == htmlStart
+		case in && t.Kind == htmlText:
+			title.WriteString(t.Text)
+		}
+	}
+	return strings.Join(strings.Fields(title.String()), " ")
+}
+
+// htmlLinks returns the page's links, resolved against base.
+func htmlLinks(tokens []htmlToken, base *url.URL) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		if t.Kind != htmlStart || t.Tag != "a" {
+			continue
+		}
+		if link := resolveLink(base, t.Attrs["href"]); link != "" && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// htmlPlainText is all the text of a page's body, with headings, list
+// items and preformatted blocks marked as in Markdown.
+func htmlPlainText(tokens []htmlToken) string {
+	var b strings.Builder
+	inHead := false
+	pre := 0
+
+	// newlines counts the newlines the text ends with, and space whether
+	// it ends with a space, so neither has to look back at it.
+	newlines, space := 0, false
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		b.WriteString(s)
+		trimmed := strings.TrimRight(s, "\n")
+		if trimmed == "" {
+			newlines += len(s)
+		} else {
+			newlines = len(s) - len(trimmed)
+		}
+		space = strings.HasSuffix(s, " ")
+	}
+	newline := func(n int) {
+		if b.Len() > 0 && newlines < n {
+			write(strings.Repeat("\n", n-newlines))
+		}
+	}
+
+	for _, t := range tokens {
+		switch t.Kind {
+		case htmlText:
+			switch {
+			case inHead:
+			case pre > 0:
+				write(t.Text)
+			default:
+				text := htmlSpace.ReplaceAllString(t.Text, " ")
+				if strings.HasPrefix(text, " ") && (b.Len() == 0 || space || newlines > 0) {
+					text = text[1:]
+				}
+				write(text)
+			}
+
+		case htmlStart:
+			switch t.Tag {
+			case "head", "title":
+				inHead = true
+			case "body":
+				inHead = false
+			case "br":
+				write("\n")
+			case "li":
+				newline(1)
+				write("- ")
+			case "pre":
+				newline(2)
+				write("```\n")
+				pre++
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				newline(2)
+				write(strings.Repeat("#", int(t.Tag[1]-'0')) + " ")
+			case "td", "th":
+				write(" | ")
+			default:
+				if htmlBlockTags[t.Tag] {
+					newline(2)
+				}
+			}
+
+		case htmlEnd:
+			switch t.Tag {
+			case "head", "title":
+				inHead = false
+			case "pre":
+				if pre > 0 {
+					pre--
+					newline(1)
+					write("```")
+					newline(2)
+				}
+			case "li":
+				newline(1)
+			default:
+				if htmlBlockTags[t.Tag] {
+					newline(2)
+				}
+			}
+		}
+	}
+	return tidyText(b.String())
+}
+
+// tidyText trims trailing spaces from each line and collapses runs of
+// blank lines.
+func tidyText(s string) string {
+	lines := strings.Split(s, "\n")
+	var out []string
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if strings.TrimSpace(line) == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// resolveLink makes href absolute against base, dropping the fragment. It
+// returns "" for links that aren't http(s).
+func resolveLink(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := base.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// htmlNode is an element of a parsed page, or a text node when Tag is "".
+type htmlNode struct {
+	Tag      string
+	Attrs    map[string]string
+	Text     string
+	Parent   *htmlNode
+	Children []*htmlNode
+}
+
+// htmlVoidTags never have content or an end tag.
+var htmlVoidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlImpliedEnds lists, for tags whose end tag may be left out, the tags
+// that end them by starting.
+var htmlImpliedEnds = map[string][]string{
+	"p": {"p"}, "li": {"li"}, "dt": {"dt", "dd"}, "dd": {"dt", "dd"}, "option": {"option"},
+	"td": {"td", "th", "tr", "thead", "tbody", "tfoot"}, "th": {"td", "th", "tr", "thead", "tbody", "tfoot"},
+	"tr": {"tr", "thead", "tbody", "tfoot"}, "thead": {"tbody", "tfoot"}, "tbody": {"tbody", "tfoot"},
+}
+
+// htmlScopes stop the search for an element to end implicitly: an <li>
+// ends the <li> of its own list, not one the list is nested in.
+var htmlScopes = map[string]bool{"ul": true, "ol": true, "dl": true, "table": true, "body": true, "html": true}
+
+// buildHTMLTree arranges tokens into a tree under an unnamed root, closing
+// elements whose end tags were left out and ignoring stray end tags, much
+// as browsers do.
+func buildHTMLTree(tokens []htmlToken) *htmlNode {
+	root := &htmlNode{}
+	current := root
+	for _, t := range tokens {
+		switch t.Kind {
+		case htmlText:
+			current.Children = append(current.Children, &htmlNode{Text: t.Text, Parent: current})
+
+		case htmlStart:
+			if htmlBlockTags[t.Tag] {
+				// A block ends an open paragraph.
+				for n := current; n != root && !htmlScopes[n.Tag]; n = n.Parent {
+					if n.Tag == "p" {
+						current = n.Parent
+						break
+					}
+				}
+			}
+			// A new cell ends the cell before it and maybe its row too.
+			for ended := true; ended; {
+				ended = false
+				for n := current; n != root && !htmlScopes[n.Tag]; n = n.Parent {
+					if ends(htmlImpliedEnds[n.Tag], t.Tag) {
+						current, ended = n.Parent, true
+						break
+					}
+				}
+			}
+			node := &htmlNode{Tag: t.Tag, Attrs: t.Attrs, Parent: current}
+			current.Children = append(current.Children, node)
+			if !htmlVoidTags[t.Tag] {
+				current = node
+			}
+
+		case htmlEnd:
+			for n := current; n != root; n = n.Parent {
+				if n.Tag == t.Tag {
+					current = n.Parent
+					break
+				}
+			}
+		}
+	}
+	return root
+}
+
+func ends(enders []string, tag string) bool {
+	for _, e := range enders {
+		if e == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent is all the text under n, as it is.
+func (n *htmlNode) textContent() string {
+	if n.Tag == "" {
+		return n.Text
+	}
+	var b strings.Builder
+	for _, c := range n.Children {
+		b.WriteString(c.textContent())
+	}
+	return b.String()
+}
+
+// find returns the elements under n, n included, that match.
+func (n *htmlNode) find(match func(*htmlNode) bool) []*htmlNode {
+	var found []*htmlNode
+	if n.Tag != "" && match(n) {
+		found = append(found, n)
+	}
+	for _, c := range n.Children {
+		found = append(found, c.find(match)...)
+	}
+	return found
+}
+
+// htmlInlineBreak stands for a <br> in inline text until whitespace has
+// been collapsed.
+const htmlInlineBreak = "\x00"
+
+// htmlMarkdownWriter renders a page's tree as Markdown, block by block:
+// inline content gathers until a block ends it, then is written out with
+// the prefix of the lists and quotes it is in.
+type htmlMarkdownWriter struct {
+	out    strings.Builder
+	inline strings.Builder
+	base   *url.URL
+	// prefix starts every line; marker, when set, starts the next one
+	// instead, for the first line of a list item.
+	prefix, marker string
+	// tight is set inside list items, whose blocks aren't separated by
+	// blank lines; listStart is set for the first item of a list that
+	// isn't in another, which is.
+	tight     int
+	listStart bool
+}
+
+// htmlToMarkdown renders n and everything under it as Markdown, with links
+// resolved against base.
+func htmlToMarkdown(n *htmlNode, base *url.URL) string {
+	w := &htmlMarkdownWriter{base: base}
+	w.block(n)
+	w.flush()
+	return tidyText(w.out.String())
+}
+
+// isHTMLBlock reports whether n is laid out as a block of its own.
+func isHTMLBlock(n *htmlNode) bool {
+	switch n.Tag {
+	case "li", "html", "body", "thead", "tbody", "tfoot":
+		return true
+	}
+	return htmlBlockTags[n.Tag]
+}
+
+// block renders the children of n, blocks as blocks and the rest inline.
+func (w *htmlMarkdownWriter) block(n *htmlNode) {
+	for _, c := range n.Children {
+		if c.Tag == "" || !isHTMLBlock(c) {
+			w.inline.WriteString(w.inlineMarkdown(c))
+			continue
+		}
+		w.element(c)
+	}
+}
+
+// element renders a block element.
+func (w *htmlMarkdownWriter) element(n *htmlNode) {
+	w.flush()
+	switch n.Tag {
+	case "head":
+		return
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.inline.WriteString(strings.Repeat("#", int(n.Tag[1]-'0')) + " " + w.inlineMarkdown(n))
+	case "hr":
+		w.write("---")
+	case "pre":
+		w.write("```" + codeLanguage(n) + "\n" + strings.Trim(n.textContent(), "\n") + "\n```")
+	case "blockquote":
+		saved := w.prefix
+		w.prefix += "> "
+		w.block(n)
+		w.flush()
+		w.prefix = saved
+	case "ul", "ol":
+		w.list(n)
+	case "table":
+		w.table(n)
+	default:
+		w.block(n)
+	}
+	w.flush()
+}
+
+// list renders the items of a list, numbered for <ol>, with what's in them
+// indented under their marker.
+func (w *htmlMarkdownWriter) list(n *htmlNode) {
+	number := 1
+	if start := n.Attrs["start"]; start != "" {
+		fmt.Sscan(start, &number)
+	}
+	saved := w.prefix
+	w.listStart = w.tight == 0
+	w.tight++
+	for _, item := range n.Children {
+		if item.Tag != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Tag == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		w.marker = saved + marker
+		w.prefix = saved + strings.Repeat(" ", len(marker))
+		w.block(item)
+		w.flush()
+		w.marker = ""
+	}
+	w.tight--
+	w.prefix = saved
+}
+
+// table renders a table as a Markdown table, its first row as the header.
+func (w *htmlMarkdownWriter) table(n *htmlNode) {
+	var rows [][]string
+	width := 0
+	for _, tr := range n.find(func(e *htmlNode) bool { return e.Tag == "tr" }) {
+		var row []string
+		for _, cell := range tr.Children {
+			if cell.Tag == "td" || cell.Tag == "th" {
+				text := strings.Join(strings.Fields(strings.ReplaceAll(w.inlineMarkdown(cell), htmlInlineBreak, " ")), " ")
+				row = append(row, strings.ReplaceAll(text, "|", `\|`))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+			width = max(width, len(row))
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString(strings.Repeat("| --- ", width) + "|\n")
+		}
+	}
+	w.write(strings.TrimRight(b.String(), "\n"))
+}
+
+// inlineMarkdown renders n as inline Markdown. Whitespace is left for
+// flush to collapse.
+func (w *htmlMarkdownWriter) inlineMarkdown(n *htmlNode) string {
+	if n.Tag == "" {
+		return n.Text
+	}
+	inner := func() string {
+		var b strings.Builder
+		for _, c := range n.Children {
+			b.WriteString(w.inlineMarkdown(c))
+		}
+		return b.String()
+	}
+	wrap := func(mark string) string {
+		text := inner()
+		if strings.TrimSpace(text) == "" {
+			return text
+		}
+		// Keep the marks against the text, as Markdown needs.
+		lead := text[:len(text)-len(strings.TrimLeft(text, " \t\n"))]
+		trail := text[len(strings.TrimRight(text, " \t\n")):]
+		return lead + mark + strings.TrimSpace(text) + mark + trail
+	}
+
+	switch n.Tag {
+	case "br":
+		return htmlInlineBreak
+	case "img":
+		if alt := strings.TrimSpace(n.Attrs["alt"]); alt != "" {
+			return fmt.Sprintf("![%s](%s)", alt, resolveLink(w.base, n.Attrs["src"]))
+		}
+		return ""
+	case "a":
+		text := inner()
+		href := resolveLink(w.base, n.Attrs["href"])
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		return "[" + strings.TrimSpace(text) + "](" + href + ")"
+	case "strong", "b":
+		return wrap("**")
+	case "em", "i":
+		return wrap("_")
+	case "code", "kbd", "samp", "tt":
+		code := strings.Join(strings.Fields(n.textContent()), " ")
+		if code == "" {
+			return ""
+		}
+		fence := "`"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + code + fence
+	case "button", "select", "input", "textarea", "head":
+		return ""
+	}
+	if isHTMLBlock(n) {
+		return " " + inner() + " "
+	}
+	return inner()
+}
+
+// flush writes out the inline content gathered so far as a paragraph.
+func (w *htmlMarkdownWriter) flush() {
+	text := w.inline.String()
+	w.inline.Reset()
+	var lines []string
+	for _, line := range strings.Split(text, htmlInlineBreak) {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	w.write(strings.Join(lines, "\n"))
+}
+
+// write adds a block, separated from the one before it and with every
+// line prefixed.
+func (w *htmlMarkdownWriter) write(block string) {
+	if block == "" {
+		return
+	}
+	if w.out.Len() > 0 {
+		if w.tight > 0 && !w.listStart {
+			w.out.WriteString("\n")
+		} else {
+			w.out.WriteString("\n\n")
+		}
+	}
+	for i, line := range strings.Split(block, "\n") {
+		if i > 0 {
+			w.out.WriteString("\n")
+		}
+		prefix := w.prefix
+		if w.marker != "" {
+			prefix, w.marker = w.marker, ""
+		}
+		w.out.WriteString(prefix + line)
+	}
+	w.listStart = false
+}
+
+// codeLanguage returns the language a <pre> block's class, or its <code>'s,
+// names, as in class="language-go" or "lang-py".
+func codeLanguage(pre *htmlNode) string {
+	for _, n := range append([]*htmlNode{pre}, pre.Children...) {
+		for _, class := range strings.Fields(n.Attrs["class"]) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				if lang, ok := strings.CutPrefix(class, prefix); ok {
+					return lang
+				}
+			}
+		}
+	}
+	return ""
+}
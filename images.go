@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// imageModel reports whether api's model only makes images, through
+// OpenAI's images endpoint rather than chat.
+func imageModel(api APIConfig) bool {
+	model := strings.ToLower(api.Model)
+	return api.Provider == ProviderOpenAI && (strings.HasPrefix(model, "gpt-image") || strings.HasPrefix(model, "dall-e"))
+}
+
+// callOpenAIImages generates images for req's prompt with an OpenAI image
+// model.
+func callOpenAIImages(config APIConfig, req Request) (Response, error) {
+	payload := map[string]interface{}{"model": config.Model, "prompt": req.Prompt, "n": 1}
+	// gpt-image models always answer in base64; DALL·E answers with URLs
+	// unless asked not to.
+	if strings.HasPrefix(strings.ToLower(config.Model), "dall-e") {
+		payload["response_format"] = "b64_json"
+	}
+	result, raw, err := postJSONRaw(config, config.BaseURL+"/images/generations", payload, openAIHeaders(config))
+	if err != nil {
+		return Response{}, err
+	}
+
+	resp := Response{Raw: raw, Model: config.Model}
+	data, _ := result["data"].([]interface{})
+	for _, item := range data {
+		d, _ := item.(map[string]interface{})
+		b64, _ := d["b64_json"].(string)
+		img, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(img) == 0 {
+			continue
+		}
+		resp.Images = append(resp.Images, Image{MediaType: "image/png", Data: img})
+		if revised, _ := d["revised_prompt"].(string); revised != "" {
+			resp.Text = "Revised prompt: " + revised
+		}
+	}
+	if u, ok := result["usage"].(map[string]interface{}); ok {
+		in, _ := u["input_tokens"].(float64)
+		out, _ := u["output_tokens"].(float64)
+		resp.Usage = &Usage{InputTokens: int(in), OutputTokens: int(out)}
+	}
+	if len(resp.Images) == 0 {
+		return resp, fmt.Errorf("%s returned no image", config.Model)
+	}
+	return resp, nil
+}
+
+// dataURLImage decodes a base64 data: URL, as image parts of chat answers
+// come.
+func dataURLImage(url string) (Image, bool) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok || !strings.HasPrefix(url, "data:") || !strings.HasSuffix(header, ";base64") {
+		return Image{}, false
+	}
+	img, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return Image{}, false
+	}
+	return Image{MediaType: strings.TrimSuffix(header, ";base64"), Data: img}, true
+}
+
+// partImages are the images among parts.
+func partImages(parts []Part) []Image {
+	var images []Image
+	for _, p := range parts {
+		if p.Type == "image" {
+			images = append(images, Image{MediaType: p.MediaType, Data: p.Data})
+		}
+	}
+	return images
+}
+
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// saveImages writes images into dir, named after the prompt they answer
+// ("a-fox-in-the-snow.png", then "-2", "-3" for more), never over an
+// existing file, and returns their paths.
+func saveImages(dir, prompt string, images []Image) ([]string, error) {
+	base := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(prompt), "-"), "-")
+	if len(base) > 40 {
+		base = strings.TrimRight(base[:40], "-")
+	}
+	if base == "" {
+		base = "image"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	n := 1
+	for _, img := range images {
+		ext := imageExtensions[img.MediaType]
+		if ext == "" {
+			ext = ".bin"
+		}
+		for {
+			name := base + ext
+			if n > 1 {
+				name = fmt.Sprintf("%s-%d%s", base, n, ext)
+			}
+			n++
+			path := filepath.Join(dir, name)
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if os.IsExist(err) {
+				continue
+			}
+			if err != nil {
+				return paths, err
+			}
+			_, err = f.Write(img.Data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+			break
+		}
+	}
+	return paths, nil
+}
+
+// saveAnswerImages saves the images in resp to --image-dir (the current
+// directory by default) and returns where they went. Failing to save one is
+// fatal: the image would otherwise be lost.
+func saveAnswerImages(parsed *cliArgs, req Request, resp Response) []string {
+	if len(resp.Images) == 0 {
+		return nil
+	}
+	paths, err := saveImages(parsed.value("image-dir", "."), req.Prompt, resp.Images)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: saving images:", err)
+		os.Exit(1)
+	}
+	return paths
+}
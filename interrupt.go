@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// interrupts is the parent of every request's context. Ctrl-C during a
+// request cancels it, so the request stops cleanly and what has arrived so
+// far can still be shown and recorded; the next request to begin gets a
+// new one.
+var (
+	interruptMu                  sync.Mutex
+	interrupts, cancelInterrupts = context.WithCancel(context.Background())
+)
+
+// errInterrupted is what a request cancelled by Ctrl-C fails with.
+var errInterrupted = errors.New("interrupted")
+
+// inFlight counts the requests under way; Ctrl-C only cancels when there
+// are some, and otherwise exits as it always has.
+var inFlight atomic.Int32
+
+// serving is set while ask serves requests from clients, whose Ctrl-C
+// shuts the server down instead of cancelling what's under way.
+var serving atomic.Bool
+
+// catchInterrupts makes the first Ctrl-C during a request cancel it, and a
+// second one, or one at any other time, exit at once.
+func catchInterrupts() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			interruptMu.Lock()
+			if serving.Load() || inFlight.Load() == 0 || interrupts.Err() != nil {
+				os.Exit(130)
+			}
+			cancelInterrupts()
+			interruptMu.Unlock()
+		}
+	}()
+}
+
+// beginRequest marks a request with api as under way until the function it
+// returns is called, and returns api carrying the request's context. A
+// request made as part of another, or with a context its caller set, keeps
+// that context.
+func beginRequest(api APIConfig) (APIConfig, func()) {
+	inFlight.Add(1)
+	if api.ctx != nil {
+		return api, func() { inFlight.Add(-1) }
+	}
+	interruptMu.Lock()
+	if interrupts.Err() != nil {
+		interrupts, cancelInterrupts = context.WithCancel(context.Background())
+	}
+	ctx, cancel := context.WithCancel(interrupts)
+	interruptMu.Unlock()
+	api.ctx = ctx
+	return api, func() {
+		cancel()
+		inFlight.Add(-1)
+	}
+}
+
+// requestContext is the context requests with api are made in: that of the
+// request under way, or one that's never cancelled outside of one.
+func (api APIConfig) requestContext() context.Context {
+	if api.ctx != nil {
+		return api.ctx
+	}
+	return context.Background()
+}
+
+// interruptedErr turns the error of a request whose context was cancelled
+// into errInterrupted, whatever layer it came up through.
+func interruptedErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return errInterrupted
+	}
+	return err
+}
+
+// sleep waits for d, or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return errInterrupted
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// keyState is where an API's key rotation has got to, kept between runs.
+type keyState struct {
+	// Next is the key round-robin rotation uses next.
+	Next int `json:"next"`
+	// Current is the key "on-429" rotation keeps using until it's rate
+	// limited.
+	Current int `json:"current"`
+}
+
+func getKeyStatePath() string {
+	return filepath.Join(stateDir(), "keys.json")
+}
+
+// keyMu serializes reading and writing the key state within a process.
+var keyMu sync.Mutex
+
+// rotatingKeys holds the keys, as sent, of APIs with more than one, so a
+// 429 to one of them moves on to the next key rather than waiting.
+var rotatingKeys sync.Map
+
+// statusError is a provider's reply with an error status.
+type statusError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	return e.Status + "\n" + e.Body
+}
+
+// rateLimited reports whether err is a 429 from the provider.
+func rateLimited(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.Code == http.StatusTooManyRequests
+}
+
+// pickKey chooses the key for a request to api from its api_keys: the next
+// in turn, or with key_rotation "on-429" the one in use until it's rate
+// limited. It returns the key and its index.
+func pickKey(api APIConfig) (string, int) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	states := loadKeyStates()
+	st := states[api.name]
+	var i int
+	if api.KeyRotation == "on-429" {
+		i = st.Current % len(api.APIKeys)
+	} else {
+		i = st.Next % len(api.APIKeys)
+		st.Next = i + 1
+	}
+	states[api.name] = st
+	saveKeyStates(states)
+	return api.APIKeys[i], i
+}
+
+// skipKey moves api off key i after it was rate limited.
+func skipKey(api APIConfig, i int) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	states := loadKeyStates()
+	st := states[api.name]
+	st.Current = (i + 1) % len(api.APIKeys)
+	states[api.name] = st
+	saveKeyStates(states)
+}
+
+func loadKeyStates() map[string]keyState {
+	states := map[string]keyState{}
+	if data, err := os.ReadFile(getKeyStatePath()); err == nil {
+		json.Unmarshal(data, &states)
+	}
+	return states
+}
+
+// saveKeyStates writes the key state. Losing it only restarts rotation at
+// the first key, so errors are ignored.
+func saveKeyStates(states map[string]keyState) {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return
+	}
+	path := getKeyStatePath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	writeFileAtomic(path, data)
+}
+
+// withKey returns api set up to use key alone.
+func withKey(api APIConfig, key string) APIConfig {
+	if len(api.APIKeys) > 1 {
+		if expanded, err := expandEnv(key); err == nil {
+			rotatingKeys.Store(expanded, true)
+		}
+	}
+	api.APIKey, api.APIKeys = key, nil
+	return api
+}
+
+// tryKeys makes a request with try using one of api's keys and, while the
+// provider answers 429, each of the others in turn.
+func tryKeys(api APIConfig, try func(APIConfig) (Response, error), canRetry func(Response) bool) (Response, error) {
+	if len(api.APIKeys) < 2 {
+		return try(api)
+	}
+	var resp Response
+	var err error
+	for attempt := 0; attempt < len(api.APIKeys); attempt++ {
+		key, i := pickKey(api)
+		resp, err = try(withKey(api, key))
+		if !rateLimited(err) || (canRetry != nil && !canRetry(resp)) || attempt == len(api.APIKeys)-1 {
+			break
+		}
+		skipKey(api, i)
+		notice := fmt.Sprintf("%s key %d (%s) is rate limited; trying the next", api.name, i+1, keyLabel(key))
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			notice = styleDim + notice + styleReset
+		}
+		fmt.Fprintln(os.Stderr, notice)
+	}
+	return resp, err
+}
+
+// usesRotatingKey reports whether req carries the key of an API with more
+// than one, in a header or the URL.
+func usesRotatingKey(req *http.Request) bool {
+	found := false
+	rotatingKeys.Range(func(k, _ interface{}) bool {
+		key := k.(string)
+		if key == "" {
+			return true
+		}
+		if strings.Contains(req.URL.RawQuery, key) {
+			found = true
+		}
+		for _, values := range req.Header {
+			for _, v := range values {
+				if strings.Contains(v, key) {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// keyLabel identifies a key in notices and the usage ledger without giving
+// it away: its last four characters.
+func keyLabel(key string) string {
+	if expanded, err := expandEnv(key); err == nil {
+		key = expanded
+	}
+	if len(key) < 12 {
+		return "…"
+	}
+	return "…" + key[len(key)-4:]
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// languageHint is one clue to a code block's language: lines matching re
+// count weight towards lang.
+type languageHint struct {
+	lang   string
+	re     *regexp.Regexp
+	weight int
+}
+
+func hint(lang, pattern string, weight int) languageHint {
+	return languageHint{lang, regexp.MustCompile(pattern), weight}
+}
+
+// shebangs maps the interpreter named on a #! line to its language.
+var shebangs = map[string]string{
+	"sh": "bash", "bash": "bash", "zsh": "bash", "dash": "bash",
+	"python": "python", "python3": "python", "node": "javascript",
+	"ruby": "ruby", "perl": "perl",
+}
+
+var languageHints = []languageHint{
+	hint("go", `^package \w+$`, 3),
+	hint("go", `^func (\(\w+ \*?\w+\) )?\w+\(`, 3),
+	hint("go", `\w+ := `, 1),
+	hint("go", `\berr != nil\b`, 2),
+	hint("go", `\bfmt\.\w+\(`, 2),
+	hint("go", `^import \($`, 2),
+
+	hint("python", `^\s*def \w+\(.*\)( -> .+)?:\s*$`, 3),
+	hint("python", `^\s*class \w+(\(.*\))?:\s*$`, 3),
+	hint("python", `^\s*from [\w.]+ import \w+`, 3),
+	hint("python", `^\s*import \w+(\.\w+)*( as \w+)?\s*$`, 1),
+	hint("python", `^\s*(elif .*|else|try|except.*|finally):\s*$`, 2),
+	hint("python", `^\s*(for \w+(, \w+)* in|if|while|with) .+:\s*$`, 2),
+	hint("python", `\bself\.\w+`, 1),
+	hint("python", `^if __name__ == `, 3),
+	hint("python", `\bprint\(f?["']`, 1),
+
+	hint("javascript", `^\s*(const|let|var) \w+ = `, 1),
+	hint("javascript", `\bfunction\s*\w*\s*\(`, 2),
+	hint("javascript", `\) => `, 2),
+	hint("javascript", `\bconsole\.log\(`, 3),
+	hint("javascript", `\brequire\(['"]`, 2),
+	hint("javascript", `^\s*export (default |const |function |class )`, 2),
+	hint("javascript", `^\s*import .+ from ['"]`, 2),
+	hint("javascript", `\bdocument\.\w+`, 2),
+
+	hint("typescript", `^\s*(export )?(interface|type) \w+ (=|\{)`, 3),
+	hint("typescript", `\w\??: (string|number|boolean|any|void)\b`, 2),
+
+	hint("rust", `^\s*(pub )?fn \w+`, 3),
+	hint("rust", `\blet mut \w+`, 3),
+	hint("rust", `\b(println|vec|format)!\(`, 3),
+	hint("rust", `^\s*use \w+(::\w+)+`, 2),
+	hint("rust", `^\s*impl\b`, 2),
+
+	hint("c", `^#include\s*[<"]`, 3),
+	hint("c", `\bint main\(`, 2),
+	hint("c", `\bprintf\(`, 1),
+	hint("cpp", `\bstd::\w+`, 3),
+	hint("cpp", `^using namespace \w+;`, 3),
+
+	hint("java", `^\s*public (static )?(final )?(class|void|interface)\b`, 3),
+	hint("java", `\bSystem\.out\.print`, 3),
+	hint("java", `^import java\.`, 3),
+
+	hint("ruby", `^\s*def \w+[!?]?(\(.*\))?\s*$`, 2),
+	hint("ruby", `^\s*end\s*$`, 1),
+	hint("ruby", `^\s*puts `, 2),
+	hint("ruby", `\.each do \|`, 3),
+	hint("ruby", `^\s*require ['"]`, 2),
+
+	hint("sql", `(?i)^\s*select\b.+\bfrom\b`, 3),
+	hint("sql", `(?i)^\s*(insert into|create table|alter table|delete from|drop table)\b`, 3),
+	hint("sql", `(?i)^\s*update \w+ set\b`, 3),
+	hint("sql", `(?i)^\s*(where|group by|order by|join)\b`, 1),
+
+	hint("bash", `^\s*(sudo|apt|apt-get|brew|npm|npx|pip|pip3|git|cd|ls|echo|export|curl|wget|mkdir|docker|kubectl|chmod|cp|mv|rm|go|cargo|make|yarn|tar|ssh)\s`, 2),
+	hint("bash", `^\s*(if \[|fi$|then$|done$|do$|esac$)`, 2),
+	hint("bash", `\| *(grep|awk|sed|xargs|sort|head|tail|wc)\b`, 2),
+	hint("bash", `^\s*\$ \S`, 2),
+
+	hint("yaml", `^[\w.-]+:( .*)?$`, 1),
+	hint("yaml", `^\s+- [\w"']`, 1),
+	hint("yaml", `^---$`, 2),
+
+	hint("html", `(?i)^\s*<(!doctype|html|head|body|div|span|p|a|ul|script)\b`, 3),
+	hint("css", `^\s*[.#]?[\w-]+( [.#]?[\w-]+)* \{$`, 2),
+	hint("css", `^\s*[\w-]+: [^;]+;$`, 1),
+}
+
+// minLanguageScore is how much evidence detectLanguage wants before naming
+// a language.
+const minLanguageScore = 3
+
+// detectLanguage guesses the language of a code block that has no language
+// tag, from a #! line, valid JSON or the hints above. It returns "" when
+// nothing stands out.
+func detectLanguage(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return ""
+	}
+	if strings.HasPrefix(trimmed, "#!") {
+		line, _, _ := strings.Cut(trimmed, "\n")
+		fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+		if len(fields) > 0 {
+			interp := fields[0][strings.LastIndex(fields[0], "/")+1:]
+			if interp == "env" && len(fields) > 1 {
+				interp = fields[1]
+			}
+			if lang, ok := shebangs[interp]; ok {
+				return lang
+			}
+		}
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+
+	scores := map[string]int{}
+	for _, line := range strings.Split(code, "\n") {
+		for _, h := range languageHints {
+			if h.re.MatchString(line) {
+				scores[h.lang] += h.weight
+			}
+		}
+	}
+	// TypeScript is JavaScript with types, and C++ is mostly C.
+	if scores["typescript"] > 0 {
+		scores["typescript"] += scores["javascript"]
+	}
+	if scores["cpp"] > 0 {
+		scores["cpp"] += scores["c"]
+	}
+
+	best, bestScore := "", 0
+	for _, h := range languageHints {
+		if s := scores[h.lang]; s > bestScore {
+			best, bestScore = h.lang, s
+		}
+	}
+	if bestScore < minLanguageScore {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Budget caps what an API may spend, in US dollars at list prices.
+type Budget struct {
+	Daily   float64 `json:"daily,omitempty"`
+	Monthly float64 `json:"monthly,omitempty"`
+	// OnExceed is "refuse" (the default) to fail requests that would go
+	// over, or "warn" to send them anyway with a warning.
+	OnExceed string `json:"on_exceed,omitempty"`
+}
+
+// LedgerEntry records one request's usage. The ledger keeps one for every
+// request any provider answers, whether or not history is on, so budgets
+// can be checked against what was actually spent.
+type LedgerEntry struct {
+	Time         time.Time `json:"time"`
+	API          string    `json:"api,omitempty"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	// Cost is in US dollars at list prices, or null when the model's price
+	// isn't known.
+	Cost *float64 `json:"cost"`
+	// Estimated is set when the provider didn't report usage and the
+	// tokens were counted locally.
+	Estimated bool `json:"estimated,omitempty"`
+	// Key is the last characters of the API key that served the request.
+	Key string `json:"key,omitempty"`
+	// Characters is how many characters a machine translation provider,
+	// which bills by the character rather than the token, translated.
+	Characters int `json:"characters,omitempty"`
+	// Cached is set for answers served from the response cache. They cost
+	// nothing and are only recorded for the cache hit rate ask dash shows.
+	Cached bool `json:"cached,omitempty"`
+}
+
+func getLedgerPath() string {
+	return filepath.Join(stateDir(), "usage.jsonl")
+}
+
+// ledgerMu keeps concurrent tool calls and server requests from
+// interleaving their lines.
+var ledgerMu sync.Mutex
+
+// recordUsage appends resp's usage to the ledger. Failed requests that
+// produced nothing aren't recorded.
+func recordUsage(api APIConfig, req Request, resp Response) {
+	if resp.Usage == nil && resp.Text == "" && len(resp.Images) == 0 {
+		return
+	}
+	e := LedgerEntry{Time: time.Now(), API: api.name, Provider: api.Provider, Model: resp.Model}
+	if e.Model == "" {
+		e.Model = api.Model
+	}
+	if api.APIKey != "" {
+		e.Key = keyLabel(api.APIKey)
+	}
+	if resp.Usage != nil {
+		e.InputTokens, e.OutputTokens = resp.Usage.InputTokens, resp.Usage.OutputTokens
+	} else {
+		e.InputTokens, e.OutputTokens = countTokens(api, req), tokenizerFor(api).Count(resp.Text)
+		e.Estimated = true
+	}
+	if cost, ok := costOf(api.Provider, e.Model, Usage{InputTokens: e.InputTokens, OutputTokens: e.OutputTokens}); ok {
+		e.Cost = &cost
+	}
+	appendLedger(e)
+}
+
+// recordSpend appends e, the usage of a request to api that isn't a chat
+// (embeddings, reranking, machine translation), on model and costing cost;
+// priced is false when model's price isn't known.
+func recordSpend(api APIConfig, model string, e LedgerEntry, cost float64, priced bool) {
+	e.Time, e.API, e.Provider, e.Model = time.Now(), api.name, api.Provider, model
+	if api.APIKey != "" {
+		e.Key = keyLabel(api.APIKey)
+	}
+	if priced {
+		e.Cost = &cost
+	}
+	appendLedger(e)
+}
+
+// recordCacheHit notes in the ledger that api's answer came from the cache.
+func recordCacheHit(api APIConfig, resp Response) {
+	e := LedgerEntry{Time: time.Now(), API: api.name, Provider: api.Provider, Model: resp.Model, Cached: true}
+	if e.Model == "" {
+		e.Model = api.Model
+	}
+	appendLedger(e)
+}
+
+func appendLedger(e LedgerEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	path := getLedgerPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// loadLedger calls fn for every ledger entry, oldest first.
+func loadLedger(fn func(e LedgerEntry)) error {
+	f, err := os.Open(getLedgerPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e LedgerEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			fn(e)
+		}
+	}
+	return scanner.Err()
+}
+
+// spent is what the named API has cost today and this month, local time.
+func spent(apiName string, now time.Time) (today, month float64, err error) {
+	y, m, d := now.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	err = loadLedger(func(e LedgerEntry) {
+		if e.API != apiName || e.Cost == nil || e.Cached || e.Time.Before(monthStart) {
+			return
+		}
+		month += *e.Cost
+		if !e.Time.Before(dayStart) {
+			today += *e.Cost
+		}
+	})
+	return today, month, err
+}
+
+// budgetWarned keeps a "warn" budget from repeating itself on every turn
+// of a tool loop.
+var budgetWarned sync.Map
+
+// checkBudget fails a request that would take api over its budget, going
+// by what the ledger says it has spent plus what req's input will cost.
+// The answer's cost can't be known beforehand, so a request is only
+// refused once the input alone would cross the line.
+func checkBudget(api APIConfig, req Request) error {
+	if !hasBudget(api) {
+		return nil
+	}
+	return checkUsage(api, Usage{InputTokens: countTokens(api, req)})
+}
+
+// checkUsage is checkBudget for a request that is to use usage: its next
+// input, and what its earlier rounds have used that the ledger doesn't
+// have yet.
+func checkUsage(api APIConfig, usage Usage) error {
+	if !hasBudget(api) {
+		return nil
+	}
+	cost, ok := costOf(api.Provider, api.Model, usage)
+	return checkCost(api, api.Model, cost, ok)
+}
+
+func hasBudget(api APIConfig) bool {
+	return api.Budget != nil && (api.Budget.Daily > 0 || api.Budget.Monthly > 0)
+}
+
+// checkCost fails a request to api that would take it over its budget by
+// costing cost on model; priced is false when model's price isn't known.
+func checkCost(api APIConfig, model string, cost float64, priced bool) error {
+	if !hasBudget(api) {
+		return nil
+	}
+	if !priced {
+		if _, warned := budgetWarned.LoadOrStore(api.name+" price "+model, true); !warned {
+			fmt.Fprintf(os.Stderr, "Warning: no price known for %s, so %s's budget can't be checked\n", model, api.name)
+		}
+		return nil
+	}
+	today, month, err := spent(api.name, time.Now())
+	if err != nil {
+		return fmt.Errorf("reading the usage ledger: %v", err)
+	}
+
+	var over error
+	switch {
+	case api.Budget.Daily > 0 && today+cost > api.Budget.Daily:
+		over = fmt.Errorf("%s has spent %s of its %s daily budget; this request would go over",
+			api.name, formatDollars(today), formatDollars(api.Budget.Daily))
+	case api.Budget.Monthly > 0 && month+cost > api.Budget.Monthly:
+		over = fmt.Errorf("%s has spent %s of its %s monthly budget; this request would go over",
+			api.name, formatDollars(month), formatDollars(api.Budget.Monthly))
+	}
+	if over == nil || api.Budget.OnExceed != "warn" {
+		return over
+	}
+	if _, warned := budgetWarned.LoadOrStore(api.name, true); !warned {
+		fmt.Fprintln(os.Stderr, "Warning:", over)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// localServers maps the local: names that refer to an OpenAI-compatible
+// server, rather than an Ollama model, to the port each listens on by default.
+var localServers = map[string]string{
+	"lmstudio": "1234",
+	"llamacpp": "8080",
+	"vllm":     "8000",
+}
+
+// localServer reports whether a local: name refers to an OpenAI-compatible
+// server. Names may carry a suffix ("vllm-qwen") to tell several apart.
+func localServer(name string) (server, port string, ok bool) {
+	for server, port := range localServers {
+		if name == server || strings.HasPrefix(name, server+"-") {
+			return server, port, true
+		}
+	}
+	return "", "", false
+}
+
+// firstServedModel asks an OpenAI-compatible server which models it serves
+// and returns the first, for entries added without an explicit model.
+func firstServedModel(api APIConfig, headers map[string]string) (string, error) {
+	result, err := doJSON(api, "GET", api.BaseURL+"/models", nil, headers)
+	if err != nil {
+		return "", fmt.Errorf("listing models on %s: %v", api.BaseURL, err)
+	}
+
+	if data, ok := result["data"].([]interface{}); ok && len(data) > 0 {
+		if id, ok := data[0].(map[string]interface{})["id"].(string); ok {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("%s serves no models; load one or set a model in the config", api.BaseURL)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const writePrompt = `You write long-form technical documents in Markdown: design docs, proposals, guides and reports. Write the complete document asked for, starting with a "# " title, organised into "## " sections, concrete and specific rather than generic. Reply with the document only.`
+
+const outlinePrompt = `You plan long-form technical documents. Given what's wanted, produce the document's title, its sections in order, each with a heading and a few sentences on exactly what it covers (so sections don't overlap), and a glossary of the key terms and names the document will use, each with a one-line definition, so that sections written separately use the same terminology.`
+
+const sectionPrompt = `You write one section of a long-form technical document in Markdown. You get the document's title, its full outline and its glossary. Write only the section asked for, starting with its "## " heading, covering what its outline entry says and nothing that belongs to another section. Use the glossary's terms exactly as defined, and don't redefine them. Reply with the section only.`
+
+// docOutline is the plan ask write --outline-first expands.
+type docOutline struct {
+	Title    string `json:"title"`
+	Sections []struct {
+		Heading string `json:"heading"`
+		Summary string `json:"summary"`
+	} `json:"sections"`
+	Glossary []struct {
+		Term       string `json:"term"`
+		Definition string `json:"definition"`
+	} `json:"glossary"`
+}
+
+var outlineSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"title", "sections", "glossary"},
+	"properties": map[string]interface{}{
+		"title": map[string]interface{}{"type": "string"},
+		"sections": map[string]interface{}{
+			"type":     "array",
+			"minItems": 1,
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"heading", "summary"},
+				"properties": map[string]interface{}{
+					"heading": map[string]interface{}{"type": "string"},
+					"summary": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		"glossary": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"term", "definition"},
+				"properties": map[string]interface{}{
+					"term":       map[string]interface{}{"type": "string"},
+					"definition": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	},
+}
+
+// runWrite handles "ask write "<what to write>" [-o file] [--outline-first
+// [--parallel N]] [--style guide.md] [--api name] [--cost]". With
+// --outline-first it plans the document first, with a glossary, then writes
+// each section in a request of its own and puts them together, so documents
+// can run longer than one answer and stay consistent. --style has the
+// finished document checked against a style guide. A project glossary in
+// .ask.toml is followed throughout and checked against the document.
+func runWrite(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{
+		"api": true, "o": true, "outline-first": false, "parallel": true, "style": true, "cost": false,
+	})
+	if err != nil || len(parsed.positional) == 0 {
+		fmt.Println(`Usage: ask write "<what to write>" [-o file] [--outline-first [--parallel N]] [--style guide.md] [--api <api-name>]`)
+		os.Exit(1)
+	}
+	parallel := 1
+	if p := parsed.value("parallel", ""); p != "" {
+		if _, err := fmt.Sscan(p, &parallel); err != nil || parallel < 1 {
+			fmt.Println("Error: --parallel must be a number, 1 or more")
+			os.Exit(1)
+		}
+		if !parsed.has("outline-first") {
+			fmt.Println("Error: --parallel needs --outline-first")
+			os.Exit(1)
+		}
+	}
+
+	var guide string
+	if path := parsed.value("style", ""); path != "" {
+		if guide, err = loadStyleGuide(path); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	brief := strings.Join(parsed.positional, " ")
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	glossary, err := projectGlossary()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	entry := newHistoryEntry(apiName, api, Request{System: withGlossary(writePrompt, glossary), Prompt: brief})
+
+	var doc string
+	var usage *Usage
+	if parsed.has("outline-first") {
+		doc, usage, err = writeOutlineFirst(api, brief, parallel, glossary)
+	} else {
+		var resp Response
+		resp, err = sendRequest(api, Request{System: withGlossary(writePrompt, glossary), Prompt: brief})
+		doc, usage = resp.Text, resp.Usage
+	}
+	if err == nil && guide != "" {
+		var edits []styleEdit
+		var styleUsage *Usage
+		doc, edits, styleUsage, err = applyStyleGuide(api, guide, doc)
+		usage = usage.add(styleUsage)
+		if err == nil {
+			reportStyleEdits(edits)
+		}
+	}
+	if err == nil && glossary != nil {
+		var fixUsage *Usage
+		var left []glossaryViolation
+		doc, fixUsage, left = enforceGlossary(api, glossary, doc, "", "")
+		usage = usage.add(fixUsage)
+		reportGlossary(left)
+	}
+	entry.addResponse(Response{Text: doc})
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	doc = strings.TrimSpace(doc) + "\n"
+	if out := parsed.value("o", ""); out != "" {
+		if err := os.WriteFile(out, []byte(doc), 0644); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "Wrote", out)
+	} else {
+		fmt.Print(doc)
+	}
+	reportCost(config.Settings, parsed.has("cost"), api, Response{Usage: usage})
+}
+
+// writeOutlineFirst plans the document, then writes its sections, up to
+// parallel at a time, and joins them under the title. The project's
+// glossary, if any, goes into every request.
+func writeOutlineFirst(api APIConfig, brief string, parallel int, glossary *Glossary) (string, *Usage, error) {
+	writeProgress("Planning the outline...")
+	resp, err := sendRequest(api, Request{System: withGlossary(outlinePrompt, glossary), Prompt: brief, Schema: outlineSchema})
+	if err != nil {
+		return "", nil, err
+	}
+	usage := resp.Usage
+	var outline docOutline
+	if err := json.Unmarshal([]byte(resp.Text), &outline); err != nil {
+		return "", usage, err
+	}
+
+	var plan strings.Builder
+	fmt.Fprintf(&plan, "Document: %s\nWhat was asked for: %s\n\nOutline:\n", outline.Title, brief)
+	for i, s := range outline.Sections {
+		fmt.Fprintf(&plan, "%d. %s: %s\n", i+1, s.Heading, s.Summary)
+	}
+	if len(outline.Glossary) > 0 {
+		plan.WriteString("\nGlossary:\n")
+		for _, g := range outline.Glossary {
+			fmt.Fprintf(&plan, "- %s: %s\n", g.Term, g.Definition)
+		}
+	}
+	writeProgress(fmt.Sprintf("Outline: %d sections, %d glossary terms", len(outline.Sections), len(outline.Glossary)))
+
+	sections := make([]string, len(outline.Sections))
+	errs := make([]error, len(outline.Sections))
+	usages := make([]*Usage, len(outline.Sections))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, s := range outline.Sections {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, heading string) {
+			defer func() { <-slots; wg.Done() }()
+			writeProgress(fmt.Sprintf("Writing section %d of %d: %s", i+1, len(sections), heading))
+			prompt := fmt.Sprintf("%s\nWrite section %d, %q.", plan.String(), i+1, heading)
+			resp, err := sendRequest(api, Request{System: withGlossary(sectionPrompt, glossary), Prompt: prompt})
+			sections[i], errs[i], usages[i] = strings.TrimSpace(resp.Text), err, resp.Usage
+		}(i, s.Heading)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		usage = usage.add(usages[i])
+		if err != nil {
+			return "", usage, fmt.Errorf("section %d (%s): %v", i+1, outline.Sections[i].Heading, err)
+		}
+	}
+	return "# " + outline.Title + "\n\n" + strings.Join(sections, "\n\n"), usage, nil
+}
+
+// writeProgressMu keeps progress lines from parallel sections whole.
+var writeProgressMu sync.Mutex
+
+func writeProgress(line string) {
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		line = styleDim + line + styleReset
+	}
+	writeProgressMu.Lock()
+	defer writeProgressMu.Unlock()
+	fmt.Fprintln(os.Stderr, line)
+}
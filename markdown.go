@@ -0,0 +1,318 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Terminal styles used when rendering Markdown. Each style is switched off
+// on its own so nested styles survive.
+const (
+	styleBold      = "\x1b[1m"
+	styleNoBold    = "\x1b[22m"
+	styleItalic    = "\x1b[3m"
+	styleNoItalic  = "\x1b[23m"
+	styleUnderline = "\x1b[4m"
+	styleNoUnder   = "\x1b[24m"
+	styleDim       = "\x1b[2m"
+	styleCode      = "\x1b[36m"
+	styleNoColor   = "\x1b[39m"
+	styleReset     = "\x1b[0m"
+)
+
+var (
+	mdHeading    = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	mdRule       = regexp.MustCompile(`^\s{0,3}([-*_])(?:\s*[-*_]){2,}\s*$`)
+	mdQuote      = regexp.MustCompile(`^(\s*)>\s?(.*)$`)
+	mdBullet     = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdCodeSpan   = regexp.MustCompile("`[^`]+`")
+	mdBold       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalicStar = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*?)\*`)
+	mdItalicBar  = regexp.MustCompile(`(^|\W)_([^_\s][^_]*?)_(\W|$)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdTableSep   = regexp.MustCompile(`^:?-+:?$`)
+	ansiEscape   = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+)
+
+// markdownWriter renders Markdown for the terminal as it streams through:
+// headings, emphasis, inline code, links, lists, quotes, rules and tables.
+// Text is held back a line at a time, tables until their last row. Code
+// blocks keep their text and are syntax highlighted when their language is
+// known. An untagged block is held back for its first few lines while its
+// language is guessed.
+type markdownWriter struct {
+	w     io.WriteCloser
+	line  []byte
+	table []string
+	fence string
+	code  *codeHighlighter // for the open code block, if its language is known
+	// untagged holds the first lines of a code block without a language tag.
+	untagged []string
+	guessing bool
+}
+
+// guessLines is how many lines of an untagged code block are held back to
+// guess its language from.
+const guessLines = 10
+
+func newMarkdownWriter(w io.WriteCloser) *markdownWriter {
+	return &markdownWriter{w: w}
+}
+
+func (m *markdownWriter) Write(b []byte) (int, error) {
+	var out strings.Builder
+	for _, c := range b {
+		if c != '\n' {
+			m.line = append(m.line, c)
+			continue
+		}
+		out.WriteString(m.renderLine(string(m.line)))
+		m.line = m.line[:0]
+	}
+	if out.Len() == 0 {
+		return len(b), nil
+	}
+	_, err := io.WriteString(m.w, out.String())
+	return len(b), err
+}
+
+// Close renders whatever is still held back, without adding a newline the
+// text didn't have.
+func (m *markdownWriter) Close() error {
+	var out string
+	partial := len(m.line) > 0
+	if partial {
+		out = m.renderLine(string(m.line))
+		m.line = nil
+	}
+	out = m.flushTable() + out + m.flushUntagged()
+	if partial {
+		out = strings.TrimSuffix(out, "\n")
+	}
+	io.WriteString(m.w, out)
+	return m.w.Close()
+}
+
+// renderLine renders one complete line, returning it with its newline.
+// Table rows are collected and come out with the first line after them.
+func (m *markdownWriter) renderLine(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if m.fence != "" {
+		if strings.HasPrefix(trimmed, m.fence) && strings.Trim(trimmed, m.fence[:1]) == "" {
+			out := m.flushUntagged()
+			m.fence, m.code = "", nil
+			return out + line + "\n"
+		}
+		if m.guessing {
+			m.untagged = append(m.untagged, line)
+			if len(m.untagged) < guessLines {
+				return ""
+			}
+			return m.flushUntagged()
+		}
+		if m.code != nil {
+			line = m.code.line(line)
+		}
+		return line + "\n"
+	}
+
+	if strings.HasPrefix(trimmed, "|") && strings.Count(trimmed, "|") >= 2 {
+		m.table = append(m.table, trimmed)
+		return ""
+	}
+	out := m.flushTable()
+
+	if f := fenceOf(trimmed); f != "" {
+		m.fence = f
+		lang := fenceLang(strings.TrimSpace(strings.TrimLeft(trimmed, f[:1])))
+		m.code = newCodeHighlighter(lang)
+		m.guessing = lang == ""
+		return out + line + "\n"
+	}
+	if h := mdHeading.FindStringSubmatch(line); h != nil {
+		style := styleBold
+		if len(h[1]) == 1 {
+			style += styleUnderline
+		}
+		return out + style + renderInline(h[2]) + styleReset + "\n"
+	}
+	if mdRule.MatchString(line) {
+		return out + styleDim + strings.Repeat("─", 40) + styleReset + "\n"
+	}
+	if q := mdQuote.FindStringSubmatch(line); q != nil {
+		return out + q[1] + styleDim + "│ " + styleNoBold + renderInline(q[2]) + "\n"
+	}
+	if b := mdBullet.FindStringSubmatch(line); b != nil {
+		return out + b[1] + "• " + renderInline(b[2]) + "\n"
+	}
+	return out + renderInline(line) + "\n"
+}
+
+// flushUntagged guesses the language of the held-back lines of an untagged
+// code block and returns them highlighted; the rest of the block follows
+// as it arrives.
+func (m *markdownWriter) flushUntagged() string {
+	if !m.guessing {
+		return ""
+	}
+	m.guessing = false
+	m.code = newCodeHighlighter(detectLanguage(strings.Join(m.untagged, "\n")))
+	var b strings.Builder
+	for _, line := range m.untagged {
+		if m.code != nil {
+			line = m.code.line(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	m.untagged = nil
+	return b.String()
+}
+
+// renderInline styles emphasis, code spans and links within a line. Code
+// spans are left exactly as written apart from their color.
+func renderInline(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range mdCodeSpan.FindAllStringIndex(s, -1) {
+		b.WriteString(renderEmphasis(s[last:loc[0]]))
+		b.WriteString(styleCode + s[loc[0]+1:loc[1]-1] + styleNoColor)
+		last = loc[1]
+	}
+	b.WriteString(renderEmphasis(s[last:]))
+	return b.String()
+}
+
+func renderEmphasis(s string) string {
+	s = mdLink.ReplaceAllString(s, styleUnderline+"$1"+styleNoUnder+styleDim+" ($2)"+styleNoBold)
+	s = mdBold.ReplaceAllString(s, styleBold+"$1$2"+styleNoBold)
+	s = mdItalicStar.ReplaceAllString(s, "$1"+styleItalic+"$2"+styleNoItalic)
+	return mdItalicBar.ReplaceAllString(s, "$1"+styleItalic+"$2"+styleNoItalic+"$3")
+}
+
+// flushTable renders the collected table rows with aligned columns, the
+// header in bold when a separator row marks one.
+func (m *markdownWriter) flushTable() string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	var rows [][]string
+	var align []string
+	header := -1
+	for _, line := range m.table {
+		cells := tableCells(line)
+		if isTableSeparator(cells) {
+			if len(rows) == 1 && header < 0 {
+				header = 0
+				for _, c := range cells {
+					switch {
+					case strings.HasPrefix(c, ":") && strings.HasSuffix(c, ":"):
+						align = append(align, "center")
+					case strings.HasSuffix(c, ":"):
+						align = append(align, "right")
+					default:
+						align = append(align, "left")
+					}
+				}
+			}
+			continue
+		}
+		for i := range cells {
+			cells[i] = renderInline(cells[i])
+		}
+		rows = append(rows, cells)
+	}
+	m.table = nil
+
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := visibleWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var b strings.Builder
+	for r, row := range rows {
+		for i, w := range widths {
+			if i > 0 {
+				b.WriteString(styleDim + " │ " + styleNoBold)
+			}
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			a := "left"
+			if i < len(align) {
+				a = align[i]
+			}
+			cell = padCell(cell, w, a)
+			if r == header {
+				cell = styleBold + cell + styleNoBold
+			}
+			b.WriteString(cell)
+		}
+		b.WriteString("\n")
+		if r == header {
+			for i, w := range widths {
+				if i > 0 {
+					b.WriteString(styleDim + "─┼─" + styleNoBold)
+				}
+				b.WriteString(styleDim + strings.Repeat("─", w) + styleNoBold)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// tableCells splits a table row into its trimmed cells, honouring \|.
+func tableCells(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func isTableSeparator(cells []string) bool {
+	for _, c := range cells {
+		if !mdTableSep.MatchString(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func padCell(cell string, width int, align string) string {
+	gap := width - visibleWidth(cell)
+	switch align {
+	case "right":
+		return strings.Repeat(" ", gap) + cell
+	case "center":
+		return strings.Repeat(" ", gap/2) + cell + strings.Repeat(" ", gap-gap/2)
+	}
+	return cell + strings.Repeat(" ", gap)
+}
+
+// visibleWidth is the number of runes s takes on screen, ignoring escape
+// sequences.
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(ansiEscape.ReplaceAllString(s, ""))
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mcpProtocolVersion is the MCP revision ask implements; clients asking
+// for another get their own version echoed back.
+const mcpProtocolVersion = "2024-11-05"
+
+// rpcMessage is a JSON-RPC 2.0 request or notification. Notifications
+// have no ID.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpServer answers MCP requests with the APIs and indexes in config.
+type mcpServer struct {
+	config *Config
+	out    *json.Encoder
+}
+
+// runServe handles "ask serve": --mcp for an MCP server on stdin/stdout that
+// lets other clients prompt the configured APIs and search ask's indexes,
+// --http for webhooks and --grpc for the control API.
+func runServe(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"mcp": false, "http": true, "grpc": true, "token": true, "callback-host": true, "any-callback": false})
+	modes := 0
+	for _, mode := range []string{"mcp", "http", "grpc"} {
+		if parsed != nil && parsed.has(mode) {
+			modes++
+		}
+	}
+	callbacks := parsed != nil && (parsed.has("callback-host") || parsed.has("any-callback"))
+	if err != nil || modes != 1 || len(parsed.positional) > 1 || parsed.has("mcp") && len(parsed.positional) > 0 || callbacks && !parsed.has("http") {
+		fmt.Println("Usage: ask serve --mcp | --http <addr> [--callback-host h]... [--any-callback] | --grpc <addr> [api-name] [--token t]")
+		os.Exit(1)
+	}
+	serving.Store(true)
+	if parsed.has("http") {
+		serveHooks(config, parsed.value("http", ""), strings.Join(parsed.positional, ""), parsed.value("token", ""), parsed.values("callback-host"), parsed.has("any-callback"))
+		return
+	}
+	if parsed.has("grpc") {
+		serveGRPC(config, parsed.value("grpc", ""), strings.Join(parsed.positional, ""), parsed.value("token", ""))
+		return
+	}
+
+	s := &mcpServer{config: config, out: json.NewEncoder(os.Stdout)}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			s.reply(json.RawMessage("null"), nil, &rpcError{Code: -32700, Message: "parse error"})
+			continue
+		}
+		result, rpcErr := s.handle(msg)
+		if len(msg.ID) > 0 {
+			s.reply(msg.ID, result, rpcErr)
+		}
+	}
+}
+
+func (s *mcpServer) reply(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	s.out.Encode(resp)
+}
+
+func (s *mcpServer) handle(msg rpcMessage) (interface{}, *rpcError) {
+	var params map[string]interface{}
+	json.Unmarshal(msg.Params, &params)
+
+	switch msg.Method {
+	case "initialize":
+		version := mcpProtocolVersion
+		if v, ok := params["protocolVersion"].(string); ok && v != "" {
+			version = v
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities": map[string]interface{}{
+				"tools":     map[string]interface{}{},
+				"resources": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{"name": "ask", "version": "1"},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools()}, nil
+	case "tools/call":
+		name, _ := params["name"].(string)
+		args, _ := params["arguments"].(map[string]interface{})
+		text, err := s.callTool(name, args)
+		if err != nil {
+			return mcpText(err.Error(), true), nil
+		}
+		return mcpText(text, false), nil
+	case "resources/list":
+		return map[string]interface{}{"resources": s.resources()}, nil
+	case "resources/read":
+		uri, _ := params["uri"].(string)
+		text, err := s.readResource(uri)
+		if err != nil {
+			return nil, &rpcError{Code: -32602, Message: err.Error()}
+		}
+		return map[string]interface{}{"contents": []map[string]interface{}{
+			{"uri": uri, "mimeType": "text/plain", "text": text},
+		}}, nil
+	}
+	if strings.HasPrefix(msg.Method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found: " + msg.Method}
+}
+
+func mcpText(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// apiNames lists the configured APIs that can answer prompts.
+func (s *mcpServer) apiNames() []string {
+	var names []string
+	for name, api := range s.config.APIs {
+		if !isTranslationProvider(api.Provider) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *mcpServer) tools() []map[string]interface{} {
+	apiParam := map[string]interface{}{
+		"type":        "string",
+		"description": "The configured API to use",
+		"enum":        s.apiNames(),
+	}
+	indexParam := map[string]interface{}{
+		"type":        "string",
+		"description": "Index name; defaults to the only index, if there is one",
+	}
+	return []map[string]interface{}{
+		{
+			"name":        "ask",
+			"description": "Send a prompt to one of the LLM APIs configured in ask and return its answer.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"api":    apiParam,
+					"prompt": map[string]interface{}{"type": "string"},
+					"system": map[string]interface{}{"type": "string", "description": "Optional system prompt"},
+				},
+				"required": []string{"api", "prompt"},
+			},
+		},
+		{
+			"name":        "search_index",
+			"description": "Return the chunks of an indexed folder most relevant to a query, with their file and line range.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{"type": "string"},
+					"index": indexParam,
+					"k":     map[string]interface{}{"type": "integer", "description": "How many chunks to return (default 5)"},
+				},
+				"required": []string{"query"},
+			},
+		},
+		{
+			"name":        "query_index",
+			"description": "Answer a question from an indexed folder with one of the configured APIs, citing files and lines.",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"api":      apiParam,
+					"question": map[string]interface{}{"type": "string"},
+					"index":    indexParam,
+					"k":        map[string]interface{}{"type": "integer", "description": "How many chunks to retrieve (default 5)"},
+				},
+				"required": []string{"api", "question"},
+			},
+		},
+	}
+}
+
+func (s *mcpServer) callTool(name string, args map[string]interface{}) (string, error) {
+	str := func(key string) string {
+		v, _ := args[key].(string)
+		return v
+	}
+	k := defaultTopK
+	if v, ok := args["k"].(float64); ok && v >= 1 {
+		k = int(v)
+	}
+
+	switch name {
+	case "ask":
+		api, err := s.api(str("api"))
+		if err != nil {
+			return "", err
+		}
+		resp, err := sendRequest(api, Request{System: str("system"), Prompt: str("prompt")})
+		return resp.String(), err
+	case "search_index":
+		_, idx, hits, err := s.search(str("index"), str("query"), k)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, h := range hits {
+			fmt.Fprintf(&sb, "%s:%d-%d (score %.3f)\n%s\n\n", filepath.Join(idx.Root, h.Path), h.Chunk.Start, h.Chunk.End, h.Score, h.Chunk.Text)
+		}
+		return strings.TrimSpace(sb.String()), nil
+	case "query_index":
+		api, err := s.api(str("api"))
+		if err != nil {
+			return "", err
+		}
+		question := str("question")
+		_, idx, hits, err := s.search(str("index"), question, k)
+		if err != nil {
+			return "", err
+		}
+		req := Request{Prompt: ragPrompt(idx.Root, hits, "", question)}
+		for _, h := range hits {
+			req.Sources = append(req.Sources, Citation{
+				Title:   fmt.Sprintf("%s:%d-%d", h.Path, h.Chunk.Start, h.Chunk.End),
+				Snippet: h.Chunk.Text,
+			})
+		}
+		resp, err := sendRequest(api, req)
+		if err != nil {
+			return "", err
+		}
+		resp.Citations = citedSources(resp.Text, req.Sources)
+		return resp.String(), nil
+	}
+	return "", fmt.Errorf("unknown tool %q", name)
+}
+
+// api looks up a configured API by exact name; the server can't ask the
+// user to pick between partial matches.
+func (s *mcpServer) api(name string) (APIConfig, error) {
+	api, ok := s.config.APIs[name]
+	if !ok {
+		return api, fmt.Errorf("no API named %q is configured (have: %s)", name, strings.Join(s.apiNames(), ", "))
+	}
+	return api, nil
+}
+
+func (s *mcpServer) search(name, query string, k int) (string, *ragIndex, []retrieved, error) {
+	name, idx, err := findIndex(name)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	embedAPI, ok := s.config.APIs[idx.EmbedAPI]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("index '%s' was embedded with '%s', which is no longer configured", name, idx.EmbedAPI)
+	}
+	hits, err := idx.search(embedAPI, query, k)
+	return name, idx, hits, err
+}
+
+// resources lists the configured APIs and every index.
+func (s *mcpServer) resources() []map[string]interface{} {
+	list := []map[string]interface{}{{
+		"uri":         "ask://apis",
+		"name":        "Configured APIs",
+		"description": "The APIs ask can route prompts to, with their providers and models",
+		"mimeType":    "text/plain",
+	}}
+	paths, _ := filepath.Glob(filepath.Join(indexDir(), "*.json"))
+	for _, p := range paths {
+		name := strings.TrimSuffix(filepath.Base(p), ".json")
+		list = append(list, map[string]interface{}{
+			"uri":         "ask://index/" + name,
+			"name":        "Index " + name,
+			"description": "The files in the " + name + " index",
+			"mimeType":    "text/plain",
+		})
+	}
+	return list
+}
+
+func (s *mcpServer) readResource(uri string) (string, error) {
+	if uri == "ask://apis" {
+		var sb strings.Builder
+		for _, name := range s.apiNames() {
+			api := s.config.APIs[name]
+			fmt.Fprintf(&sb, "%s\t%s\t%s\n", name, api.Provider, api.Model)
+		}
+		return sb.String(), nil
+	}
+
+	name, ok := strings.CutPrefix(uri, "ask://index/")
+	if !ok {
+		return "", fmt.Errorf("unknown resource %s", uri)
+	}
+	idx, err := loadIndex(name)
+	if err != nil {
+		return "", fmt.Errorf("no index named %s", name)
+	}
+	var files []string
+	for path := range idx.Files {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "root: %s\nembedded with: %s\n\n", idx.Root, idx.EmbedAPI)
+	for _, path := range files {
+		fmt.Fprintf(&sb, "%s (%d chunks)\n", path, len(idx.Files[path].Chunks))
+	}
+	return sb.String(), nil
+}
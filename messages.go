@@ -0,0 +1,447 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Message is a turn of a conversation in ask's own terms, whichever
+// provider wrote or reads it. Role is "system", "user", "assistant" or
+// "tool". Conversations are kept in this form and only encoded for a
+// provider when sent, so any of them can carry on from turns another wrote.
+type Message struct {
+	Role  string `json:"role"`
+	Parts []Part `json:"parts"`
+}
+
+// Part is one piece of a message. Type is "text", "thinking", "image",
+// "document", "tool_call" or "tool_result". Attachments carry their data
+// for sending but are recorded by size and SHA-256 rather than inline.
+type Part struct {
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text,omitempty"`
+	ID        string                 `json:"id,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	MediaType string                 `json:"media_type,omitempty"`
+	Size      int                    `json:"size,omitempty"`
+	SHA256    string                 `json:"sha256,omitempty"`
+	// Signature is Claude's seal on its thinking, which has to be sent
+	// back with it.
+	Signature string `json:"signature,omitempty"`
+	Data      []byte `json:"-"`
+}
+
+func (p Part) base64() string {
+	return base64.StdEncoding.EncodeToString(p.Data)
+}
+
+func (p Part) dataURL() string {
+	return "data:" + p.MediaType + ";base64," + p.base64()
+}
+
+func attachmentPart(kind, name, mediaType string, data []byte) Part {
+	sum := sha256.Sum256(data)
+	return Part{Type: kind, Name: name, MediaType: mediaType, Size: len(data), SHA256: hex.EncodeToString(sum[:]), Data: data}
+}
+
+// requestMessages is the opening of a conversation for req: the system
+// prompt, the turns before, then the user's attachments and prompt.
+func requestMessages(req Request) []Message {
+	var messages []Message
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Parts: []Part{{Type: "text", Text: req.System}}})
+	}
+	messages = append(messages, req.History...)
+	var parts []Part
+	for _, doc := range req.Documents {
+		parts = append(parts, attachmentPart("document", doc.Name, doc.MediaType, doc.Data))
+	}
+	for _, img := range req.Images {
+		parts = append(parts, attachmentPart("image", "", img.MediaType, img.Data))
+	}
+	parts = append(parts, Part{Type: "text", Text: req.Prompt})
+	return append(messages, Message{Role: "user", Parts: parts})
+}
+
+// textMessage is a message of plain text.
+func textMessage(role, text string) Message {
+	return Message{Role: role, Parts: []Part{{Type: "text", Text: text}}}
+}
+
+// transcriptPrompt is req's prompt with its history written out ahead of
+// it, for providers that take a single prompt rather than turns.
+func transcriptPrompt(req Request) string {
+	if len(req.History) == 0 {
+		return req.Prompt
+	}
+	var b strings.Builder
+	b.WriteString("The conversation so far:\n\n")
+	for _, m := range req.History {
+		b.WriteString(strings.ToUpper(m.Role[:1]) + m.Role[1:] + ": " + strings.TrimSpace(partsText(m.Parts)) + "\n\n")
+	}
+	b.WriteString("Reply to the user's next message:\n\n" + req.Prompt)
+	return b.String()
+}
+
+// resultsMessage answers tool calls with their results.
+func resultsMessage(calls []toolCall, results []string) Message {
+	m := Message{Role: "tool"}
+	for i, call := range calls {
+		m.Parts = append(m.Parts, Part{Type: "tool_result", ID: call.ID, Name: call.Name, Text: results[i]})
+	}
+	return m
+}
+
+// turnFromParts reads an assistant message as a tool turn.
+func turnFromParts(parts []Part) toolTurn {
+	var turn toolTurn
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			turn.Text += p.Text
+		case "thinking":
+			turn.Thinking += p.Text
+		case "tool_call":
+			turn.Calls = append(turn.Calls, toolCall{ID: p.ID, Name: p.Name, Args: p.Args})
+		}
+	}
+	return turn
+}
+
+// systemText joins the system messages; providers take them apart from the
+// conversation.
+func systemText(messages []Message) string {
+	var texts []string
+	for _, m := range messages {
+		if m.Role == "system" {
+			for _, p := range m.Parts {
+				texts = append(texts, p.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// encodeClaude turns messages into Claude's system prompt and messages.
+// Tool results go in user turns, and turns of the same role are merged, as
+// Claude wants them to alternate.
+func encodeClaude(messages []Message) (string, []map[string]interface{}) {
+	var out []map[string]interface{}
+	for _, m := range messages {
+		if m.Role == "system" {
+			continue
+		}
+		role := m.Role
+		if role == "tool" {
+			role = "user"
+		}
+		var blocks []map[string]interface{}
+		for _, p := range m.Parts {
+			switch p.Type {
+			case "text":
+				blocks = append(blocks, map[string]interface{}{"type": "text", "text": p.Text})
+			case "thinking":
+				// Thinking can only go back with the signature it came with.
+				if p.Signature != "" {
+					blocks = append(blocks, map[string]interface{}{"type": "thinking", "thinking": p.Text, "signature": p.Signature})
+				}
+			case "image", "document":
+				blocks = append(blocks, map[string]interface{}{
+					"type": p.Type,
+					"source": map[string]string{
+						"type":       "base64",
+						"media_type": p.MediaType,
+						"data":       p.base64(),
+					},
+				})
+			case "tool_call":
+				blocks = append(blocks, map[string]interface{}{"type": "tool_use", "id": p.ID, "name": p.Name, "input": nonNilArgs(p.Args)})
+			case "tool_result":
+				blocks = append(blocks, map[string]interface{}{"type": "tool_result", "tool_use_id": p.ID, "content": p.Text})
+			}
+		}
+		if n := len(out); n > 0 && out[n-1]["role"] == role {
+			out[n-1]["content"] = append(out[n-1]["content"].([]map[string]interface{}), blocks...)
+			continue
+		}
+		out = append(out, map[string]interface{}{"role": role, "content": blocks})
+	}
+	return systemText(messages), out
+}
+
+// decodeClaude reads the content blocks of a Claude reply.
+func decodeClaude(content []interface{}) []Part {
+	var parts []Part
+	for _, item := range content {
+		block, _ := item.(map[string]interface{})
+		switch block["type"] {
+		case "text":
+			t, _ := block["text"].(string)
+			parts = append(parts, Part{Type: "text", Text: t})
+		case "thinking":
+			p := Part{Type: "thinking"}
+			p.Text, _ = block["thinking"].(string)
+			p.Signature, _ = block["signature"].(string)
+			parts = append(parts, p)
+		case "tool_use":
+			p := Part{Type: "tool_call"}
+			p.ID, _ = block["id"].(string)
+			p.Name, _ = block["name"].(string)
+			p.Args, _ = block["input"].(map[string]interface{})
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// encodeOpenAI turns messages into chat completion messages. A user turn
+// that is only text is sent as a plain string; thinking isn't sent back.
+func encodeOpenAI(messages []Message) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			out = append(out, map[string]interface{}{"role": "system", "content": partsText(m.Parts)})
+		case "user":
+			var content []map[string]interface{}
+			images := false
+			for _, p := range m.Parts {
+				switch p.Type {
+				case "text":
+					content = append(content, map[string]interface{}{"type": "text", "text": p.Text})
+				case "image":
+					images = true
+				}
+			}
+			for _, p := range m.Parts {
+				if p.Type == "image" {
+					content = append(content, map[string]interface{}{
+						"type":      "image_url",
+						"image_url": map[string]string{"url": p.dataURL()},
+					})
+				}
+			}
+			if images {
+				out = append(out, map[string]interface{}{"role": "user", "content": content})
+			} else {
+				out = append(out, map[string]interface{}{"role": "user", "content": partsText(m.Parts)})
+			}
+		case "assistant":
+			var content interface{}
+			if text := partsText(m.Parts); text != "" {
+				content = text
+			}
+			msg := map[string]interface{}{"role": "assistant", "content": content}
+			var calls []map[string]interface{}
+			for _, p := range m.Parts {
+				if p.Type == "tool_call" {
+					args, _ := json.Marshal(nonNilArgs(p.Args))
+					calls = append(calls, map[string]interface{}{
+						"id":       p.ID,
+						"type":     "function",
+						"function": map[string]interface{}{"name": p.Name, "arguments": string(args)},
+					})
+				}
+			}
+			if len(calls) > 0 {
+				msg["tool_calls"] = calls
+			}
+			out = append(out, msg)
+		case "tool":
+			for _, p := range m.Parts {
+				out = append(out, map[string]interface{}{"role": "tool", "tool_call_id": p.ID, "content": p.Text})
+			}
+		}
+	}
+	return out
+}
+
+// decodeOpenAI reads a chat completion message. Reasoning models behind
+// OpenAI-compatible servers return their thinking separately.
+func decodeOpenAI(message map[string]interface{}) []Part {
+	var parts []Part
+	if t, _ := message["reasoning_content"].(string); t != "" {
+		parts = append(parts, Part{Type: "thinking", Text: t})
+	}
+	if t, _ := message["content"].(string); t != "" {
+		parts = append(parts, Part{Type: "text", Text: t})
+	}
+	// OpenRouter and other gateways return generated images beside the
+	// text, as data URLs.
+	images, _ := message["images"].([]interface{})
+	for _, item := range images {
+		im, _ := item.(map[string]interface{})
+		u, _ := im["image_url"].(map[string]interface{})
+		url, _ := u["url"].(string)
+		if img, ok := dataURLImage(url); ok {
+			parts = append(parts, attachmentPart("image", "", img.MediaType, img.Data))
+		}
+	}
+	list, _ := message["tool_calls"].([]interface{})
+	for _, item := range list {
+		tc, _ := item.(map[string]interface{})
+		fn, _ := tc["function"].(map[string]interface{})
+		p := Part{Type: "tool_call", Args: map[string]interface{}{}}
+		p.ID, _ = tc["id"].(string)
+		p.Name, _ = fn["name"].(string)
+		if raw, ok := fn["arguments"].(string); ok {
+			json.Unmarshal([]byte(raw), &p.Args)
+		}
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// encodeGemini turns messages into Gemini's system instruction (nil without
+// one) and contents. Tool results go in user turns as function responses.
+func encodeGemini(messages []Message) (map[string]interface{}, []map[string]interface{}) {
+	var contents []map[string]interface{}
+	for _, m := range messages {
+		role := "user"
+		switch m.Role {
+		case "system":
+			continue
+		case "assistant":
+			role = "model"
+		}
+		var parts []map[string]interface{}
+		for _, p := range m.Parts {
+			switch p.Type {
+			case "text":
+				parts = append(parts, map[string]interface{}{"text": p.Text})
+			case "image", "document":
+				parts = append(parts, map[string]interface{}{
+					"inline_data": map[string]string{
+						"mime_type": p.MediaType,
+						"data":      p.base64(),
+					},
+				})
+			case "tool_call":
+				parts = append(parts, map[string]interface{}{
+					"functionCall": map[string]interface{}{"name": p.Name, "args": nonNilArgs(p.Args)},
+				})
+			case "tool_result":
+				parts = append(parts, map[string]interface{}{
+					"functionResponse": map[string]interface{}{
+						"name":     p.Name,
+						"response": map[string]interface{}{"result": p.Text},
+					},
+				})
+			}
+		}
+		contents = append(contents, map[string]interface{}{"role": role, "parts": parts})
+	}
+	var system map[string]interface{}
+	if text := systemText(messages); text != "" {
+		system = geminiSystem(text)
+	}
+	return system, contents
+}
+
+// decodeGemini reads the parts of a Gemini reply.
+func decodeGemini(parts []interface{}) []Part {
+	var out []Part
+	for _, item := range parts {
+		part, _ := item.(map[string]interface{})
+		if t, ok := part["text"].(string); ok {
+			if thought, _ := part["thought"].(bool); thought {
+				out = append(out, Part{Type: "thinking", Text: t})
+			} else {
+				out = append(out, Part{Type: "text", Text: t})
+			}
+		}
+		if inline, ok := part["inlineData"].(map[string]interface{}); ok {
+			mediaType, _ := inline["mimeType"].(string)
+			b64, _ := inline["data"].(string)
+			if data, err := base64.StdEncoding.DecodeString(b64); err == nil {
+				out = append(out, attachmentPart("image", "", mediaType, data))
+			}
+		}
+		if fn, ok := part["functionCall"].(map[string]interface{}); ok {
+			p := Part{Type: "tool_call"}
+			p.Name, _ = fn["name"].(string)
+			p.Args, _ = fn["args"].(map[string]interface{})
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// encodeOllama turns messages into Ollama chat messages, which carry images
+// as a list of base64 strings beside the text.
+func encodeOllama(messages []Message) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, m := range messages {
+		if m.Role == "tool" {
+			for _, p := range m.Parts {
+				out = append(out, map[string]interface{}{"role": "tool", "tool_name": p.Name, "content": p.Text})
+			}
+			continue
+		}
+		msg := map[string]interface{}{"role": m.Role, "content": partsText(m.Parts)}
+		var images []string
+		var calls []map[string]interface{}
+		for _, p := range m.Parts {
+			switch p.Type {
+			case "image":
+				images = append(images, p.base64())
+			case "tool_call":
+				calls = append(calls, map[string]interface{}{
+					"function": map[string]interface{}{"name": p.Name, "arguments": nonNilArgs(p.Args)},
+				})
+			}
+		}
+		if len(images) > 0 {
+			msg["images"] = images
+		}
+		if len(calls) > 0 {
+			msg["tool_calls"] = calls
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// decodeOllama reads an Ollama chat message.
+func decodeOllama(message map[string]interface{}) []Part {
+	var parts []Part
+	if t, _ := message["thinking"].(string); t != "" {
+		parts = append(parts, Part{Type: "thinking", Text: t})
+	}
+	if t, _ := message["content"].(string); t != "" {
+		parts = append(parts, Part{Type: "text", Text: t})
+	}
+	list, _ := message["tool_calls"].([]interface{})
+	for _, item := range list {
+		tc, _ := item.(map[string]interface{})
+		fn, _ := tc["function"].(map[string]interface{})
+		p := Part{Type: "tool_call"}
+		p.Name, _ = fn["name"].(string)
+		p.Args, _ = fn["arguments"].(map[string]interface{})
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+// partsText joins the text parts of a message.
+func partsText(parts []Part) string {
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+// nonNilArgs keeps tool call arguments an object when there are none.
+func nonNilArgs(args map[string]interface{}) map[string]interface{} {
+	if args == nil {
+		return map[string]interface{}{}
+	}
+	return args
+}
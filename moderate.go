@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// defaultModerationModel is OpenAI's moderation model.
+const defaultModerationModel = "omni-moderation-latest"
+
+// exitFlagged is the exit code of ask moderate when the text is flagged,
+// kept apart from 1 so pipelines can tell it from an error.
+const exitFlagged = 2
+
+// moderationCategories are OpenAI's categories; model-based classification
+// scores the same ones so the output is comparable.
+var moderationCategories = []string{
+	"harassment", "harassment/threatening", "hate", "hate/threatening",
+	"illicit", "illicit/violent", "self-harm", "self-harm/instructions",
+	"self-harm/intent", "sexual", "sexual/minors", "violence", "violence/graphic",
+}
+
+const moderationPrompt = `Classify the text below for content moderation. For each of these categories give the probability, from 0 to 1, that the text falls into it: %s.
+
+Reply with only a JSON object mapping each category name to its score, nothing else.
+
+Text:
+"""
+%s
+"""`
+
+// Moderation is the result of checking one text.
+type Moderation struct {
+	Flagged    bool               `json:"flagged"`
+	Categories map[string]float64 `json:"categories"`
+	// FlaggedCategories lists the categories that were flagged, highest
+	// score first.
+	FlaggedCategories []string `json:"flagged_categories"`
+}
+
+// runModerate handles "ask moderate <api> [text] [--threshold x]". It prints
+// the category scores as JSON and exits with exitFlagged if the text is
+// flagged.
+func runModerate(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"threshold": true})
+	if err != nil || len(parsed.positional) < 1 {
+		fmt.Println("Usage: ask moderate <api-name> [\"<text>\"] [--threshold 0.5]  (or text on stdin)")
+		os.Exit(1)
+	}
+	_, api := resolveAPI(config, parsed.positional[0])
+
+	text := strings.Join(parsed.positional[1:], " ")
+	if text == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("Error reading stdin:", err)
+			os.Exit(1)
+		}
+		text = strings.TrimSpace(string(data))
+	}
+	if text == "" {
+		fmt.Println("Nothing to check.")
+		os.Exit(1)
+	}
+
+	threshold := 0.5
+	if t := parsed.value("threshold", ""); t != "" {
+		if threshold, err = strconv.ParseFloat(t, 64); err != nil || threshold <= 0 || threshold > 1 {
+			fmt.Println("Error: --threshold must be a number between 0 and 1")
+			os.Exit(1)
+		}
+	}
+
+	result, err := moderate(api, text, threshold, parsed.has("threshold"))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	data, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(data))
+	if result.Flagged {
+		os.Exit(exitFlagged)
+	}
+}
+
+// moderate checks text with OpenAI's moderation endpoint, or by asking any
+// other chat model to classify it. OpenAI's own verdict is used unless a
+// threshold was given explicitly.
+func moderate(api APIConfig, text string, threshold float64, explicit bool) (Moderation, error) {
+	var result Moderation
+	var err error
+	if api.Provider == ProviderOpenAI {
+		result, err = openAIModeration(api, text)
+	} else {
+		result, err = classifyModeration(api, text)
+		explicit = true
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if explicit {
+		result.FlaggedCategories = []string{}
+		for name, score := range result.Categories {
+			if score >= threshold {
+				result.FlaggedCategories = append(result.FlaggedCategories, name)
+			}
+		}
+		result.Flagged = len(result.FlaggedCategories) > 0
+	}
+	sort.Slice(result.FlaggedCategories, func(i, j int) bool {
+		a, b := result.FlaggedCategories[i], result.FlaggedCategories[j]
+		if result.Categories[a] != result.Categories[b] {
+			return result.Categories[a] > result.Categories[b]
+		}
+		return a < b
+	})
+	return result, nil
+}
+
+func openAIModeration(api APIConfig, text string) (Moderation, error) {
+	api, err := expandAPIConfig(api)
+	if err != nil {
+		return Moderation{}, err
+	}
+	resp, err := postJSON(api, api.BaseURL+"/moderations", map[string]interface{}{
+		"model": defaultModerationModel,
+		"input": text,
+	}, openAIHeaders(api))
+	if err != nil {
+		return Moderation{}, err
+	}
+
+	results, _ := resp["results"].([]interface{})
+	if len(results) == 0 {
+		return Moderation{}, fmt.Errorf("empty moderation response")
+	}
+	first, _ := results[0].(map[string]interface{})
+	result := Moderation{Categories: map[string]float64{}, FlaggedCategories: []string{}}
+	result.Flagged, _ = first["flagged"].(bool)
+	scores, _ := first["category_scores"].(map[string]interface{})
+	for name, v := range scores {
+		if score, ok := v.(float64); ok {
+			result.Categories[name] = score
+		}
+	}
+	flags, _ := first["categories"].(map[string]interface{})
+	for name, v := range flags {
+		if flagged, _ := v.(bool); flagged {
+			result.FlaggedCategories = append(result.FlaggedCategories, name)
+		}
+	}
+	return result, nil
+}
+
+func classifyModeration(api APIConfig, text string) (Moderation, error) {
+	reply, err := sendPrompt(api, fmt.Sprintf(moderationPrompt, strings.Join(moderationCategories, ", "), text))
+	if err != nil {
+		return Moderation{}, err
+	}
+	var scores map[string]float64
+	if err := json.Unmarshal([]byte(extractJSON(reply)), &scores); err != nil {
+		return Moderation{}, fmt.Errorf("could not read the classification: %v", err)
+	}
+
+	result := Moderation{Categories: map[string]float64{}}
+	for _, name := range moderationCategories {
+		result.Categories[name] = scores[name]
+	}
+	return result, nil
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const defaultOllamaHost = "http://localhost:11434"
+
+// ollamaHost returns the Ollama server to talk to: the entry's base URL if
+// set, then OLLAMA_HOST, then the local default. Like the ollama CLI it
+// accepts OLLAMA_HOST without a scheme or port.
+func ollamaHost(config APIConfig) string {
+	host := config.BaseURL
+	if host == "" {
+		host = os.Getenv("OLLAMA_HOST")
+	}
+	if host == "" {
+		return defaultOllamaHost
+	}
+
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	scheme, rest, _ := strings.Cut(host, "://")
+	hostPort, path, _ := strings.Cut(rest, "/")
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), "11434")
+	}
+	host = scheme + "://" + hostPort
+	if path != "" {
+		host += "/" + strings.TrimSuffix(path, "/")
+	}
+	return host
+}
+
+// runLocalModel streams a local model's answer to onDelta as it is
+// generated.
+func runLocalModel(config APIConfig, req Request, onDelta func(string)) (Response, error) {
+	resp, err := ollamaChat(config, req, onDelta)
+	if err != nil {
+		return resp, fmt.Errorf("running model %s: %w", config.Model, err)
+	}
+	return resp, nil
+}
+
+// callLocalModel runs a local model and returns its whole answer.
+func callLocalModel(config APIConfig, req Request) (Response, error) {
+	return ollamaChat(config, req, nil)
+}
+
+// sendOrPull makes a request to api with send, and if api is a local model
+// Ollama says isn't installed, offers to pull it and makes the request
+// again. Only the interactive prompt offers; elsewhere the error is
+// returned like any other, so failover can move on.
+func sendOrPull(api APIConfig, send func() (Response, error)) (Response, error) {
+	resp, err := send()
+	if api.Provider != ProviderLocal || !isModelNotFound(err, api.Model) {
+		return resp, err
+	}
+	pulled, pullErr := offerPull(api)
+	if pullErr != nil {
+		return resp, pullErr
+	}
+	if pulled {
+		resp, err = send()
+	}
+	return resp, err
+}
+
+// ollamaChat sends req to Ollama's /api/chat endpoint. When onDelta is
+// non-nil the answer is streamed and each chunk handed to it as it arrives;
+// the full response is returned either way.
+func ollamaChat(config APIConfig, req Request, onDelta func(string)) (Response, error) {
+	payload := ollamaChatPayload(config, encodeOllama(requestMessages(req)))
+	payload["stream"] = onDelta != nil
+	if req.Schema != nil {
+		payload["format"] = req.Schema
+	}
+
+	resp, err := ollamaPost(config, "/api/chat", payload)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var text, thinking strings.Builder
+	result := Response{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk struct {
+			Message struct {
+				Content  string `json:"content"`
+				Thinking string `json:"thinking"`
+			} `json:"message"`
+			Model           string `json:"model"`
+			Error           string `json:"error"`
+			Done            bool   `json:"done"`
+			DoneReason      string `json:"done_reason"`
+			PromptEvalCount int    `json:"prompt_eval_count"`
+			EvalCount       int    `json:"eval_count"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			result.Text = text.String()
+			return result, err
+		}
+		if chunk.Error != "" {
+			result.Text = text.String()
+			return result, errors.New(chunk.Error)
+		}
+
+		if onDelta == nil {
+			result.Raw = append([]byte(nil), scanner.Bytes()...)
+		}
+		text.WriteString(chunk.Message.Content)
+		thinking.WriteString(chunk.Message.Thinking)
+		if onDelta != nil && chunk.Message.Content != "" {
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			result.Model, result.FinishReason = chunk.Model, chunk.DoneReason
+			if chunk.EvalCount > 0 {
+				result.Usage = &Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+			}
+			break
+		}
+	}
+	result.Text, result.Thinking = text.String(), thinking.String()
+	return result, scanner.Err()
+}
+
+// ollamaChatPayload builds an /api/chat request with the entry's options.
+func ollamaChatPayload(config APIConfig, messages []map[string]interface{}) map[string]interface{} {
+	payload := map[string]interface{}{
+		"model":    config.Model,
+		"messages": messages,
+	}
+	if len(config.Options) > 0 {
+		payload["options"] = config.Options
+	}
+	if config.KeepAlive != "" {
+		payload["keep_alive"] = keepAliveValue(config.KeepAlive)
+	}
+	return payload
+}
+
+// ollamaPost posts payload to an Ollama API path and returns the response
+// for the caller to read, turning error statuses into errors.
+func ollamaPost(config APIConfig, path string, payload interface{}) (*http.Response, error) {
+	return ollamaRequest(config, "POST", path, payload)
+}
+
+// ollamaRequest is ollamaPost for any method; payload may be nil.
+func ollamaRequest(config APIConfig, method, path string, payload interface{}) (*http.Response, error) {
+	host := ollamaHost(config)
+
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+	req, err := http.NewRequestWithContext(config.requestContext(), method, host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := setAPIHeaders(req, config); err != nil {
+		return nil, err
+	}
+
+	// No overall timeout: local generation and model loading can be slow,
+	// and streamed responses are read as they arrive.
+	transport, err := apiTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.DialContext = (&net.Dialer{Timeout: 5 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = 10 * time.Minute
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Ollama at %s (is it running?): %v", host, err)
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, &ollamaError{status: resp.StatusCode, message: apiErr.Error}
+		}
+		return nil, fmt.Errorf("%s\n%s", resp.Status, string(body))
+	}
+	return resp, nil
+}
+
+// keepAliveValue converts a keep_alive setting for the Ollama API, which
+// reads bare numbers as seconds and strings as durations.
+func keepAliveValue(s string) interface{} {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return s
+}
+
+// localCommands are the "ask local" subcommands.
+var localCommands = []string{"list", "pull", "rm", "warm"}
+
+func runLocalCommand(config *Config, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: ask local <list|pull|rm|warm> [model]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		listLocalModels(APIConfig{Provider: ProviderLocal})
+	case "pull":
+		if len(args) != 2 {
+			fmt.Println("Usage: ask local pull <model>")
+			os.Exit(1)
+		}
+		api := localAPI(config, args[1])
+		if err := ollamaPull(api, api.Model, os.Stdout); err != nil {
+			fmt.Printf("Error pulling %s: %v\n", api.Model, err)
+			os.Exit(1)
+		}
+	case "rm":
+		if len(args) != 2 {
+			fmt.Println("Usage: ask local rm <model>")
+			os.Exit(1)
+		}
+		api := localAPI(config, args[1])
+		resp, err := ollamaRequest(api, "DELETE", "/api/delete", map[string]interface{}{"model": api.Model})
+		if err != nil {
+			fmt.Printf("Error removing %s: %v\n", api.Model, err)
+			os.Exit(1)
+		}
+		resp.Body.Close()
+		fmt.Printf("Removed %s\n", api.Model)
+	case "warm":
+		parsed, err := parseArgs(args[1:], map[string]bool{"keep-alive": true})
+		if err != nil || len(parsed.positional) != 1 {
+			fmt.Println("Usage: ask local warm <model|local:name> [--keep-alive 30m]")
+			os.Exit(1)
+		}
+		api := localAPI(config, parsed.positional[0])
+		api.KeepAlive = parsed.value("keep-alive", api.KeepAlive)
+		warmModel(api)
+	default:
+		fmt.Printf("Unknown local command: %s\n", args[0])
+		if hint := didYouMean(args[0], localCommands); hint != "" {
+			fmt.Println(hint)
+		}
+		os.Exit(1)
+	}
+}
+
+// localAPI returns the configured entry for a local: name, or a bare entry
+// on the default host for a plain model name.
+func localAPI(config *Config, name string) APIConfig {
+	if api, ok := config.APIs[name]; ok && api.Provider == ProviderLocal {
+		api, err := expandAPIConfig(api)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return api
+	}
+	if api, ok := config.APIs["local:"+name]; ok && api.Provider == ProviderLocal {
+		return localAPI(config, "local:"+name)
+	}
+	return APIConfig{Provider: ProviderLocal, Model: strings.TrimPrefix(name, "local:")}
+}
+
+// warmModel loads a model into memory without generating anything, so the
+// next prompt doesn't pay the load time.
+func warmModel(config APIConfig) {
+	payload := map[string]interface{}{"model": config.Model}
+	if config.KeepAlive != "" {
+		payload["keep_alive"] = keepAliveValue(config.KeepAlive)
+	}
+
+	start := time.Now()
+	resp, err := ollamaPost(config, "/api/generate", payload)
+	if err != nil {
+		fmt.Printf("Error warming %s: %v\n", config.Model, err)
+		os.Exit(1)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	fmt.Printf("Loaded %s in %s\n", config.Model, time.Since(start).Round(time.Millisecond))
+}
+
+// ollamaError is an error Ollama answered a request with.
+type ollamaError struct {
+	status  int
+	message string
+}
+
+func (e *ollamaError) Error() string {
+	return e.message
+}
+
+// isModelNotFound reports whether err is Ollama saying model isn't pulled:
+// a 404 whose message names it, as in `model "llama3" not found, try
+// pulling it first` (older servers quote it with '). Other 404s, such as a
+// base_url that isn't Ollama, aren't.
+func isModelNotFound(err error, model string) bool {
+	var apiErr *ollamaError
+	if !errors.As(err, &apiErr) || apiErr.status != http.StatusNotFound {
+		return false
+	}
+	return strings.Contains(apiErr.message, fmt.Sprintf("model %q not found", model)) ||
+		strings.Contains(apiErr.message, fmt.Sprintf("model '%s' not found", model))
+}
+
+// offerPull asks whether to pull a missing model and pulls it if the user
+// agrees, reporting whether it did. It never prompts when stdin isn't a
+// terminal.
+func offerPull(config APIConfig) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, nil
+	}
+
+	size := ""
+	if n, err := ollamaModelSize(config.Model); err == nil {
+		size = fmt.Sprintf(" (%s download)", formatBytes(n))
+	}
+	// On stderr, like the progress, to keep stdout to the answer.
+	fmt.Fprintf(os.Stderr, "Model %s is not installed. Pull it now%s? [y/N] ", config.Model, size)
+	answer, _ := readLine()
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		return false, nil
+	}
+
+	if err := ollamaPull(config, config.Model, os.Stderr); err != nil {
+		return false, fmt.Errorf("pulling %s: %v", config.Model, err)
+	}
+	return true, nil
+}
+
+// ollamaPull pulls a model through the Ollama server, drawing a progress bar
+// for each layer on out as it downloads.
+func ollamaPull(config APIConfig, model string, out io.Writer) error {
+	resp, err := ollamaPost(config, "/api/pull", map[string]interface{}{"model": model, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	status := ""
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event struct {
+			Status    string `json:"status"`
+			Digest    string `json:"digest"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		if event.Error != "" {
+			fmt.Fprintln(out)
+			return errors.New(event.Error)
+		}
+
+		if event.Total > 0 {
+			fmt.Fprintf(out, "\r%s", progressBar(event.Status, event.Completed, event.Total))
+			status = event.Status
+			continue
+		}
+		if status != "" {
+			fmt.Fprintln(out)
+			status = ""
+		}
+		fmt.Fprintln(out, event.Status)
+	}
+	return scanner.Err()
+}
+
+// progressBar renders a single-line download progress bar.
+func progressBar(label string, done, total int64) string {
+	const width = 30
+	if done > total {
+		done = total
+	}
+	filled := int(float64(width) * float64(done) / float64(total))
+	if len(label) > 24 {
+		label = label[:24]
+	}
+	return fmt.Sprintf("%-24s [%s%s] %3d%% %s/%s ", label,
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		done*100/total, formatBytes(done), formatBytes(total))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ollamaModelSize looks up a model's download size in the Ollama registry,
+// so the pull prompt can say how big it is before anything is fetched.
+func ollamaModelSize(model string) (int64, error) {
+	name, tag, ok := strings.Cut(model, ":")
+	if !ok {
+		tag = "latest"
+	}
+	if !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://registry.ollama.ai/v2/%s/manifests/%s", name, tag), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("registry returned %s", resp.Status)
+	}
+
+	var manifest struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return 0, err
+	}
+
+	total := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		total += layer.Size
+	}
+	return total, nil
+}
+
+// ollamaModel is an installed model as reported by /api/tags.
+type ollamaModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Details    struct {
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// installedModels lists the models installed on the Ollama server.
+func installedModels(config APIConfig) ([]ollamaModel, error) {
+	resp, err := ollamaRequest(config, "GET", "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []ollamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+func listLocalModels(config APIConfig) {
+	models, err := installedModels(config)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if len(models) == 0 {
+		fmt.Println("No local models installed. Use 'ask local pull <model>' to get one.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPARAMS\tQUANT\tSIZE\tMODIFIED")
+	for _, m := range models {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, m.Details.ParameterSize,
+			m.Details.QuantizationLevel, formatBytes(m.Size), m.ModifiedAt.Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+// sameModel reports whether a configured model name refers to an installed
+// one; Ollama adds the ":latest" tag when none is given.
+func sameModel(configured, installed string) bool {
+	if !strings.Contains(configured, ":") {
+		configured += ":latest"
+	}
+	return configured == installed
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// openapiConcurrency bounds how many generation requests run at once.
+const openapiConcurrency = 4
+
+var languageExtensions = map[string]string{
+	"go": "go", "python": "py", "typescript": "ts", "javascript": "js", "java": "java",
+	"kotlin": "kt", "rust": "rs", "ruby": "rb", "csharp": "cs", "php": "php", "swift": "swift",
+}
+
+// openapiContract describes the shared client every generated file codes
+// against, so files generated in parallel fit together.
+const openapiContract = `All files belong to one %s package named %q. The package has:
+- client.%s: a Client type holding the base URL, an HTTP client and default headers (for auth), with a constructor, and one internal helper that sends a request given method, path, query parameters and an optional JSON body, returns an error/raises for non-2xx responses and decodes the JSON response. Name the helper idiomatically for the language (e.g. "do" in Go, "_request" in Python, "request" in TypeScript).
+- models.%s: one type per schema in components.schemas, named after the schema in the language's naming style.
+- one file per API tag with a method on Client for each operation, named after its operationId, using the models types for request and response bodies.
+Reply with a single code block containing the complete file and nothing else.`
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openapiJob is one file to generate from a slice of the spec.
+type openapiJob struct {
+	file   string
+	prompt string
+}
+
+func runOpenAPI(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{
+		"lang": true, "o": true, "package": true, "api": true,
+	})
+	if err != nil || len(parsed.positional) != 2 || parsed.positional[0] != "client" {
+		fmt.Println("Usage: ask openapi client <spec.json|spec.yaml> --lang <language> [--package name] [-o dir] [--api <api-name>]")
+		os.Exit(1)
+	}
+
+	lang := strings.ToLower(parsed.value("lang", "go"))
+	ext, ok := languageExtensions[lang]
+	if !ok {
+		ext = lang
+	}
+
+	spec, err := loadOpenAPISpec(parsed.positional[1])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	pkg := parsed.value("package", "")
+	if pkg == "" {
+		info, _ := spec["info"].(map[string]interface{})
+		title, _ := info["title"].(string)
+		pkg = packageName(title)
+	}
+	outDir := parsed.value("o", pkg)
+	_, api := selectAPI(config, parsed.value("api", ""))
+
+	jobs := openapiJobs(spec, lang, pkg, ext)
+	fmt.Fprintf(os.Stderr, "Generating %d files into %s/\n", len(jobs), outDir)
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, openapiConcurrency)
+	failed := 0
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job openapiJob) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := generateFile(api, job, outDir)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", job.file, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "✓ %s\n", job.file)
+		}(job)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		fmt.Printf("%d of %d files failed\n", failed, len(jobs))
+		os.Exit(1)
+	}
+}
+
+func generateFile(api APIConfig, job openapiJob, outDir string) error {
+	text, err := sendPrompt(api, job.prompt)
+	if err != nil {
+		return err
+	}
+
+	code := text
+	if blocks := extractCodeBlocks(text); len(blocks) > 0 {
+		code = blocks[0].Code
+	}
+	return os.WriteFile(filepath.Join(outDir, job.file), []byte(strings.TrimSpace(code)+"\n"), 0644)
+}
+
+// loadOpenAPISpec reads a JSON spec, converting YAML through yq since the
+// standard library has no YAML parser.
+func loadOpenAPISpec(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		if _, err := exec.LookPath("yq"); err != nil {
+			return nil, fmt.Errorf("YAML specs need yq installed (or convert the spec to JSON first)")
+		}
+		if data, err = exec.Command("yq", "-o=json", path).Output(); err != nil {
+			return nil, fmt.Errorf("converting %s with yq: %v", path, err)
+		}
+	}
+
+	var spec map[string]interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, describeJSONError(data, err))
+	}
+	if _, ok := spec["paths"].(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%s has no paths; is it an OpenAPI spec?", path)
+	}
+	return spec, nil
+}
+
+// openapiJobs splits the spec into one chunk per tag, plus the shared
+// client and models, each carrying only the schemas it references.
+func openapiJobs(spec map[string]interface{}, lang, pkg, ext string) []openapiJob {
+	contract := fmt.Sprintf(openapiContract, lang, pkg, ext, ext)
+	components, _ := spec["components"].(map[string]interface{})
+	schemas, _ := components["schemas"].(map[string]interface{})
+
+	byTag := map[string]map[string]interface{}{}
+	paths, _ := spec["paths"].(map[string]interface{})
+	for path, item := range paths {
+		ops, _ := item.(map[string]interface{})
+		for _, method := range httpMethods {
+			op, ok := ops[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tag := "default"
+			if tags, ok := op["tags"].([]interface{}); ok && len(tags) > 0 {
+				if t, ok := tags[0].(string); ok {
+					tag = t
+				}
+			}
+			if byTag[tag] == nil {
+				byTag[tag] = map[string]interface{}{}
+			}
+			if byTag[tag][path] == nil {
+				byTag[tag][path] = map[string]interface{}{}
+			}
+			byTag[tag][path].(map[string]interface{})[method] = op
+			if params, ok := ops["parameters"]; ok {
+				byTag[tag][path].(map[string]interface{})["parameters"] = params
+			}
+		}
+	}
+
+	header := map[string]interface{}{
+		"openapi":    spec["openapi"],
+		"info":       spec["info"],
+		"servers":    spec["servers"],
+		"security":   spec["security"],
+		"components": map[string]interface{}{"securitySchemes": components["securitySchemes"]},
+	}
+	jobs := []openapiJob{
+		{file: "client." + ext, prompt: contract + "\n\nWrite client." + ext + " for this API:\n\n" + mustJSON(header)},
+		{file: "models." + ext, prompt: contract + "\n\nWrite models." + ext + " for these schemas:\n\n" + mustJSON(schemas)},
+	}
+
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	// A tag named like the shared files, or two tags spelt alike, would
+	// overwrite each other's file; later ones get a suffix.
+	used := map[string]bool{"client": true, "models": true}
+	for _, tag := range tags {
+		chunk := map[string]interface{}{
+			"paths":      byTag[tag],
+			"components": map[string]interface{}{"schemas": referencedSchemas(byTag[tag], schemas)},
+		}
+		name := packageName(tag)
+		if used[name] {
+			name += "_api"
+		}
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_api%d", packageName(tag), n)
+		}
+		used[name] = true
+		file := name + "." + ext
+		jobs = append(jobs, openapiJob{
+			file:   file,
+			prompt: fmt.Sprintf("%s\n\nWrite %s with the operations tagged %q. The schemas are included for reference only; they are already defined in models.%s.\n\n%s", contract, file, tag, ext, mustJSON(chunk)),
+		})
+	}
+	return jobs
+}
+
+var schemaRef = regexp.MustCompile(`"#/components/schemas/([^"]+)"`)
+
+// referencedSchemas returns the schemas reachable through $refs from v.
+func referencedSchemas(v interface{}, schemas map[string]interface{}) map[string]interface{} {
+	found := map[string]interface{}{}
+	queue := []string{mustJSON(v)}
+	for len(queue) > 0 {
+		text := queue[0]
+		queue = queue[1:]
+		for _, m := range schemaRef.FindAllStringSubmatch(text, -1) {
+			name := m[1]
+			if _, seen := found[name]; seen {
+				continue
+			}
+			if schema, ok := schemas[name]; ok {
+				found[name] = schema
+				queue = append(queue, mustJSON(schema))
+			}
+		}
+	}
+	return found
+}
+
+func mustJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// packageName turns a title or tag into a lower-case identifier.
+func packageName(s string) string {
+	name := strings.Trim(nonWord.ReplaceAllString(strings.ToLower(s), "_"), "_")
+	if name == "" {
+		return "client"
+	}
+	return name
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Output pacing modes for streamed responses.
+const (
+	// PaceImmediate writes every chunk the moment it arrives.
+	PaceImmediate = "immediate"
+	// PaceSmooth buffers chunks and releases them at a steady rate, which
+	// hides the bursts some providers send and keeps rendering calm.
+	PaceSmooth = "smooth"
+)
+
+const (
+	// paceTick is how often smoothed output is released (about 60 fps).
+	paceTick = 16 * time.Millisecond
+	// paceDrain is how long the backlog may take to drain: the release
+	// rate adapts so a burst is spread over roughly this long, keeping
+	// output close behind the stream instead of lagging further and further.
+	paceDrain = 250 * time.Millisecond
+)
+
+// newStreamWriter wraps w according to the pacing mode. The returned
+// writer must be closed once the stream ends to flush anything held back.
+func newStreamWriter(w io.Writer, pace string) (io.WriteCloser, error) {
+	switch pace {
+	case "", PaceImmediate:
+		return nopCloser{w}, nil
+	case PaceSmooth:
+		return newPacedWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown pace %q (use %s or %s)", pace, PaceImmediate, PaceSmooth)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// pacedWriter releases what is written to it at a steady, adaptive rate.
+type pacedWriter struct {
+	w       io.Writer
+	mu      sync.Mutex
+	pending []byte
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newPacedWriter(w io.Writer) *pacedWriter {
+	p := &pacedWriter{w: w, done: make(chan struct{}), stopped: make(chan struct{})}
+	go p.run()
+	return p
+}
+
+func (p *pacedWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	p.pending = append(p.pending, b...)
+	p.mu.Unlock()
+	return len(b), nil
+}
+
+// Close releases everything still held back and stops the pacing loop.
+func (p *pacedWriter) Close() error {
+	close(p.done)
+	<-p.stopped
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(p.pending)
+	p.pending = nil
+	return err
+}
+
+func (p *pacedWriter) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(paceTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		if len(p.pending) == 0 {
+			p.mu.Unlock()
+			continue
+		}
+		runes := utf8.RuneCount(p.pending)
+		n := runes * int(paceTick) / int(paceDrain)
+		if n < 1 {
+			n = 1
+		}
+		cut := runeOffset(p.pending, n)
+		chunk := append([]byte(nil), p.pending[:cut]...)
+		p.pending = p.pending[cut:]
+		p.mu.Unlock()
+
+		p.w.Write(chunk)
+	}
+}
+
+// runeOffset returns the byte offset just past the first n runes of b.
+func runeOffset(b []byte, n int) int {
+	offset := 0
+	for i := 0; i < n && offset < len(b); i++ {
+		_, size := utf8.DecodeRune(b[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// newOutput builds the writer a prompt's response travels through on its
+// way to stdout: rendered as Markdown on a terminal (unless --plain),
+// word-wrapped to the terminal, paced, and finally paged.
+func newOutput(parsed *cliArgs, settings Settings) (io.WriteCloser, error) {
+	return withPager(parsed.value("pager", settings.Pager), func(stdout io.Writer) (io.WriteCloser, error) {
+		return newWrappedOutput(parsed, settings, stdout)
+	})
+}
+
+func newWrappedOutput(parsed *cliArgs, settings Settings, stdout io.Writer) (io.WriteCloser, error) {
+	paced, err := newStreamWriter(stdout, parsed.value("pace", settings.Pace))
+	if err != nil {
+		return nil, err
+	}
+
+	width := 0
+	if w := parsed.value("width", ""); w != "" {
+		if width, err = strconv.Atoi(w); err != nil || width < 0 {
+			return nil, fmt.Errorf("invalid width %q", w)
+		}
+	} else if term.IsTerminal(int(os.Stdout.Fd())) {
+		width, _, _ = term.GetSize(int(os.Stdout.Fd()))
+	}
+	var out io.WriteCloser = paced
+	if width > 0 {
+		out = newWrapWriter(paced, width)
+	}
+	if !parsed.has("plain") && term.IsTerminal(int(os.Stdout.Fd())) {
+		out = newMarkdownWriter(out)
+	}
+	return out, nil
+}
+
+// wrapWriter word-wraps text to a fixed width as it streams through. Lines
+// inside fenced code blocks are left alone, and wrapped list items and
+// indented lines continue at their text's indentation.
+type wrapWriter struct {
+	w      io.WriteCloser
+	width  int
+	col    int    // runes written on the current line
+	indent int    // hanging indent for continuation lines
+	spaces int    // spaces seen but not yet written
+	word   []rune // word being collected
+	wordW  int    // visible width of word
+	line   []rune // the current line's text so far, for fence detection
+	inCode bool
+	esc    bool // inside a terminal escape sequence
+	out    []byte
+}
+
+func newWrapWriter(w io.WriteCloser, width int) *wrapWriter {
+	return &wrapWriter{w: w, width: width}
+}
+
+func (ww *wrapWriter) Write(b []byte) (int, error) {
+	ww.out = ww.out[:0]
+	for _, r := range string(b) {
+		ww.writeRune(r)
+	}
+	_, err := ww.w.Write(ww.out)
+	return len(b), err
+}
+
+func (ww *wrapWriter) Close() error {
+	ww.out = ww.out[:0]
+	ww.flushWord()
+	ww.w.Write(ww.out)
+	return ww.w.Close()
+}
+
+func (ww *wrapWriter) writeRune(r rune) {
+	if r == '\n' {
+		ww.flushWord()
+		ww.out = append(ww.out, '\n')
+		if strings.HasPrefix(strings.TrimSpace(string(ww.line)), "```") {
+			ww.inCode = !ww.inCode
+		}
+		ww.col, ww.indent, ww.spaces, ww.line = 0, 0, 0, ww.line[:0]
+		return
+	}
+	ww.line = append(ww.line, r)
+
+	if r == '\x1b' || ww.esc {
+		// Escape sequences (colors) take up no room on screen.
+		ww.esc = r == '\x1b' || r == '[' || r < '@' || r > '~'
+		if ww.inCode {
+			ww.out = utf8.AppendRune(ww.out, r)
+		} else {
+			ww.word = append(ww.word, r)
+		}
+		return
+	}
+
+	if ww.inCode || strings.HasPrefix(strings.TrimSpace(string(ww.line)), "```") {
+		ww.flushWord()
+		ww.out = utf8.AppendRune(ww.out, r)
+		ww.col++
+		return
+	}
+
+	if r == ' ' || r == '\t' {
+		ww.flushWord()
+		if ww.col == 0 || ww.isLineStart() {
+			// Leading indentation is kept as written.
+			ww.out = utf8.AppendRune(ww.out, r)
+			ww.col++
+			ww.indent = ww.col
+			return
+		}
+		ww.spaces++
+		return
+	}
+	ww.word = append(ww.word, r)
+	ww.wordW++
+}
+
+// isLineStart reports whether nothing but indentation has been written on
+// the current line.
+func (ww *wrapWriter) isLineStart() bool {
+	return strings.TrimSpace(string(ww.line[:len(ww.line)-1])) == ""
+}
+
+func (ww *wrapWriter) flushWord() {
+	if len(ww.word) == 0 {
+		return
+	}
+
+	firstWord := ww.col == ww.indent && ww.spaces == 0
+	if !firstWord && ww.col+ww.spaces+ww.wordW > ww.width {
+		ww.out = append(ww.out, '\n')
+		ww.out = append(ww.out, strings.Repeat(" ", ww.indent)...)
+		ww.col = ww.indent
+	} else {
+		ww.out = append(ww.out, strings.Repeat(" ", ww.spaces)...)
+		ww.col += ww.spaces
+	}
+	ww.spaces = 0
+
+	// Words longer than a whole line are broken wherever they hit the edge,
+	// unless they carry escape sequences that mustn't be split.
+	if ww.wordW != len(ww.word) {
+		ww.out = append(ww.out, string(ww.word)...)
+		ww.col += ww.wordW
+		ww.word, ww.wordW = ww.word[:0], 0
+	}
+	for len(ww.word) > 0 {
+		room := ww.width - ww.col
+		if room <= 0 {
+			ww.out = append(ww.out, '\n')
+			ww.out = append(ww.out, strings.Repeat(" ", ww.indent)...)
+			ww.col = ww.indent
+			room = ww.width - ww.col
+			if room <= 0 {
+				room = 1
+			}
+		}
+		n := len(ww.word)
+		if n > room {
+			n = room
+		}
+		ww.out = append(ww.out, string(ww.word[:n])...)
+		ww.col += n
+		ww.word = ww.word[n:]
+	}
+	ww.wordW = 0
+
+	// A list marker sets the hanging indent for the rest of the item.
+	if firstWord && isListMarker(strings.TrimSpace(string(ww.line))) {
+		ww.indent = ww.col + 1
+	}
+}
+
+// isListMarker reports whether s is a Markdown bullet or numbered list
+// marker such as "-", "*" or "12.", or a rendered bullet.
+func isListMarker(s string) bool {
+	if s == "-" || s == "*" || s == "+" || s == "•" {
+		return true
+	}
+	if len(s) < 2 || (s[len(s)-1] != '.' && s[len(s)-1] != ')') {
+		return false
+	}
+	_, err := strconv.Atoi(s[:len(s)-1])
+	return err == nil
+}
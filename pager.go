@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// Pager modes for long responses.
+const (
+	PagerAuto   = "auto"
+	PagerAlways = "always"
+	PagerNever  = "never"
+)
+
+// pagedWriter records everything written to stdout so that, once the
+// stream ends, the full response can be handed to $PAGER for scrolling.
+type pagedWriter struct {
+	io.WriteCloser
+	mode string
+	buf  *bytes.Buffer
+}
+
+// withPager arranges for the output of the writer built by build to be
+// paged according to mode once it is closed. Nothing is paged unless
+// stdout is a terminal.
+func withPager(mode string, build func(w io.Writer) (io.WriteCloser, error)) (io.WriteCloser, error) {
+	switch mode {
+	case "", PagerNever:
+		return build(os.Stdout)
+	case PagerAuto, PagerAlways:
+	default:
+		return nil, fmt.Errorf("unknown pager mode %q (use %s, %s or %s)", mode, PagerAuto, PagerAlways, PagerNever)
+	}
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return build(os.Stdout)
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := build(io.MultiWriter(os.Stdout, buf))
+	if err != nil {
+		return nil, err
+	}
+	return &pagedWriter{WriteCloser: w, mode: mode, buf: buf}, nil
+}
+
+func (p *pagedWriter) Close() error {
+	err := p.WriteCloser.Close()
+	if p.mode == PagerAuto {
+		_, height, sizeErr := term.GetSize(int(os.Stdout.Fd()))
+		if sizeErr != nil || bytes.Count(p.buf.Bytes(), []byte("\n")) < height {
+			return err
+		}
+	}
+	if pageErr := runPager(p.buf); pageErr != nil && err == nil {
+		err = pageErr
+	}
+	return err
+}
+
+// runPager shows r in $PAGER, falling back to less. Like git, it sets
+// LESS so colors come through unless the user configured less themselves.
+func runPager(r io.Reader) error {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	return cmd.Run()
+}
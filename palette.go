@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// paletteEntry is one launchable item in the command palette.
+type paletteEntry struct {
+	label string // what is shown and matched against
+	desc  string
+	args  string   // argument hint; when set, arguments are asked for
+	run   []string // the command line to dispatch, before any arguments
+	// freeText passes the typed arguments through as a single word, for
+	// prompts that shouldn't need quoting.
+	freeText bool
+}
+
+var paletteCommands = []paletteEntry{
+	{label: "list", desc: "List configured APIs", run: []string{"list"}},
+	{label: "add", desc: "Add a new API/model", args: "<api:provider-model|local:model>", run: []string{"add"}},
+	{label: "remove", desc: "Remove an API", args: "<api-name>", run: []string{"remove"}},
+	{label: "default", desc: "Show or set the default API", args: "[api-name]", run: []string{"default"}},
+	{label: "smoke", desc: "Check every configured API", run: []string{"smoke"}},
+	{label: "config repair", desc: "Salvage valid entries from a broken config", run: []string{"config", "repair"}},
+	{label: "history", desc: "List recorded runs", run: []string{"history"}},
+	{label: "history show", desc: "Show a recorded run", args: "<id|last>", run: []string{"history", "show"}},
+	{label: "usage", desc: "Report requests, tokens and spend", args: "[--since date] [--by model|day]", run: []string{"usage"}},
+	{label: "dash", desc: "Browse spend, recent runs and provider health", args: "[--days N]", run: []string{"dash"}},
+	{label: "cache", desc: "Show the cache of answers", run: []string{"cache"}},
+	{label: "cache clear", desc: "Empty the cache of answers", run: []string{"cache", "clear"}},
+	{label: "template list", desc: "List prompt templates", run: []string{"template", "list"}},
+	{label: "template search", desc: "Search prompt templates", args: "\"<query>\"", run: []string{"template", "search"}},
+	{label: "bookmark", desc: "Save a recorded run's code as a snippet", args: "<id|last> --name <name>", run: []string{"bookmark"}},
+	{label: "snippets", desc: "List or search saved snippets", args: "[query]", run: []string{"snippets", "list"}},
+	{label: "snippets copy", desc: "Copy a saved snippet to the clipboard", args: "<name>", run: []string{"snippets", "copy"}},
+	{label: "context show", desc: "Show the .ask.toml context sent with prompts", run: []string{"context", "show"}},
+	{label: "translate", desc: "Translate text", args: "<lang> \"<text>\"", run: []string{"translate"}},
+	{label: "chart", desc: "Describe a chart or extract its data", args: "<image> [--extract-data]", run: []string{"chart"}},
+	{label: "diagram", desc: "Generate a Mermaid/PlantUML diagram", args: "\"<description>\" [-o file]", run: []string{"diagram"}},
+	{label: "openapi client", desc: "Generate an API client from a spec", args: "<spec> --lang <language>", run: []string{"openapi", "client"}},
+	{label: "embed", desc: "Compute embedding vectors", args: "<api-name> [--file path] [-o out.json]", run: []string{"embed"}},
+	{label: "index", desc: "Index a folder for ask query", args: "<dir> [--name name]", run: []string{"index"}},
+	{label: "index --workspace", desc: "Index the workspace roots in .ask.toml", run: []string{"index", "--workspace"}},
+	{label: "query", desc: "Answer a question from an indexed folder", args: "<api-name> \"<question>\"", run: []string{"query"}},
+	{label: "rerank", desc: "Rank documents by relevance to a query", args: "<api-name> \"<query>\" --file <path>...", run: []string{"rerank"}},
+	{label: "calc", desc: "Answer with locally computed numbers", args: "\"<question>\"", run: []string{"calc"}},
+	{label: "tokens", desc: "Count a prompt's tokens for a model", args: "<api-name> [--file path] \"<prompt>\"", run: []string{"tokens"}},
+	{label: "edit", desc: "Change a file through a reviewed diff", args: "<api-name> --file <path> \"<instruction>\"", run: []string{"edit"}},
+	{label: "fix", desc: "Patch files to fix the errors in a log", args: "<log-file> <file>...", run: []string{"fix"}},
+	{label: "fix --cmd", desc: "Patch and re-run a command until it passes", args: "\"<command>\"", run: []string{"fix", "--cmd"}},
+	{label: "commit", desc: "Write a commit message for the staged changes", run: []string{"commit"}},
+	{label: "sh", desc: "Suggest a shell command for a task", args: "\"<what to do>\" [-x]", run: []string{"sh"}},
+	{label: "explain", desc: "Explain code or text", args: "<file> [--eli5|--expert] [--lines 40-80]", run: []string{"explain"}},
+	{label: "explain-last", desc: "Explain what went wrong with the last command", run: []string{"explain-last"}},
+	{label: "gogen", desc: "Write Go code for a type, given just its context", args: "--type ./pkg.Type --task \"<task>\"", run: []string{"gogen"}},
+	{label: "write", desc: "Write a long-form document, outline first", args: "\"<what to write>\" -o doc.md --outline-first", run: []string{"write"}},
+	{label: "undo", desc: "Restore the files the last edit session changed", run: []string{"undo"}},
+	{label: "undo --list", desc: "List edit sessions that can be undone", run: []string{"undo", "--list"}},
+	{label: "sessions to-pr", desc: "Turn an edit session into a branch, commits and a PR body", args: "<name>", run: []string{"sessions", "to-pr"}},
+	{label: "review", desc: "Review the uncommitted changes", run: []string{"review"}},
+	{label: "review --pr", desc: "Review a GitHub pull request", args: "<number>", run: []string{"review", "--pr"}},
+	{label: "agent", desc: "Work on a goal with file and command tools", args: "<api-name> \"<goal>\"", run: []string{"agent"}},
+	{label: "watch-dir", desc: "Answer prompt files dropped into a directory", args: "<dir> --out <dir>", run: []string{"watch-dir"}},
+	{label: "moderate", desc: "Score text for moderation categories", args: "<api-name> \"<text>\"", run: []string{"moderate"}},
+	{label: "local list", desc: "List installed local models", run: []string{"local", "list"}},
+	{label: "local pull", desc: "Download a local model", args: "<model>", run: []string{"local", "pull"}},
+	{label: "local rm", desc: "Delete a local model", args: "<model>", run: []string{"local", "rm"}},
+	{label: "local warm", desc: "Preload a local model", args: "<model>", run: []string{"local", "warm"}},
+}
+
+// runPalette shows a fuzzy-searchable list of commands and configured APIs
+// and runs whichever the user picks.
+func runPalette(config *Config) {
+	var entries []paletteEntry
+	for _, name := range sortedAPINames(config) {
+		api := config.APIs[name]
+		entries = append(entries, paletteEntry{
+			label:    name,
+			desc:     fmt.Sprintf("Ask %s (%s)", api.Model, api.Provider),
+			args:     "<prompt>",
+			run:      []string{name},
+			freeText: true,
+		})
+	}
+	entries = append(entries, paletteCommands...)
+
+	entry, ok := pickEntry(entries)
+	if !ok {
+		return
+	}
+
+	args := entry.run
+	if entry.args != "" {
+		fmt.Println(dim("ask " + strings.Join(entry.run, " ") + " " + entry.args))
+		label := fmt.Sprintf("ask %s ", strings.Join(entry.run, " "))
+		var line string
+		var err error
+		if entry.freeText {
+			// Prompts are completed from the ones run before.
+			line, err = readPrompt(label, promptSuggestions())
+		} else {
+			fmt.Print(label)
+			line, err = readLine()
+		}
+		if err != nil {
+			return
+		}
+		words := splitWords(line)
+		if entry.freeText {
+			words = []string{line}
+		}
+		args = append(append([]string{}, entry.run...), words...)
+	}
+	dispatch(args)
+}
+
+// pickEntry runs the interactive picker and returns the chosen entry.
+func pickEntry(entries []paletteEntry) (paletteEntry, bool) {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return paletteEntry{}, false
+	}
+	defer term.Restore(fd, oldState)
+
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height < 4 {
+		height = 12
+	}
+	maxItems := height - 2
+	if maxItems > 10 {
+		maxItems = 10
+	}
+
+	query := ""
+	selected := 0
+	drawn := 0
+	buf := make([]byte, 16)
+	for {
+		matches := filterEntries(entries, query)
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		drawn = drawPalette(query, matches, selected, maxItems, drawn)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return paletteEntry{}, false
+		}
+		key := buf[:n]
+
+		switch {
+		case n == 1 && (key[0] == 3 || key[0] == 27): // Ctrl-C, Esc
+			clearPalette(drawn)
+			return paletteEntry{}, false
+		case n == 1 && (key[0] == '\r' || key[0] == '\n'):
+			clearPalette(drawn)
+			if len(matches) == 0 {
+				return paletteEntry{}, false
+			}
+			return matches[selected], true
+		case n == 1 && (key[0] == 127 || key[0] == 8):
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+		case string(key) == "\x1b[A" || (n == 1 && key[0] == 16): // Up, Ctrl-P
+			selected--
+		case string(key) == "\x1b[B" || (n == 1 && key[0] == 14): // Down, Ctrl-N
+			selected++
+		case n == 1 && key[0] >= 32 && key[0] < 127:
+			query += string(key)
+			selected = 0
+		}
+	}
+}
+
+// drawPalette redraws the picker in place and returns how many lines it
+// drew below the query line, so the next draw can overwrite them.
+func drawPalette(query string, matches []paletteEntry, selected, maxItems, drawn int) int {
+	var sb strings.Builder
+	if drawn > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", drawn)
+	}
+	sb.WriteString("\r\x1b[J")
+
+	start := 0
+	if selected >= maxItems {
+		start = selected - maxItems + 1
+	}
+	lines := 0
+	for i := start; i < len(matches) && i < start+maxItems; i++ {
+		marker := "  "
+		label := matches[i].label
+		if i == selected {
+			marker = "> "
+			label = "\x1b[1m" + label + "\x1b[0m"
+		}
+		fmt.Fprintf(&sb, "%s%-28s %s\r\n", marker, label, dim(matches[i].desc))
+		lines++
+	}
+	if len(matches) == 0 {
+		sb.WriteString(dim("  no matches") + "\r\n")
+		lines++
+	}
+	fmt.Fprintf(&sb, "ask> %s", query)
+
+	fmt.Print(sb.String())
+	return lines
+}
+
+func clearPalette(drawn int) {
+	if drawn > 0 {
+		fmt.Printf("\x1b[%dA", drawn)
+	}
+	fmt.Print("\r\x1b[J")
+}
+
+func dim(s string) string {
+	return "\x1b[2m" + s + "\x1b[0m"
+}
+
+// filterEntries returns the entries matching query, best match first.
+func filterEntries(entries []paletteEntry, query string) []paletteEntry {
+	if query == "" {
+		return entries
+	}
+
+	type scored struct {
+		entry paletteEntry
+		score int
+	}
+	var matches []scored
+	for _, e := range entries {
+		if score, ok := fuzzyScore(query, e.label+" "+e.desc); ok {
+			matches = append(matches, scored{e, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	result := make([]paletteEntry, len(matches))
+	for i, m := range matches {
+		result[i] = m.entry
+	}
+	return result
+}
+
+// fuzzyScore reports whether the letters of query appear in order in text,
+// scoring consecutive runs and word-start matches higher.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+
+	score, qi, run := 0, 0, 0
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			run = 0
+			continue
+		}
+		run++
+		score += run
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) {
+			score += 3
+		}
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// splitWords splits a command line into words, honouring single and double
+// quotes and backslash escapes the way a shell would.
+func splitWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+func sortedAPINames(config *Config) []string {
+	names := make([]string, 0, len(config.APIs))
+	for name := range config.APIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunk is one change to a file: the lines it replaces and what replaces
+// them. Start is the 1-based line the change claims to begin at, or 0 when
+// it doesn't say; it's only a hint, since models miscount.
+type hunk struct {
+	Start int
+	Old   []string
+	New   []string
+}
+
+// filePatch is the changes to one file.
+type filePatch struct {
+	Path  string
+	Hunks []hunk
+}
+
+var (
+	hunkHeader     = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+	searchMarker   = regexp.MustCompile(`^<{5,}\s*SEARCH\s*$`)
+	dividerMarker  = regexp.MustCompile(`^={5,}\s*$`)
+	replaceMarker  = regexp.MustCompile(`^>{5,}\s*REPLACE\s*$`)
+	diffPathPrefix = regexp.MustCompile(`^[ab]/`)
+)
+
+// parseUnifiedDiff reads the unified diff in text, which may sit among
+// prose or in a fence. Hunks before any ---/+++ header belong to
+// defaultPath. Line counts in hunk headers aren't trusted: a hunk ends at
+// the first line that isn't context, a removal or an addition. They
+// only tell a removed "-- " line followed by an added "++ " one from a
+// ---/+++ header: the pair is taken for a header once a hunk's lines have
+// all been read, or when a hunk header follows it.
+func parseUnifiedDiff(text, defaultPath string) []filePatch {
+	var patches []filePatch
+	path := defaultPath
+	var current *hunk
+	// oldLeft and newLeft are the lines the current hunk's header says it
+	// has still to come.
+	var oldLeft, newLeft int
+	flush := func() {
+		if current != nil && (len(current.Old) > 0 || len(current.New) > 0) {
+			patches = addHunk(patches, path, *current)
+		}
+		current = nil
+	}
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") &&
+			(current == nil || oldLeft <= 0 && newLeft <= 0 || i+2 < len(lines) && hunkHeader.MatchString(lines[i+2])) {
+			flush()
+			path = diffPath(lines[i+1][4:])
+			if path == "/dev/null" {
+				path = diffPath(line[4:])
+			}
+			i++
+			continue
+		}
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			flush()
+			start, _ := strconv.Atoi(m[1])
+			if m[2] == "0" {
+				// A pure addition gives the line it goes after.
+				start++
+			}
+			current = &hunk{Start: start}
+			oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[3])
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch {
+		case line == "":
+			// Editors and models drop the space of blank context lines.
+			current.Old = append(current.Old, "")
+			current.New = append(current.New, "")
+			oldLeft, newLeft = oldLeft-1, newLeft-1
+		case line[0] == ' ':
+			current.Old = append(current.Old, line[1:])
+			current.New = append(current.New, line[1:])
+			oldLeft, newLeft = oldLeft-1, newLeft-1
+		case line[0] == '-':
+			current.Old = append(current.Old, line[1:])
+			oldLeft--
+		case line[0] == '+':
+			current.New = append(current.New, line[1:])
+			newLeft--
+		case line[0] == '\\': // "\ No newline at end of file"
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	// Trailing blank "context" is usually the blank line after the diff.
+	for i := range patches {
+		for j := range patches[i].Hunks {
+			h := &patches[i].Hunks[j]
+			for len(h.Old) > 0 && len(h.New) > 0 && h.Old[len(h.Old)-1] == "" && h.New[len(h.New)-1] == "" {
+				h.Old, h.New = h.Old[:len(h.Old)-1], h.New[:len(h.New)-1]
+			}
+		}
+	}
+	return patches
+}
+
+// hunkCount reads a line count from a hunk header, which is 1 when left
+// out.
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffPath cleans the path on a ---/+++ line: no a/ or b/ prefix and no
+// timestamp.
+func diffPath(s string) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\t")
+	if s == "/dev/null" {
+		return s
+	}
+	return diffPathPrefix.ReplaceAllString(s, "")
+}
+
+// parseSearchReplace reads search/replace blocks:
+//
+//	path/to/file.go
+//	<<<<<<< SEARCH
+//	old lines
+//	=======
+//	new lines
+//	>>>>>>> REPLACE
+//
+// The file is the last non-empty line before the block that isn't a fence.
+// A block straight after another is for the same file, and blocks without a
+// file belong to defaultPath.
+func parseSearchReplace(text, defaultPath string) []filePatch {
+	var patches []filePatch
+	path := defaultPath
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		if !searchMarker.MatchString(lines[i]) {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			prev := strings.TrimSpace(lines[j])
+			if prev == "" || fenceOf(prev) != "" {
+				continue
+			}
+			if replaceMarker.MatchString(prev) {
+				break
+			}
+			path = defaultPath
+			if !strings.Contains(prev, " ") {
+				path = strings.Trim(prev, "`*:")
+			}
+			break
+		}
+
+		var h hunk
+		target := &h.Old
+		for i++; i < len(lines) && !replaceMarker.MatchString(lines[i]); i++ {
+			if dividerMarker.MatchString(lines[i]) && target == &h.Old {
+				target = &h.New
+				continue
+			}
+			*target = append(*target, lines[i])
+		}
+		patches = addHunk(patches, path, h)
+	}
+	return patches
+}
+
+func addHunk(patches []filePatch, path string, h hunk) []filePatch {
+	for i := range patches {
+		if patches[i].Path == path {
+			patches[i].Hunks = append(patches[i].Hunks, h)
+			return patches
+		}
+	}
+	return append(patches, filePatch{Path: path, Hunks: []hunk{h}})
+}
+
+// matchPatchPath maps the path a patch names to one of files: the same
+// path, else the only file with the same base name.
+func matchPatchPath(path string, files []string) (string, bool) {
+	clean := filepath.Clean(path)
+	var byBase []string
+	for _, f := range files {
+		if filepath.Clean(f) == clean {
+			return f, true
+		}
+		if filepath.Base(f) == filepath.Base(clean) {
+			byBase = append(byBase, f)
+		}
+	}
+	if len(byBase) == 1 {
+		return byBase[0], true
+	}
+	return "", false
+}
+
+// splitLines splits content into lines, reporting whether it ended with a
+// newline.
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return nil, true
+	}
+	final := strings.HasSuffix(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), final
+}
+
+func joinLines(lines []string, final bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	s := strings.Join(lines, "\n")
+	if final {
+		s += "\n"
+	}
+	return s
+}
+
+// applyHunks applies hunks to content in order. Each hunk's old lines are
+// looked for exactly, then ignoring trailing and then surrounding
+// whitespace, and the match nearest the line the hunk gives is used. It
+// fails, changing nothing, if any hunk can't be placed.
+func applyHunks(content string, hunks []hunk) (string, error) {
+	lines, final := splitLines(content)
+	offset := 0
+	for i, h := range hunks {
+		want := h.Start - 1 + offset
+		if len(h.Old) == 0 {
+			at := len(lines)
+			if h.Start > 0 && want <= len(lines) {
+				at = max(want, 0)
+			}
+			lines = append(lines[:at], append(append([]string{}, h.New...), lines[at:]...)...)
+			offset = at - (h.Start - 1) + len(h.New)
+			continue
+		}
+
+		at, err := findHunk(lines, h.Old, want, h.Start > 0)
+		if err != nil {
+			return "", fmt.Errorf("hunk %d doesn't apply: %v:\n%s", i+1, err, indent(strings.Join(h.Old, "\n"), "  "))
+		}
+		rest := append(append([]string{}, h.New...), lines[at+len(h.Old):]...)
+		lines = append(lines[:at], rest...)
+		// Later hunks are likely off by as much as this one was.
+		offset = at - (h.Start - 1) + len(h.New) - len(h.Old)
+	}
+	return joinLines(lines, final), nil
+}
+
+// findHunk finds where old occurs in lines, trying looser comparisons in
+// turn. Several matches are only resolved by a line hint.
+func findHunk(lines, old []string, want int, hinted bool) (int, error) {
+	for _, norm := range []func(string) string{
+		func(s string) string { return s },
+		func(s string) string { return strings.TrimRight(s, " \t") },
+		strings.TrimSpace,
+	} {
+		var found []int
+		for at := 0; at+len(old) <= len(lines); at++ {
+			match := true
+			for j := range old {
+				if norm(lines[at+j]) != norm(old[j]) {
+					match = false
+					break
+				}
+			}
+			if match {
+				found = append(found, at)
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+		if len(found) > 1 && !hinted {
+			return 0, fmt.Errorf("the lines occur %d times", len(found))
+		}
+		best := found[0]
+		for _, at := range found {
+			if abs(at-want) < abs(best-want) {
+				best = at
+			}
+		}
+		return best, nil
+	}
+	return 0, fmt.Errorf("can't find the lines")
+}
+
+// Colors for removed and added lines in diffs.
+const (
+	colorRemoved = "\x1b[31m"
+	colorAdded   = "\x1b[32m"
+)
+
+// lineOp is one line of a diff: ' ' kept, '-' removed or '+' added.
+type lineOp struct {
+	Kind byte
+	Text string
+}
+
+// maxDiffCells caps the table diffLines fills; beyond it the changed middle
+// is shown as removed and re-added whole.
+const maxDiffCells = 4_000_000
+
+// diffLines returns the edit from a to b as kept, removed and added lines,
+// by longest common subsequence after trimming what they share at either end.
+func diffLines(a, b []string) []lineOp {
+	var ops []lineOp
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		ops = append(ops, lineOp{' ', a[pre]})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, l := range ma {
+			ops = append(ops, lineOp{'-', l})
+		}
+		for _, l := range mb {
+			ops = append(ops, lineOp{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of ma[i:] and mb[j:].
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				ops = append(ops, lineOp{' ', ma[i]})
+				i++
+				j++
+			case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, lineOp{'-', ma[i]})
+				i++
+			default:
+				ops = append(ops, lineOp{'+', mb[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, lineOp{' ', l})
+	}
+	return ops
+}
+
+// diffHunks compares two versions of a file and returns the changes as
+// hunks with up to context lines of context around each.
+func diffHunks(oldContent, newContent string, context int) []hunk {
+	a, _ := splitLines(oldContent)
+	b, _ := splitLines(newContent)
+	ops := diffLines(a, b)
+
+	var hunks []hunk
+	line := 1 // in the old file
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			line++
+			i++
+			continue
+		}
+		// Back up over leading context, then take changes until there's a
+		// run of more than 2*context unchanged lines.
+		start := max(i-context, 0)
+		h := hunk{Start: line - (i - start)}
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = run
+		}
+		for _, op := range ops[start:end] {
+			if op.Kind != '+' {
+				h.Old = append(h.Old, op.Text)
+			}
+			if op.Kind != '-' {
+				h.New = append(h.New, op.Text)
+			}
+		}
+		for _, op := range ops[i:end] {
+			if op.Kind != '+' {
+				line++
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// formatDiff renders hunks of a change to path as a unified diff, colored
+// when color is set.
+func formatDiff(path string, hunks []hunk, color bool) string {
+	paint := func(s, c string) string {
+		if !color {
+			return s
+		}
+		return c + s + styleReset
+	}
+	var b strings.Builder
+	b.WriteString(paint("--- a/"+path, styleBold) + "\n" + paint("+++ b/"+path, styleBold) + "\n")
+	offset := 0
+	for _, h := range hunks {
+		b.WriteString(formatHunk(h, offset, paint))
+		offset += len(h.New) - len(h.Old)
+	}
+	return b.String()
+}
+
+// formatHunk renders one hunk, offset being how many lines earlier hunks
+// added to the new file.
+func formatHunk(h hunk, offset int, paint func(s, c string) string) string {
+	var b strings.Builder
+	oldStart, newStart := h.Start, h.Start+offset
+	if len(h.Old) == 0 {
+		oldStart--
+	}
+	if len(h.New) == 0 {
+		newStart--
+	}
+	b.WriteString(paint(fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, len(h.Old), newStart, len(h.New)), styleCode) + "\n")
+	for _, op := range diffLines(h.Old, h.New) {
+		line := string(op.Kind) + op.Text
+		switch op.Kind {
+		case '-':
+			line = paint(line, colorRemoved)
+		case '+':
+			line = paint(line, colorAdded)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// supportsPDF reports whether a provider reads PDFs natively.
+func supportsPDF(provider string) bool {
+	return provider == ProviderClaude || provider == ProviderGemini
+}
+
+// attachPDF adds a PDF to req. Providers that read PDFs natively get the
+// whole file; everything else, and any request for a page range, gets the
+// text extracted locally with pdftotext and placed ahead of the prompt.
+func attachPDF(req *Request, provider, path, pages string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return fmt.Errorf("%s is not a PDF", path)
+	}
+
+	if supportsPDF(provider) && pages == "" {
+		req.Documents = append(req.Documents, Document{
+			Name:      filepath.Base(path),
+			MediaType: "application/pdf",
+			Data:      data,
+		})
+		return nil
+	}
+
+	text, err := extractPDFText(path, pages)
+	if err != nil {
+		return err
+	}
+
+	attrs := fmt.Sprintf("name=%q", filepath.Base(path))
+	if pages != "" {
+		attrs += fmt.Sprintf(" pages=%q", pages)
+	}
+	req.Prompt = fmt.Sprintf("<document %s>\n%s\n</document>\n\n%s", attrs, strings.TrimSpace(text), req.Prompt)
+	return nil
+}
+
+// extractPDFText runs pdftotext over the given page range ("3", "3-7",
+// "3-" or "" for all pages).
+func extractPDFText(path, pages string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		return "", fmt.Errorf("extracting PDF text needs pdftotext (poppler-utils) installed")
+	}
+
+	args := []string{"-layout"}
+	if pages != "" {
+		first, last, err := parsePageRange(pages)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "-f", strconv.Itoa(first))
+		if last > 0 {
+			args = append(args, "-l", strconv.Itoa(last))
+		}
+	}
+	args = append(args, path, "-")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("pdftotext", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("pdftotext: %s", strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// parsePageRange parses "N", "N-M" or "N-". last is 0 when open-ended.
+func parsePageRange(pages string) (first, last int, err error) {
+	from, to, isRange := strings.Cut(pages, "-")
+	if first, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || first < 1 {
+		return 0, 0, fmt.Errorf("invalid page range %q", pages)
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	if strings.TrimSpace(to) == "" {
+		return first, 0, nil
+	}
+	if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || last < first {
+		return 0, 0, fmt.Errorf("invalid page range %q", pages)
+	}
+	return first, last, nil
+}
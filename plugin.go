@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WASM plugins are WASI command modules (wasm32-wasi, wasip1) that ask runs
+// in a sandbox: no files, no network, no environment but ASK_PLUGIN, a
+// memory cap and a time limit. The ABI is the module's standard streams:
+//
+//	tool      stdin: the arguments as a JSON object  stdout: the result
+//	filter    stdin: the answer                      stdout: the new answer
+//	provider  stdin: {"model","system","prompt"}     stdout: the answer
+//
+// ASK_PLUGIN holds the role, and argv[0] the tool or model name. Exiting
+// non-zero fails a filter or provider; a tool's failure is shown to the
+// model, as a shell tool's is. Stderr is passed through.
+const (
+	pluginTimeout   = 60 * time.Second
+	pluginMaxOutput = 5 << 20
+	// pluginMemoryPages caps a module's memory at 256 MiB.
+	pluginMemoryPages = 4096
+)
+
+// getPluginCacheDir holds compiled plugins.
+func getPluginCacheDir() string {
+	return filepath.Join(stateDir(), "cache", "wasm")
+}
+
+// pluginRequest is what a provider plugin reads on stdin.
+type pluginRequest struct {
+	Model  string `json:"model,omitempty"`
+	System string `json:"system,omitempty"`
+	Prompt string `json:"prompt"`
+}
+
+// runPlugin runs the module at path as role, with stdin as its input, and
+// returns its output, cut to max bytes, and whether it was cut. A non-zero
+// exit is returned as a *sys.ExitError along with the output so far.
+func runPlugin(ctx context.Context, path, role, name string, stdin []byte, max int) (string, bool, error) {
+	path, err := expandEnv(path)
+	if err != nil {
+		return "", false, err
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[2:])
+	}
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(parent, pluginTimeout)
+	defer cancel()
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(pluginMemoryPages)
+	// Compiling is the slow part; the cache keeps it to the first run.
+	if cache, err := wazero.NewCompilationCacheWithDir(getPluginCacheDir()); err == nil {
+		defer cache.Close(ctx)
+		config = config.WithCompilationCache(cache)
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	defer runtime.Close(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	module, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %v", path, err)
+	}
+	out := limitedBuffer{max: max}
+	_, err = runtime.InstantiateModule(ctx, module, wazero.NewModuleConfig().
+		WithArgs(name).
+		WithEnv("ASK_PLUGIN", role).
+		WithStdin(bytes.NewReader(stdin)).
+		WithStdout(&out).
+		WithStderr(os.Stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader))
+	if ctx.Err() == context.DeadlineExceeded {
+		return out.String(), out.truncated, fmt.Errorf("%s: timed out after %s", filepath.Base(path), pluginTimeout)
+	}
+	if err := parent.Err(); err != nil {
+		return out.String(), out.truncated, errInterrupted
+	}
+	return out.String(), out.truncated, err
+}
+
+// wasmTool wraps a tool whose "wasm" module does the work.
+func (tc ToolConfig) wasmTool(name string, params map[string]interface{}) Tool {
+	return Tool{
+		Name:        name,
+		Description: tc.Description,
+		Parameters:  params,
+		Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			input, err := json.Marshal(args)
+			if err != nil {
+				return "", err
+			}
+			writeProgress(fmt.Sprintf("wasm %s %s", filepath.Base(tc.Wasm), input))
+			output, truncated, err := runPlugin(ctx, tc.Wasm, "tool", name, input, shellToolMaxOutput)
+			if truncated {
+				output += fmt.Sprintf("\n[output truncated to %d bytes]", shellToolMaxOutput)
+			}
+			var exit *sys.ExitError
+			if errors.As(err, &exit) {
+				return output + fmt.Sprintf("\n[exit status %d]", exit.ExitCode()), nil
+			}
+			return output, err
+		},
+	}
+}
+
+// applyFilters passes text through the --filter modules in paths, in order.
+func applyFilters(paths []string, text string) (string, error) {
+	for _, path := range paths {
+		output, truncated, err := runPlugin(context.Background(), path, "filter", filepath.Base(path), []byte(text), pluginMaxOutput)
+		if err != nil {
+			return text, fmt.Errorf("filter %s: %v", path, err)
+		}
+		if truncated {
+			return text, fmt.Errorf("filter %s: output over %d bytes", path, pluginMaxOutput)
+		}
+		text = strings.TrimSpace(output)
+	}
+	return text, nil
+}
+
+// callWasm answers req with the provider plugin in api.Wasm.
+func callWasm(api APIConfig, req Request) (Response, error) {
+	if api.Wasm == "" {
+		return Response{}, fmt.Errorf("the wasm provider needs a \"wasm\" module path")
+	}
+	input, err := json.Marshal(pluginRequest{Model: api.Model, System: req.System, Prompt: transcriptPrompt(req)})
+	if err != nil {
+		return Response{}, err
+	}
+	output, truncated, err := runPlugin(api.requestContext(), api.Wasm, "provider", api.Model, input, pluginMaxOutput)
+	if err != nil {
+		return Response{}, err
+	}
+	if truncated {
+		return Response{}, fmt.Errorf("%s: answer over %d bytes", api.Wasm, pluginMaxOutput)
+	}
+	return Response{Text: strings.TrimSpace(output), Model: api.Model, FinishReason: "stop"}, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// modelPrice is what a model costs, in US dollars per million tokens.
+type modelPrice struct {
+	Input, Output float64
+}
+
+// modelPrices are list prices by model name prefix; the longest matching
+// prefix wins, so dated versions like "gpt-4o-2024-08-06" find theirs.
+var modelPrices = map[string]modelPrice{
+	"claude-opus-4-5":   {5, 25},
+	"claude-opus-4":     {15, 75},
+	"claude-sonnet-4":   {3, 15},
+	"claude-haiku-4":    {1, 5},
+	"claude-3-7-sonnet": {3, 15},
+	"claude-3-5-sonnet": {3, 15},
+	"claude-3-5-haiku":  {0.8, 4},
+	"claude-3-opus":     {15, 75},
+	"claude-3-haiku":    {0.25, 1.25},
+
+	"gpt-5":         {1.25, 10},
+	"gpt-5-mini":    {0.25, 2},
+	"gpt-5-nano":    {0.05, 0.4},
+	"gpt-4.1":       {2, 8},
+	"gpt-4.1-mini":  {0.4, 1.6},
+	"gpt-4.1-nano":  {0.1, 0.4},
+	"gpt-4o":        {2.5, 10},
+	"gpt-4o-mini":   {0.15, 0.6},
+	"gpt-4-turbo":   {10, 30},
+	"gpt-4":         {30, 60},
+	"gpt-3.5-turbo": {0.5, 1.5},
+	"o1":            {15, 60},
+	"o1-mini":       {1.1, 4.4},
+	"o3":            {2, 8},
+	"o3-mini":       {1.1, 4.4},
+	"o4-mini":       {1.1, 4.4},
+
+	"gemini-2.5-pro":        {1.25, 10},
+	"gemini-2.5-flash":      {0.3, 2.5},
+	"gemini-2.5-flash-lite": {0.1, 0.4},
+	"gemini-2.0-flash":      {0.1, 0.4},
+	"gemini-1.5-pro":        {1.25, 5},
+	"gemini-1.5-flash":      {0.075, 0.3},
+
+	"command-r-plus": {2.5, 10},
+	"command-r":      {0.15, 0.6},
+
+	"text-embedding-3-small": {0.02, 0},
+	"text-embedding-3-large": {0.13, 0},
+	"text-embedding-ada-002": {0.1, 0},
+	"embed-english-v3":       {0.1, 0},
+	"embed-multilingual-v3":  {0.1, 0},
+	"embed-v4":               {0.12, 0},
+	"gemini-embedding-001":   {0.15, 0},
+}
+
+// Services that don't bill by the token, at list prices in US dollars.
+const (
+	// per million characters translated
+	deepLPrice    = 25.0
+	googleMTPrice = 20.0
+	// per thousand searches; a search ranks up to rerankSearchDocs
+	// documents
+	rerankPrice      = 2.0
+	rerankSearchDocs = 100
+)
+
+// translationCost is what translating chars characters costs with the MT
+// provider.
+func translationCost(provider string, chars int) float64 {
+	price := deepLPrice
+	if provider == ProviderGoogleMT {
+		price = googleMTPrice
+	}
+	return float64(chars) * price / 1e6
+}
+
+// rerankCost is what ranking docs documents against one query costs.
+func rerankCost(docs int) float64 {
+	searches := (docs + rerankSearchDocs - 1) / rerankSearchDocs
+	return float64(searches) * rerankPrice / 1000
+}
+
+// priceFor looks up model's price.
+func priceFor(model string) (modelPrice, bool) {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	best, found := "", false
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, found = prefix, true
+		}
+	}
+	return modelPrices[best], found
+}
+
+// costOf is what usage costs on model, in US dollars at list prices. Local
+// models are free; ok is false when the model's price isn't known.
+func costOf(provider, model string, usage Usage) (float64, bool) {
+	if provider == ProviderLocal || provider == ProviderLocalOpenAI {
+		return 0, true
+	}
+	price, ok := priceFor(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1e6, true
+}
+
+// reportCost prints resp's token counts and what they cost on stderr, when
+// show (--cost) or the cost setting asks for it. The model the provider
+// says answered is priced, or else the configured one; local models are
+// free.
+func reportCost(settings Settings, show bool, api APIConfig, resp Response) {
+	if !show && settings.Cost != "on" {
+		return
+	}
+	line := ""
+	switch {
+	case resp.Usage == nil:
+		line = "Tokens: not reported by " + api.Provider
+	default:
+		line = fmt.Sprintf("Tokens: %d in, %d out", resp.Usage.InputTokens, resp.Usage.OutputTokens)
+		model := resp.Model
+		if model == "" {
+			model = api.Model
+		}
+		if api.Provider == ProviderLocal || api.Provider == ProviderLocalOpenAI {
+			line += ", free (local)"
+		} else if cost, ok := costOf(api.Provider, model, *resp.Usage); ok {
+			line += fmt.Sprintf(", about %s at %s list prices", formatDollars(cost), model)
+		} else {
+			line += fmt.Sprintf(", no price known for %s", model)
+		}
+	}
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		line = styleDim + line + styleReset
+	}
+	fmt.Fprintln(os.Stderr, line)
+}
+
+// formatDollars shows small amounts with enough digits to mean something.
+func formatDollars(d float64) string {
+	switch {
+	case d == 0:
+		return "$0"
+	case d < 0.01:
+		return fmt.Sprintf("$%.4f", d)
+	}
+	return fmt.Sprintf("$%.2f", d)
+}
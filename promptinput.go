@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxPromptSuggestions caps how many past prompts are offered.
+const maxPromptSuggestions = 200
+
+// promptSuggestions returns the distinct prompts in the history, most
+// recent first.
+func promptSuggestions() []string {
+	entries, _ := loadHistory()
+	seen := map[string]bool{}
+	var prompts []string
+	for i := len(entries) - 1; i >= 0 && len(prompts) < maxPromptSuggestions; i-- {
+		p := strings.TrimSpace(entries[i].prompt())
+		if p == "" || strings.Contains(p, "\n") || seen[p] {
+			continue
+		}
+		seen[p] = true
+		prompts = append(prompts, p)
+	}
+	return prompts
+}
+
+// matchSuggestions returns the suggestions for what has been typed so far:
+// those starting with it first, then fuzzy matches, best first.
+func matchSuggestions(suggestions []string, typed string) []string {
+	if strings.TrimSpace(typed) == "" {
+		return nil
+	}
+	var prefixed []string
+	type scored struct {
+		text  string
+		score int
+	}
+	var fuzzy []scored
+	lower := strings.ToLower(typed)
+	for _, s := range suggestions {
+		if s == typed {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(s), lower) {
+			prefixed = append(prefixed, s)
+		} else if score, ok := fuzzyScore(typed, s); ok {
+			fuzzy = append(fuzzy, scored{s, score})
+		}
+	}
+	sort.SliceStable(fuzzy, func(i, j int) bool { return fuzzy[i].score > fuzzy[j].score })
+	for _, f := range fuzzy {
+		prefixed = append(prefixed, f.text)
+	}
+	return prefixed
+}
+
+var errPromptCancelled = errors.New("cancelled")
+
+// readPrompt reads a line on a terminal, suggesting past prompts as it is
+// typed: a suggestion that continues the text shows as dim text after the
+// cursor, any other match after an arrow. Tab accepts the suggestion and
+// Up/Down move between matches. Without a terminal it's readLine.
+func readPrompt(label string, suggestions []string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if len(suggestions) == 0 || !term.IsTerminal(fd) {
+		fmt.Print(label)
+		return readLine()
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Print(label)
+		return readLine()
+	}
+	defer term.Restore(fd, oldState)
+
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 {
+		width = 80
+	}
+
+	var line []rune
+	selected := 0
+	buf := make([]byte, 16)
+	for {
+		matches := matchSuggestions(suggestions, string(line))
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		suggestion := ""
+		if len(matches) > 0 {
+			suggestion = matches[selected]
+		}
+		drawPrompt(label, string(line), suggestion, width)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		key := buf[:n]
+		switch {
+		case n == 1 && (key[0] == 3 || key[0] == 27): // Ctrl-C, Esc
+			fmt.Print("\r\n")
+			return "", errPromptCancelled
+		case n == 1 && (key[0] == '\r' || key[0] == '\n'):
+			drawPrompt(label, string(line), "", width)
+			fmt.Print("\r\n")
+			return strings.TrimSpace(string(line)), nil
+		case n == 1 && key[0] == '\t':
+			if suggestion != "" {
+				line, selected = []rune(suggestion), 0
+			}
+		case n == 1 && (key[0] == 127 || key[0] == 8):
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+			selected = 0
+		case n == 1 && key[0] == 21: // Ctrl-U
+			line, selected = nil, 0
+		case string(key) == "\x1b[A" || (n == 1 && key[0] == 16): // Up, Ctrl-P
+			selected--
+		case string(key) == "\x1b[B" || (n == 1 && key[0] == 14): // Down, Ctrl-N
+			selected++
+		case key[0] >= 32 && key[0] != 127 && key[0] != 27:
+			line = append(line, []rune(string(key))...)
+			selected = 0
+		}
+	}
+}
+
+// drawPrompt redraws the input line with the suggestion after the cursor,
+// cut to fit the terminal, and puts the cursor back at the end of the text.
+func drawPrompt(label, line, suggestion string, width int) {
+	hint := ""
+	if suggestion != "" {
+		if strings.HasPrefix(strings.ToLower(suggestion), strings.ToLower(line)) {
+			hint = string([]rune(suggestion)[len([]rune(line)):])
+		} else {
+			hint = "  → " + suggestion
+		}
+	}
+	room := width - 1 - len([]rune(label)) - len([]rune(line))
+	if room < 0 {
+		room = 0
+	}
+	if r := []rune(hint); len(r) > room {
+		hint = string(r[:room])
+	}
+
+	out := "\r\x1b[K" + label + line
+	if hint != "" {
+		out += dim(hint) + fmt.Sprintf("\x1b[%dD", len([]rune(hint)))
+	}
+	fmt.Print(out)
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// chunkLines, chunkChars and chunkTokens bound the size of an indexed
+	// chunk; whichever is reached first ends it.
+	chunkLines  = 40
+	chunkChars  = 2000
+	chunkTokens = 512
+	// chunkOverlap is how many lines consecutive chunks share, so text
+	// that straddles a boundary is still found whole.
+	chunkOverlap = 5
+	// maxIndexedFile skips files too large to be worth embedding.
+	maxIndexedFile = 1 << 20
+	// defaultTopK is how many chunks a query retrieves.
+	defaultTopK = 5
+)
+
+// skippedDirs are never descended into when indexing.
+var skippedDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "__pycache__": true, "dist": true, "build": true, "target": true,
+}
+
+// ragIndex is an embedded copy of a directory, stored as
+// ~/.ask/index/<name>.json. A workspace index is rooted at the directory of
+// its .ask.toml and also lists the workspace roots it covers.
+type ragIndex struct {
+	Root     string                 `json:"root"`
+	Roots    []string               `json:"roots,omitempty"`
+	EmbedAPI string                 `json:"embed_api"`
+	Files    map[string]indexedFile `json:"files"`
+}
+
+// indexedFile holds the chunks of one file, keyed in ragIndex.Files by the
+// file's path relative to the root.
+type indexedFile struct {
+	Hash   string  `json:"hash"`
+	Chunks []chunk `json:"chunks"`
+}
+
+// chunk is a run of lines from a file and its embedding.
+type chunk struct {
+	Start  int       `json:"start"` // first line, 1-based
+	End    int       `json:"end"`   // last line, inclusive
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// retrieved is a chunk returned for a query.
+type retrieved struct {
+	Path  string
+	Chunk chunk
+	Score float64
+}
+
+func indexDir() string {
+	return filepath.Join(stateDir(), "index")
+}
+
+func indexPath(name string) string {
+	return filepath.Join(indexDir(), name+".json")
+}
+
+// runIndex handles "ask index <dir>|--workspace [--name n] [--embed api]".
+// With --workspace it indexes every root .ask.toml declares, following
+// their include and exclude rules. Files that haven't changed since the
+// last run keep their embeddings.
+func runIndex(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"name": true, "embed": true, "workspace": false})
+	if err != nil || len(parsed.positional) > 1 || parsed.has("workspace") == (len(parsed.positional) == 1) {
+		fmt.Println("Usage: ask index <dir>|--workspace [--name <name>] [--embed <api-name>]")
+		os.Exit(1)
+	}
+
+	var root string
+	var roots []workspaceRoot
+	if parsed.has("workspace") {
+		cwd, _ := os.Getwd()
+		pc, err := findProjectContext(cwd)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if pc == nil || len(pc.Roots) == 0 {
+			fmt.Printf("Error: no %s with [roots.<name>] tables found in this directory or its parents\n", contextFile)
+			os.Exit(1)
+		}
+		root, roots = filepath.Dir(pc.Path), pc.Roots
+	} else {
+		if root, err = filepath.Abs(parsed.positional[0]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		roots = []workspaceRoot{{Path: root}}
+	}
+	for _, r := range roots {
+		if info, err := os.Stat(r.Path); err != nil || !info.IsDir() {
+			fmt.Printf("Error: %s is not a directory\n", r.Path)
+			os.Exit(1)
+		}
+	}
+	name := parsed.value("name", filepath.Base(root))
+
+	idx, err := loadIndex(name)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if idx != nil && idx.Root != root {
+		fmt.Printf("Index '%s' already covers %s; pick another --name.\n", name, idx.Root)
+		os.Exit(1)
+	}
+	if idx == nil {
+		idx = &ragIndex{Root: root, Files: map[string]indexedFile{}}
+	}
+	idx.Roots = nil
+	if parsed.has("workspace") {
+		for _, r := range roots {
+			idx.Roots = append(idx.Roots, r.Path)
+		}
+	}
+
+	embedName, embedAPI := selectAPI(config, parsed.value("embed", idx.EmbedAPI))
+	if idx.EmbedAPI != "" && idx.EmbedAPI != embedName {
+		// Vectors from different models can't be compared; start over.
+		idx.Files = map[string]indexedFile{}
+	}
+	idx.EmbedAPI = embedName
+	// Chunks are sized in the embedding model's tokens.
+	tokAPI := embedAPI
+	tokAPI.Model = embedModel(embedAPI)
+	tok := tokenizerFor(tokAPI)
+
+	// Files are keyed relative to the index root, so a sibling
+	// repository's start with "../".
+	var files []string
+	seen := map[string]bool{}
+	for _, r := range roots {
+		found, err := indexableFiles(r.Path, r.allows)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, f := range found {
+			rel, _ := filepath.Rel(root, filepath.Join(r.Path, f))
+			if rel = filepath.ToSlash(rel); !seen[rel] {
+				seen[rel] = true
+				files = append(files, rel)
+			}
+		}
+	}
+
+	fresh := map[string]indexedFile{}
+	var pending []*chunk
+	var pendingText []string
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", rel, err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		if old, ok := idx.Files[rel]; ok && old.Hash == hash {
+			fresh[rel] = old
+			continue
+		}
+
+		file := indexedFile{Hash: hash, Chunks: chunkText(string(data), tok)}
+		fresh[rel] = file
+		for i := range file.Chunks {
+			pending = append(pending, &fresh[rel].Chunks[i])
+			pendingText = append(pendingText, "File: "+rel+"\n\n"+file.Chunks[i].Text)
+		}
+	}
+
+	for start := 0; start < len(pending); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(pending))
+		fmt.Printf("\rEmbedding chunks %d/%d...", end, len(pending))
+		vectors, err := embedTexts(embedAPI, pendingText[start:end], embedDocument)
+		if err != nil {
+			fmt.Println()
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for i, v := range vectors {
+			pending[start+i].Vector = toFloat32(v)
+		}
+	}
+	if len(pending) > 0 {
+		fmt.Println()
+	}
+
+	idx.Files = fresh
+	if err := saveIndex(name, idx); err != nil {
+		fmt.Println("Error saving index:", err)
+		os.Exit(1)
+	}
+
+	total := 0
+	for _, f := range idx.Files {
+		total += len(f.Chunks)
+	}
+	fmt.Printf("✓ Indexed %s as '%s': %d files, %d chunks (%d embedded now, using %s)\n",
+		root, name, len(idx.Files), total, len(pending), embedName)
+}
+
+// runQuery handles "ask query <api> <question> [--index name] [-k n]": it
+// retrieves the chunks closest to the question and answers from them.
+func runQuery(config *Config, args []string) {
+	spec := map[string]bool{"index": true, "k": true, "rerank": true}
+	for flag, takesValue := range promptFlags {
+		spec[flag] = takesValue
+	}
+	parsed, err := parseArgs(args, spec)
+	if err != nil || len(parsed.positional) < 2 {
+		fmt.Println("Usage: ask query <api-name> \"<question>\" [--index <name>] [-k <n>] [--rerank <api-name>] [--sources]")
+		os.Exit(1)
+	}
+	question := strings.Join(parsed.positional[1:], " ")
+
+	k, err := strconv.Atoi(parsed.value("k", strconv.Itoa(defaultTopK)))
+	if err != nil || k < 1 {
+		fmt.Println("Error: -k must be a positive number")
+		os.Exit(1)
+	}
+
+	name, idx, err := findIndex(parsed.value("index", ""))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	embedAPI, ok := config.APIs[idx.EmbedAPI]
+	if !ok {
+		fmt.Printf("Index '%s' was embedded with '%s', which is no longer configured.\n", name, idx.EmbedAPI)
+		os.Exit(1)
+	}
+
+	rerankWith := parsed.value("rerank", config.Settings.Rerank)
+	pool := k
+	if rerankWith != "" {
+		pool = k * rerankPoolFactor
+	}
+	hits, err := idx.search(embedAPI, question, pool)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if rerankWith != "" {
+		_, rerankAPI := resolveAPI(config, rerankWith)
+		if hits, err = rerankHits(rerankAPI, question, hits, k); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	apiName, apiConfig := resolveAPI(config, parsed.positional[0])
+	apiConfig.KeepAlive = parsed.value("keep-alive", apiConfig.KeepAlive)
+	tok := tokenizerFor(apiConfig)
+	hits, omitted := fitHits(config.Settings, hits, promptBudget(apiConfig)-tok.Count(question), tok)
+	req := Request{Prompt: ragPrompt(idx.Root, hits, omitted, question)}
+	for _, h := range hits {
+		req.Sources = append(req.Sources, Citation{
+			Title:   fmt.Sprintf("%s:%d-%d", h.Path, h.Chunk.Start, h.Chunk.End),
+			Snippet: h.Chunk.Text,
+		})
+	}
+	answer(config, parsed, apiName, apiConfig, req)
+}
+
+// search returns the k chunks most similar to query.
+func (idx *ragIndex) search(embedAPI APIConfig, query string, k int) ([]retrieved, error) {
+	vectors, err := embedTexts(embedAPI, []string{query}, embedQuery)
+	if err != nil {
+		return nil, err
+	}
+	q := toFloat32(vectors[0])
+
+	var hits []retrieved
+	for path, file := range idx.Files {
+		for _, c := range file.Chunks {
+			hits = append(hits, retrieved{Path: path, Chunk: c, Score: cosine(q, c.Vector)})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// rerankHits reorders retrieved chunks with a reranking model and keeps the
+// best k.
+func rerankHits(api APIConfig, question string, hits []retrieved, k int) ([]retrieved, error) {
+	docs := make([]string, len(hits))
+	for i, h := range hits {
+		docs[i] = "File: " + h.Path + "\n\n" + h.Chunk.Text
+	}
+	ranking, err := rerankTexts(api, question, docs, k)
+	if err != nil {
+		return nil, err
+	}
+
+	reranked := make([]retrieved, len(ranking))
+	for i, r := range ranking {
+		reranked[i] = hits[r.Index]
+		reranked[i].Score = r.Score
+	}
+	return reranked, nil
+}
+
+// fitHits keeps the best-ranked hits that fit in budget tokens, so a
+// small model isn't sent more than it can read, and returns a notice for
+// the prompt about the ones it left out.
+func fitHits(settings Settings, hits []retrieved, budget int, tok Tokenizer) ([]retrieved, string) {
+	items := make([]contextItem, len(hits))
+	for i, h := range hits {
+		items[i] = contextItem{Label: fmt.Sprintf("%s:%d-%d", h.Path, h.Chunk.Start, h.Chunk.End), Text: h.Chunk.Text, Tier: tierRetrieved}
+	}
+	parts := assembleContext(items, budget, tok)
+	reportAssembly(settings, parts)
+	var kept []retrieved
+	dropped, omitted := 0, 0
+	for i, p := range parts {
+		if p.Dropped {
+			dropped++
+			omitted += p.Omitted
+		} else {
+			kept = append(kept, hits[i])
+		}
+	}
+	if dropped == 0 {
+		return kept, ""
+	}
+	return kept, omissionNotice(fmt.Sprintf("%d lower-ranked excerpt(s), %s tokens,", dropped, formatTokens(omitted)))
+}
+
+// ragPrompt stuffs the retrieved chunks, numbered for citation, into the
+// prompt ahead of the question, followed by omitted, the notice for any
+// that didn't fit.
+func ragPrompt(root string, hits []retrieved, omitted, question string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Answer the question using the numbered excerpts below from files in %s. If they don't contain the answer, say so rather than guessing. "+
+		"Cite the excerpts you rely on by number in square brackets, like [2], right after the statement they support.\n\n", root)
+	for i, h := range hits {
+		fmt.Fprintf(&sb, "[%d] %s (lines %d-%d)\n%s\n\n", i+1, h.Path, h.Chunk.Start, h.Chunk.End, h.Chunk.Text)
+	}
+	if omitted != "" {
+		sb.WriteString(omitted + "\n\n")
+	}
+	sb.WriteString("Question: " + question)
+	return sb.String()
+}
+
+// findIndex loads the named index or, without a name, the one covering the
+// current directory, or the only one there is.
+func findIndex(name string) (string, *ragIndex, error) {
+	if name != "" {
+		idx, err := loadIndex(name)
+		if os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("no index named '%s'; create it with 'ask index <dir> --name %s'", name, name)
+		}
+		return name, idx, err
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(indexDir(), "*.json"))
+	if len(paths) == 0 {
+		return "", nil, fmt.Errorf("nothing indexed yet; run 'ask index <dir>' first")
+	}
+
+	cwd, _ := os.Getwd()
+	var names []string
+	best, bestIdx := "", (*ragIndex)(nil)
+	for _, p := range paths {
+		n := strings.TrimSuffix(filepath.Base(p), ".json")
+		names = append(names, n)
+		idx, err := loadIndex(n)
+		if err != nil {
+			continue
+		}
+		if len(paths) == 1 {
+			return n, idx, nil
+		}
+		within := inDir(cwd, idx.Root)
+		for _, r := range idx.Roots {
+			within = within || inDir(cwd, r)
+		}
+		if within && (bestIdx == nil || len(idx.Root) > len(bestIdx.Root)) {
+			best, bestIdx = n, idx
+		}
+	}
+	if bestIdx != nil {
+		return best, bestIdx, nil
+	}
+	return "", nil, fmt.Errorf("several indexes exist (%s); pick one with --index", strings.Join(names, ", "))
+}
+
+func loadIndex(name string) (*ragIndex, error) {
+	data, err := os.ReadFile(indexPath(name))
+	if err != nil {
+		return nil, err
+	}
+	idx := &ragIndex{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("index %s is corrupt: %v", name, err)
+	}
+	return idx, nil
+}
+
+func saveIndex(name string, idx *ragIndex) error {
+	if err := os.MkdirAll(indexDir(), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexPath(name), data, 0600)
+}
+
+// inDir reports whether path is dir or inside it.
+func inDir(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// indexableFiles lists the text files under root, relative to it, skipping
+// hidden and dependency directories, binaries, very large files and
+// whatever keep, if given, turns down.
+func indexableFiles(root string, keep func(rel string, dir bool) bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || skippedDirs[name] || keep != nil && !keep(rel, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || !d.Type().IsRegular() || keep != nil && !keep(rel, false) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() == 0 || info.Size() > maxIndexedFile {
+			return nil
+		}
+		if !isTextFile(path) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// isTextFile sniffs the start of a file for NUL bytes or invalid UTF-8.
+func isTextFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, 8192)
+	n, _ := f.Read(head)
+	head = head[:n]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	// A multi-byte character may be cut off at the end of the sample.
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return utf8.Valid(head)
+}
+
+// chunkText splits text into overlapping runs of lines.
+func chunkText(text string, tok Tokenizer) []chunk {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), maxIndexedFile)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var chunks []chunk
+	for start := 0; start < len(lines); {
+		end, size, tokens := start, 0, 0
+		for end < len(lines) && end-start < chunkLines {
+			n := tok.Count(lines[end]) + 1
+			if size > 0 && (size+len(lines[end]) > chunkChars || tokens+n > chunkTokens) {
+				break
+			}
+			size += len(lines[end]) + 1
+			tokens += n
+			end++
+		}
+		body := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(body) != "" {
+			chunks = append(chunks, chunk{Start: start + 1, End: end, Text: body})
+		}
+		if end == len(lines) {
+			break
+		}
+		next := end - chunkOverlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+func toFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
+
+// cosine returns the cosine similarity of a and b.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Class and id words that mark page furniture, and those that mark the
+// content, as readability scores them.
+var (
+	unlikelyContent = regexp.MustCompile(`(?i)\b(?:ad|ads|advert\w*|banner|breadcrumbs?|comments?|cookie\w*|footer|header|masthead|menu|modal|nav\w*|newsletter|pagination|popup|promo\w*|related|share|sharing|sidebar|social|sponsor\w*|subscribe|toc|widget)\b`)
+	likelyContent   = regexp.MustCompile(`(?i)\b(?:article|body|content|entry|main|page|post|story|text)\b`)
+)
+
+// furnitureTags are left out of the content whatever their class.
+var furnitureTags = map[string]bool{
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true, "button": true,
+	"iframe": true, "select": true, "dialog": true, "menu": true,
+}
+
+// minReadableText is how much text a container needs to be taken for a
+// page's content outright.
+const minReadableText = 250
+
+// readableContent finds the main content of a page, the way Readability
+// does it in short: without navigation, headers, footers, sidebars and the
+// like, it takes the page's <article> or <main> when there's one with
+// enough text, and otherwise the element whose paragraphs score best for
+// length and commas against their links. It falls back on the whole body.
+func readableContent(root *htmlNode) *htmlNode {
+	pruneFurniture(root)
+
+	for _, tag := range []string{"article", "main"} {
+		found := root.find(func(n *htmlNode) bool {
+			return n.Tag == tag || tag == "main" && n.Attrs["role"] == "main"
+		})
+		if len(found) == 1 && textLength(found[0]) >= minReadableText {
+			return found[0]
+		}
+	}
+
+	scores := map[*htmlNode]float64{}
+	for _, p := range root.find(func(n *htmlNode) bool {
+		return n.Tag == "p" || n.Tag == "pre" || n.Tag == "td" || n.Tag == "blockquote"
+	}) {
+		text := strings.TrimSpace(p.textContent())
+		if len(text) < 25 || p.Parent == nil {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		scores[p.Parent] += score
+		if grand := p.Parent.Parent; grand != nil && grand.Tag != "" {
+			scores[grand] += score / 2
+		}
+	}
+
+	var best *htmlNode
+	bestScore := 0.0
+	for n, score := range scores {
+		score = (score + classWeight(n)) * (1 - linkDensity(n))
+		if score > bestScore || score == bestScore && best != nil && textLength(n) > textLength(best) {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		if body := root.find(func(n *htmlNode) bool { return n.Tag == "body" }); len(body) > 0 {
+			return body[0]
+		}
+		return root
+	}
+	return withRelatedSiblings(best, bestScore)
+}
+
+// pruneFurniture removes the page's furniture from under n: scripts aside
+// (the tokenizer drops them), elements that are always furniture, hidden
+// ones, and those whose class or id says they are furniture without also
+// saying they're content.
+func pruneFurniture(n *htmlNode) {
+	kept := n.Children[:0]
+	for _, c := range n.Children {
+		if c.Tag != "" && isFurniture(c) {
+			continue
+		}
+		pruneFurniture(c)
+		kept = append(kept, c)
+	}
+	n.Children = kept
+}
+
+func isFurniture(n *htmlNode) bool {
+	if furnitureTags[n.Tag] || n.Attrs["hidden"] != "" || n.Attrs["aria-hidden"] == "true" {
+		return true
+	}
+	switch n.Attrs["role"] {
+	case "navigation", "banner", "contentinfo", "complementary", "dialog", "menu":
+		return true
+	}
+	if n.Tag == "body" || n.Tag == "html" || n.Tag == "main" || n.Tag == "article" {
+		return false
+	}
+	names := n.Attrs["class"] + " " + n.Attrs["id"]
+	return unlikelyContent.MatchString(names) && !likelyContent.MatchString(names)
+}
+
+// classWeight favours elements whose class or id says they are content.
+func classWeight(n *htmlNode) float64 {
+	names := n.Attrs["class"] + " " + n.Attrs["id"]
+	weight := 0.0
+	if likelyContent.MatchString(names) {
+		weight += 25
+	}
+	if unlikelyContent.MatchString(names) {
+		weight -= 25
+	}
+	return weight
+}
+
+// textLength is the length of n's text, whitespace collapsed.
+func textLength(n *htmlNode) int {
+	return len(strings.Join(strings.Fields(n.textContent()), " "))
+}
+
+// linkDensity is the share of n's text that is in links.
+func linkDensity(n *htmlNode) float64 {
+	total := textLength(n)
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	for _, a := range n.find(func(e *htmlNode) bool { return e.Tag == "a" }) {
+		linked += textLength(a)
+	}
+	return min(float64(linked)/float64(total), 1)
+}
+
+// withRelatedSiblings returns best, or, when content is split across
+// sibling containers (a lead paragraph and the body, say), a node holding
+// best and the siblings that read like content too.
+func withRelatedSiblings(best *htmlNode, score float64) *htmlNode {
+	if best.Parent == nil {
+		return best
+	}
+	var siblings []*htmlNode
+	for _, s := range best.Parent.Children {
+		if s == best {
+			siblings = append(siblings, s)
+			continue
+		}
+		if s.Tag == "" {
+			continue
+		}
+		length := textLength(s)
+		density := linkDensity(s)
+		if s.Tag == "p" && (length > 80 && density < 0.25 || length > 0 && density == 0 && strings.Contains(s.textContent(), ". ")) {
+			siblings = append(siblings, s)
+		} else if s.Tag != "p" && length > minReadableText && density < 0.25 && classWeight(s) >= 0 && score > 0 {
+			siblings = append(siblings, s)
+		}
+	}
+	if len(siblings) == 1 {
+		return best
+	}
+	return &htmlNode{Tag: "div", Children: siblings}
+}
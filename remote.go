@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// runRemote runs ask with args on host over ssh, so prompts use the keys,
+// config and local models there. Output streams back as it's produced and
+// ask exits with the remote status. File arguments (--image, --pdf, --data)
+// name files on the remote machine.
+func runRemote(host string, args []string) {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		fmt.Println("Error: --remote needs ssh on PATH")
+		os.Exit(1)
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	sshArgs := []string{}
+	// A terminal on both ends keeps streaming, colours and the pager
+	// working; with piped input the remote side reads it as usual.
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		sshArgs = append(sshArgs, "-t")
+	}
+	sshArgs = append(sshArgs, host, "ask "+strings.Join(quoted, " "))
+
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	replicatePollInterval = time.Second
+	replicateTimeout      = 10 * time.Minute
+)
+
+// callReplicate creates a prediction and polls it until it settles, since
+// Replicate runs models asynchronously rather than answering the POST.
+//
+// The model is either "owner/name" for official models or
+// "owner/name:version" to pin a specific version.
+func callReplicate(config APIConfig, req Request) (Response, error) {
+	headers := map[string]string{
+		"Authorization": "Bearer " + config.APIKey,
+		// Let Replicate hold the request open briefly; fast models finish
+		// within it and never need polling.
+		"Prefer": "wait=30",
+	}
+
+	input := map[string]interface{}{"prompt": transcriptPrompt(req)}
+	if req.System != "" {
+		input["system_prompt"] = req.System
+	}
+	var url string
+	var payload map[string]interface{}
+	if _, version, ok := strings.Cut(config.Model, ":"); ok {
+		url = config.BaseURL + "/predictions"
+		payload = map[string]interface{}{"version": version, "input": input}
+	} else {
+		url = fmt.Sprintf("%s/models/%s/predictions", config.BaseURL, config.Model)
+		payload = map[string]interface{}{"input": input}
+	}
+
+	prediction, raw, err := postJSONRaw(config, url, payload, headers)
+	if err != nil {
+		return Response{}, err
+	}
+
+	delete(headers, "Prefer")
+	deadline := time.Now().Add(replicateTimeout)
+	for {
+		status, _ := prediction["status"].(string)
+		switch status {
+		case "succeeded":
+			return Response{Text: replicateOutput(prediction["output"]), Raw: raw}, nil
+		case "failed", "canceled":
+			if msg, ok := prediction["error"].(string); ok && msg != "" {
+				return Response{}, fmt.Errorf("prediction %s: %s", status, msg)
+			}
+			return Response{}, fmt.Errorf("prediction %s", status)
+		}
+
+		if time.Now().After(deadline) {
+			return Response{}, fmt.Errorf("prediction still %s after %s", status, replicateTimeout)
+		}
+
+		urls, _ := prediction["urls"].(map[string]interface{})
+		getURL, _ := urls["get"].(string)
+		if getURL == "" {
+			return Response{}, fmt.Errorf("prediction has no status URL")
+		}
+
+		if err := sleep(config.requestContext(), replicatePollInterval); err != nil {
+			return Response{}, err
+		}
+		if prediction, raw, err = doJSONRaw(config, "GET", getURL, nil, headers); err != nil {
+			return Response{}, err
+		}
+	}
+}
+
+// replicateOutput flattens a prediction's output. Language models return a
+// list of token strings; others return a single string.
+func replicateOutput(output interface{}) string {
+	switch out := output.(type) {
+	case string:
+		return out
+	case []interface{}:
+		var sb strings.Builder
+		for _, piece := range out {
+			if s, ok := piece.(string); ok {
+				sb.WriteString(s)
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
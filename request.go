@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Request is a single prompt together with its attachments.
+type Request struct {
+	// System holds instructions sent ahead of the prompt, if any.
+	System string
+	// History is the conversation so far, user and assistant turns sent
+	// between the system prompt and this one.
+	History   []Message
+	Prompt    string
+	Images    []Image
+	Documents []Document
+	// Logprobs asks for per-token probabilities where the provider
+	// supports them.
+	Logprobs bool
+	// Sources are numbered in the prompt for the model to cite; the
+	// response's citations are the ones it refers to.
+	Sources []Citation
+	// Tools the model may call while answering.
+	Tools []Tool
+	// MaxToolRounds caps how often the model may call tools; 0 means
+	// maxToolRounds.
+	MaxToolRounds int
+	// Schema is a JSON Schema the answer must match; the answer is then
+	// the JSON alone.
+	Schema map[string]interface{}
+}
+
+// Image is an image attachment sent alongside the prompt.
+type Image struct {
+	MediaType string
+	Data      []byte
+}
+
+// Document is a file the provider reads natively, such as a PDF.
+type Document struct {
+	Name      string
+	MediaType string
+	Data      []byte
+}
+
+// maxImageSize caps downloaded images; providers reject larger ones anyway.
+const maxImageSize = 20 << 20
+
+// loadImage reads an image from a file or an http(s) URL, sniffing its media
+// type from the content. Images are always sent inline, so URLs work the
+// same for every provider.
+func loadImage(src string) (Image, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		data, err = downloadImage(src)
+	} else {
+		data, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	mediaType := http.DetectContentType(data)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return Image{}, fmt.Errorf("%s is not an image (%s)", src, mediaType)
+	}
+	return Image{MediaType: mediaType, Data: data}, nil
+}
+
+func downloadImage(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("%s is larger than %s", url, formatBytes(maxImageSize))
+	}
+	return data, nil
+}
+
+// supportsImages reports whether a provider accepts image input.
+func supportsImages(provider string) bool {
+	switch provider {
+	case ProviderClaude, ProviderOpenAI, ProviderGemini, ProviderLocal, ProviderLocalOpenAI:
+		return true
+	}
+	return false
+}
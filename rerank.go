@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+// defaultRerankModel is used when a Cohere entry has no rerank_model set.
+const defaultRerankModel = "rerank-v3.5"
+
+// rerankPoolFactor is how many more candidates than asked for ask query
+// retrieves when it reranks them.
+const rerankPoolFactor = 4
+
+// ranked is a document's position in the input and its relevance score.
+type ranked struct {
+	Index int
+	Score float64
+}
+
+// runRerank handles "ask rerank <api> <query> [--file path]... [--top n]".
+// Each file is a document; without files, every line of stdin is one.
+func runRerank(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"file": true, "top": true})
+	if err != nil || len(parsed.positional) < 2 {
+		fmt.Println("Usage: ask rerank <api-name> \"<query>\" [--file <path>]... [--top <n>]  (or documents on stdin, one per line)")
+		os.Exit(1)
+	}
+	_, api := resolveAPI(config, parsed.positional[0])
+	query := strings.Join(parsed.positional[1:], " ")
+
+	var labels, docs []string
+	for _, path := range parsed.values("file") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		labels, docs = append(labels, path), append(docs, string(data))
+	}
+	if len(docs) == 0 && !term.IsTerminal(int(os.Stdin.Fd())) {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				labels, docs = append(labels, line), append(docs, line)
+			}
+		}
+	}
+	if len(docs) == 0 {
+		fmt.Println("No documents to rank.")
+		os.Exit(1)
+	}
+
+	top := len(docs)
+	if t := parsed.value("top", ""); t != "" {
+		if top, err = strconv.Atoi(t); err != nil || top < 1 {
+			fmt.Println("Error: --top must be a positive number")
+			os.Exit(1)
+		}
+	}
+
+	results, err := rerankTexts(api, query, docs, top)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tSCORE\tDOCUMENT")
+	for i, r := range results {
+		label := labels[r.Index]
+		if len(label) > 80 {
+			label = label[:77] + "..."
+		}
+		fmt.Fprintf(w, "%d\t%.4f\t%s\n", i+1, r.Score, label)
+	}
+	w.Flush()
+}
+
+// rerankTexts orders docs by relevance to query, most relevant first, and
+// returns at most top of them.
+func rerankTexts(api APIConfig, query string, docs []string, top int) ([]ranked, error) {
+	api, err := expandAPIConfig(api)
+	if err != nil {
+		return nil, err
+	}
+	if api.Provider != ProviderCohere {
+		return nil, fmt.Errorf("%s does not support reranking (use a Cohere API)", api.Provider)
+	}
+
+	model := api.RerankModel
+	if model == "" {
+		model = defaultRerankModel
+	}
+	cost := rerankCost(len(docs))
+	if err := checkCost(api, model, cost, true); err != nil {
+		return nil, err
+	}
+	result, err := postJSON(api, api.BaseURL+"/rerank", map[string]interface{}{
+		"model":     model,
+		"query":     query,
+		"documents": docs,
+		"top_n":     top,
+	}, map[string]string{
+		"Authorization": "Bearer " + api.APIKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordSpend(api, model, LedgerEntry{}, cost, true)
+
+	var ranking []ranked
+	list, _ := result["results"].([]interface{})
+	for _, item := range list {
+		r, _ := item.(map[string]interface{})
+		index, _ := r["index"].(float64)
+		score, _ := r["relevance_score"].(float64)
+		if int(index) < len(docs) {
+			ranking = append(ranking, ranked{Index: int(index), Score: score})
+		}
+	}
+	return ranking, nil
+}
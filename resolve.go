@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// resolveAPI looks up the API spec names, with resolveOneAPI. A spec may
+// list several, as in "api:claude,api:gpt-4o": the ones after the first,
+// then the fallbacks each configures, are tried in turn when a request to
+// the one before fails.
+func resolveAPI(config *Config, spec string) (string, APIConfig) {
+	var names []string
+	var apis []APIConfig
+	seen := map[string]bool{}
+	add := func(name string, api APIConfig) {
+		if key := name + "/" + api.Model; !seen[key] {
+			seen[key] = true
+			names, apis = append(names, name), append(apis, api)
+		}
+	}
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part != "" || len(names) == 0 {
+			add(resolveOneAPI(config, part))
+		}
+	}
+	for i := 0; i < len(apis); i++ {
+		for _, name := range apis[i].Fallback {
+			api, ok := config.APIs[name]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Warning: %s falls back to %s, which isn't configured\n", names[i], name)
+				continue
+			}
+			add(name, api)
+		}
+	}
+
+	api := apis[0]
+	api.fallbacks = apis[1:]
+	return names[0], api
+}
+
+// resolvesAPI reports whether some part of spec names a configured API, in
+// full or in part, or as "<api or provider>/<model>": then it's a prompt's
+// API rather than a mistyped command.
+func resolvesAPI(config *Config, spec string) bool {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if _, ok := config.APIs[part]; ok || len(matchAPIs(config, part)) > 0 {
+			return true
+		}
+		if base, model, ok := strings.Cut(part, "/"); ok && model != "" {
+			if _, _, ok := providerAPI(config, base); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveOneAPI looks up an API by name, tolerating a missing "api:" or
+// "local:" prefix and partial names. When several entries match it lets
+// the user pick one on a terminal, and otherwise lists them. It exits if
+// nothing matches.
+//
+// "<api or provider>/<model>", as in api:openai/gpt-4.1-nano, reuses a
+// configured API's credentials with any model ID.
+func resolveOneAPI(config *Config, spec string) (string, APIConfig) {
+	if api, ok := config.APIs[spec]; ok {
+		return spec, api
+	}
+	if base, model, ok := strings.Cut(spec, "/"); ok && model != "" {
+		if name, api, ok := providerAPI(config, base); ok {
+			if mapped, ok := modelMappings[model]; ok {
+				model = mapped
+			}
+			api.Model = model
+			fmt.Fprintf(os.Stderr, "Using %s with model %s\n", name, model)
+			return name, api
+		}
+	}
+
+	candidates := matchAPIs(config, spec)
+	switch {
+	case len(candidates) == 1:
+		fmt.Fprintf(os.Stderr, "Using %s\n", candidates[0])
+		return candidates[0], config.APIs[candidates[0]]
+	case len(candidates) > 1 && term.IsTerminal(int(os.Stdin.Fd())):
+		name := pickAPI(spec, candidates)
+		return name, config.APIs[name]
+	case len(candidates) > 1:
+		fmt.Printf("'%s' matches several APIs: %s\n", spec, strings.Join(candidates, ", "))
+	default:
+		fmt.Printf("API '%s' not configured. Use 'ask add %s' to add it.\n", spec, spec)
+		if hint := didYouMeanAPI(config, spec); hint != "" {
+			fmt.Println(hint)
+		}
+	}
+	os.Exit(1)
+	return "", APIConfig{}
+}
+
+// providerAPI finds the API whose credentials an ad-hoc model uses: the one
+// named base, or else the first configured for the provider base names
+// ("api:openai" or "openai").
+func providerAPI(config *Config, base string) (string, APIConfig, bool) {
+	if api, ok := config.APIs[base]; ok {
+		return base, api, true
+	}
+	provider := strings.TrimPrefix(strings.TrimPrefix(base, "api:"), "local:")
+	var names []string
+	for name, api := range config.APIs {
+		if strings.EqualFold(api.Provider, provider) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", APIConfig{}, false
+	}
+	sort.Strings(names)
+	return names[0], config.APIs[names[0]], true
+}
+
+// matchAPIs returns the configured API names spec plausibly refers to:
+// exact matches once a scheme prefix is added, then names, providers or
+// models containing it.
+func matchAPIs(config *Config, spec string) []string {
+	var exact, partial []string
+	want := strings.ToLower(spec)
+	for name, api := range config.APIs {
+		bare := name
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			bare = name[i+1:]
+		}
+		switch {
+		case strings.EqualFold(bare, spec):
+			exact = append(exact, name)
+		case strings.Contains(strings.ToLower(name), want),
+			strings.EqualFold(api.Provider, spec),
+			strings.Contains(strings.ToLower(api.Model), want):
+			partial = append(partial, name)
+		}
+	}
+
+	if len(exact) > 0 {
+		sort.Strings(exact)
+		return exact
+	}
+	sort.Strings(partial)
+	return partial
+}
+
+// pickAPI shows a numbered list of candidates and reads the user's choice.
+func pickAPI(spec string, candidates []string) string {
+	fmt.Printf("'%s' matches several APIs:\n", spec)
+	for i, name := range candidates {
+		fmt.Printf("  %d) %s\n", i+1, name)
+	}
+
+	for {
+		fmt.Printf("Choose 1-%d: ", len(candidates))
+		answer, err := readLine()
+		if err != nil {
+			os.Exit(1)
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(candidates) {
+			return candidates[n-1]
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// maxRetries is how many times a rate-limited or failing request is
+// retried, set with --retries N or --no-retry.
+var maxRetries = 3
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+	// retryMaxWait is the longest Retry-After honoured; a provider asking
+	// for longer (a spent daily quota, say) fails the request instead.
+	retryMaxWait = 2 * time.Minute
+)
+
+// takeRetryFlags removes --retries N and --no-retry from args, wherever
+// they are before "--", and applies them, so every command accepts them.
+func takeRetryFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(rest, args[i:]...), nil
+		case arg == "--no-retry":
+			maxRetries = 0
+		case arg == "--retries" || strings.HasPrefix(arg, "--retries="):
+			value, ok := strings.CutPrefix(arg, "--retries=")
+			if !ok {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("flag --retries needs a value")
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("--retries must be a number, 0 or more")
+			}
+			maxRetries = n
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, nil
+}
+
+// retryableStatus reports whether a response with status may succeed if
+// sent again: rate limits and server errors, apart from those that say the
+// request itself can't be served.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests ||
+		(status >= 500 && status != http.StatusNotImplemented && status != http.StatusHTTPVersionNotSupported)
+}
+
+// doWithRetry sends req with client, sending it again after 429 and 5xx
+// responses: after the delay the provider's Retry-After asks for, or with
+// jittered exponential backoff. The last response is returned as is, for
+// the caller to report.
+func doWithRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err != nil || !retryableStatus(resp.StatusCode) || attempt >= maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && usesRotatingKey(req) {
+			// Another of the API's keys is tried instead.
+			return resp, nil
+		}
+		wait, ok := retryDelay(resp.Header.Get("Retry-After"), attempt, time.Now())
+		if !ok {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		notice := fmt.Sprintf("%s from %s; retrying in %s (%d of %d)", resp.Status, req.URL.Host, wait.Round(100*time.Millisecond), attempt+1, maxRetries)
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			notice = styleDim + notice + styleReset
+		}
+		fmt.Fprintln(os.Stderr, notice)
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryDelay is how long to wait before retry number attempt+1: what a
+// Retry-After header (seconds or an HTTP date) asks for, or else a random
+// delay between half and all of an exponentially growing one. ok is false
+// when Retry-After asks for longer than is worth waiting.
+func retryDelay(retryAfter string, attempt int, now time.Time) (time.Duration, bool) {
+	if retryAfter != "" {
+		var wait time.Duration
+		if secs, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil {
+			wait = time.Duration(secs) * time.Second
+		} else if at, err := http.ParseTime(retryAfter); err == nil {
+			wait = at.Sub(now)
+		} else {
+			return backoff(attempt), true
+		}
+		return max(wait, 0), wait <= retryMaxWait
+	}
+	return backoff(attempt), true
+}
+
+func backoff(attempt int) time.Duration {
+	// Doubling stops at the cap, so a high --retries can't overflow it.
+	d := retryBaseDelay
+	for i := 0; i < attempt && d < retryMaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, retryMaxDelay)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
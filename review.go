@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const reviewHelp = `y - apply this hunk
+n - skip this hunk
+e - edit the hunk's new lines in $EDITOR, then apply them
+c - comment on the hunk and have the model redo it
+a - apply this hunk and the rest in this file
+d - skip this hunk and the rest in this file
+q - skip this hunk and everything left
+? - show this help`
+
+// reviseFunc asks the model for a new version of hunk h of the change to
+// path, whose content is old, following the reviewer's comment. It returns
+// the hunk's new lines.
+type reviseFunc func(path, old string, h hunk, comment string) ([]string, error)
+
+// reviewChanges shows each change as a colored diff, a hunk at a time, and
+// asks which hunks to keep, much like git add -p. With revise, a hunk can
+// also be sent back with a comment, as often as it takes. It returns the
+// changes cut down to the accepted hunks; files with none accepted are left
+// out.
+func reviewChanges(changes []fileChange, revise reviseFunc) ([]fileChange, error) {
+	color := term.IsTerminal(int(os.Stdout.Fd()))
+	paint := func(s, c string) string {
+		if !color {
+			return s
+		}
+		return c + s + styleReset
+	}
+
+	keys := "y,n,e,a,d,q,?"
+	if revise != nil {
+		keys = "y,n,e,c,a,d,q,?"
+	}
+
+	var accepted []fileChange
+	quit := false
+	for _, c := range changes {
+		hunks := diffHunks(c.Old, c.New, 3)
+		if quit || len(hunks) == 0 {
+			continue
+		}
+		fmt.Print(paint("--- a/"+c.Path, styleBold) + "\n" + paint("+++ b/"+c.Path, styleBold) + "\n")
+
+		var keep []hunk
+		offset := 0
+		rest := "" // "a" or "d" once chosen for the rest of the file
+		for i := 0; i < len(hunks); i++ {
+			h := hunks[i]
+			choice := rest
+			for choice == "" {
+				fmt.Print(formatHunk(h, offset, paint))
+				fmt.Printf("(%d/%d) Apply this hunk to %s [%s]? ", i+1, len(hunks), c.Path, keys)
+				answer, err := readLine()
+				if err != nil {
+					return nil, err
+				}
+				switch a := strings.ToLower(answer); {
+				case a == "y" || a == "n" || a == "e" || a == "a" || a == "d" || a == "q":
+					choice = a
+				case a == "c" && revise != nil:
+					fmt.Print("What should change? ")
+					comment, err := readLine()
+					if err != nil || comment == "" {
+						continue
+					}
+					lines, err := revise(c.Path, c.Old, h, comment)
+					if err != nil {
+						fmt.Println("Error:", err)
+						continue
+					}
+					h.New = lines
+				default:
+					help := reviewHelp
+					if revise == nil {
+						help = strings.Replace(help, "c - comment on the hunk and have the model redo it\n", "", 1)
+					}
+					fmt.Println(help)
+				}
+			}
+
+			switch choice {
+			case "e":
+				edited, err := editLines(c.Path, h.New)
+				if err != nil {
+					return nil, err
+				}
+				h.New = edited
+				fallthrough
+			case "y":
+				keep = append(keep, h)
+				offset += len(h.New) - len(h.Old)
+			case "a":
+				rest = "a"
+				keep = append(keep, h)
+				offset += len(h.New) - len(h.Old)
+			case "d":
+				rest = "d"
+			case "q":
+				quit = true
+			}
+			if quit {
+				break
+			}
+		}
+
+		if len(keep) == 0 {
+			continue
+		}
+		patched, err := applyHunks(c.Old, keep)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Path, err)
+		}
+		accepted = append(accepted, fileChange{Path: c.Path, Old: c.Old, New: patched})
+	}
+	return accepted, nil
+}
+
+// editLines opens lines in $VISUAL or $EDITOR (vi if neither is set) and
+// returns them as saved.
+func editLines(path string, lines []string) ([]string, error) {
+	// Keep the extension so the editor picks the right syntax.
+	f, err := os.CreateTemp("", "ask-hunk-*"+filepath.Ext(path))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(joinLines(lines, true))
+	f.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor: %v", err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	edited, _ := splitLines(string(data))
+	return edited, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Limits applied to every snippet the model runs.
+const (
+	sandboxTimeout   = 60 * time.Second
+	sandboxMemory    = "512m"
+	sandboxCPUs      = "1"
+	sandboxMaxOutput = 20000
+)
+
+// sandboxImages are the container images snippets run in, by language.
+// Settings.SandboxImages overrides them.
+var sandboxImages = map[string]string{
+	"python": "python:3.12-slim",
+	"node":   "node:22-slim",
+}
+
+// sandboxInterpreters read a program from stdin.
+var sandboxInterpreters = map[string][]string{
+	"python": {"python", "-"},
+	"node":   {"node", "-"},
+}
+
+// sandbox runs code snippets in a throwaway container with no network, a
+// read-only filesystem and the data files mounted under /data.
+type sandbox struct {
+	runtime string
+	lang    string
+	image   string
+	mounts  []string
+	files   []string
+}
+
+func newSandbox(lang string, settings Settings, dataFiles []string) (*sandbox, error) {
+	interp := sandboxInterpreters[lang]
+	if interp == nil {
+		return nil, fmt.Errorf("unknown sandbox language %q (use python or node)", lang)
+	}
+
+	var runtime string
+	for _, name := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(name); err == nil {
+			runtime = name
+			break
+		}
+	}
+	if runtime == "" {
+		return nil, fmt.Errorf("--sandbox needs docker or podman installed")
+	}
+
+	image := sandboxImages[lang]
+	if custom := settings.SandboxImages[lang]; custom != "" {
+		image = custom
+	}
+
+	sb := &sandbox{runtime: runtime, lang: lang, image: image}
+	seen := map[string]bool{}
+	for _, path := range dataFiles {
+		abs := absPath(path)
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory; attach files with --data", path)
+		}
+		name := filepath.Base(abs)
+		if seen[name] {
+			return nil, fmt.Errorf("two data files are named %s", name)
+		}
+		seen[name] = true
+		sb.mounts = append(sb.mounts, "-v", abs+":/data/"+name+":ro")
+		sb.files = append(sb.files, "/data/"+name)
+	}
+	return sb, nil
+}
+
+// systemPrompt tells the model what it can run and which files it has.
+func (sb *sandbox) systemPrompt() string {
+	prompt := fmt.Sprintf("You have a run_code tool that runs %s programs in an isolated sandbox without network access "+
+		"and returns their output. Use it to compute anything about the data instead of estimating, print the "+
+		"values you need, and base your answer on the output.", sb.lang)
+	if len(sb.files) > 0 {
+		prompt += " The attached data files are mounted read-only at: " + strings.Join(sb.files, ", ") + "."
+	}
+	return prompt
+}
+
+// tool is the run_code tool. Every snippet and its output is printed to
+// stderr as it runs, so the whole analysis can be reviewed.
+func (sb *sandbox) tool() Tool {
+	tty := term.IsTerminal(int(os.Stderr.Fd()))
+	return Tool{
+		Name:        "run_code",
+		Description: fmt.Sprintf("Run a %s program in a sandbox and return its stdout and stderr. Data files are under /data; nothing persists between runs.", sb.lang),
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"code": map[string]interface{}{
+					"type":        "string",
+					"description": "The complete program to run",
+				},
+			},
+			"required": []string{"code"},
+		},
+		Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			code, _ := args["code"].(string)
+			output, err := sb.run(ctx, code)
+
+			transcript := fmt.Sprintf("```%s\n%s\n```\n", sb.lang, strings.TrimRight(code, "\n"))
+			if output != "" {
+				transcript += indent(strings.TrimRight(output, "\n"), "  ") + "\n"
+			}
+			if err != nil {
+				transcript += "  (" + err.Error() + ")\n"
+			}
+			if tty {
+				transcript = dim(transcript)
+			}
+			fmt.Fprintln(os.Stderr, transcript)
+
+			if err != nil {
+				return output + "\n" + err.Error(), nil
+			}
+			return output, nil
+		},
+	}
+}
+
+// run executes code and returns its combined output, truncated to
+// sandboxMaxOutput bytes. A non-nil error means the run failed or timed out.
+func (sb *sandbox) run(ctx context.Context, code string) (string, error) {
+	name := fmt.Sprintf("ask-sandbox-%d-%d", os.Getpid(), time.Now().UnixNano())
+	args := []string{"run", "--rm", "-i", "--name", name,
+		"--network", "none",
+		"--memory", sandboxMemory,
+		"--cpus", sandboxCPUs,
+		"--pids-limit", "128",
+		"--read-only", "--tmpfs", "/tmp",
+		"-w", "/tmp",
+	}
+	args = append(args, sb.mounts...)
+	args = append(args, sb.image)
+	args = append(args, sandboxInterpreters[sb.lang]...)
+
+	ctx, cancel := context.WithTimeout(ctx, sandboxTimeout)
+	defer cancel()
+
+	out := limitedBuffer{max: sandboxMaxOutput}
+	cmd := exec.CommandContext(ctx, sb.runtime, args...)
+	cmd.Stdin = strings.NewReader(code)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+
+	output := out.String()
+	if out.truncated {
+		output += fmt.Sprintf("\n[output truncated to %d bytes]", out.max)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		// Killing the client doesn't stop the container.
+		exec.Command(sb.runtime, "kill", name).Run()
+		return output, fmt.Errorf("timed out after %s", sandboxTimeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return output, fmt.Errorf("exit status %d", exitErr.ExitCode())
+	}
+	return output, err
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxSchemaRetries is how many times an answer that doesn't match the
+// schema is sent back to be fixed.
+const maxSchemaRetries = 2
+
+// schemaToolName is the tool Claude is forced to call to answer with
+// structured output.
+const schemaToolName = "respond"
+
+// loadSchema reads a JSON Schema file.
+func loadSchema(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("%s is not a valid JSON schema: %s", path, describeJSONError(data, err))
+	}
+	return schema, nil
+}
+
+// nativeSchema reports whether provider can be made to follow a schema,
+// rather than just asked to.
+func nativeSchema(provider string) bool {
+	switch provider {
+	case ProviderOpenAI, ProviderLocalOpenAI, ProviderClaude, ProviderGemini, ProviderLocal:
+		return true
+	}
+	return false
+}
+
+// sendStructured sends a request whose answer must be JSON matching
+// req.Schema. Answers that don't parse or validate are sent back with the
+// problem up to maxSchemaRetries times. The response text is the JSON,
+// indented.
+func sendStructured(api APIConfig, req Request) (Response, error) {
+	if len(req.Tools) > 0 {
+		return Response{}, fmt.Errorf("--schema can't be combined with tools")
+	}
+	schemaJSON, _ := json.MarshalIndent(req.Schema, "", "  ")
+	if !nativeSchema(api.Provider) {
+		req.System = strings.TrimSpace(req.System + "\n\nReply with only a JSON value matching this JSON Schema, with no prose or code fences:\n" + string(schemaJSON))
+	}
+
+	prompt := req.Prompt
+	var problem error
+	for attempt := 0; attempt <= maxSchemaRetries; attempt++ {
+		resp, err := callProvider(api, req)
+		if err != nil {
+			return resp, err
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(extractJSON(resp.Text)), &value); err != nil {
+			problem = fmt.Errorf("the reply is not valid JSON: %v", err)
+		} else if err := validateSchema(value, req.Schema, "$"); err != nil {
+			problem = err
+		} else {
+			data, _ := json.MarshalIndent(value, "", "  ")
+			resp.Text = string(data)
+			return resp, nil
+		}
+
+		req.Prompt = fmt.Sprintf("%s\n\nYour previous reply was:\n%s\n\nIt was rejected because %v. Reply again with JSON that matches the schema.", prompt, resp.Text, problem)
+	}
+	return Response{}, fmt.Errorf("no answer matched the schema after %d attempts; last problem: %v", maxSchemaRetries+1, problem)
+}
+
+// claudeSchemaTool describes the tool Claude is made to call. Tool inputs
+// must be objects, so other schemas are wrapped in a "value" property.
+func claudeSchemaTool(schema map[string]interface{}) map[string]interface{} {
+	input := schema
+	if schema["type"] != "object" {
+		input = map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"value": schema},
+			"required":   []string{"value"},
+		}
+	}
+	return map[string]interface{}{
+		"name":         schemaToolName,
+		"description":  "Give the answer in the required structure.",
+		"input_schema": input,
+	}
+}
+
+// claudeSchemaAnswer turns the input of Claude's forced tool call back into
+// the answer's JSON text.
+func claudeSchemaAnswer(schema map[string]interface{}, input interface{}) string {
+	if schema["type"] != "object" {
+		if m, ok := input.(map[string]interface{}); ok {
+			input = m["value"]
+		}
+	}
+	data, _ := json.Marshal(input)
+	return string(data)
+}
+
+// geminiSchemaKeys are the schema keywords Gemini's responseSchema accepts.
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "description": true, "nullable": true, "enum": true,
+	"properties": true, "required": true, "items": true, "minItems": true, "maxItems": true,
+	"minimum": true, "maximum": true, "anyOf": true, "propertyOrdering": true,
+}
+
+// geminiSchema drops the keywords Gemini rejects; the answer is still
+// validated against the full schema.
+func geminiSchema(v interface{}) interface{} {
+	switch s := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, val := range s {
+			if !geminiSchemaKeys[k] {
+				continue
+			}
+			if k == "properties" {
+				props := map[string]interface{}{}
+				m, _ := val.(map[string]interface{})
+				for name, p := range m {
+					props[name] = geminiSchema(p)
+				}
+				out[k] = props
+				continue
+			}
+			out[k] = geminiSchema(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(s))
+		for i, item := range s {
+			out[i] = geminiSchema(item)
+		}
+		return out
+	}
+	return v
+}
+
+// validateSchema checks value against the commonly used part of JSON
+// Schema: type, enum, const, properties, required, additionalProperties,
+// items, the numeric, length and size bounds, pattern, and
+// allOf/anyOf/oneOf. Unknown keywords are ignored. path names the value in
+// errors.
+func validateSchema(value interface{}, schema map[string]interface{}, path string) error {
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []interface{}:
+			for _, x := range t {
+				if s, ok := x.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		matched := false
+		for _, t := range types {
+			if hasJSONType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s should be %s, got %s", path, strings.Join(types, " or "), jsonTypeName(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(value, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allowed, _ := json.Marshal(enum)
+			return fmt.Errorf("%s should be one of %s", path, allowed)
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(value, c) {
+		want, _ := json.Marshal(c)
+		return fmt.Errorf("%s should be %s", path, want)
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, ok := schema[key].([]interface{})
+		if !ok {
+			continue
+		}
+		passed := 0
+		var firstErr error
+		for _, sub := range subs {
+			s, _ := sub.(map[string]interface{})
+			if err := validateSchema(value, s, path); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				if key == "allOf" {
+					return err
+				}
+			} else {
+				passed++
+			}
+		}
+		if key == "anyOf" && passed == 0 {
+			return fmt.Errorf("%s matches none of the allowed shapes (%v)", path, firstErr)
+		}
+		if key == "oneOf" && passed != 1 {
+			return fmt.Errorf("%s should match exactly one of the allowed shapes, matches %d", path, passed)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(v, schema, path)
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s should have at least %v items", path, n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s should have at most %v items", path, n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			return fmt.Errorf("%s should be at least %v characters", path, n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			return fmt.Errorf("%s should be at most %v characters", path, n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(v) {
+				return fmt.Errorf("%s should match %s", path, p)
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			return fmt.Errorf("%s should be at least %v", path, n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			return fmt.Errorf("%s should be at most %v", path, n)
+		}
+	}
+	return nil
+}
+
+func validateObject(obj map[string]interface{}, schema map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s is missing required property %q", path, name)
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := path + "." + name
+		if p, ok := props[name].(map[string]interface{}); ok {
+			if err := validateSchema(obj[name], p, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return fmt.Errorf("%s is not an allowed property", sub)
+			}
+		case map[string]interface{}:
+			if err := validateSchema(obj[name], extra, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func hasJSONType(value interface{}, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+func jsonTypeName(value interface{}) string {
+	for _, t := range []string{"null", "boolean", "string", "integer", "number", "array", "object"} {
+		if hasJSONType(value, t) {
+			return t
+		}
+	}
+	return "unknown"
+}
+
+func jsonEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
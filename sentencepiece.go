@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Piece types in a SentencePiece model.
+const (
+	spNormal      = 1
+	spUnknown     = 2
+	spControl     = 3
+	spUserDefined = 4
+	spByte        = 6
+)
+
+// spSpace stands for a space in SentencePiece vocabularies.
+const spSpace = "▁"
+
+// sentencePiece encodes text the way a SentencePiece model does, as Llama
+// and Gemma models are tokenized: spaces become ▁, and words are segmented
+// by merging the best-scoring pairs (BPE models) or by the most likely
+// segmentation (unigram models). Characters outside the vocabulary fall
+// back to their bytes.
+type sentencePiece struct {
+	name        string
+	ids         map[string]int
+	scores      []float32
+	unigram     bool
+	dummyPrefix bool
+	maxPieceLen int
+	bytes       [256]int
+	unknown     int
+}
+
+// parseSentencePiece reads a tokenizer.model file, which is a ModelProto
+// protobuf. Only the fields tokenizing needs are read.
+func parseSentencePiece(name string, data []byte) (*sentencePiece, error) {
+	sp := &sentencePiece{name: name, ids: map[string]int{}, dummyPrefix: true, unknown: -1}
+	for i := range sp.bytes {
+		sp.bytes[i] = -1
+	}
+	err := readProto(data, func(field int, value uint64, msg []byte) error {
+		switch field {
+		case 1: // pieces
+			piece, score, typ := "", float32(0), uint64(spNormal)
+			err := readProto(msg, func(field int, value uint64, msg []byte) error {
+				switch field {
+				case 1:
+					piece = string(msg)
+				case 2:
+					score = math.Float32frombits(uint32(value))
+				case 3:
+					typ = value
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			id := len(sp.scores)
+			sp.scores = append(sp.scores, score)
+			switch typ {
+			case spNormal, spUserDefined:
+				sp.ids[piece] = id
+				sp.maxPieceLen = max(sp.maxPieceLen, utf8.RuneCountInString(piece))
+			case spUnknown:
+				sp.unknown = id
+			case spByte:
+				var b byte
+				if _, err := fmt.Sscanf(piece, "<0x%02X>", &b); err == nil {
+					sp.bytes[b] = id
+				}
+			}
+		case 2: // trainer_spec
+			return readProto(msg, func(field int, value uint64, _ []byte) error {
+				if field == 3 { // model_type
+					sp.unigram = value == 1
+				}
+				return nil
+			})
+		case 3: // normalizer_spec
+			return readProto(msg, func(field int, value uint64, _ []byte) error {
+				if field == 3 { // add_dummy_prefix
+					sp.dummyPrefix = value != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil || len(sp.ids) == 0 {
+		return nil, fmt.Errorf("%s: not a SentencePiece model", strings.TrimPrefix(name, "sentencepiece:"))
+	}
+	return sp, nil
+}
+
+// readProto calls fn for each field of a protobuf message, with the value
+// of varint and fixed-size fields and the bytes of length-delimited ones.
+func readProto(data []byte, fn func(field int, value uint64, msg []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("bad protobuf key")
+		}
+		data = data[n:]
+		var value uint64
+		var msg []byte
+		switch key & 7 {
+		case 0:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("bad protobuf varint")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return fmt.Errorf("short protobuf field")
+			}
+			value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return fmt.Errorf("short protobuf field")
+			}
+			msg, data = data[n:n+int(size)], data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return fmt.Errorf("short protobuf field")
+			}
+			value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		if err := fn(int(key>>3), value, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sp *sentencePiece) Name() string { return sp.name }
+
+func (sp *sentencePiece) Count(text string) int { return len(sp.encode(text)) }
+
+func (sp *sentencePiece) encode(text string) []int {
+	if text == "" {
+		return nil
+	}
+	if sp.dummyPrefix {
+		text = " " + text
+	}
+	text = strings.ReplaceAll(text, " ", spSpace)
+
+	// Pieces never span a word boundary, so each word, with the ▁ that
+	// starts it, is segmented on its own.
+	var ids []int
+	for len(text) > 0 {
+		end := strings.Index(text[len(spSpace):], spSpace)
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += len(spSpace)
+		}
+		var symbols []string
+		if sp.unigram {
+			symbols = sp.viterbi(text[:end])
+		} else {
+			symbols = sp.mergePairs(text[:end])
+		}
+		for _, s := range symbols {
+			ids = append(ids, sp.lookup(s)...)
+		}
+		text = text[end:]
+	}
+	return ids
+}
+
+// mergePairs segments a word as BPE models do: from its characters,
+// merging the adjacent pair whose union scores best until none is in the
+// vocabulary.
+func (sp *sentencePiece) mergePairs(word string) []string {
+	var symbols []string
+	for _, r := range word {
+		symbols = append(symbols, string(r))
+	}
+	for len(symbols) > 1 {
+		at := -1
+		var best float32
+		for i := 0; i+1 < len(symbols); i++ {
+			if id, ok := sp.ids[symbols[i]+symbols[i+1]]; ok && (at < 0 || sp.scores[id] > best) {
+				best, at = sp.scores[id], i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		symbols[at] += symbols[at+1]
+		symbols = append(symbols[:at+1], symbols[at+2:]...)
+	}
+	return symbols
+}
+
+// viterbi segments a word as unigram models do: into the pieces whose
+// scores (log probabilities) add up highest, a character outside the
+// vocabulary scoring well below any piece.
+func (sp *sentencePiece) viterbi(word string) []string {
+	var starts []int
+	for i := range word {
+		starts = append(starts, i)
+	}
+	starts = append(starts, len(word))
+
+	const unknownScore = -100
+	best := make([]float32, len(starts))
+	from := make([]int, len(starts))
+	for end := 1; end < len(starts); end++ {
+		best[end], from[end] = best[end-1]+unknownScore, end-1
+		for start := max(0, end-sp.maxPieceLen); start < end; start++ {
+			if id, ok := sp.ids[word[starts[start]:starts[end]]]; ok && best[start]+sp.scores[id] > best[end] {
+				best[end], from[end] = best[start]+sp.scores[id], start
+			}
+		}
+	}
+
+	var symbols []string
+	for end := len(starts) - 1; end > 0; end = from[end] {
+		symbols = append(symbols, word[starts[from[end]]:starts[end]])
+	}
+	for i, j := 0, len(symbols)-1; i < j; i, j = i+1, j-1 {
+		symbols[i], symbols[j] = symbols[j], symbols[i]
+	}
+	return symbols
+}
+
+// lookup is the id of a symbol, or of its bytes when the model falls back
+// to them, or the unknown piece.
+func (sp *sentencePiece) lookup(symbol string) []int {
+	if id, ok := sp.ids[symbol]; ok {
+		return []int{id}
+	}
+	var ids []int
+	for i := 0; i < len(symbol); i++ {
+		if sp.bytes[symbol[i]] < 0 {
+			return []int{sp.unknown}
+		}
+		ids = append(ids, sp.bytes[symbol[i]])
+	}
+	return ids
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const sessionPRPrompt = `You turn a coding session into a pull request. Below are the requests made to the assistant during the session and the diff of the files it changed.
+
+Group the changed files into a few logical commits, in the order they should be applied, each with a git commit message: a capitalized, imperative summary under 72 characters and, if the change needs explaining, a blank line and a short body wrapped at 72 characters. Every file goes in exactly one commit. Then name a short git branch (lower case words joined by "-") and write the pull request's title and body: what the change does and why, as the session's requests explain it, and how it can be checked.`
+
+var sessionPRSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"branch", "commits", "title", "body"},
+	"properties": map[string]interface{}{
+		"branch": map[string]interface{}{"type": "string"},
+		"commits": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"message", "files"},
+				"properties": map[string]interface{}{
+					"message": map[string]interface{}{"type": "string"},
+					"files":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				},
+			},
+		},
+		"title": map[string]interface{}{"type": "string"},
+		"body":  map[string]interface{}{"type": "string"},
+	},
+}
+
+// sessionPR is the model's plan for a session's pull request.
+type sessionPR struct {
+	Branch  string `json:"branch"`
+	Commits []struct {
+		Message string   `json:"message"`
+		Files   []string `json:"files"`
+	} `json:"commits"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// runSessions handles "ask sessions [list | to-pr <name> [api] [--branch
+// name] [--create] [--yes] [--cost]]". Sessions are the edits recorded for
+// ask undo.
+func runSessions(config *Config, args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		runUndo([]string{"--list"})
+		return
+	}
+	if args[0] != "to-pr" {
+		fmt.Println("Usage: ask sessions [list | to-pr <name> [api-name] [--branch name] [--create] [--yes] [--cost]]")
+		os.Exit(1)
+	}
+	parsed, err := parseArgs(args[1:], map[string]bool{"branch": true, "create": false, "yes": false, "cost": false})
+	if err != nil || len(parsed.positional) < 1 || len(parsed.positional) > 2 {
+		fmt.Println("Usage: ask sessions to-pr <name> [api-name] [--branch name] [--create] [--yes] [--cost]")
+		os.Exit(1)
+	}
+	name := parsed.positional[0]
+	var s *backupSession
+	if safeName.MatchString(name) {
+		s, _ = loadSession(name)
+	}
+	if s == nil {
+		fmt.Printf("Error: no session %s (see 'ask sessions list')\n", name)
+		os.Exit(1)
+	}
+	if !parsed.has("yes") && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Error: ask sessions to-pr asks before committing; run it in a terminal or pass --yes")
+		os.Exit(1)
+	}
+
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	// Paths are taken from the top, wherever ask was run.
+	if err := os.Chdir(strings.TrimSpace(root)); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if staged, _ := git("diff", "--cached", "--name-only"); strings.TrimSpace(staged) != "" {
+		fmt.Println("Error: there are staged changes; commit or unstage them first")
+		os.Exit(1)
+	}
+	files := sessionChanges(s, strings.TrimSpace(root))
+	if len(files) == 0 {
+		fmt.Printf("Session %s has no uncommitted changes in this repository.\n", s.Name)
+		os.Exit(1)
+	}
+
+	// New files are added with intent to add, so they show in the diff;
+	// they're committed below either way.
+	if _, err := git(append([]string{"add", "--intent-to-add", "--"}, files...)...); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	diff, err := git(append([]string{"diff", "--no-color", "HEAD", "--"}, files...)...)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	apiName, api := selectAPI(config, strings.Join(parsed.positional[1:], ""))
+	tok := tokenizerFor(api)
+	requests := sessionRequests(s)
+	parts := assembleContext(diffItems(diff), min(promptBudget(api)-tok.Count(requests), maxDiffTokens), tok)
+	reportAssembly(config.Settings, parts)
+	req := Request{
+		System: sessionPRPrompt,
+		Prompt: fmt.Sprintf("Requests:\n%s\n\nChanged files:\n%s\n\nDiff:\n%s", requests, strings.Join(files, "\n"), joinParts(parts, "\n")),
+		Schema: sessionPRSchema,
+	}
+	entry := newHistoryEntry(apiName, api, req)
+	resp, err := sendRequest(api, req)
+	entry.addResponse(resp)
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	reportCost(config.Settings, parsed.has("cost"), api, resp)
+	var plan sessionPR
+	if err := json.Unmarshal([]byte(resp.Text), &plan); err != nil || len(plan.Commits) == 0 {
+		fmt.Println("Error: the model gave no usable plan")
+		os.Exit(1)
+	}
+	groups := planGroups(plan, files)
+	branch := parsed.value("branch", "ask/"+branchName(plan.Branch, s.Name))
+
+	fmt.Printf("\nBranch %s\n", branch)
+	for i, g := range groups {
+		fmt.Printf("\n%d. %s\n", i+1, strings.SplitN(g.message, "\n", 2)[0])
+		for _, f := range g.files {
+			fmt.Println(dim("     " + f))
+		}
+	}
+	fmt.Printf("\n%s\n\n%s\n\n", plan.Title, plan.Body)
+	if !parsed.has("yes") {
+		fmt.Print("Create the branch and commits? [y/N]: ")
+		if answer, _ := readLine(); !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			git(append([]string{"reset", "-q", "--"}, files...)...)
+			fmt.Println("Nothing committed.")
+			return
+		}
+	}
+
+	if _, err := git("switch", "-c", branch); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	for _, g := range groups {
+		if _, err := git(append([]string{"add", "--"}, g.files...)...); err == nil {
+			_, err = git("commit", "-q", "-m", g.message)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Committed:", strings.SplitN(g.message, "\n", 2)[0])
+	}
+
+	bodyPath := filepath.Join(getBackupsDir(), s.Name, "pr-body.md")
+	if err := os.WriteFile(bodyPath, []byte(plan.Body+"\n"), 0600); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if !parsed.has("create") {
+		fmt.Printf("PR body saved to %s\nOpen it with: git push -u origin %s && gh pr create --title %s --body-file %s\n", bodyPath, branch, shellQuote(plan.Title), shellQuote(bodyPath))
+		return
+	}
+	for _, cmd := range [][]string{{"git", "push", "-u", "origin", branch}, {"gh", "pr", "create", "--title", plan.Title, "--body-file", bodyPath}} {
+		c := exec.Command(cmd[0], cmd[1:]...)
+		c.Stdout, c.Stderr = os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			fmt.Printf("Error: %s: %v\n", strings.Join(cmd[:2], " "), err)
+			os.Exit(1)
+		}
+	}
+}
+
+// sessionChanges returns the files s changed that differ from HEAD, relative
+// to the repository at root. Files outside it, and those since committed or
+// put back, are left out.
+func sessionChanges(s *backupSession, root string) []string {
+	var files []string
+	for _, f := range s.Files {
+		rel, err := filepath.Rel(root, f.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if status, err := git("status", "--porcelain", "--", rel); err == nil && strings.TrimSpace(status) != "" {
+			files = append(files, rel)
+		}
+	}
+	return files
+}
+
+// sessionRequests lists what was asked in the runs that made s: those that
+// named it with --session or, for a session named after its time, the last
+// run started before its first change.
+func sessionRequests(s *backupSession) string {
+	entries, _ := loadHistory()
+	var runs []HistoryEntry
+	for _, e := range entries {
+		for i, arg := range e.Args {
+			if arg == "--session="+s.Name || arg == "--session" && i+1 < len(e.Args) && e.Args[i+1] == s.Name {
+				runs = append(runs, e)
+				break
+			}
+		}
+	}
+	if len(runs) == 0 {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if e := entries[i]; !e.Time.After(s.Created) {
+				if s.Created.Sub(e.Time) < time.Hour {
+					runs = append(runs, e)
+				}
+				break
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, e := range runs {
+		for _, m := range e.Messages {
+			if m.Role != "user" {
+				continue
+			}
+			for _, p := range m.Parts {
+				text := strings.TrimSpace(p.Text)
+				if p.Type != "text" || text == "" {
+					continue
+				}
+				// Long prompts are mostly pasted context; their start says
+				// what was asked.
+				if r := []rune(text); len(r) > 2000 {
+					text = string(r[:2000]) + "..."
+				}
+				fmt.Fprintf(&b, "- %s\n", text)
+			}
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "(none recorded)"
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// commitGroup is one commit of the pull request.
+type commitGroup struct {
+	message string
+	files   []string
+}
+
+// planGroups keeps the plan's commits to the session's files, each in the
+// first commit that names it; files the plan forgot go in a last commit.
+func planGroups(plan sessionPR, files []string) []commitGroup {
+	left := map[string]bool{}
+	for _, f := range files {
+		left[f] = true
+	}
+	var groups []commitGroup
+	for _, c := range plan.Commits {
+		g := commitGroup{message: strings.TrimSpace(c.Message)}
+		for _, f := range c.Files {
+			if left[f] {
+				g.files = append(g.files, f)
+				delete(left, f)
+			}
+		}
+		if len(g.files) > 0 && g.message != "" {
+			groups = append(groups, g)
+		}
+	}
+	if len(left) > 0 {
+		g := commitGroup{message: "Apply the remaining session changes"}
+		for _, f := range files {
+			if left[f] {
+				g.files = append(g.files, f)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// branchName makes the model's suggestion, or the session's name, safe for
+// a branch.
+func branchName(suggested, fallback string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(suggested) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	if name := strings.Trim(b.String(), "-"); name != "" {
+		return name
+	}
+	return fallback
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const shellCommandPrompt = `You turn requests into shell commands. Reply with exactly one command line for the shell and system described, using only tools that normally come with it, without explanation or a code fence. Chain steps with pipes or && if needed. If the request can't be done safely in one command, reply with a comment line starting with # that says why.`
+
+// runShell handles `ask sh "<request>" [--api name] [-x]
+// [--allow-dangerous] [--cost]`: it prints the command the model suggests
+// for the request and, with -x, runs it after an explicit confirmation.
+// Destructive commands have to be confirmed by typing, unless
+// --allow-dangerous.
+func runShell(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"api": true, "x": false, "execute": false, "allow-dangerous": false, "cost": false})
+	if err != nil || len(parsed.positional) == 0 {
+		fmt.Println(`Usage: ask sh "<what to do>" [--api <api-name>] [-x [--allow-dangerous]] [--cost]`)
+		os.Exit(1)
+	}
+	execute := parsed.has("x") || parsed.has("execute")
+	if execute && !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Error: -x asks before running the command; run it in a terminal")
+		os.Exit(1)
+	}
+
+	shell := userShell()
+	req := Request{
+		System: shellCommandPrompt,
+		Prompt: fmt.Sprintf("%s\n\nRequest: %s", shellEnvironment(shell), strings.Join(parsed.positional, " ")),
+	}
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	entry := newHistoryEntry(apiName, api, req)
+	resp, err := sendRequest(api, req)
+	entry.addResponse(resp)
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	reportCost(config.Settings, parsed.has("cost"), api, resp)
+
+	command := cleanShellCommand(resp.Text)
+	if command == "" || strings.HasPrefix(command, "#") {
+		fmt.Println(strings.TrimSpace(strings.TrimPrefix(command, "#")))
+		os.Exit(1)
+	}
+	if !execute {
+		fmt.Println(command)
+		if reasons := dangerReasons(command); len(reasons) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: this command %s.\n", strings.Join(reasons, ", and "))
+		}
+		return
+	}
+
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Println(styleBold + command + styleReset)
+	} else {
+		fmt.Println(command)
+	}
+	if !confirmRun(command, parsed.has("allow-dangerous")) {
+		fmt.Println("Not run.")
+		return
+	}
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// userShell is the user's login shell from $SHELL, or sh.
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "sh"
+}
+
+// shellEnvironment describes the shell, the system and the working
+// directory for the prompt, so suggestions fit them (GNU find or BSD find,
+// zsh or fish syntax).
+func shellEnvironment(shell string) string {
+	system := runtime.GOOS
+	switch runtime.GOOS {
+	case "darwin":
+		system = "macOS"
+	case "linux":
+		if data, err := os.ReadFile("/etc/os-release"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if name, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+					system = "Linux (" + strings.Trim(name, `"`) + ")"
+				}
+			}
+		}
+	}
+	cwd, _ := os.Getwd()
+	return fmt.Sprintf("Shell: %s\nSystem: %s on %s\nWorking directory: %s", filepath.Base(shell), system, runtime.GOARCH, cwd)
+}
+
+// cleanShellCommand takes the command out of what models wrap it in: a code
+// fence or a "$ " prompt.
+func cleanShellCommand(text string) string {
+	if blocks := extractCodeBlocks(text); len(blocks) > 0 {
+		text = blocks[0].Code
+	}
+	text = strings.TrimSpace(text)
+	if len(text) > 1 && text[0] == '`' && text[len(text)-1] == '`' {
+		text = strings.Trim(text, "`")
+	}
+	return strings.TrimSpace(strings.TrimPrefix(text, "$ "))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxExplainOutput caps how many of the last lines of a command's output
+// ask explain-last sends.
+const maxExplainOutput = 200
+
+const explainLastPrompt = `You help people at the command line. You get a shell command they just ran, its exit status and, when available, its output. Explain briefly what went wrong, or what the output means if nothing did, and give the command or change that fixes it. Don't pad the answer.`
+
+// The hooks ask shell-init prints. Each records the last command line, its
+// exit status and the directory it ran in, one per line with the command
+// last, in the file %[1]s stands for. Commands that are ask explain-last
+// themselves aren't recorded, so it can be run more than once.
+const (
+	bashHook = `__ask_last_entry=
+__ask_record() {
+  local last_status=$? entry
+  entry=$(HISTTIMEFORMAT= builtin history 1)
+  if [ -n "$entry" ] && [ "$entry" != "$__ask_last_entry" ]; then
+    __ask_last_entry=$entry
+    entry=$(printf '%%s' "$entry" | sed 's/^ *[0-9]* *//')
+    case "$entry" in
+      "ask explain-last"*) ;;
+      *) printf '%%s\n%%s\n%%s\n' "$last_status" "$PWD" "$entry" > %[1]s ;;
+    esac
+  fi
+  return $last_status
+}
+PROMPT_COMMAND="__ask_record${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`
+	zshHook = `__ask_preexec() { __ask_cmd=$1 }
+__ask_precmd() {
+  local last_status=$?
+  [[ -n $__ask_cmd ]] || return
+  case $__ask_cmd in
+    "ask explain-last"*) ;;
+    *) printf '%%s\n%%s\n%%s\n' $last_status "$PWD" "$__ask_cmd" >| %[1]s ;;
+  esac
+  __ask_cmd=
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __ask_preexec
+add-zsh-hook precmd __ask_precmd
+`
+	fishHook = `function __ask_record --on-event fish_postexec
+    set -l last_status $status
+    string match -q 'ask explain-last*' -- $argv[1]; and return
+    printf '%%s\n%%s\n%%s\n' $last_status $PWD $argv[1] > %[1]s
+end
+`
+)
+
+func getLastCommandPath() string {
+	return filepath.Join(stateDir(), "last-command")
+}
+
+// runShellInit handles "ask shell-init bash|zsh|fish": it prints the hook
+// that records each command for ask explain-last, to be evaluated from the
+// shell's startup file.
+func runShellInit(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: ask shell-init bash|zsh|fish")
+		os.Exit(1)
+	}
+	hooks := map[string]string{"bash": bashHook, "zsh": zshHook, "fish": fishHook}
+	hook, ok := hooks[args[0]]
+	if !ok {
+		fmt.Printf("Error: unsupported shell %s (bash, zsh and fish are)\n", args[0])
+		os.Exit(1)
+	}
+	path := getLastCommandPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	fmt.Printf(hook, shellQuote(path))
+}
+
+// lastCommand is the command the shell hook recorded last.
+type lastCommand struct {
+	Status  int
+	Dir     string
+	Command string
+}
+
+func loadLastCommand() (*lastCommand, error) {
+	data, err := os.ReadFile(getLastCommandPath())
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitN(strings.TrimRight(string(data), "\n"), "\n", 3)
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("the recorded command is damaged")
+	}
+	status, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("the recorded command is damaged")
+	}
+	return &lastCommand{Status: status, Dir: lines[1], Command: lines[2]}, nil
+}
+
+// runExplainLast handles "ask explain-last [--api name] [--rerun]": the
+// command the shell hook recorded last, its exit status and its output go
+// to the model to explain. The output comes from stdin when it's piped, or,
+// with --rerun, from running the command again in the directory it ran in;
+// a destructive one is confirmed first, as with ask sh -x.
+func runExplainLast(config *Config, args []string) {
+	spec := map[string]bool{"api": true, "rerun": false, "allow-dangerous": false}
+	for flag, takesValue := range promptFlags {
+		spec[flag] = takesValue
+	}
+	parsed, err := parseArgs(args, spec)
+	if err != nil || len(parsed.positional) > 0 {
+		fmt.Println("Usage: ask explain-last [--api <api-name>] [--rerun [--allow-dangerous]]")
+		os.Exit(1)
+	}
+
+	last, err := loadLastCommand()
+	if os.IsNotExist(err) {
+		fmt.Println("No command recorded yet. Add the hook to your shell's startup file, e.g.")
+		fmt.Println(`  eval "$(ask shell-init bash)"    # or zsh; for fish: ask shell-init fish | source`)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	var output string
+	switch {
+	case !term.IsTerminal(int(os.Stdin.Fd())):
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		output = string(data)
+	case parsed.has("rerun"):
+		fmt.Println("$ " + last.Command)
+		if reasons := dangerReasons(last.Command); len(reasons) > 0 && !confirmRun(last.Command, parsed.has("allow-dangerous")) {
+			fmt.Println("Not run.")
+			os.Exit(1)
+		}
+		var out bytes.Buffer
+		last.Status = 0
+		cmd := exec.Command(userShell(), "-c", last.Command)
+		cmd.Dir, cmd.Stdout, cmd.Stderr = last.Dir, &out, &out
+		if err := cmd.Run(); err != nil {
+			if exit, ok := err.(*exec.ExitError); ok {
+				last.Status = exit.ExitCode()
+			} else {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+		output = out.String()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\nCommand: %s\nRun in: %s\nExit status: %d\n", shellEnvironment(userShell()), last.Command, last.Dir, last.Status)
+	if strings.TrimSpace(output) != "" {
+		lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+		if n := len(lines) - maxExplainOutput; n > 0 {
+			notifyTruncation(config.Settings, "Sending only the last %d of %d output lines", maxExplainOutput, len(lines))
+			lines = append([]string{omissionNotice(fmt.Sprintf("%d earlier lines of output", n))}, lines[n:]...)
+		}
+		fmt.Fprintf(&b, "Output:\n```\n%s\n```", strings.Join(lines, "\n"))
+	} else {
+		b.WriteString("(Output not captured.)")
+	}
+
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+	answer(config, parsed, apiName, api, Request{System: explainLastPrompt, Prompt: b.String()})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Limits for user-defined shell tools.
+const (
+	shellToolTimeout   = 60 * time.Second
+	shellToolMaxOutput = 20000
+)
+
+// ToolConfig is a tool declared under "tools" in the config: the model
+// fills in the arguments described by Parameters and ask runs Command with
+// them substituted, or the WASM module Wasm with them on stdin.
+type ToolConfig struct {
+	Description string `json:"description"`
+	// Parameters is the JSON schema of the arguments object. Without one the
+	// tool takes no arguments.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// Command is run with sh -c after every {{name}} is replaced with the
+	// shell-quoted argument of that name.
+	Command string `json:"command,omitempty"`
+	// Wasm is a WASM plugin to run instead of Command; see plugin.go.
+	Wasm string `json:"wasm,omitempty"`
+}
+
+// toolPlaceholder matches {{name}} in a command template.
+var toolPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// configTools returns the configured tools named in names, or all of them
+// for "all".
+func configTools(config *Config, names []string) ([]Tool, error) {
+	if len(names) == 1 && names[0] == "all" {
+		names = nil
+		for name := range config.Tools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var tools []Tool
+	for _, name := range names {
+		tc, ok := config.Tools[name]
+		if !ok {
+			return nil, fmt.Errorf("no tool named %q in config", name)
+		}
+		if tc.Command == "" && tc.Wasm == "" {
+			return nil, fmt.Errorf("tool %s has no command or wasm module", name)
+		}
+		if tc.Command != "" && tc.Wasm != "" {
+			return nil, fmt.Errorf("tool %s has both a command and a wasm module", name)
+		}
+		tools = append(tools, tc.tool(name))
+	}
+	return tools, nil
+}
+
+// tool wraps tc for the tool-calling loop. Each command is printed to
+// stderr before it runs.
+func (tc ToolConfig) tool(name string) Tool {
+	params := tc.Parameters
+	if params == nil {
+		params = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	if tc.Wasm != "" {
+		return tc.wasmTool(name, params)
+	}
+	tty := term.IsTerminal(int(os.Stderr.Fd()))
+	return Tool{
+		Name:        name,
+		Description: tc.Description,
+		Parameters:  params,
+		Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			command := expandToolCommand(tc.Command, args)
+			line := "$ " + command
+			if tty {
+				line = dim(line)
+			}
+			fmt.Fprintln(os.Stderr, line)
+			return runShellTool(ctx, command)
+		},
+	}
+}
+
+// expandToolCommand substitutes args into a command template. Strings are
+// inserted as-is and other values as JSON, always shell-quoted; missing
+// arguments become empty strings.
+func expandToolCommand(command string, args map[string]interface{}) string {
+	return toolPlaceholder.ReplaceAllStringFunc(command, func(ref string) string {
+		var value string
+		switch v := args[toolPlaceholder.FindStringSubmatch(ref)[1]].(type) {
+		case nil:
+		case string:
+			value = v
+		default:
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+		return shellQuote(value)
+	})
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runShellTool runs command and returns its combined output. A failing
+// command isn't an error for the loop: the model sees the output and the
+// exit status and can react to them.
+func runShellTool(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, shellToolTimeout)
+	defer cancel()
+
+	out := limitedBuffer{max: shellToolMaxOutput}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+
+	output := out.String()
+	if out.truncated {
+		output += fmt.Sprintf("\n[output truncated to %d bytes]", out.max)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return output + fmt.Sprintf("\n[timed out after %s]", shellToolTimeout), nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return output + fmt.Sprintf("\n[exit status %d]", exitErr.ExitCode()), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return output, nil
+}
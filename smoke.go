@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// smokePrompt is deliberately tiny so a smoke run costs next to nothing.
+const smokePrompt = "Reply with the single word OK."
+
+// smokeText is what machine translation providers, which take no prompts,
+// are checked by translating, into smokeTarget.
+const (
+	smokeText   = "OK"
+	smokeTarget = "de"
+)
+
+type smokeResult struct {
+	name    string
+	latency time.Duration
+	err     error
+}
+
+// runSmoke sends a trivial prompt to every configured API concurrently (a
+// trivial translation to MT providers) and prints a pass/fail table, exiting non-zero if any API failed.
+func runSmoke(config *Config) {
+	if len(config.APIs) == 0 {
+		fmt.Println("No APIs configured. Use 'ask add' to add one.")
+		return
+	}
+
+	names := make([]string, 0, len(config.APIs))
+	for name := range config.APIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]smokeResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			start := time.Now()
+			var err error
+			if api := config.APIs[name]; isTranslationProvider(api.Provider) {
+				_, err = translateWith(api, smokeTarget, smokeText, nil)
+			} else {
+				_, err = sendPrompt(api, smokePrompt)
+			}
+			results[i] = smokeResult{name: name, latency: time.Since(start), err: err}
+		}(i, name)
+	}
+	wg.Wait()
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "API\tSTATUS\tLATENCY\tERROR")
+	for _, r := range results {
+		status, reason := "✓", ""
+		if r.err != nil {
+			failed++
+			status, reason = "✗", smokeReason(r.err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.name, status, r.latency.Round(time.Millisecond), reason)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d APIs failed\n", failed, len(results))
+		os.Exit(1)
+	}
+}
+
+// smokeReason condenses an error to a single short line for the table.
+func smokeReason(err error) string {
+	reason := strings.TrimSpace(err.Error())
+	if i := strings.IndexByte(reason, '\n'); i >= 0 {
+		reason = reason[:i]
+	}
+	// Cut by characters, so a multi-byte one isn't split.
+	if r := []rune(reason); len(r) > 80 {
+		reason = string(r[:77]) + "..."
+	}
+	return reason
+}
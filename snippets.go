@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snippet is a piece of a recorded answer kept under a name: its code
+// blocks, or the whole answer when it has none.
+type Snippet struct {
+	Name    string    `json:"name"`
+	Tags    []string  `json:"tags,omitempty"`
+	Lang    string    `json:"lang,omitempty"`
+	Text    string    `json:"text"`
+	Prompt  string    `json:"prompt"`
+	API     string    `json:"api,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// safeName is what snippets and sessions may be called, so names work
+// unquoted on the command line and as file names.
+var safeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func getSnippetsPath() string {
+	return filepath.Join(stateDir(), "snippets.json")
+}
+
+func loadSnippets() ([]Snippet, error) {
+	data, err := os.ReadFile(getSnippetsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snippets []Snippet
+	if err := json.Unmarshal(data, &snippets); err != nil {
+		return nil, fmt.Errorf("%s is invalid: %s", getSnippetsPath(), describeJSONError(data, err))
+	}
+	return snippets, nil
+}
+
+func saveSnippets(snippets []Snippet) error {
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].Name < snippets[j].Name })
+	data, err := json.MarshalIndent(snippets, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := getSnippetsPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func findSnippet(snippets []Snippet, name string) (int, bool) {
+	for i, s := range snippets {
+		if s.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// answer is the text of the last assistant message.
+func (e HistoryEntry) answer() string {
+	for i := len(e.Messages) - 1; i >= 0; i-- {
+		if e.Messages[i].Role != "assistant" {
+			continue
+		}
+		for _, p := range e.Messages[i].Parts {
+			if p.Type == "text" {
+				return p.Text
+			}
+		}
+	}
+	return ""
+}
+
+// runBookmark handles "ask bookmark <history-id|last> --name <name> [--tag
+// t]... [--block n]", saving the entry's code (or just its nth code block)
+// as a snippet.
+func runBookmark(args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"name": true, "tag": true, "block": true, "force": false})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	name := parsed.value("name", "")
+	if len(parsed.positional) != 1 || name == "" {
+		fmt.Println("Usage: ask bookmark <history-id|last> --name <name> [--tag tag]... [--block n] [--force]")
+		os.Exit(1)
+	}
+	if !safeName.MatchString(name) {
+		fmt.Println("Error: snippet names may only use letters, digits, '.', '_' and '-'")
+		os.Exit(1)
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Println("Error reading history:", err)
+		os.Exit(1)
+	}
+	entry, err := findHistoryEntry(entries, parsed.positional[0])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	answer := entry.answer()
+	if answer == "" {
+		fmt.Println("Error: that run has no answer to bookmark")
+		os.Exit(1)
+	}
+
+	snippet := Snippet{
+		Name:    name,
+		Tags:    parsed.values("tag"),
+		Text:    answer,
+		Prompt:  entry.prompt(),
+		API:     entry.label(),
+		Created: time.Now(),
+	}
+	blocks := extractCodeBlocks(answer)
+	if b := parsed.value("block", ""); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 1 || n > len(blocks) {
+			fmt.Printf("Error: --block must be between 1 and %d\n", len(blocks))
+			os.Exit(1)
+		}
+		blocks = blocks[n-1 : n]
+	}
+	if len(blocks) > 0 {
+		var code []string
+		snippet.Lang = blocks[0].Lang
+		for _, block := range blocks {
+			code = append(code, block.Code)
+			if block.Lang != snippet.Lang {
+				snippet.Lang = ""
+			}
+		}
+		snippet.Text = strings.Join(code, "\n\n")
+	}
+
+	snippets, err := loadSnippets()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if i, ok := findSnippet(snippets, name); ok {
+		if !parsed.has("force") {
+			fmt.Printf("Error: snippet %s already exists (use --force to replace it)\n", name)
+			os.Exit(1)
+		}
+		snippets = append(snippets[:i], snippets[i+1:]...)
+	}
+	if err := saveSnippets(append(snippets, snippet)); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved snippet %s (%d lines)\n", name, strings.Count(snippet.Text, "\n")+1)
+}
+
+// runSnippets handles "ask snippets [list [--tag t] [query] | show <name> |
+// copy <name> | rm <name>]".
+func runSnippets(args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"tag": true})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	sub := "list"
+	if len(parsed.positional) > 0 {
+		sub = parsed.positional[0]
+	}
+	snippets, err := loadSnippets()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	switch sub {
+	case "list":
+		matches := filterSnippets(snippets, parsed.values("tag"), strings.Join(parsed.positional[min(1, len(parsed.positional)):], " "))
+		if len(matches) == 0 {
+			if len(snippets) == 0 {
+				fmt.Println("No snippets yet. Save one with 'ask bookmark <history-id> --name <name>'.")
+			} else {
+				fmt.Println("No matching snippets.")
+			}
+			return
+		}
+		for _, s := range matches {
+			line := fmt.Sprintf("%-24s %-10s %s", s.Name, s.Lang, summarizePrompt(s.Prompt))
+			if len(s.Tags) > 0 {
+				line += dim("  #" + strings.Join(s.Tags, " #"))
+			}
+			fmt.Println(line)
+		}
+	case "show", "copy", "rm":
+		if len(parsed.positional) != 2 {
+			fmt.Printf("Usage: ask snippets %s <name>\n", sub)
+			os.Exit(1)
+		}
+		i, ok := findSnippet(snippets, parsed.positional[1])
+		if !ok {
+			fmt.Printf("Error: no snippet named %s\n", parsed.positional[1])
+			os.Exit(1)
+		}
+		switch sub {
+		case "show":
+			fmt.Println(snippets[i].Text)
+		case "copy":
+			if err := copyToClipboard(snippets[i].Text); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Copied %s to the clipboard\n", snippets[i].Name)
+		case "rm":
+			if err := saveSnippets(append(snippets[:i], snippets[i+1:]...)); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed snippet %s\n", parsed.positional[1])
+		}
+	default:
+		fmt.Println("Usage: ask snippets [list [--tag tag] [query] | show <name> | copy <name> | rm <name>]")
+		os.Exit(1)
+	}
+}
+
+// filterSnippets keeps the snippets carrying every tag in tags whose name,
+// tags, prompt or text fuzzy-match query, best match first.
+func filterSnippets(snippets []Snippet, tags []string, query string) []Snippet {
+	type scored struct {
+		snippet Snippet
+		score   int
+	}
+	var matches []scored
+	for _, s := range snippets {
+		if !hasAllTags(s.Tags, tags) {
+			continue
+		}
+		score := 0
+		if query != "" {
+			var ok bool
+			if score, ok = fuzzyScore(query, s.Name+" "+strings.Join(s.Tags, " ")+" "+s.Prompt+" "+s.Text); !ok {
+				continue
+			}
+		}
+		matches = append(matches, scored{s, score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	result := make([]Snippet, len(matches))
+	for i, m := range matches {
+		result[i] = m.snippet
+	}
+	return result
+}
+
+func hasAllTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// copyToClipboard hands text to the platform's clipboard tool.
+func copyToClipboard(text string) error {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip"}}
+	default:
+		candidates = [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"clip.exe"}}
+	}
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return fmt.Errorf("no clipboard tool found (install wl-copy, xclip or xsel)")
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// canStream reports whether answers from provider can be streamed as they
+// are generated.
+func canStream(provider string) bool {
+	switch provider {
+	case ProviderLocal, ProviderOpenAI, ProviderLocalOpenAI, ProviderClaude, ProviderGemini:
+		return true
+	}
+	return false
+}
+
+// streamRequest sends req and hands each piece of the answer to onDelta as
+// it arrives, returning the complete response at the end. Providers that
+// can't stream deliver their whole answer as one delta.
+func streamRequest(api APIConfig, req Request, onDelta func(string)) (resp Response, err error) {
+	api, done := beginRequest(api)
+	defer done()
+	defer func(ctx context.Context) { err = interruptedErr(ctx, err) }(api.ctx)
+	if !canStream(api.Provider) || len(req.Tools) > 0 || imageModel(api) {
+		resp, err = sendRequest(api, req)
+		if err == nil && resp.Text != "" {
+			onDelta(resp.Text)
+		}
+		return resp, err
+	}
+
+	if len(api.fallbacks) > 0 || len(api.APIKeys) > 1 {
+		// Once part of the answer is out, another API can't take over.
+		started := false
+		return failover(api, func(api APIConfig) (Response, error) {
+			return streamRequest(api, req, func(delta string) {
+				started = true
+				onDelta(delta)
+			})
+		}, func(Response) bool { return !started })
+	}
+
+	api, err = expandAPIConfig(api)
+	if err != nil {
+		return Response{}, err
+	}
+	if cached, ok := cachedAnswer(api, req); ok {
+		onDelta(cached.Text)
+		return cached, nil
+	}
+	if err := checkRequest(api, req); err != nil {
+		return Response{}, err
+	}
+	if err := checkBudget(api, req); err != nil {
+		return Response{}, err
+	}
+	defer func() {
+		recordUsage(api, req, resp)
+		if err == nil {
+			cacheAnswer(api, req, resp)
+		}
+	}()
+
+	switch api.Provider {
+	case ProviderLocal:
+		return runLocalModel(api, req, onDelta)
+	case ProviderClaude:
+		return streamClaude(api, req, onDelta)
+	case ProviderGemini:
+		return streamGemini(api, req, onDelta)
+	default:
+		return streamOpenAI(api, req, onDelta)
+	}
+}
+
+// postStream posts payload and returns the response for the caller to read
+// as it arrives. Only the wait for the response headers is bounded, since a
+// long answer can take minutes to stream.
+func postStream(api APIConfig, url string, payload interface{}, headers map[string]string) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(api.requestContext(), "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if err := setAPIHeaders(req, api); err != nil {
+		return nil, err
+	}
+
+	transport, err := apiTransport(api)
+	if err != nil {
+		return nil, err
+	}
+	transport.ResponseHeaderTimeout = 60 * time.Second
+	client := &http.Client{Transport: transport}
+	resp, err := doWithRetry(client, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &statusError{Code: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	return resp, nil
+}
+
+// readSSE calls onEvent for every server-sent event in body until it ends
+// or onEvent returns io.EOF.
+func readSSE(body io.Reader, onEvent func(event, data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := onEvent(event, strings.Join(data, "\n")); err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(line[len("data:"):], " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		if err := onEvent(event, strings.Join(data, "\n")); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+func streamOpenAI(config APIConfig, req Request, onDelta func(string)) (Response, error) {
+	headers := openAIHeaders(config)
+	model, err := openAIModel(config, headers)
+	if err != nil {
+		return Response{}, err
+	}
+	payload := map[string]interface{}{
+		"model":    model,
+		"messages": encodeOpenAI(requestMessages(req)),
+		"stream":   true,
+	}
+	if config.Provider == ProviderOpenAI {
+		payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	httpResp, err := postStream(config, config.BaseURL+"/chat/completions", payload, headers)
+	if err != nil {
+		return Response{}, err
+	}
+	defer httpResp.Body.Close()
+
+	var text, thinking strings.Builder
+	resp := Response{}
+	err = readSSE(httpResp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return io.EOF
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if e, ok := chunk["error"].(map[string]interface{}); ok {
+			msg, _ := e["message"].(string)
+			return errors.New(msg)
+		}
+		if choices, ok := chunk["choices"].([]interface{}); ok && len(choices) > 0 {
+			choice, _ := choices[0].(map[string]interface{})
+			delta, _ := choice["delta"].(map[string]interface{})
+			if t, _ := delta["content"].(string); t != "" {
+				text.WriteString(t)
+				onDelta(t)
+			}
+			if t, _ := delta["reasoning_content"].(string); t != "" {
+				thinking.WriteString(t)
+			}
+			if _, ok := delta["images"]; ok {
+				resp.Images = append(resp.Images, partImages(decodeOpenAI(map[string]interface{}{"images": delta["images"]}))...)
+			}
+		}
+		if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+			in, _ := usage["prompt_tokens"].(float64)
+			out, _ := usage["completion_tokens"].(float64)
+			resp.Usage = &Usage{InputTokens: int(in), OutputTokens: int(out)}
+		}
+		// Perplexity repeats its sources on every chunk.
+		if citations, ok := chunk["citations"].([]interface{}); ok {
+			resp.Citations = urlCitations(citations)
+		}
+		return nil
+	})
+	resp.Text, resp.Thinking = text.String(), thinking.String()
+	return resp, err
+}
+
+func streamClaude(config APIConfig, req Request, onDelta func(string)) (Response, error) {
+	system, messages := encodeClaude(requestMessages(req))
+	payload := map[string]interface{}{
+		"model":      config.Model,
+		"messages":   messages,
+		"max_tokens": 4096,
+		"stream":     true,
+	}
+	if system != "" {
+		payload["system"] = system
+	}
+
+	httpResp, err := postStream(config, config.BaseURL+"/messages", payload, claudeHeaders(config))
+	if err != nil {
+		return Response{}, err
+	}
+	defer httpResp.Body.Close()
+
+	// Usage stays nil until message_start reports it, so a stream that
+	// fails before then isn't recorded as a request that used nothing.
+	var text, thinking strings.Builder
+	resp := Response{}
+	err = readSSE(httpResp.Body, func(event, data string) error {
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return err
+		}
+		switch event {
+		case "message_start":
+			msg, _ := ev["message"].(map[string]interface{})
+			resp.Model, _ = msg["model"].(string)
+			u, _ := msg["usage"].(map[string]interface{})
+			in, _ := u["input_tokens"].(float64)
+			resp.Usage = &Usage{InputTokens: int(in)}
+		case "content_block_delta":
+			delta, _ := ev["delta"].(map[string]interface{})
+			if t, _ := delta["text"].(string); t != "" {
+				text.WriteString(t)
+				onDelta(t)
+			}
+			if t, _ := delta["thinking"].(string); t != "" {
+				thinking.WriteString(t)
+			}
+		case "message_delta":
+			delta, _ := ev["delta"].(map[string]interface{})
+			resp.FinishReason, _ = delta["stop_reason"].(string)
+			u, _ := ev["usage"].(map[string]interface{})
+			if out, ok := u["output_tokens"].(float64); ok && resp.Usage != nil {
+				resp.Usage.OutputTokens = int(out)
+			}
+		case "message_stop":
+			return io.EOF
+		case "error":
+			e, _ := ev["error"].(map[string]interface{})
+			msg, _ := e["message"].(string)
+			return errors.New(msg)
+		}
+		return nil
+	})
+	resp.Text, resp.Thinking = text.String(), thinking.String()
+	return resp, err
+}
+
+func streamGemini(config APIConfig, req Request, onDelta func(string)) (Response, error) {
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse&key=%s", config.BaseURL, config.Model, config.APIKey)
+	system, contents := encodeGemini(requestMessages(req))
+	payload := map[string]interface{}{"contents": contents}
+	if system != nil {
+		payload["system_instruction"] = system
+	}
+	if geminiImageModel(config.Model) {
+		payload["generationConfig"] = map[string]interface{}{"responseModalities": []string{"TEXT", "IMAGE"}}
+	}
+
+	httpResp, err := postStream(config, url, payload, nil)
+	if err != nil {
+		return Response{}, err
+	}
+	defer httpResp.Body.Close()
+
+	var text, thinking strings.Builder
+	var last map[string]interface{}
+	var usage *Usage
+	var images []Image
+	model := config.Model
+	err = readSSE(httpResp.Body, func(_, data string) error {
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if candidates, ok := chunk["candidates"].([]interface{}); ok && len(candidates) > 0 {
+			last, _ = candidates[0].(map[string]interface{})
+			content, _ := last["content"].(map[string]interface{})
+			parts, _ := content["parts"].([]interface{})
+			for _, p := range decodeGemini(parts) {
+				switch p.Type {
+				case "thinking":
+					thinking.WriteString(p.Text)
+				case "text":
+					if p.Text != "" {
+						text.WriteString(p.Text)
+						onDelta(p.Text)
+					}
+				case "image":
+					images = append(images, Image{MediaType: p.MediaType, Data: p.Data})
+				}
+			}
+		}
+		if v, ok := chunk["modelVersion"].(string); ok {
+			model = v
+		}
+		if u, ok := chunk["usageMetadata"].(map[string]interface{}); ok {
+			in, _ := u["promptTokenCount"].(float64)
+			out, _ := u["candidatesTokenCount"].(float64)
+			usage = &Usage{InputTokens: int(in), OutputTokens: int(out)}
+		}
+		return nil
+	})
+
+	// Grounding sources arrive with the final chunk and refer to offsets in
+	// the whole text.
+	resp := Response{Text: text.String()}
+	if last != nil {
+		resp = geminiCitations(text.String(), last)
+		resp.FinishReason, _ = last["finishReason"].(string)
+	}
+	resp.Thinking, resp.Usage, resp.Model, resp.Images = thinking.String(), usage, model, images
+	return resp, err
+}
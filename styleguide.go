@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// styleLintPrompt has a model check a text against a style guide.
+const styleLintPrompt = `You are a copy editor. Check the text below against the style guide and rewrite whatever breaks it: wording, tone, capitalisation, punctuation, headings, lists, whatever the guide covers. Change nothing the guide doesn't call for, keep the meaning, and leave code blocks, commands and quoted output exactly as they are.
+
+Return the full rewritten text, and one entry per change: the guide's rule it applies, the original passage and its replacement, each just long enough to find. When nothing breaks the guide, return the text unchanged and no changes.
+
+<style-guide>
+%s
+</style-guide>
+
+<text>
+%s
+</text>`
+
+// styleEdit is one change the style pass made.
+type styleEdit struct {
+	Rule   string `json:"rule"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+var styleSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"text", "changes"},
+	"properties": map[string]interface{}{
+		"text": map[string]interface{}{"type": "string"},
+		"changes": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"rule", "before", "after"},
+				"properties": map[string]interface{}{
+					"rule":   map[string]interface{}{"type": "string"},
+					"before": map[string]interface{}{"type": "string"},
+					"after":  map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	},
+}
+
+// loadStyleGuide reads the guide --style names.
+func loadStyleGuide(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("--style: %v", err)
+	}
+	guide := strings.TrimSpace(string(data))
+	if guide == "" {
+		return "", fmt.Errorf("--style: %s is empty", path)
+	}
+	return guide, nil
+}
+
+// applyStyleGuide has api rewrite text where it breaks guide, and returns
+// the rewritten text, the changes made and the usage of the pass.
+func applyStyleGuide(api APIConfig, guide, text string) (string, []styleEdit, *Usage, error) {
+	writeProgress("Checking the style guide...")
+	resp, err := sendRequest(api, Request{Prompt: fmt.Sprintf(styleLintPrompt, guide, text), Schema: styleSchema})
+	if err != nil {
+		return text, nil, resp.Usage, fmt.Errorf("style pass failed: %v", err)
+	}
+	var result struct {
+		Text    string      `json:"text"`
+		Changes []styleEdit `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(resp.Text), &result); err != nil || strings.TrimSpace(result.Text) == "" {
+		return text, nil, resp.Usage, fmt.Errorf("style pass gave no text back")
+	}
+	return strings.TrimSpace(result.Text), result.Changes, resp.Usage, nil
+}
+
+// reportStyleEdits lists the style pass's changes on stderr.
+func reportStyleEdits(edits []styleEdit) {
+	if len(edits) == 0 {
+		writeProgress("Style guide: no changes")
+		return
+	}
+	writeProgress(fmt.Sprintf("Style guide: %d changes", len(edits)))
+	for _, e := range edits {
+		writeProgress(fmt.Sprintf("  %s: %q -> %q", e.Rule, e.Before, e.After))
+	}
+}
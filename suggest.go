@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandNames lists the subcommands, for typo suggestions.
+var commandNames = []string{
+	"add", "list", "remove", "default", "smoke", "config", "translate",
+	"chart", "diagram", "openapi", "local", "embed", "index", "query",
+	"calc", "tokens", "rerank", "moderate", "context", "agent", "history", "serve",
+	"bookmark", "snippets", "edit", "fix", "commit", "sh", "explain", "explain-last", "gogen", "write", "shell-init", "undo", "sessions", "review",
+	"watch-dir", "usage", "template", "cache", "dash",
+}
+
+// suggest returns the options within a small edit distance of word,
+// closest first. The allowed distance grows with the word's length so short
+// words don't match everything.
+func suggest(word string, options []string) []string {
+	maxDist := len(word) / 3
+	if maxDist < 1 {
+		maxDist = 1
+	}
+
+	type match struct {
+		option string
+		dist   int
+	}
+	var matches []match
+	lower := strings.ToLower(word)
+	for _, option := range options {
+		if d := editDistance(lower, strings.ToLower(option)); d <= maxDist {
+			matches = append(matches, match{option, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].option < matches[j].option
+	})
+
+	result := make([]string, len(matches))
+	for i, m := range matches {
+		result[i] = m.option
+	}
+	return result
+}
+
+// didYouMean formats suggestions for an error message, or returns "" when
+// there are none.
+func didYouMean(word string, options []string) string {
+	matches := suggest(word, options)
+	if len(matches) == 0 {
+		return ""
+	}
+	if len(matches) > 3 {
+		matches = matches[:3]
+	}
+	return fmt.Sprintf("Did you mean %s?", strings.Join(quoteAll(matches), " or "))
+}
+
+func quoteAll(words []string) []string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = "'" + w + "'"
+	}
+	return quoted
+}
+
+// didYouMeanAPI suggests configured API names close to word, comparing
+// both the full names and the names without their "api:"/"local:" prefix.
+func didYouMeanAPI(config *Config, word string) string {
+	full := map[string]string{}
+	var options []string
+	for name := range config.APIs {
+		full[name] = name
+		options = append(options, name)
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			full[name[i+1:]] = name
+			options = append(options, name[i+1:])
+		}
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, match := range suggest(word, options) {
+		if name := full[match]; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	if len(names) > 3 {
+		names = names[:3]
+	}
+	return fmt.Sprintf("Did you mean %s?", strings.Join(quoteAll(names), " or "))
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment)
+// distance, so swapped letters ("lsit") count as one edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
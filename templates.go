@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Template is a reusable prompt. Besides the built-in ones, templates are
+// Markdown files in the templates directory next to the config, named
+// <name>.md, with optional front matter:
+//
+//	---
+//	description: Write a commit message for a diff
+//	example: ask api:claude --template commit --var diff=@staged.diff
+//	---
+//	Write a commit message for this diff, in the {{style|conventional}} style:
+//	{{diff}}
+//
+// {{name}} is a variable given with --var name=value, {{name|default}} one
+// that may be left out, and {{input}} the prompt text after the API.
+type Template struct {
+	Name        string
+	Description string
+	Example     string
+	Body        string
+	// Source is the file the template was read from, or says it's built
+	// in.
+	Source string
+}
+
+// templateVar is a variable a template's body uses.
+type templateVar struct {
+	Name    string
+	Default string
+	// Required is set when there's no default.
+	Required bool
+}
+
+// templatePlaceholder matches {{name}} and {{name|default}}.
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?:\|([^}]*))?\}\}`)
+
+func getTemplatesDir() string {
+	return filepath.Join(stateDir(), "templates")
+}
+
+// loadTemplates reads every template, the built-in ones and the user's,
+// sorted by name. A user template replaces the built-in one of its name.
+func loadTemplates() ([]Template, error) {
+	byName := map[string]Template{}
+	for name, text := range builtinTemplates {
+		t := parseTemplate(name, text)
+		t.Source = fmt.Sprintf("built-in (v%d)", builtinTemplatesVersion)
+		byName[name] = t
+	}
+
+	entries, err := os.ReadDir(getTemplatesDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".md" {
+			continue
+		}
+		path := filepath.Join(getTemplatesDir(), e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		t := parseTemplate(strings.TrimSuffix(e.Name(), ".md"), string(data))
+		t.Source = path
+		if _, ok := builtinTemplates[t.Name]; ok {
+			t.Source += ", in place of the built-in"
+		}
+		byName[t.Name] = t
+	}
+
+	templates := make([]Template, 0, len(byName))
+	for _, t := range byName {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// parseTemplate reads a template file: front matter of "key: value" lines
+// between --- lines, if any, then the body.
+func parseTemplate(name, text string) Template {
+	t := Template{Name: name, Body: text}
+	rest, ok := strings.CutPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "---\n")
+	if !ok {
+		return t
+	}
+	front, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return t
+	}
+	t.Body = strings.TrimLeft(body, "\n")
+	for _, line := range strings.Split(front, "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "description":
+			t.Description = value
+		case "example":
+			t.Example = value
+		}
+	}
+	return t
+}
+
+// findTemplate looks a template up by name.
+func findTemplate(name string) (Template, error) {
+	templates, err := loadTemplates()
+	if err != nil {
+		return Template{}, err
+	}
+	for _, t := range templates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	var names []string
+	for _, t := range templates {
+		names = append(names, t.Name)
+	}
+	if hint := didYouMean(name, names); hint != "" {
+		return Template{}, fmt.Errorf("no template named %s. %s", name, hint)
+	}
+	return Template{}, fmt.Errorf("no template named %s; see 'ask template list'", name)
+}
+
+// variables lists the variables t uses, in order of first use.
+func (t Template) variables() []templateVar {
+	var vars []templateVar
+	seen := map[string]bool{}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(t.Body, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		vars = append(vars, templateVar{Name: m[1], Default: strings.TrimSpace(m[2]), Required: !strings.Contains(m[0], "|")})
+	}
+	return vars
+}
+
+// render fills in t's variables. Input stands in for {{input}}, or is added
+// after the body when the template doesn't use it.
+func (t Template) render(vars map[string]string, input string) (string, error) {
+	if _, ok := vars["input"]; !ok && input != "" {
+		vars["input"] = input
+	}
+	var missing []string
+	for _, v := range t.variables() {
+		if _, ok := vars[v.Name]; !ok && v.Required {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s needs %s", t.Name, strings.Join(quoteVars(missing), ", "))
+	}
+
+	usesInput := false
+	text := templatePlaceholder.ReplaceAllStringFunc(t.Body, func(ref string) string {
+		m := templatePlaceholder.FindStringSubmatch(ref)
+		usesInput = usesInput || m[1] == "input"
+		if value, ok := vars[m[1]]; ok {
+			return value
+		}
+		return strings.TrimSpace(m[2])
+	})
+	text = strings.TrimSpace(text)
+	if !usesInput && input != "" {
+		text += "\n\n" + input
+	}
+	return text, nil
+}
+
+func quoteVars(names []string) []string {
+	var out []string
+	for _, n := range names {
+		if n == "input" {
+			out = append(out, "prompt text")
+		} else {
+			out = append(out, "--var "+n+"=...")
+		}
+	}
+	return out
+}
+
+// parseVars reads --var name=value flags. A value starting with @ names a
+// file to read it from.
+func parseVars(flags []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, f := range flags {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--var takes name=value, not %q", f)
+		}
+		if path, ok := strings.CutPrefix(value, "@"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			value = strings.TrimRight(string(data), "\n")
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// templatePrompt is the prompt --template name builds from the --var flags
+// and the prompt text.
+func templatePrompt(name string, varFlags []string, input string) (string, error) {
+	t, err := findTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	vars, err := parseVars(varFlags)
+	if err != nil {
+		return "", err
+	}
+	return t.render(vars, input)
+}
+
+// runTemplate handles "ask template [list | search <query> | show <name>]".
+func runTemplate(args []string) {
+	sub := "list"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	templates, err := loadTemplates()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	switch sub {
+	case "list":
+		for _, t := range templates {
+			fmt.Printf("%-24s %s\n", t.Name, t.Description)
+		}
+	case "search":
+		query := strings.Join(args[1:], " ")
+		if query == "" {
+			fmt.Println(`Usage: ask template search "<query>"`)
+			os.Exit(1)
+		}
+		matches := searchTemplates(templates, query)
+		if len(matches) == 0 {
+			fmt.Println("No matching templates.")
+			return
+		}
+		for i, t := range matches {
+			if i > 0 {
+				fmt.Println()
+			}
+			printTemplateSummary(t)
+		}
+	case "show":
+		if len(args) != 2 {
+			fmt.Println("Usage: ask template show <name>")
+			os.Exit(1)
+		}
+		t, err := findTemplate(args[1])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		printTemplateSummary(t)
+		fmt.Println()
+		fmt.Println(strings.TrimRight(t.Body, "\n"))
+	default:
+		fmt.Println(`Usage: ask template [list | search "<query>" | show <name>]`)
+		os.Exit(1)
+	}
+}
+
+// searchTemplates keeps the templates whose name, description, variables
+// or example fuzzy-match query, best match first. Bodies aren't searched:
+// a long prompt contains the letters of almost any query.
+func searchTemplates(templates []Template, query string) []Template {
+	type scored struct {
+		template Template
+		score    int
+	}
+	var matches []scored
+	for _, t := range templates {
+		var names []string
+		for _, v := range t.variables() {
+			names = append(names, v.Name)
+		}
+		// The name counts most, so it's scored on its own too.
+		score, ok := fuzzyScore(query, t.Name+" "+t.Description+" "+strings.Join(names, " ")+" "+t.Example)
+		if !ok {
+			continue
+		}
+		if s, ok := fuzzyScore(query, t.Name); ok {
+			score += 2 * s
+		}
+		matches = append(matches, scored{t, score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	result := make([]Template, len(matches))
+	for i, m := range matches {
+		result[i] = m.template
+	}
+	return result
+}
+
+// printTemplateSummary prints a template's name, description, variables
+// and example invocation.
+func printTemplateSummary(t Template) {
+	fmt.Printf("%s  %s\n", t.Name, t.Description)
+	var vars []string
+	for _, v := range t.variables() {
+		switch {
+		case v.Name == "input":
+			vars = append(vars, "input (the prompt text)")
+		case v.Required:
+			vars = append(vars, v.Name+" (required)")
+		default:
+			vars = append(vars, fmt.Sprintf("%s (default %q)", v.Name, v.Default))
+		}
+	}
+	if len(vars) > 0 {
+		fmt.Println("  variables: " + strings.Join(vars, ", "))
+	}
+	example := t.Example
+	if example == "" {
+		input := ""
+		example = "ask <api> --template " + t.Name
+		for _, v := range t.variables() {
+			if v.Name == "input" {
+				input = ` "<text>"`
+			} else if v.Required {
+				example += " --var " + v.Name + "=..."
+			}
+		}
+		example += input
+	}
+	fmt.Println("  example:   " + example)
+	source := "  " + t.Source
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		source = dim(source)
+	}
+	fmt.Println(source)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokenizer counts tokens the way a model does, for fitting prompts to its
+// context window and chunking what gets embedded.
+type Tokenizer interface {
+	// Name says which tokenizer it is, e.g. "o200k_base".
+	Name() string
+	// Count is the number of tokens text encodes to.
+	Count(text string) int
+}
+
+// estimator is the fallback for models whose tokenizer ask doesn't have:
+// about four characters per token.
+type estimator struct{}
+
+func (estimator) Name() string { return "estimate" }
+
+func (estimator) Count(text string) int { return estimateTokens(text) }
+
+// tiktokenEncodings are OpenAI's BPE encodings: where their vocabularies are
+// published, their SHA-256, and how they split text into pieces before
+// merging.
+var tiktokenEncodings = map[string]struct{ url, sha256, pattern string }{
+	"cl100k_base": {
+		"https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken",
+		"223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+		`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^{ws}\p{L}\p{N}]+[\r\n]*|[{ws}]*[\r\n]+|[{ws}]+`,
+	},
+	"o200k_base": {
+		"https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken",
+		"446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+			`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+			`\p{N}{1,3}| ?[^{ws}\p{L}\p{N}]+[\r\n/]*|[{ws}]*[\r\n]+|[{ws}]+`,
+	},
+}
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+// tokenizerRetryAfter is how long ask tokens leaves a vocabulary whose
+// download failed before trying it again by itself.
+const tokenizerRetryAfter = 24 * time.Hour
+
+// errNotDownloaded is loadTokenizer's error for a vocabulary that has yet
+// to be downloaded.
+var errNotDownloaded = errors.New("vocabulary not downloaded")
+
+// tokenizerFor returns the tokenizer for api's model: the entry's
+// tokenizer setting, or the one its model is known to use. It never
+// downloads, so prompts aren't held up: a vocabulary that isn't there yet
+// is estimated for until ask tokens fetches it. A tokenizer that can't be
+// loaded otherwise is reported once and replaced by the estimate.
+func tokenizerFor(api APIConfig) Tokenizer {
+	api = tokenizerAPI(api)
+	spec := tokenizerSpec(api)
+
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if tok, ok := tokenizers[spec]; ok {
+		return tok
+	}
+	tok, err := loadTokenizer(api, spec, false)
+	if err != nil {
+		if err != errNotDownloaded {
+			fmt.Fprintf(os.Stderr, "Warning: tokenizer %s unavailable, estimating tokens instead: %v\n", spec, err)
+		}
+		tok = estimator{}
+	}
+	tokenizers[spec] = tok
+	return tok
+}
+
+// tokenizerAPI is api with its settings expanded, as far as they matter for
+// its tokenizer.
+func tokenizerAPI(api APIConfig) APIConfig {
+	// Only the model matters here; picking a key would move its rotation
+	// on.
+	api.APIKeys = nil
+	if expanded, err := expandAPIConfig(api); err == nil {
+		api = expanded
+	}
+	return api
+}
+
+// tokenizerSpec is the tokenizer api's entry names, or the one its model
+// is known to use.
+func tokenizerSpec(api APIConfig) string {
+	if api.Tokenizer != "" {
+		return api.Tokenizer
+	}
+	return defaultTokenizer(api.Model)
+}
+
+// fetchTokenizer downloads the vocabulary of api's tokenizer if it has one
+// that isn't there yet. A failed download is recorded, and without force
+// isn't tried again for tokenizerRetryAfter.
+func fetchTokenizer(api APIConfig, force bool) error {
+	api = tokenizerAPI(api)
+	spec := tokenizerSpec(api)
+	name, _ := vocabSource(spec)
+	if name == "" {
+		return nil
+	}
+	failure := vocabFailurePath(name)
+	if info, err := os.Stat(failure); err == nil && !force && time.Since(info.ModTime()) < tokenizerRetryAfter {
+		reason, _ := os.ReadFile(failure)
+		return fmt.Errorf("the download failed %s ago (%s); retry with --download", time.Since(info.ModTime()).Round(time.Minute), strings.TrimSpace(string(reason)))
+	}
+	if _, err := loadTokenizer(api, spec, true); err != nil {
+		return err
+	}
+	tokenizersMu.Lock()
+	delete(tokenizers, spec)
+	tokenizersMu.Unlock()
+	return nil
+}
+
+// defaultTokenizer names the tokenizer model uses, as far as it's
+// published; Claude's and Gemini's aren't, so their counts are estimated.
+func defaultTokenizer(model string) string {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	hasPrefix := func(prefixes ...string) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(model, p) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case hasPrefix("gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"):
+		return "o200k_base"
+	case hasPrefix("gpt-4", "gpt-3.5", "text-embedding-3", "text-embedding-ada"):
+		return "cl100k_base"
+	}
+	return "estimate"
+}
+
+// loadTokenizer loads a tokenizer by its spec: "estimate", the name of a
+// tiktoken encoding, or "sentencepiece:" followed by the path or URL of a
+// SentencePiece model. Vocabularies not yet downloaded are fetched, through
+// api's transport, only with download set.
+func loadTokenizer(api APIConfig, spec string, download bool) (Tokenizer, error) {
+	if spec == "estimate" {
+		return estimator{}, nil
+	}
+	if enc, ok := tiktokenEncodings[spec]; ok {
+		data, err := vocabFile(api, spec+".tiktoken", enc.url, enc.sha256, download)
+		if err != nil {
+			return nil, err
+		}
+		return parseTiktoken(spec, data, enc.pattern)
+	}
+	if src, ok := strings.CutPrefix(spec, "sentencepiece:"); ok {
+		var data []byte
+		var err error
+		if name, remote := vocabSource(spec); name != "" {
+			data, err = vocabFile(api, name, remote, "", download)
+		} else {
+			if strings.HasPrefix(src, "~/") {
+				home, _ := os.UserHomeDir()
+				src = filepath.Join(home, src[2:])
+			}
+			data, err = os.ReadFile(src)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseSentencePiece(spec, data)
+	}
+	return nil, fmt.Errorf("unknown tokenizer (estimate, cl100k_base, o200k_base or sentencepiece:<path or URL>)")
+}
+
+func getTokenizersDir() string {
+	return filepath.Join(stateDir(), "tokenizers")
+}
+
+// vocabSource is the file a spec's vocabulary is cached as and the URL it's
+// downloaded from, or an empty name for specs that download nothing.
+func vocabSource(spec string) (name, src string) {
+	if enc, ok := tiktokenEncodings[spec]; ok {
+		return spec + ".tiktoken", enc.url
+	}
+	if src, ok := strings.CutPrefix(spec, "sentencepiece:"); ok && (strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")) {
+		sum := sha256.Sum256([]byte(src))
+		return hex.EncodeToString(sum[:8]) + ".model", src
+	}
+	return "", ""
+}
+
+// vocabFailurePath is where the last failed download of name is recorded.
+func vocabFailurePath(name string) string {
+	return filepath.Join(getTokenizersDir(), name+".failed")
+}
+
+// vocabFile returns the vocabulary cached as name, or errNotDownloaded
+// unless download is set, when it's fetched from src through api's
+// transport and checked against sum, if given. Hugging Face downloads send
+// $HF_TOKEN, which gated models such as Llama and Gemma need.
+func vocabFile(api APIConfig, name, src, sum string, download bool) ([]byte, error) {
+	path := filepath.Join(getTokenizersDir(), name)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+	if !download {
+		return nil, errNotDownloaded
+	}
+
+	fmt.Fprintf(os.Stderr, "Downloading tokenizer vocabulary from %s\n", src)
+	data, err := downloadVocab(api, src, sum)
+	if err := os.MkdirAll(getTokenizersDir(), 0700); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		os.WriteFile(vocabFailurePath(name), []byte(err.Error()+"\n"), 0600)
+		return nil, err
+	}
+	os.Remove(vocabFailurePath(name))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+	return data, os.Rename(tmp, path)
+}
+
+// downloadVocab fetches a vocabulary from src, checking it against sum if
+// one is given.
+func downloadVocab(api APIConfig, src, sum string) ([]byte, error) {
+	req, err := http.NewRequest("GET", src, nil)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(src); err == nil && strings.HasSuffix(u.Hostname(), "huggingface.co") && os.Getenv("HF_TOKEN") != "" {
+		req.Header.Set("Authorization", "Bearer "+os.Getenv("HF_TOKEN"))
+	}
+	transport, err := apiTransport(api)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport, Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("downloading %s: %s", src, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if sum != "" {
+		if got := sha256.Sum256(data); hex.EncodeToString(got[:]) != sum {
+			return nil, fmt.Errorf("%s doesn't match its published SHA-256", src)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runTokens handles `ask tokens <api> [--file path]... ["<prompt>"]`: it
+// counts the tokens the prompt and files come to for api's model, with
+// Claude's and Gemini's count endpoints, which know their tokenizers, or
+// the local tokenizer otherwise, and compares that with the context window.
+// The local tokenizer's vocabulary is downloaded here if need be, as
+// prompts only ever estimate without it; --download fetches it even after
+// a recent failure, and on its own does nothing else.
+func runTokens(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"file": true, "no-context": false, "local": false, "download": false})
+	onlyDownload := parsed != nil && parsed.has("download") && len(parsed.positional) == 1 && len(parsed.values("file")) == 0
+	if err != nil || len(parsed.positional) == 0 || (len(parsed.positional) == 1 && len(parsed.values("file")) == 0 && !onlyDownload) {
+		fmt.Println(`Usage: ask tokens <api-name> [--file <path>]... ["<prompt>"] [--no-context] [--local] [--download]`)
+		os.Exit(1)
+	}
+	apiName, api := resolveAPI(config, parsed.positional[0])
+	if onlyDownload {
+		if err := fetchTokenizer(api, true); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s counts tokens with %s\n", apiName, tokenizerFor(api).Name())
+		return
+	}
+
+	var b strings.Builder
+	for _, path := range parsed.values("file") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(&b, "%s\n```\n%s\n```\n\n", path, strings.TrimSuffix(string(data), "\n"))
+	}
+	b.WriteString(strings.Join(parsed.positional[1:], " "))
+	req := Request{Prompt: strings.TrimSpace(b.String())}
+	if !parsed.has("no-context") {
+		if err := applyProjectContext(config.Settings, &req); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	n, counter := 0, ""
+	if !parsed.has("local") {
+		n, counter, err = countTokensRemote(api, req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s couldn't count the tokens (%v); counting locally\n", apiName, err)
+		}
+	}
+	if counter == "" {
+		if err := fetchTokenizer(api, parsed.has("download")); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: tokenizer vocabulary unavailable, estimating tokens instead: %v\n", err)
+		}
+		n, counter = countTokens(api, req), tokenizerFor(api).Name()
+		if counter == "estimate" {
+			counter = "estimated"
+		}
+	}
+
+	window := contextWindow(api)
+	fmt.Printf("%d tokens (%s)\n", n, counter)
+	fmt.Printf("%d%% of %s's %d-token context window, %d left for the answer\n", n*100/window, apiName, window, max(window-n, 0))
+	if n > promptBudget(api) {
+		fmt.Fprintln(os.Stderr, tooLongWarning(apiName, api, n))
+		os.Exit(1)
+	}
+}
+
+// countTokens counts req's tokens with api's tokenizer: its text, plus the
+// few tokens each message's framing takes.
+func countTokens(api APIConfig, req Request) int {
+	tok := tokenizerFor(api)
+	n := 3
+	for _, m := range requestMessages(req) {
+		n += 4
+		for _, p := range m.Parts {
+			n += tok.Count(p.Text)
+		}
+	}
+	return n
+}
+
+// countTokensRemote asks the provider to count req's tokens, for providers
+// whose tokenizers aren't published. The counter is empty when api's
+// provider has no count endpoint.
+func countTokensRemote(api APIConfig, req Request) (int, string, error) {
+	api, err := expandAPIConfig(api)
+	if err != nil {
+		return 0, "", err
+	}
+	switch api.Provider {
+	case ProviderClaude:
+		system, messages := encodeClaude(requestMessages(req))
+		payload := map[string]interface{}{"model": api.Model, "messages": messages}
+		if system != "" {
+			payload["system"] = system
+		}
+		result, err := postJSON(api, api.BaseURL+"/messages/count_tokens", payload, claudeHeaders(api))
+		if err != nil {
+			return 0, "", err
+		}
+		n, _ := result["input_tokens"].(float64)
+		return int(n), "counted by Anthropic", nil
+	case ProviderGemini:
+		system, contents := encodeGemini(requestMessages(req))
+		inner := map[string]interface{}{"model": "models/" + api.Model, "contents": contents}
+		if system != nil {
+			inner["systemInstruction"] = system
+		}
+		url := fmt.Sprintf("%s/models/%s:countTokens?key=%s", api.BaseURL, api.Model, api.APIKey)
+		result, err := postJSON(api, url, map[string]interface{}{"generateContentRequest": inner}, nil)
+		if err != nil {
+			return 0, "", err
+		}
+		n, _ := result["totalTokens"].(float64)
+		return int(n), "counted by Gemini", nil
+	}
+	return 0, "", nil
+}
+
+// warnIfTooLong warns on stderr when req won't fit api's context window
+// with room for an answer, going by the local count.
+func warnIfTooLong(apiName string, api APIConfig, req Request) {
+	if n := countTokens(api, req); n > promptBudget(api) {
+		fmt.Fprintln(os.Stderr, tooLongWarning(apiName, api, n))
+	}
+}
+
+func tooLongWarning(apiName string, api APIConfig, n int) string {
+	return fmt.Sprintf("Warning: the prompt is about %d tokens, more than %s can take in with room for an answer (%d of its %d-token context window); it may be rejected or cut off.",
+		n, apiName, promptBudget(api), contextWindow(api))
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// maxToolRounds bounds how many times the model may call tools before it
+// has to answer, unless the request sets its own limit.
+const maxToolRounds = 10
+
+// Tool is a function the model may call while answering.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters map[string]interface{}
+	// Run runs the tool; ctx is cancelled when the request is.
+	Run func(ctx context.Context, args map[string]interface{}) (string, error)
+}
+
+// toolCall is one call the model asked for.
+type toolCall struct {
+	ID   string
+	Name string
+	Args map[string]interface{}
+}
+
+// toolTurn is one reply of the model in a tool conversation.
+type toolTurn struct {
+	Text string
+	// Thinking is the model's visible reasoning, where the provider
+	// returns it.
+	Thinking string
+	Calls    []toolCall
+	// Usage is the turn's token count, when the provider reports it.
+	Usage *Usage
+}
+
+// ToolStep is a turn in which the model called tools, with their results.
+type ToolStep struct {
+	Thinking string
+	Text     string
+	Calls    []toolCall
+	Results  []string
+}
+
+// toolChat is a conversation with one provider in which the model may call
+// tools. send posts the conversation so far and records the model's turn;
+// addResults answers the calls it made.
+type toolChat interface {
+	send() (toolTurn, error)
+	addResults(calls []toolCall, results []string)
+}
+
+// sendWithTools answers req, running the tools (req.Tools) the model calls
+// and feeding their results back until it gives a final answer. onCall, if
+// set, is told about every call as it completes. The response's Steps record
+// every round of calls.
+func sendWithTools(api APIConfig, req Request, onCall func(call toolCall, result string)) (resp Response, err error) {
+	api, done := beginRequest(api)
+	defer done()
+	defer func(ctx context.Context) { err = interruptedErr(ctx, err) }(api.ctx)
+	if len(api.fallbacks) > 0 || len(api.APIKeys) > 1 {
+		// Tools the model already called have had their effect; only a
+		// loop that failed before running any starts over elsewhere.
+		return failover(api, func(api APIConfig) (Response, error) { return sendWithTools(api, req, onCall) },
+			func(resp Response) bool { return len(resp.Steps) == 0 })
+	}
+	api, err = expandAPIConfig(api)
+	if err != nil {
+		return Response{}, err
+	}
+	defer func() { recordUsage(api, req, resp) }()
+
+	var chat toolChat
+	switch api.Provider {
+	case ProviderOpenAI, ProviderLocalOpenAI:
+		chat, err = newOpenAIToolChat(api, req)
+	case ProviderClaude:
+		chat = newClaudeToolChat(api, req)
+	case ProviderGemini:
+		chat = newGeminiToolChat(api, req)
+	case ProviderLocal:
+		chat = newOllamaToolChat(api, req)
+	default:
+		return Response{}, fmt.Errorf("%s does not support tool calling", api.Provider)
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	rounds := req.MaxToolRounds
+	if rounds <= 0 {
+		rounds = maxToolRounds
+	}
+	// Every round resends the conversation, so the usage is the sum, and
+	// the budget is checked against it before each one: the ledger only
+	// hears of the loop once it's over.
+	var steps []ToolStep
+	var usage *Usage
+	input := 0
+	if hasBudget(api) {
+		input = countTokens(api, req)
+	}
+	for round := 0; round < rounds; round++ {
+		if err := checkUsage(api, *usage.add(&Usage{InputTokens: input})); err != nil {
+			return Response{Steps: steps, Usage: usage}, err
+		}
+		turn, err := chat.send()
+		if err != nil {
+			return Response{Steps: steps, Usage: usage}, err
+		}
+		usage = usage.add(turn.Usage)
+		if len(turn.Calls) == 0 {
+			return Response{Text: turn.Text, Thinking: turn.Thinking, Steps: steps, Usage: usage}, nil
+		}
+
+		results := make([]string, len(turn.Calls))
+		for i, call := range turn.Calls {
+			results[i] = runTool(api.ctx, req.Tools, call)
+			if onCall != nil {
+				onCall(call, results[i])
+			}
+		}
+		chat.addResults(turn.Calls, results)
+		steps = append(steps, ToolStep{Thinking: turn.Thinking, Text: turn.Text, Calls: turn.Calls, Results: results})
+	}
+	return Response{Steps: steps, Usage: usage}, fmt.Errorf("no answer after %d rounds of tool calls", rounds)
+}
+
+// runTool runs the tool call names. Failures are reported back to the model
+// as the result so it can correct itself.
+func runTool(ctx context.Context, tools []Tool, call toolCall) string {
+	for _, tool := range tools {
+		if tool.Name == call.Name {
+			result, err := tool.Run(ctx, call.Args)
+			if err != nil {
+				return "error: " + err.Error()
+			}
+			return result
+		}
+	}
+	return fmt.Sprintf("error: no tool named %q", call.Name)
+}
+
+// openAITools describes tools in the OpenAI (and Ollama) format.
+func openAITools(tools []Tool) []map[string]interface{} {
+	var list []map[string]interface{}
+	for _, t := range tools {
+		list = append(list, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
+	}
+	return list
+}
+
+// conversation is the provider-neutral state of a tool chat. Each chat
+// encodes it for its provider on every send, so the model's turns and the
+// tool results are kept the same way whoever answers.
+type conversation struct {
+	messages []Message
+}
+
+// addTurn records the model's reply and returns it as a turn.
+func (c *conversation) addTurn(parts []Part) toolTurn {
+	c.messages = append(c.messages, Message{Role: "assistant", Parts: parts})
+	return turnFromParts(parts)
+}
+
+func (c *conversation) addResults(calls []toolCall, results []string) {
+	c.messages = append(c.messages, resultsMessage(calls, results))
+}
+
+type openAIToolChat struct {
+	conversation
+	config  APIConfig
+	headers map[string]string
+	model   string
+	tools   []map[string]interface{}
+}
+
+func newOpenAIToolChat(config APIConfig, req Request) (*openAIToolChat, error) {
+	headers := openAIHeaders(config)
+	model, err := openAIModel(config, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &openAIToolChat{
+		conversation: conversation{requestMessages(req)},
+		config:       config,
+		headers:      headers,
+		model:        model,
+		tools:        openAITools(req.Tools),
+	}, nil
+}
+
+func (c *openAIToolChat) send() (toolTurn, error) {
+	result, err := postJSON(c.config, c.config.BaseURL+"/chat/completions", map[string]interface{}{
+		"model":    c.model,
+		"messages": encodeOpenAI(c.messages),
+		"tools":    c.tools,
+	}, c.headers)
+	if err != nil {
+		return toolTurn{}, err
+	}
+
+	choices, _ := result["choices"].([]interface{})
+	if len(choices) == 0 {
+		return toolTurn{}, nil
+	}
+	message, _ := choices[0].(map[string]interface{})["message"].(map[string]interface{})
+	turn := c.addTurn(decodeOpenAI(message))
+	turn.Usage = openAIUsage(result)
+	return turn, nil
+}
+
+type claudeToolChat struct {
+	conversation
+	config APIConfig
+	tools  []map[string]interface{}
+}
+
+func newClaudeToolChat(config APIConfig, req Request) *claudeToolChat {
+	c := &claudeToolChat{conversation: conversation{requestMessages(req)}, config: config}
+	for _, t := range req.Tools {
+		c.tools = append(c.tools, map[string]interface{}{
+			"name":         t.Name,
+			"description":  t.Description,
+			"input_schema": t.Parameters,
+		})
+	}
+	return c
+}
+
+func (c *claudeToolChat) send() (toolTurn, error) {
+	system, messages := encodeClaude(c.messages)
+	payload := map[string]interface{}{
+		"model":      c.config.Model,
+		"messages":   messages,
+		"tools":      c.tools,
+		"max_tokens": 4096,
+	}
+	if system != "" {
+		payload["system"] = system
+	}
+	result, err := postJSON(c.config, c.config.BaseURL+"/messages", payload, claudeHeaders(c.config))
+	if err != nil {
+		return toolTurn{}, err
+	}
+
+	content, _ := result["content"].([]interface{})
+	turn := c.addTurn(decodeClaude(content))
+	turn.Usage = claudeUsage(result)
+	return turn, nil
+}
+
+type geminiToolChat struct {
+	conversation
+	config APIConfig
+	tools  []map[string]interface{}
+}
+
+func newGeminiToolChat(config APIConfig, req Request) *geminiToolChat {
+	var decls []map[string]interface{}
+	for _, t := range req.Tools {
+		decls = append(decls, map[string]interface{}{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		})
+	}
+	return &geminiToolChat{
+		conversation: conversation{requestMessages(req)},
+		config:       config,
+		tools:        []map[string]interface{}{{"functionDeclarations": decls}},
+	}
+}
+
+func (c *geminiToolChat) send() (toolTurn, error) {
+	system, contents := encodeGemini(c.messages)
+	payload := map[string]interface{}{
+		"contents": contents,
+		"tools":    c.tools,
+	}
+	if system != nil {
+		payload["system_instruction"] = system
+	}
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.config.BaseURL, c.config.Model, c.config.APIKey)
+	result, err := postJSON(c.config, url, payload, nil)
+	if err != nil {
+		return toolTurn{}, err
+	}
+
+	candidates, _ := result["candidates"].([]interface{})
+	if len(candidates) == 0 {
+		return toolTurn{}, nil
+	}
+	content, _ := candidates[0].(map[string]interface{})["content"].(map[string]interface{})
+	parts, _ := content["parts"].([]interface{})
+	turn := c.addTurn(decodeGemini(parts))
+	turn.Usage = geminiUsage(result)
+	return turn, nil
+}
+
+type ollamaToolChat struct {
+	conversation
+	config APIConfig
+	tools  []map[string]interface{}
+}
+
+func newOllamaToolChat(config APIConfig, req Request) *ollamaToolChat {
+	return &ollamaToolChat{conversation: conversation{requestMessages(req)}, config: config, tools: openAITools(req.Tools)}
+}
+
+func (c *ollamaToolChat) send() (toolTurn, error) {
+	payload := ollamaChatPayload(c.config, encodeOllama(c.messages))
+	payload["tools"] = c.tools
+	payload["stream"] = false
+
+	resp, err := ollamaPost(c.config, "/api/chat", payload)
+	if err != nil {
+		return toolTurn{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Message         map[string]interface{} `json:"message"`
+		PromptEvalCount int                    `json:"prompt_eval_count"`
+		EvalCount       int                    `json:"eval_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return toolTurn{}, err
+	}
+	turn := c.addTurn(decodeOllama(result.Message))
+	turn.Usage = &Usage{InputTokens: result.PromptEvalCount, OutputTokens: result.EvalCount}
+	return turn, nil
+}
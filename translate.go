@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// isTranslationProvider reports whether provider is a dedicated machine
+// translation service rather than a chat model.
+func isTranslationProvider(provider string) bool {
+	return provider == ProviderDeepL || provider == ProviderGoogleMT
+}
+
+// runTranslate translates text with a dedicated MT provider when one is
+// configured, falling back to an LLM when none is or when it fails.
+func runTranslate(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"via": true, "api": true})
+	if err != nil || len(parsed.positional) < 1 {
+		fmt.Println("Usage: ask translate <target-lang> [\"<text>\"] [--via <api-name>] [--api <chat-api>]")
+		os.Exit(1)
+	}
+
+	target := parsed.positional[0]
+	text := strings.Join(parsed.positional[1:], " ")
+	if text == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("Error reading stdin:", err)
+			os.Exit(1)
+		}
+		text = strings.TrimSpace(string(data))
+	}
+	if text == "" {
+		fmt.Println("Nothing to translate.")
+		os.Exit(1)
+	}
+
+	glossary, err := projectGlossary()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	// A bad --api is reported before anything is translated; otherwise the
+	// chat model is only looked for when it's needed.
+	var chat *APIConfig
+	if parsed.has("api") {
+		chat = translationChatAPI(config, parsed.value("api", ""))
+	}
+
+	var route []string
+	if via := parsed.value("via", ""); via != "" {
+		route = []string{via}
+	} else {
+		for name, api := range config.APIs {
+			if isTranslationProvider(api.Provider) {
+				route = append(route, name)
+			}
+		}
+		sort.Strings(route)
+	}
+
+	for _, name := range route {
+		api, exists := config.APIs[name]
+		if !exists {
+			fmt.Printf("API '%s' not configured. Use 'ask add %s' to add it.\n", name, name)
+			os.Exit(1)
+		}
+
+		translated, err := translateWith(api, target, text, glossary)
+		if err == nil {
+			if glossary != nil && chat == nil {
+				chat = translationChatAPI(config, "")
+			}
+			printTranslation(chat, glossary, target, text, translated)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+	}
+
+	if len(route) == 1 && parsed.has("via") {
+		os.Exit(1)
+	}
+
+	// No MT provider worked; let a chat model do it.
+	if chat == nil {
+		chat = translationChatAPI(config, "")
+	}
+	if chat == nil {
+		fmt.Println("Error: no chat API to translate with; pass --api <api-name> or use 'ask default <api-name>'")
+		os.Exit(1)
+	}
+	translated, err := translateWith(*chat, target, text, glossary)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	printTranslation(chat, glossary, target, text, translated)
+}
+
+// translationChatAPI returns the chat model that translates when no MT
+// provider can, and corrects terms to the glossary: the one --api names,
+// else the default, else the only chat API configured. It returns nil when
+// none of them is a chat model; only a bad --api exits.
+func translationChatAPI(config *Config, spec string) *APIConfig {
+	explicit := spec != ""
+	if spec = apiSpecOrDefault(config, spec); spec == "" {
+		return nil
+	}
+	if !explicit && !resolvesAPI(config, spec) {
+		return nil
+	}
+	_, api := resolveAPI(config, spec)
+	if isTranslationProvider(api.Provider) {
+		if explicit {
+			fmt.Printf("Error: --api takes a chat API; %s is a translation provider (see --via)\n", spec)
+			os.Exit(1)
+		}
+		return nil
+	}
+	return &api
+}
+
+// printTranslation prints translated, first having chat correct any terms
+// the glossary renders differently. Without a chat model the translation is
+// printed as it is, with a warning.
+func printTranslation(chat *APIConfig, glossary *Glossary, target, text, translated string) {
+	if glossary != nil && chat == nil {
+		fmt.Fprintln(os.Stderr, "Warning: no chat API to check the glossary with (pass --api or set a default); printing the translation unchecked")
+	} else if glossary != nil {
+		var left []glossaryViolation
+		translated, _, left = enforceGlossary(*chat, glossary, translated, text, target)
+		reportGlossary(left)
+	}
+	fmt.Println(translated)
+}
+
+// translateWith translates text into the target language using api, which
+// may be an MT provider or a chat model. A chat model is also given the
+// glossary's terms, if there is one.
+func translateWith(api APIConfig, target, text string, glossary *Glossary) (string, error) {
+	api, err := expandAPIConfig(api)
+	if err != nil {
+		return "", err
+	}
+	if isTranslationProvider(api.Provider) {
+		return translateMT(api, target, text)
+	}
+
+	prompt := fmt.Sprintf("Translate the following text into %s. Reply with the translation only.\n\n%s", target, text)
+	if glossary != nil {
+		prompt = glossary.prompt(target) + "\n\n" + prompt
+	}
+	return sendPrompt(api, prompt)
+}
+
+// translateMT translates text with api's MT provider, which bills by the
+// character, within api's budget.
+func translateMT(api APIConfig, target, text string) (string, error) {
+	chars := utf8.RuneCountInString(text)
+	cost := translationCost(api.Provider, chars)
+	if err := checkCost(api, api.Provider, cost, true); err != nil {
+		return "", err
+	}
+	call := callDeepL
+	if api.Provider == ProviderGoogleMT {
+		call = callGoogleTranslate
+	}
+	translated, err := call(api, target, text)
+	if err != nil {
+		return "", err
+	}
+	recordSpend(api, api.Provider, LedgerEntry{Characters: chars}, cost, true)
+	return translated, nil
+}
+
+func callDeepL(config APIConfig, target, text string) (string, error) {
+	payload := map[string]interface{}{
+		"text":        []string{text},
+		"target_lang": strings.ToUpper(target),
+	}
+
+	result, err := postJSON(config, config.BaseURL+"/translate", payload, map[string]string{
+		"Authorization": "DeepL-Auth-Key " + config.APIKey,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if translations, ok := result["translations"].([]interface{}); ok && len(translations) > 0 {
+		if text, ok := translations[0].(map[string]interface{})["text"].(string); ok {
+			return text, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected response from DeepL")
+}
+
+func callGoogleTranslate(config APIConfig, target, text string) (string, error) {
+	payload := map[string]interface{}{
+		"q":      text,
+		"target": strings.ToLower(target),
+		"format": "text",
+	}
+
+	result, err := postJSON(config, config.BaseURL+"?key="+config.APIKey, payload, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if data, ok := result["data"].(map[string]interface{}); ok {
+		if translations, ok := data["translations"].([]interface{}); ok && len(translations) > 0 {
+			if text, ok := translations[0].(map[string]interface{})["translatedText"].(string); ok {
+				return text, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unexpected response from Google Translate")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// apiTransport returns a transport for requests to api. It goes through
+// api's proxy when the entry sets one, "none" going direct, and otherwise
+// through the one HTTP_PROXY, HTTPS_PROXY and NO_PROXY name, if any. TLS
+// follows the entry's CA, client certificate and verification settings.
+func apiTransport(api APIConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	spec, err := expandEnv(api.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %v", err)
+	}
+	switch spec {
+	case "":
+	case "none":
+		transport.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(spec)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("proxy: %q is not a URL such as http://proxy:8080 or socks5://proxy:1080", spec)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy: unsupported scheme %q (use http, https or socks5)", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if transport.TLSClientConfig, err = apiTLSConfig(api); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// insecureWarnings remembers the entries already warned about skipping
+// certificate verification, to warn once per run.
+var insecureWarnings sync.Map
+
+// apiTLSConfig returns the TLS settings for api, or nil for the defaults:
+// the system's CAs, no client certificate.
+func apiTLSConfig(api APIConfig) (*tls.Config, error) {
+	if api.CACert == "" && api.ClientCert == "" && api.ClientKey == "" && api.ClientCertStore == "" && !api.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{}
+
+	if api.CACert != "" {
+		pem, err := readTLSFile(api.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("ca_cert: %v", err)
+		}
+		// The CA is added to the system's, so a gateway behind a private CA
+		// and a public endpoint it redirects to both verify.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert: no PEM certificates in %s", api.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	cert, err := clientCertificate(api)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+
+	if api.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+		name := api.name
+		if name == "" {
+			name = api.BaseURL
+		}
+		if _, warned := insecureWarnings.LoadOrStore(name, true); !warned {
+			fmt.Fprintf(os.Stderr, "Warning: %s skips TLS certificate verification; anyone on the network path can read and change its traffic. Set ca_cert instead.\n", name)
+		}
+	}
+	return config, nil
+}
+
+// readTLSFile reads a certificate or key file named in the config, which
+// may reference environment variables or start with ~/.
+func readTLSFile(path string) ([]byte, error) {
+	path, err := expandEnv(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[2:])
+	}
+	return os.ReadFile(path)
+}
+
+// setAPIHeaders adds the entry's own headers to req, after the provider's
+// so they can override them. Values may reference environment variables.
+func setAPIHeaders(req *http.Request, api APIConfig) error {
+	for k, v := range api.Headers {
+		value, err := expandEnv(v)
+		if err != nil {
+			return fmt.Errorf("headers.%s: %v", k, err)
+		}
+		req.Header.Set(k, value)
+	}
+	return nil
+}
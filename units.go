@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dims are the powers of the base dimensions a unit is made of: length,
+// mass, time, temperature, current and information.
+type dims [6]int
+
+var (
+	dLength      = dims{1}
+	dMass        = dims{0, 1}
+	dTime        = dims{0, 0, 1}
+	dTemperature = dims{0, 0, 0, 1}
+	dCurrent     = dims{0, 0, 0, 0, 1}
+	dData        = dims{0, 0, 0, 0, 0, 1}
+)
+
+var dimNames = [6]string{"length", "mass", "time", "temperature", "current", "data"}
+
+func (d dims) add(o dims, times int) dims {
+	for i := range d {
+		d[i] += o[i] * times
+	}
+	return d
+}
+
+// unit converts to SI base units as value*factor + offset. Only absolute
+// temperature scales have an offset.
+type unit struct {
+	factor *big.Rat
+	offset *big.Rat
+	dims   dims
+}
+
+func rat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic("bad unit factor " + s)
+	}
+	return r
+}
+
+func mkUnit(factor string, d dims) unit {
+	return unit{factor: rat(factor), dims: d}
+}
+
+func derived(factor string, parts ...dims) unit {
+	var d dims
+	for _, p := range parts {
+		d = d.add(p, 1)
+	}
+	return mkUnit(factor, d)
+}
+
+var (
+	dVolume   = dims{3}
+	dArea     = dims{2}
+	dSpeed    = dims{1, 0, -1}
+	dForce    = dims{1, 1, -2}
+	dEnergy   = dims{2, 1, -2}
+	dPower    = dims{2, 1, -3}
+	dPressure = dims{-1, 1, -2}
+	dFreq     = dims{0, 0, -1}
+)
+
+// units are the known unit symbols. Those in prefixable also take SI
+// prefixes (km, mg, GB, kWh...).
+var units = map[string]unit{
+	"m": mkUnit("1", dLength), "in": mkUnit("0.0254", dLength), "ft": mkUnit("0.3048", dLength),
+	"yd": mkUnit("0.9144", dLength), "mi": mkUnit("1609.344", dLength), "nmi": mkUnit("1852", dLength),
+	"au": mkUnit("149597870700", dLength), "ly": mkUnit("9460730472580800", dLength),
+
+	"g": mkUnit("1/1000", dMass), "t": mkUnit("1000", dMass), "lb": mkUnit("0.45359237", dMass),
+	"oz": mkUnit("0.028349523125", dMass), "st": mkUnit("6.35029318", dMass),
+
+	"s": mkUnit("1", dTime), "min": mkUnit("60", dTime), "h": mkUnit("3600", dTime),
+	"day": mkUnit("86400", dTime), "week": mkUnit("604800", dTime), "year": mkUnit("31557600", dTime),
+
+	"K": mkUnit("1", dTemperature),
+	"C": {factor: rat("1"), offset: rat("273.15"), dims: dTemperature},
+	"F": {factor: rat("5/9"), offset: rat("45967/180"), dims: dTemperature},
+
+	"A": mkUnit("1", dCurrent),
+
+	"bit": mkUnit("1", dData), "B": mkUnit("8", dData),
+
+	"L": mkUnit("1/1000", dVolume), "gal": mkUnit("0.003785411784", dVolume),
+	"qt": mkUnit("0.000946352946", dVolume), "pt": mkUnit("0.000473176473", dVolume),
+	"cup": mkUnit("0.0002365882365", dVolume), "floz": mkUnit("0.0000295735295625", dVolume),
+
+	"ha": mkUnit("10000", dArea), "acre": mkUnit("4046.8564224", dArea),
+
+	"mph": derived("0.44704", dSpeed), "kph": derived("5/18", dSpeed), "kn": derived("463/900", dSpeed),
+
+	"N": derived("1", dForce), "lbf": derived("4.4482216152605", dForce),
+	"J": derived("1", dEnergy), "cal": derived("4.184", dEnergy), "Wh": derived("3600", dEnergy),
+	"eV": derived("1.602176634e-19", dEnergy), "BTU": derived("1055.05585262", dEnergy),
+	"W": derived("1", dPower), "hp": derived("745.69987158227022", dPower),
+	"Pa": derived("1", dPressure), "bar": derived("100000", dPressure), "atm": derived("101325", dPressure),
+	"psi": derived("6894.757293168361", dPressure), "mmHg": derived("133.322387415", dPressure),
+	"Hz": derived("1", dFreq),
+}
+
+var prefixable = map[string]bool{
+	"m": true, "g": true, "s": true, "L": true, "A": true, "bit": true, "B": true,
+	"N": true, "J": true, "cal": true, "Wh": true, "eV": true, "W": true, "Pa": true, "Hz": true,
+}
+
+var prefixes = map[string]string{
+	"P": "1e15", "T": "1e12", "G": "1e9", "M": "1e6", "k": "1e3", "h": "1e2", "d": "1e-1",
+	"c": "1e-2", "m": "1e-3", "u": "1e-6", "µ": "1e-6", "n": "1e-9",
+	"Ki": "1024", "Mi": "1048576", "Gi": "1073741824", "Ti": "1099511627776",
+}
+
+// unitAliases maps spelled-out and alternative names to unit symbols.
+var unitAliases = map[string]string{
+	"meter": "m", "metre": "m", "inch": "in", "foot": "ft", "feet": "ft", "yard": "yd", "mile": "mi",
+	"gram": "g", "kilogram": "kg", "kilo": "kg", "tonne": "t", "pound": "lb", "lbs": "lb", "ounce": "oz", "stone": "st",
+	"second": "s", "sec": "s", "minute": "min", "hour": "h", "hr": "h", "d": "day", "days": "day",
+	"wk": "week", "yr": "year",
+	"kelvin": "K", "celsius": "C", "°c": "C", "degc": "C", "℃": "C", "fahrenheit": "F", "°f": "F", "degf": "F", "℉": "F",
+	"byte": "B", "liter": "L", "litre": "L", "l": "L", "ml": "mL", "gallon": "gal", "quart": "qt", "pint": "pt",
+	"fl oz": "floz", "kmh": "kph", "km/h": "kph", "knot": "kn", "kt": "kn",
+	"kilometer": "km", "kilometre": "km", "centimeter": "cm", "millimeter": "mm",
+	"calorie": "cal", "joule": "J", "watt": "W", "newton": "N", "pascal": "Pa", "hertz": "Hz", "amp": "A",
+}
+
+// parseUnit reads a unit expression such as "km/h", "kg*m/s^2", "m²" or
+// "miles per hour" into a single unit.
+func parseUnit(expr string) (unit, error) {
+	s := strings.TrimSpace(expr)
+	if alias, ok := unitAliases[strings.ToLower(s)]; ok {
+		s = alias
+	}
+	s = strings.NewReplacer(" per ", "/", "²", "^2", "³", "^3", "·", "*").Replace(s)
+
+	result := unit{factor: big.NewRat(1, 1)}
+	for i, side := range strings.Split(s, "/") {
+		sign := 1
+		if i > 0 {
+			sign = -1
+		}
+		for _, factor := range strings.FieldsFunc(side, func(r rune) bool { return r == '*' || r == ' ' }) {
+			u, exp, err := parseUnitFactor(factor)
+			if err != nil {
+				return unit{}, err
+			}
+			exp *= sign
+			if u.offset != nil {
+				if len(s) != len(factor) || exp != 1 {
+					return unit{}, fmt.Errorf("%s can't be combined with other units", factor)
+				}
+				return u, nil
+			}
+			for n := 0; n < abs(exp); n++ {
+				if exp > 0 {
+					result.factor.Mul(result.factor, u.factor)
+				} else {
+					result.factor.Quo(result.factor, u.factor)
+				}
+			}
+			result.dims = result.dims.add(u.dims, exp)
+		}
+	}
+	return result, nil
+}
+
+// parseUnitFactor reads one unit with an optional exponent ("s^-2", "m2").
+func parseUnitFactor(s string) (unit, int, error) {
+	exp := 1
+	if name, power, ok := strings.Cut(s, "^"); ok {
+		n, err := strconv.Atoi(power)
+		if err != nil {
+			return unit{}, 0, fmt.Errorf("bad exponent in %q", s)
+		}
+		s, exp = name, n
+	} else if i := strings.LastIndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }); i >= 0 && i < len(s)-1 {
+		exp, _ = strconv.Atoi(s[i+1:])
+		s = s[:i+1]
+	}
+
+	u, ok := lookupUnit(s)
+	if !ok {
+		return unit{}, 0, fmt.Errorf("unknown unit %q", s)
+	}
+	return u, exp, nil
+}
+
+func lookupUnit(name string) (unit, bool) {
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	if alias, ok := unitAliases[strings.ToLower(name)]; ok && alias != name {
+		return lookupUnit(alias)
+	}
+	// Plurals: "miles", "hours", "bytes".
+	if strings.HasSuffix(name, "s") && len(name) > 2 {
+		if u, ok := lookupUnit(strings.TrimSuffix(name, "s")); ok {
+			return u, true
+		}
+	}
+	for p, factor := range prefixes {
+		base := strings.TrimPrefix(name, p)
+		if base == name || !prefixable[base] {
+			continue
+		}
+		u := units[base]
+		return unit{factor: new(big.Rat).Mul(u.factor, rat(factor)), dims: u.dims}, true
+	}
+	return unit{}, false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func describeDims(d dims) string {
+	var parts []string
+	for i, n := range d {
+		switch {
+		case n == 1:
+			parts = append(parts, dimNames[i])
+		case n != 0:
+			parts = append(parts, fmt.Sprintf("%s^%d", dimNames[i], n))
+		}
+	}
+	if len(parts) == 0 {
+		return "dimensionless"
+	}
+	return strings.Join(parts, "·")
+}
+
+// convertUnits converts v from one unit expression to another.
+func convertUnits(v calcValue, from, to string) (calcValue, error) {
+	fu, err := parseUnit(from)
+	if err != nil {
+		return calcValue{}, err
+	}
+	tu, err := parseUnit(to)
+	if err != nil {
+		return calcValue{}, err
+	}
+	if fu.dims != tu.dims {
+		return calcValue{}, fmt.Errorf("can't convert %s (%s) to %s (%s)", from, describeDims(fu.dims), to, describeDims(tu.dims))
+	}
+
+	si := new(big.Rat).Mul(v.r, fu.factor)
+	if fu.offset != nil {
+		si.Add(si, fu.offset)
+	}
+	if tu.offset != nil {
+		si.Sub(si, tu.offset)
+	}
+	return calcValue{r: si.Quo(si, tu.factor), exact: v.exact}, nil
+}
+
+// currencySymbols maps symbols to ISO currency codes.
+var currencySymbols = map[string]string{
+	"$": "USD", "US$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY", "R$": "BRL", "₹": "INR", "C$": "CAD", "A$": "AUD",
+}
+
+// currencyCode returns the ISO code s names, if it looks like a currency.
+func currencyCode(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if code, ok := currencySymbols[s]; ok {
+		return code, true
+	}
+	if len(s) == 3 && strings.ToUpper(s) == s && strings.IndexFunc(s, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 {
+		return s, true
+	}
+	return "", false
+}
+
+const (
+	ratesURL = "https://open.er-api.com/v6/latest/USD"
+	ratesTTL = 12 * time.Hour
+)
+
+// exchangeRates are units of each currency per US dollar.
+type exchangeRates struct {
+	Fetched time.Time          `json:"fetched"`
+	Rates   map[string]float64 `json:"rates"`
+}
+
+func ratesCachePath() string {
+	return filepath.Join(stateDir(), "cache", "rates.json")
+}
+
+// loadRates returns exchange rates, from the cache when it's fresh (or
+// whenever offline is set) and otherwise from the network.
+func loadRates(offline bool) (*exchangeRates, error) {
+	cached := &exchangeRates{}
+	data, err := os.ReadFile(ratesCachePath())
+	haveCache := err == nil && json.Unmarshal(data, cached) == nil && len(cached.Rates) > 0
+	if haveCache && (offline || time.Since(cached.Fetched) < ratesTTL) {
+		return cached, nil
+	}
+	if offline {
+		return nil, fmt.Errorf("no cached exchange rates; run once without --offline to fetch them")
+	}
+
+	rates, err := fetchRates()
+	if err != nil {
+		if haveCache {
+			// Stale rates beat none.
+			return cached, nil
+		}
+		return nil, fmt.Errorf("fetching exchange rates: %v", err)
+	}
+	if data, err := json.Marshal(rates); err == nil {
+		os.MkdirAll(filepath.Dir(ratesCachePath()), 0700)
+		os.WriteFile(ratesCachePath(), data, 0600)
+	}
+	return rates, nil
+}
+
+func fetchRates() (*exchangeRates, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(ratesURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	var body struct {
+		Result string             `json:"result"`
+		Rates  map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Result != "success" || len(body.Rates) == 0 {
+		return nil, fmt.Errorf("unexpected response")
+	}
+	return &exchangeRates{Fetched: time.Now(), Rates: body.Rates}, nil
+}
+
+// convertTool returns the conversion tool the calculator offers alongside
+// calc. With offline set, currency conversion only uses cached rates.
+func convertTool(offline bool) Tool {
+	return Tool{
+		Name: "convert",
+		Description: "Convert a quantity between units or currencies. Units cover length, mass, time, temperature, " +
+			"volume, area, speed, force, energy, power, pressure, frequency and data sizes, with SI prefixes and " +
+			"compound units such as m/s, km/h, kWh or kg*m/s^2. Currencies are ISO codes (USD, EUR, BRL...) " +
+			"converted at current exchange rates. value may be an arithmetic expression.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"value": map[string]interface{}{"type": "string", "description": "The quantity, e.g. 34 or 1.5*60"},
+				"from":  map[string]interface{}{"type": "string", "description": "Unit or currency to convert from, e.g. mph"},
+				"to":    map[string]interface{}{"type": "string", "description": "Unit or currency to convert to, e.g. m/s"},
+			},
+			"required": []string{"value", "from", "to"},
+		},
+		Run: func(_ context.Context, args map[string]interface{}) (string, error) {
+			from, _ := args["from"].(string)
+			to, _ := args["to"].(string)
+			v, err := evalExpression(fmt.Sprint(args["value"]))
+			if err != nil {
+				return "", err
+			}
+
+			fromCode, fromIsCurrency := currencyCode(from)
+			toCode, toIsCurrency := currencyCode(to)
+			if _, known := lookupUnit(from); fromIsCurrency && toIsCurrency && !known {
+				rates, err := loadRates(offline)
+				if err != nil {
+					return "", err
+				}
+				fromRate, toRate := rates.Rates[fromCode], rates.Rates[toCode]
+				if fromRate == 0 || toRate == 0 {
+					return "", fmt.Errorf("no exchange rate for %s to %s", fromCode, toCode)
+				}
+				converted, err := approxValue(v.float() / fromRate * toRate)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%s %s (rates as of %s)", converted, toCode, rates.Fetched.Format("2006-01-02 15:04")), nil
+			}
+
+			converted, err := convertUnits(v, from, to)
+			if err != nil {
+				return "", err
+			}
+			return converted.String() + " " + to, nil
+		},
+	}
+}
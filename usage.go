@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// usageRow sums the ledger entries of one API, provider, model, key or
+// day.
+type usageRow struct {
+	Key          string  `json:"key"`
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	// Unpriced counts requests to models with no known price, which the
+	// cost leaves out.
+	Unpriced int `json:"unpriced"`
+	// Estimated counts requests whose tokens were counted locally.
+	Estimated int `json:"estimated"`
+}
+
+func (r *usageRow) add(e LedgerEntry) {
+	r.Requests++
+	r.InputTokens += e.InputTokens
+	r.OutputTokens += e.OutputTokens
+	if e.Cost != nil {
+		r.Cost += *e.Cost
+	} else {
+		r.Unpriced++
+	}
+	if e.Estimated {
+		r.Estimated++
+	}
+}
+
+// runUsage handles `ask usage [--since date] [--by api|provider|model|key|day]
+// [--json]`: requests, tokens and spend from the usage ledger.
+func runUsage(args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"since": true, "by": true, "json": false})
+	if err != nil || len(parsed.positional) > 0 {
+		fmt.Println("Usage: ask usage [--since 2024-01-01] [--by api|provider|model|key|day] [--json]")
+		os.Exit(1)
+	}
+	var since time.Time
+	if s := parsed.value("since", ""); s != "" {
+		if since, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			fmt.Println("Error: --since must be a date like 2024-01-01")
+			os.Exit(1)
+		}
+	}
+	by := parsed.value("by", "model")
+	keyOf := map[string]func(LedgerEntry) string{
+		"api":      func(e LedgerEntry) string { return e.API },
+		"provider": func(e LedgerEntry) string { return e.Provider },
+		"model":    func(e LedgerEntry) string { return e.Model },
+		"key": func(e LedgerEntry) string {
+			if e.Key == "" {
+				return e.API
+			}
+			return e.API + " " + e.Key
+		},
+		"day": func(e LedgerEntry) string { return e.Time.Local().Format("2006-01-02") },
+	}[by]
+	if keyOf == nil {
+		fmt.Println("Error: --by must be api, provider, model, key or day")
+		os.Exit(1)
+	}
+
+	rows := map[string]*usageRow{}
+	total := &usageRow{Key: "total"}
+	err = loadLedger(func(e LedgerEntry) {
+		if e.Cached || e.Time.Before(since) {
+			return
+		}
+		key := keyOf(e)
+		if key == "" {
+			key = "(unnamed)"
+		}
+		if rows[key] == nil {
+			rows[key] = &usageRow{Key: key}
+		}
+		rows[key].add(e)
+		total.add(e)
+	})
+	if err != nil {
+		fmt.Println("Error reading the usage ledger:", err)
+		os.Exit(1)
+	}
+
+	// Days read best in order; everything else biggest spender first.
+	sorted := make([]*usageRow, 0, len(rows))
+	for _, r := range rows {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if by != "day" && a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		if by != "day" && a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Key < b.Key
+	})
+
+	if parsed.has("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]interface{}{"by": by, "rows": sorted, "total": total})
+		return
+	}
+	if total.Requests == 0 {
+		fmt.Println("No usage recorded.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tREQUESTS\tINPUT\tOUTPUT\tCOST\n", map[string]string{"api": "API", "provider": "PROVIDER", "model": "MODEL", "key": "KEY", "day": "DAY"}[by])
+	for _, r := range append(sorted, total) {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", r.Key, r.Requests, usageTokens(r.InputTokens, r), usageTokens(r.OutputTokens, r), usageCost(r))
+	}
+	w.Flush()
+
+	if total.Estimated > 0 || total.Unpriced > 0 {
+		fmt.Println()
+	}
+	if total.Estimated > 0 {
+		fmt.Printf("~ %d of %d request(s) had their tokens counted locally; the provider didn't report them.\n", total.Estimated, total.Requests)
+	}
+	if total.Unpriced > 0 {
+		fmt.Printf("* %d request(s) went to models with no known price and aren't in the cost.\n", total.Unpriced)
+	}
+}
+
+// usageTokens shows a token count, marked when part of it is an estimate.
+func usageTokens(n int, r *usageRow) string {
+	if r.Estimated > 0 {
+		return fmt.Sprintf("~%d", n)
+	}
+	return fmt.Sprint(n)
+}
+
+// usageCost shows a row's cost, marked when some of its requests couldn't
+// be priced.
+func usageCost(r *usageRow) string {
+	switch {
+	case r.Unpriced == r.Requests:
+		return "unknown*"
+	case r.Unpriced > 0:
+		return formatDollars(r.Cost) + "*"
+	}
+	return formatDollars(r.Cost)
+}
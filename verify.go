@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// verifyPrompt asks a model to check a draft answer before it is shown.
+const verifyPrompt = `You are reviewing a draft answer before it is shown to the user. Check it against the question and any material attached or quoted in it. Fix factual errors, wrong numbers, claims the material doesn't support and mistakes in code or reasoning. Keep everything that is correct, along with the draft's format, tone and any citation markers or annotations.
+
+Reply with the corrected answer only, without commentary about what you changed. If nothing needs fixing, reply with the draft unchanged.
+
+<question>
+%s
+</question>
+
+<draft>
+%s
+</draft>`
+
+// verifyAnswer has the verifier API (or the one that answered, when none is
+// set) critique and correct draft, the answer to req.
+func verifyAnswer(config *Config, verifier string, apiConfig APIConfig, req Request, draft Response) (Response, error) {
+	if verifier != "" {
+		_, apiConfig = resolveAPI(config, verifier)
+	}
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s\n", dim("Verifying the answer..."))
+	}
+
+	check := Request{
+		Prompt:    fmt.Sprintf(verifyPrompt, req.Prompt, draft.Text),
+		Images:    req.Images,
+		Documents: req.Documents,
+	}
+	if len(check.Images) > 0 && !supportsImages(apiConfig.Provider) {
+		check.Images = nil
+	}
+	if len(check.Documents) > 0 && !supportsPDF(apiConfig.Provider) {
+		check.Documents = nil
+	}
+
+	resp, err := sendRequest(apiConfig, check)
+	if err != nil {
+		return draft, fmt.Errorf("verification failed: %v", err)
+	}
+	if len(resp.Citations) == 0 {
+		resp.Citations = draft.Citations
+	}
+	return resp, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchPrompt is a .json prompt file dropped into a watched directory.
+// Only prompt is required; api names a configured API exactly and
+// overrides --api for this prompt.
+type watchPrompt struct {
+	Prompt string `json:"prompt"`
+	System string `json:"system"`
+	API    string `json:"api"`
+	Model  string `json:"model"`
+}
+
+// watchedFile is what a scan saw of a prompt file, to tell when it has
+// stopped changing.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// runWatchDir handles `ask watch-dir <dir> --out <dir> [--api name]
+// [--interval 2s]`: every .md or .json file dropped into dir is sent as a
+// prompt and its answer written to the out directory under the same name,
+// for tools that can only write files. Answered prompts move to dir/done,
+// failed ones to dir/failed. It runs until interrupted.
+func runWatchDir(config *Config, args []string) {
+	parsed, err := parseArgs(args, map[string]bool{"out": true, "api": true, "interval": true, "once": false})
+	if err != nil || len(parsed.positional) != 1 || parsed.value("out", "") == "" {
+		fmt.Println("Usage: ask watch-dir <dir> --out <dir> [--api name] [--interval 2s] [--once]")
+		os.Exit(1)
+	}
+	dir, outDir := parsed.positional[0], parsed.value("out", "")
+	interval, err := time.ParseDuration(parsed.value("interval", "2s"))
+	if err != nil || interval <= 0 {
+		fmt.Println("Error: --interval must be a duration like 2s or 500ms")
+		os.Exit(1)
+	}
+	for _, d := range []string{dir, outDir, filepath.Join(dir, "done"), filepath.Join(dir, "failed")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	apiName, api := selectAPI(config, parsed.value("api", ""))
+
+	if !parsed.has("once") {
+		serving.Store(true)
+		fmt.Fprintf(os.Stderr, "Watching %s for .md and .json prompts, answers go to %s (Ctrl-C to stop)\n", dir, outDir)
+	}
+	seen := map[string]watchedFile{}
+	for {
+		names, err := pendingPrompts(dir, seen, parsed.has("once"))
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			answerPromptFile(config, apiName, api, dir, outDir, name)
+		}
+		if parsed.has("once") {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// pendingPrompts lists the prompt files in dir that are ready to answer:
+// those unchanged since the previous scan, so a file still being written
+// isn't read half-way. With now, every prompt file is ready.
+func pendingPrompts(dir string, seen map[string]watchedFile, now bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]watchedFile{}
+	var ready []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		// Editors and downloaders write to hidden or temporary names first.
+		if e.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") || (ext != ".md" && ext != ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		f := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := seen[name]; now || (ok && prev == f) {
+			ready = append(ready, name)
+		} else {
+			current[name] = f
+		}
+	}
+	for name := range seen {
+		delete(seen, name)
+	}
+	for name, f := range current {
+		seen[name] = f
+	}
+	sort.Strings(ready)
+	return ready, nil
+}
+
+// answerPromptFile answers one prompt file. A .md file is the prompt and
+// gets a .md answer; a .json file is a watchPrompt and gets the object
+// --json prints, or {"error": ...}. A failed .md prompt leaves its error
+// in name.error.txt instead. Answers are written whole, then renamed into
+// place, so whatever watches outDir never reads one half-written.
+func answerPromptFile(config *Config, apiName string, api APIConfig, dir, outDir, name string) {
+	path := filepath.Join(dir, name)
+	isJSON := strings.EqualFold(filepath.Ext(name), ".json")
+	started := time.Now()
+	resp, imagePaths, err := sendPromptFile(config, apiName, api, path, outDir, isJSON)
+
+	out, answerName := []byte(resp.Text+"\n"), name
+	if isJSON {
+		var v interface{} = map[string]string{"error": fmt.Sprint(err)}
+		if err == nil {
+			answer := jsonAnswer{
+				Text:      resp.Text,
+				Model:     resp.Model,
+				Usage:     resp.Usage,
+				LatencyMS: time.Since(started).Milliseconds(),
+				Citations: resp.Citations,
+				Images:    imagePaths,
+			}
+			if resp.FinishReason != "" {
+				answer.FinishReason = &resp.FinishReason
+			}
+			v = answer
+		}
+		out, _ = json.MarshalIndent(v, "", "  ")
+		out = append(out, '\n')
+	} else if err != nil {
+		out = []byte("Error: " + err.Error() + "\n")
+		answerName = strings.TrimSuffix(name, filepath.Ext(name)) + ".error.txt"
+	}
+
+	answerPath := filepath.Join(outDir, answerName)
+	if werr := writeFileAtomic(answerPath, out); werr != nil {
+		fmt.Fprintf(os.Stderr, "%s: writing the answer: %v\n", name, werr)
+		return
+	}
+	moveTo := "done"
+	if err != nil {
+		moveTo = "failed"
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: answered in %s\n", name, answerPath)
+	}
+	if err := os.Rename(path, filepath.Join(dir, moveTo, name)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	}
+}
+
+// sendPromptFile reads a prompt file and sends it, recording the run in the
+// history. Images in the answer are saved to outDir.
+func sendPromptFile(config *Config, apiName string, api APIConfig, path, outDir string, isJSON bool) (Response, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Response{}, nil, err
+	}
+	req := Request{Prompt: strings.TrimSpace(string(data))}
+	if isJSON {
+		var p watchPrompt
+		if err := json.Unmarshal(data, &p); err != nil {
+			return Response{}, nil, fmt.Errorf("not a prompt file: %v", err)
+		}
+		req = Request{Prompt: strings.TrimSpace(p.Prompt), System: p.System}
+		if p.API != "" {
+			configured, ok := config.APIs[p.API]
+			if !ok {
+				return Response{}, nil, fmt.Errorf("API '%s' not configured", p.API)
+			}
+			apiName, api = p.API, configured
+		}
+		if p.Model != "" {
+			api.Model = p.Model
+		}
+	}
+	if req.Prompt == "" {
+		return Response{}, nil, fmt.Errorf("the prompt is empty")
+	}
+
+	warnIfTooLong(apiName, api, req)
+	entry := newHistoryEntry(apiName, api, req)
+	resp, err := sendRequest(api, req)
+	entry.addResponse(resp)
+	saveHistory(config.Settings, entry, err)
+	if err != nil {
+		return resp, nil, err
+	}
+	if resp.Model == "" {
+		resp.Model = api.Model
+	}
+	var imagePaths []string
+	if len(resp.Images) > 0 {
+		if imagePaths, err = saveImages(outDir, req.Prompt, resp.Images); err != nil {
+			return resp, imagePaths, fmt.Errorf("saving images: %v", err)
+		}
+	}
+	return resp, imagePaths, nil
+}
+
+// writeFileAtomic writes data to a hidden temporary file next to path and
+// renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
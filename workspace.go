@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// workspaceRoot is a directory .ask.toml adds to the workspace, such as a
+// package of a monorepo or a sibling repository, declared as a
+// [roots.<name>] table:
+//
+//	[roots.api]
+//	path = "../api"
+//	include = ["**/*.go"]
+//	exclude = ["**/testdata"]
+type workspaceRoot struct {
+	Name string
+	// Path is absolute; in .ask.toml it's relative to the file.
+	Path    string
+	Include []string
+	Exclude []string
+}
+
+// allows reports whether the root's rules take in rel, a slash-separated
+// path relative to the root. Exclude patterns apply to the path and the
+// directories it is in; include patterns, when there are any, only to
+// files.
+func (r workspaceRoot) allows(rel string, dir bool) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range r.Exclude {
+			if matchGlob(pattern, p) {
+				return false
+			}
+		}
+	}
+	if dir || len(r.Include) == 0 {
+		return true
+	}
+	for _, pattern := range r.Include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches rel against a glob. A pattern without a "/" matches the
+// last element at any depth, like "*.go"; otherwise it matches the whole
+// path, with "**" standing for any number of directories.
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// parseRoot sets field of the root named name from a roots.<name>.<field>
+// key in .ask.toml.
+func parseRoot(roots map[string]*workspaceRoot, key string, v interface{}) bool {
+	i := strings.LastIndex(key, ".")
+	if i <= 0 {
+		return false
+	}
+	name, field := key[:i], key[i+1:]
+	r := roots[name]
+	if r == nil {
+		r = &workspaceRoot{Name: name}
+		roots[name] = r
+	}
+	var ok bool
+	switch field {
+	case "path":
+		r.Path, ok = v.(string)
+		ok = ok && r.Path != ""
+	case "include":
+		r.Include, ok = v.([]string)
+	case "exclude":
+		r.Exclude, ok = v.([]string)
+	}
+	return ok
+}
+
+// workspaceRoots returns the roots the .ask.toml for the working directory
+// declares, if any.
+func workspaceRoots() ([]workspaceRoot, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	pc, err := findProjectContext(dir)
+	if err != nil || pc == nil {
+		return nil, err
+	}
+	return pc.Roots, nil
+}
+
+// resolveInWorkspace is resolveInside for a workspace: path, relative to
+// root, may also lead into any of roots, as long as that root's rules allow
+// it. Within nested roots the innermost one decides.
+func resolveInWorkspace(root, p string, roots []workspaceRoot) (string, error) {
+	target := p
+	if !filepath.IsAbs(p) {
+		target = filepath.Join(root, p)
+	}
+
+	var best *workspaceRoot
+	bestDir, bestPath := "", ""
+	for i, r := range roots {
+		dir, err := filepath.EvalSymlinks(r.Path)
+		if err != nil {
+			continue
+		}
+		abs, err := resolveInside(dir, target)
+		if err == nil && len(dir) > len(bestDir) {
+			best, bestDir, bestPath = &roots[i], dir, abs
+		}
+	}
+	if best == nil {
+		return resolveInside(root, p)
+	}
+
+	rel, _ := filepath.Rel(bestDir, bestPath)
+	info, err := os.Stat(bestPath)
+	if !best.allows(filepath.ToSlash(rel), err == nil && info.IsDir()) {
+		return "", fmt.Errorf("%s is excluded from workspace root %s", p, best.Name)
+	}
+	return bestPath, nil
+}
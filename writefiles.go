@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeFilesPrompt asks the model to say which file each code block is.
+const writeFilesPrompt = "When you give the contents of a file, put the whole file in one fenced code block and annotate the fence with its path relative to the current directory, like ```go title=main.go."
+
+// fileWrite is a file from the answer, due to be written.
+type fileWrite struct {
+	path    string // as given in the answer
+	file    string // resolved, absolute
+	old     string // current content, if the file exists
+	content string
+	status  string
+}
+
+// writeAnswerFiles handles --write: it lists the files the answer's code
+// blocks are annotated with, says which would be created or overwritten and
+// writes them, hunk by hunk as approved (or all of them with yes). Hunks
+// commented on go to revise. Paths can't leave the current directory,
+// except into the workspace roots .ask.toml declares.
+func writeAnswerFiles(text string, yes bool, revise reviseFunc) error {
+	root, err := os.Getwd()
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return err
+	}
+	roots, err := workspaceRoots()
+	if err != nil {
+		return err
+	}
+
+	// A file given twice gets its last version.
+	var writes []*fileWrite
+	byPath := map[string]*fileWrite{}
+	for _, block := range extractCodeBlocks(text) {
+		path := block.path()
+		if path == "" {
+			continue
+		}
+		content := block.Code
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if w, ok := byPath[path]; ok {
+			w.content = content
+			continue
+		}
+		w := &fileWrite{path: path, content: content}
+		byPath[path] = w
+		writes = append(writes, w)
+	}
+	if len(writes) == 0 {
+		fmt.Println("No files to write: no code block in the answer names a file.")
+		return nil
+	}
+
+	pending := 0
+	fmt.Println("\nFiles in the answer:")
+	for _, w := range writes {
+		if w.file, err = resolveInWorkspace(root, w.path, roots); err != nil {
+			w.status = "skip"
+			fmt.Printf("  skip       %v\n", err)
+			continue
+		}
+		lines := strings.Count(w.content, "\n")
+		switch old, err := os.ReadFile(w.file); {
+		case err != nil:
+			w.status = "create"
+			fmt.Printf("  create     %s (%d lines)\n", w.path, lines)
+		case string(old) == w.content:
+			w.status = "unchanged"
+			fmt.Printf("  unchanged  %s\n", w.path)
+			continue
+		default:
+			w.status, w.old = "overwrite", string(old)
+			fmt.Printf("  overwrite  %s (%d lines → %d lines)\n", w.path, strings.Count(string(old), "\n"), lines)
+		}
+		pending++
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	var changes []fileChange
+	files := map[string]string{}
+	for _, w := range writes {
+		if w.status == "create" || w.status == "overwrite" {
+			changes = append(changes, fileChange{Path: w.path, Old: w.old, New: w.content})
+			files[w.path] = w.file
+		}
+	}
+	if !yes {
+		fmt.Println()
+		if changes, err = reviewChanges(changes, revise); err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Println("Nothing written.")
+			return nil
+		}
+	}
+	for _, c := range changes {
+		file := files[c.Path]
+		if err := snapshotBeforeWrite(file); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(c.New), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d file(s).\n", len(changes))
+	return nil
+}